@@ -0,0 +1,235 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Interpretation is a way of reading the payload of a length-delimited
+// field.
+type Interpretation int
+
+const (
+	AsBytes Interpretation = iota
+	AsString
+	AsMessage
+	AsPackedVarint
+	AsPackedFixed32
+	AsPackedFixed64
+)
+
+var interpretationNames = []string{
+	AsBytes:         "bytes",
+	AsString:        "string",
+	AsMessage:       "message",
+	AsPackedVarint:  "packed-varint",
+	AsPackedFixed32: "packed-fixed32",
+	AsPackedFixed64: "packed-fixed64",
+}
+
+func (i Interpretation) String() string {
+	if i >= 0 && int(i) < len(interpretationNames) {
+		return interpretationNames[i]
+	}
+	return fmt.Sprintf("Unknown(%d)", int(i))
+}
+
+// ParseInterpretation parses an interpretation name as returned by String.
+func ParseInterpretation(s string) (Interpretation, error) {
+	for i, name := range interpretationNames {
+		if name == s {
+			return Interpretation(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown interpretation %q", s)
+}
+
+// packedTypes are the element types used for the packed interpretations.
+var packedTypes = map[Interpretation]string{
+	AsPackedVarint:  "uint64",
+	AsPackedFixed32: "fixed32",
+	AsPackedFixed64: "fixed64",
+}
+
+// Interpretation returns the way the field is currently read.
+func (l *LengthDelimitedField) Interpretation() Interpretation {
+	switch {
+	case len(l.SubFields) > 0 || l.EmptyMessage:
+		return AsMessage
+	case l.IsString:
+		return AsString
+	case l.Packed != nil:
+		switch (&FieldSchema{Type: l.Packed.Type}).WireType() {
+		case WireFixed32:
+			return AsPackedFixed32
+		case WireFixed64:
+			return AsPackedFixed64
+		}
+		return AsPackedVarint
+	default:
+		return AsBytes
+	}
+}
+
+// Alternative is one candidate reading of a length-delimited field, fully
+// decoded.
+type Alternative struct {
+	As        Interpretation
+	SubFields []Field // The decoded message, for AsMessage
+	Text      string  // The text, for AsString
+	Packed    *Packed // The elements, for the packed interpretations
+}
+
+// Alternatives returns every interpretation the field's payload supports,
+// in the order message, string, packed varint, fixed32 and fixed64, ending
+// with raw bytes, which is always possible. If the field is currently read
+// as a message, that alternative carries the current nested fields, so
+// choices made deeper in the tree are kept.
+func Alternatives(l *LengthDelimitedField) []Alternative {
+	data := l.payload()
+	var alts []Alternative
+	if l.Interpretation() == AsMessage {
+		alts = append(alts, Alternative{As: AsMessage, SubFields: l.SubFields})
+	} else if fields, err := DecodeFields(data); err == nil && len(fields) > 0 {
+		alts = append(alts, Alternative{As: AsMessage, SubFields: fields})
+	}
+	if len(data) > 0 && utf8.Valid(data) && isPrintableString(data) {
+		alts = append(alts, Alternative{As: AsString, Text: string(data)})
+	}
+	for _, as := range []Interpretation{AsPackedVarint, AsPackedFixed32, AsPackedFixed64} {
+		if len(data) == 0 {
+			break
+		}
+		typ := packedTypes[as]
+		if values, err := decodePacked(data, &FieldSchema{Type: typ}); err == nil {
+			alts = append(alts, Alternative{As: as, Packed: &Packed{Type: typ, Values: values}})
+		}
+	}
+	return append(alts, Alternative{As: AsBytes})
+}
+
+// Reinterpret switches the field to another reading of its payload, keeping
+// its encoded bytes unchanged. It returns an error if the payload cannot be
+// read that way.
+func (l *LengthDelimitedField) Reinterpret(as Interpretation) error {
+	if l.Interpretation() == as {
+		return nil
+	}
+	for _, alt := range Alternatives(l) {
+		if alt.As == as {
+			l.apply(alt)
+			return nil
+		}
+	}
+	return fmt.Errorf("payload cannot be read as %s", as)
+}
+
+// apply makes alt the field's current reading.
+func (l *LengthDelimitedField) apply(alt Alternative) {
+	l.Data = l.payload()
+	l.SubFields, l.IsString, l.StringValue, l.Packed = nil, false, "", nil
+	l.EmptyMessage, l.Padding = false, 0
+	l.lazy = nil
+	switch alt.As {
+	case AsMessage:
+		l.SubFields, l.EmptyMessage = alt.SubFields, len(alt.SubFields) == 0
+	case AsString:
+		l.IsString, l.StringValue = true, alt.Text
+	case AsPackedVarint, AsPackedFixed32, AsPackedFixed64:
+		l.Packed = alt.Packed
+	}
+	if alt.As != AsMessage {
+		l.Wrapping = ""
+	}
+}
+
+// Ambiguity is a length-delimited field that could reasonably be read more
+// than one way.
+type Ambiguity struct {
+	Path         FieldPath
+	Field        *LengthDelimitedField
+	Alternatives []Alternative
+}
+
+// FindAmbiguities returns the fields in the tree whose payload parses as a
+// message and also as a string or packed varints, the cases where the
+// decoder's choice is a guess. Packed fixed-width readings are listed among
+// the alternatives but do not make a field ambiguous on their own, as every
+// payload of suitable length has them. Fields are returned in tree order,
+// descending into nested messages as they are currently read.
+func FindAmbiguities(fields []Field) []Ambiguity {
+	var found []Ambiguity
+	Walk(fields, func(path FieldPath, f Field) bool {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			return true
+		}
+		alts := Alternatives(l)
+		var message, other bool
+		for _, alt := range alts {
+			switch alt.As {
+			case AsMessage:
+				message = true
+			case AsString, AsPackedVarint:
+				other = true
+			}
+		}
+		if message && other {
+			found = append(found, Ambiguity{Path: path, Field: l, Alternatives: alts})
+		}
+		return true
+	})
+	return found
+}
+
+// Reinterpret switches every length-delimited field at path to the given
+// interpretation (see LengthDelimitedField.Reinterpret).
+func Reinterpret(fields []Field, path FieldPath, as Interpretation) error {
+	found := Find(fields, path)
+	if len(found) == 0 {
+		return fmt.Errorf("no field at path %s", path)
+	}
+	for _, f := range found {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			return fmt.Errorf("field %s is not length-delimited", path)
+		}
+		if err := l.Reinterpret(as); err != nil {
+			return fmt.Errorf("field %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// encode returns the packed encoding of the elements.
+func (p *Packed) encode() []byte {
+	var b []byte
+	wireType := (&FieldSchema{Type: p.Type}).WireType()
+	for _, v := range p.Values {
+		switch wireType {
+		case WireFixed32:
+			b = binary.LittleEndian.AppendUint32(b, uint32(v))
+		case WireFixed64:
+			b = binary.LittleEndian.AppendUint64(b, v)
+		default:
+			b = binary.AppendUvarint(b, v)
+		}
+	}
+	return b
+}
+
+// size returns the length of the encoding of the elements.
+func (p *Packed) size() int {
+	switch (&FieldSchema{Type: p.Type}).WireType() {
+	case WireFixed32:
+		return 4 * len(p.Values)
+	case WireFixed64:
+		return 8 * len(p.Values)
+	}
+	n := 0
+	for _, v := range p.Values {
+		n += uvarintLen(v)
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+package deproto
+
+import (
+	"strings"
+)
+
+// AnyPair is a string field holding a type URL followed by a
+// length-delimited field holding a message of that type, as in a
+// google.protobuf.Any. Many protocols imitate Any with their own field
+// numbers, so pairs are found by content and position, not by number.
+type AnyPair struct {
+	Path     FieldPath // Path of the type URL field
+	TypeURL  *LengthDelimitedField
+	Value    *LengthDelimitedField // The next field after TypeURL
+	TypeName string                // The type URL's last segment, such as "pkg.Request"
+}
+
+// FindAnyPairs returns the Any-like pairs in a tree, in the order they
+// appear.
+func FindAnyPairs(fields []Field) []AnyPair {
+	var pairs []AnyPair
+	findAnyPairs(nil, fields, &pairs)
+	return pairs
+}
+
+func findAnyPairs(parent FieldPath, fields []Field, pairs *[]AnyPair) {
+	for i, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			continue
+		}
+		if len(l.SubFields) > 0 {
+			findAnyPairs(parent.Append(l.ID), l.SubFields, pairs)
+			continue
+		}
+		if !l.IsString || i+1 == len(fields) {
+			continue
+		}
+		value, ok := fields[i+1].(*LengthDelimitedField)
+		if !ok || value.IsString {
+			continue
+		}
+		if name, ok := typeURLName(l.StringValue); ok {
+			*pairs = append(*pairs, AnyPair{Path: parent.Append(l.ID), TypeURL: l, Value: value, TypeName: name})
+		}
+	}
+}
+
+// typeURLName returns the type name at the end of a type URL such as
+// "type.googleapis.com/pkg.Request". The URL must start with a host name,
+// so that file paths and the like are not mistaken for type URLs.
+func typeURLName(s string) (string, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	slash := strings.LastIndexByte(s, '/')
+	if slash < 0 {
+		return "", false
+	}
+	host, _, _ := strings.Cut(s, "/")
+	if !strings.Contains(host, ".") || strings.ContainsAny(s, " \t\r\n") {
+		return "", false
+	}
+	name := s[slash+1:]
+	for _, part := range strings.Split(name, ".") {
+		if !isIdentifier(part) {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// isIdentifier reports whether s is a protobuf identifier.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package deproto
+
+import "fmt"
+
+// AnomalyKind classifies a deviation from a Baseline.
+type AnomalyKind int
+
+const (
+	AnomalyUnknownField AnomalyKind = iota // Field path never seen in the baseline
+	AnomalyTypeChange                      // Field seen before, but with another wire type
+	AnomalyOutOfRange                      // Value or length outside the observed range
+)
+
+// String returns a short name for the anomaly kind.
+func (k AnomalyKind) String() string {
+	switch k {
+	case AnomalyUnknownField:
+		return "unknown-field"
+	case AnomalyTypeChange:
+		return "type-change"
+	case AnomalyOutOfRange:
+		return "out-of-range"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// Anomaly describes a single field that deviates from a Baseline.
+type Anomaly struct {
+	Kind    AnomalyKind
+	Path    FieldPath
+	Field   Field
+	Message string // Human-readable explanation
+}
+
+// String returns a one-line description of the anomaly.
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s [%s]: %s", a.Path, a.Kind, a.Message)
+}
+
+// pathStats accumulates what the baseline has observed at one field path.
+type pathStats struct {
+	count     int
+	wireTypes map[int]bool
+	min, max  uint64 // Observed value range (numeric) or length range (bytes)
+}
+
+// Baseline records the field paths, wire types and value ranges observed in a
+// corpus, so later messages can be checked for unusual fields.
+type Baseline struct {
+	paths   map[string]*pathStats
+	samples int
+}
+
+// NewBaseline builds a baseline from a corpus of decoded messages.
+func NewBaseline(corpus [][]Field) *Baseline {
+	b := &Baseline{paths: make(map[string]*pathStats)}
+	for _, fields := range corpus {
+		b.Add(fields)
+	}
+	return b
+}
+
+// Add extends the baseline with the observations from one message.
+func (b *Baseline) Add(fields []Field) {
+	b.samples++
+	Walk(fields, func(path FieldPath, f Field) bool {
+		key := path.String()
+		stats, ok := b.paths[key]
+		value := measure(f)
+		if !ok {
+			stats = &pathStats{wireTypes: make(map[int]bool), min: value, max: value}
+			b.paths[key] = stats
+		}
+		stats.count++
+		stats.wireTypes[fieldBase(f).WireType] = true
+		stats.min = min(stats.min, value)
+		stats.max = max(stats.max, value)
+		return true
+	})
+}
+
+// Samples returns the number of messages the baseline was built from.
+func (b *Baseline) Samples() int {
+	return b.samples
+}
+
+// Check compares a message against the baseline and returns every anomaly
+// found, in the order the fields appear.
+func (b *Baseline) Check(fields []Field) []Anomaly {
+	var anomalies []Anomaly
+	Walk(fields, func(path FieldPath, f Field) bool {
+		base := fieldBase(f)
+		stats, ok := b.paths[path.String()]
+		if !ok {
+			anomalies = append(anomalies, Anomaly{
+				Kind:    AnomalyUnknownField,
+				Path:    path,
+				Field:   f,
+				Message: fmt.Sprintf("field never seen in %d baseline samples", b.samples),
+			})
+			return false
+		}
+		if !stats.wireTypes[base.WireType] {
+			anomalies = append(anomalies, Anomaly{
+				Kind:    AnomalyTypeChange,
+				Path:    path,
+				Field:   f,
+				Message: fmt.Sprintf("wire type %s not seen in baseline", wireTypeString(base.WireType)),
+			})
+			return false
+		}
+		if value := measure(f); value < stats.min || value > stats.max {
+			what := "value"
+			if base.WireType == WireBytes {
+				what = "length"
+			}
+			anomalies = append(anomalies, Anomaly{
+				Kind:    AnomalyOutOfRange,
+				Path:    path,
+				Field:   f,
+				Message: fmt.Sprintf("%s %d outside observed range [%d, %d]", what, value, stats.min, stats.max),
+			})
+		}
+		return true
+	})
+	return anomalies
+}
+
+// measure returns the numeric value of a scalar field, or the data length of
+// a length-delimited one.
+func measure(f Field) uint64 {
+	switch v := f.(type) {
+	case *VarintField:
+		return v.Value
+	case *Fixed64Field:
+		return v.Value
+	case *Fixed32Field:
+		return uint64(v.Value)
+	case *LengthDelimitedField:
+		return uint64(len(v.Data))
+	default:
+		return 0
+	}
+}
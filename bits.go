@@ -0,0 +1,84 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// RenderBits renders the varints of a message bit by bit: for the key of
+// every field, and the value or length that follows it, the raw bytes, each
+// split into its continuation bit and seven payload bits, then the payload
+// bits reassembled most significant group first into the value they encode.
+// Fixed-size values are shown as their bytes. It descends into the nested
+// messages DecodeFields finds. Meant for learning the encoding and for
+// checking what a hand-written encoder produced, byte by byte.
+func RenderBits(data []byte) (string, error) {
+	fields, err := DecodeFields(data)
+	var b strings.Builder
+	renderBits(&b, data, 0, fields, 0)
+	return b.String(), err
+}
+
+// renderBits renders the encoding of fields, found at offset in the
+// message.
+func renderBits(b *strings.Builder, data []byte, offset int, fields []Field, indentLevel int) {
+	indent := strings.Repeat("    ", indentLevel)
+	pos := 0
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		fmt.Fprintf(b, "%s[%d %s] at %d\n", indent, base.ID, wireTypeString(base.WireType), offset+pos)
+		key, n := binary.Uvarint(data[pos:])
+		fmt.Fprintf(b, "%s    key    %s: field %d, wire type %d\n", indent, varintBits(data[pos:pos+n]), key>>3, key&7)
+		pos += n
+		switch v := f.(type) {
+		case *VarintField:
+			_, m := binary.Uvarint(data[pos:])
+			note := ""
+			if int64(v.Value) < 0 {
+				note = fmt.Sprintf(", int64 %d", int64(v.Value))
+			}
+			fmt.Fprintf(b, "%s    value  %s%s\n", indent, varintBits(data[pos:pos+m]), note)
+			pos += m
+		case *Fixed64Field:
+			fmt.Fprintf(b, "%s    value  % x, little-endian %d\n", indent, data[pos:pos+8], v.Value)
+			pos += 8
+		case *Fixed32Field:
+			fmt.Fprintf(b, "%s    value  % x, little-endian %d\n", indent, data[pos:pos+4], v.Value)
+			pos += 4
+		case *LengthDelimitedField:
+			length, m := binary.Uvarint(data[pos:])
+			fmt.Fprintf(b, "%s    length %s bytes\n", indent, varintBits(data[pos:pos+m]))
+			pos += m
+			if len(v.SubFields) > 0 && v.Wrapping == "" {
+				renderBits(b, data[pos:pos+int(length)], offset+pos, v.SubFields, indentLevel+1)
+			}
+			pos += int(length)
+		}
+	}
+}
+
+// varintBits renders the encoding of a varint as its bytes in hex, each
+// byte's continuation bit and payload bits, and the value they add up to,
+// as in "96 01  1|0010110 0|0000001 -> 0000001 0010110 = 150". A varint
+// longer than needed is flagged as non-minimal.
+func varintBits(enc []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "% x ", enc)
+	for _, c := range enc {
+		fmt.Fprintf(&b, " %d|%07b", c>>7, c&0x7f)
+	}
+	b.WriteString(" ->")
+	for i := len(enc) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, " %07b", enc[i]&0x7f)
+	}
+	value, _ := binary.Uvarint(enc)
+	fmt.Fprintf(&b, " = %d", value)
+	if len(enc) > uvarintLen(value) {
+		fmt.Fprintf(&b, " (non-minimal: %d of %d bytes needed)", uvarintLen(value), len(enc))
+	}
+	return b.String()
+}
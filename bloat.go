@@ -0,0 +1,126 @@
+package deproto
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BloatEntry summarizes the cost of one field path across a corpus.
+type BloatEntry struct {
+	Path           FieldPath
+	Count          int     // Number of occurrences
+	Bytes          int     // Total encoded bytes, including tags and nested fields
+	Share          float64 // Bytes as a fraction of the whole corpus
+	Distinct       int     // Distinct values of leaf length-delimited fields
+	RedundantBytes int     // Payload bytes spent repeating values already seen
+	Compression    float64 // Compressed/uncompressed ratio of leaf payloads, or 0
+}
+
+// BloatReport ranks the field paths of a corpus by the bytes they consume.
+type BloatReport struct {
+	Samples     int
+	TotalBytes  int
+	Entries     []BloatEntry // Sorted by Bytes, largest first
+	Suggestions []string
+}
+
+// AnalyzeBloat builds a BloatReport for a corpus of decoded messages. Nested
+// fields are counted both on their own and as part of their parent, so the
+// entries do not sum to TotalBytes.
+func AnalyzeBloat(corpus [][]Field) *BloatReport {
+	type accumulator struct {
+		entry   BloatEntry
+		values  map[string]int
+		payload bytes.Buffer
+	}
+	report := &BloatReport{Samples: len(corpus)}
+	byPath := make(map[string]*accumulator)
+	var order []string
+
+	for _, fields := range corpus {
+		report.TotalBytes += Size(fields)
+		Walk(fields, func(path FieldPath, f Field) bool {
+			key := path.String()
+			acc, ok := byPath[key]
+			if !ok {
+				acc = &accumulator{entry: BloatEntry{Path: path}, values: make(map[string]int)}
+				byPath[key] = acc
+				order = append(order, key)
+			}
+			acc.entry.Count++
+			acc.entry.Bytes += f.EncodedLen()
+			if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) == 0 {
+				if acc.values[string(l.Data)] > 0 {
+					acc.entry.RedundantBytes += len(l.Data)
+				}
+				acc.values[string(l.Data)]++
+				acc.payload.Write(l.Data)
+			}
+			return true
+		})
+	}
+
+	for _, key := range order {
+		acc := byPath[key]
+		e := acc.entry
+		e.Distinct = len(acc.values)
+		if report.TotalBytes > 0 {
+			e.Share = float64(e.Bytes) / float64(report.TotalBytes)
+		}
+		if acc.payload.Len() > 0 {
+			e.Compression = compressionRatio(acc.payload.Bytes())
+		}
+		report.Entries = append(report.Entries, e)
+	}
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		return report.Entries[i].Bytes > report.Entries[j].Bytes
+	})
+
+	for _, e := range report.Entries {
+		if e.Share < 0.05 {
+			continue
+		}
+		if e.Distinct > 0 && e.RedundantBytes*2 > e.Bytes {
+			report.Suggestions = append(report.Suggestions, fmt.Sprintf(
+				"field %s: %d occurrences share %d distinct values; consider interning them",
+				e.Path, e.Count, e.Distinct))
+		} else if e.Compression > 0 && e.Compression < 0.5 && e.Bytes/e.Count >= 64 {
+			report.Suggestions = append(report.Suggestions, fmt.Sprintf(
+				"field %s: payloads compress to %.0f%%; consider compressing them",
+				e.Path, e.Compression*100))
+		}
+	}
+	return report
+}
+
+// String renders the report as a table followed by any suggestions.
+func (r *BloatReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d samples, %d bytes\n", r.Samples, r.TotalBytes)
+	fmt.Fprintf(&b, "%-16s %8s %10s %7s %9s %10s\n", "PATH", "COUNT", "BYTES", "SHARE", "DISTINCT", "REDUNDANT")
+	for _, e := range r.Entries {
+		distinct := "-"
+		if e.Distinct > 0 {
+			distinct = fmt.Sprint(e.Distinct)
+		}
+		fmt.Fprintf(&b, "%-16s %8d %10d %6.1f%% %9s %10d\n",
+			e.Path, e.Count, e.Bytes, e.Share*100, distinct, e.RedundantBytes)
+	}
+	for _, s := range r.Suggestions {
+		fmt.Fprintf(&b, "* %s\n", s)
+	}
+	return b.String()
+}
+
+// compressionRatio returns how small data becomes under DEFLATE, as a
+// fraction of its original size.
+func compressionRatio(data []byte) float64 {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+	return float64(buf.Len()) / float64(len(data))
+}
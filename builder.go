@@ -0,0 +1,105 @@
+package deproto
+
+import "math"
+
+// MessageBuilder constructs a field tree programmatically:
+//
+//	data := deproto.NewMessage().
+//		Varint(1, 5).
+//		String(2, "hi").
+//		Message(3, deproto.NewMessage().Bool(1, true)).
+//		Encode()
+type MessageBuilder struct {
+	fields []Field
+}
+
+// NewMessage returns an empty MessageBuilder.
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// Varint appends a varint field.
+func (m *MessageBuilder) Varint(id int, value uint64) *MessageBuilder {
+	return m.Field(&VarintField{FieldBase: FieldBase{ID: id, WireType: WireVarint}, Value: value})
+}
+
+// Int appends a signed varint field (int32/int64) in two's complement.
+func (m *MessageBuilder) Int(id int, value int64) *MessageBuilder {
+	return m.Varint(id, uint64(value))
+}
+
+// Sint appends a zigzag-encoded varint field (sint32/sint64).
+func (m *MessageBuilder) Sint(id int, value int64) *MessageBuilder {
+	return m.Varint(id, uint64(value<<1)^uint64(value>>63))
+}
+
+// Bool appends a varint field holding 0 or 1.
+func (m *MessageBuilder) Bool(id int, value bool) *MessageBuilder {
+	if value {
+		return m.Varint(id, 1)
+	}
+	return m.Varint(id, 0)
+}
+
+// Fixed64 appends a fixed64 field.
+func (m *MessageBuilder) Fixed64(id int, value uint64) *MessageBuilder {
+	return m.Field(&Fixed64Field{FieldBase: FieldBase{ID: id, WireType: WireFixed64}, Value: value})
+}
+
+// Double appends a fixed64 field holding an IEEE 754 double.
+func (m *MessageBuilder) Double(id int, value float64) *MessageBuilder {
+	return m.Fixed64(id, math.Float64bits(value))
+}
+
+// Fixed32 appends a fixed32 field.
+func (m *MessageBuilder) Fixed32(id int, value uint32) *MessageBuilder {
+	return m.Field(&Fixed32Field{FieldBase: FieldBase{ID: id, WireType: WireFixed32}, Value: value})
+}
+
+// Float appends a fixed32 field holding an IEEE 754 float.
+func (m *MessageBuilder) Float(id int, value float32) *MessageBuilder {
+	return m.Fixed32(id, math.Float32bits(value))
+}
+
+// String appends a length-delimited field holding a string.
+func (m *MessageBuilder) String(id int, value string) *MessageBuilder {
+	return m.Field(&LengthDelimitedField{
+		FieldBase:   FieldBase{ID: id, WireType: WireBytes},
+		Data:        []byte(value),
+		IsString:    true,
+		StringValue: value,
+	})
+}
+
+// Bytes appends a length-delimited field holding raw bytes.
+func (m *MessageBuilder) Bytes(id int, value []byte) *MessageBuilder {
+	return m.Field(&LengthDelimitedField{
+		FieldBase: FieldBase{ID: id, WireType: WireBytes},
+		Data:      value,
+	})
+}
+
+// Message appends a length-delimited field holding the message built by sub.
+func (m *MessageBuilder) Message(id int, sub *MessageBuilder) *MessageBuilder {
+	return m.Field(&LengthDelimitedField{
+		FieldBase: FieldBase{ID: id, WireType: WireBytes},
+		Data:      sub.Encode(),
+		SubFields: sub.Build(),
+	})
+}
+
+// Field appends an already constructed field.
+func (m *MessageBuilder) Field(f Field) *MessageBuilder {
+	m.fields = append(m.fields, f)
+	return m
+}
+
+// Build returns the fields added so far.
+func (m *MessageBuilder) Build() []Field {
+	return m.fields
+}
+
+// Encode returns the wire encoding of the fields added so far.
+func (m *MessageBuilder) Encode() []byte {
+	return Encode(m.fields)
+}
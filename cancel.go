@@ -0,0 +1,25 @@
+package deproto
+
+import "context"
+
+// cancelCheckInterval is the number of fields decoded between checks for
+// cancellation.
+const cancelCheckInterval = 1024
+
+// DecodeFieldsContext is like DecodeFields, but stops with the context's
+// error once ctx is done.
+func DecodeFieldsContext(ctx context.Context, data []byte) ([]Field, error) {
+	return DecodeOptions{}.DecodeContext(ctx, data)
+}
+
+// DecodeContext is like Decode, but checks ctx for cancellation while
+// decoding and stops with its error once it is done, so that a deadline
+// can be enforced on inputs that take long to decode. The fields decoded
+// so far are returned along with the error.
+func (o DecodeOptions) DecodeContext(ctx context.Context, data []byte) ([]Field, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o.state = &decodeState{ctx: ctx}
+	return o.Decode(data)
+}
@@ -0,0 +1,177 @@
+package deproto
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpointVersion is the version of the format written by
+// CorpusAnalyzer.Save. Version 1 kept messages encoded, to be decoded again
+// with DecodeFields.
+const checkpointVersion = 2
+
+// checkpoint is the state of a CorpusAnalyzer as saved to a file.
+type checkpoint struct {
+	Version int               `json:"version"`
+	Options SampleOptions     `json:"options"`
+	Random  []byte            `json:"random"` // State of the sampler's generator
+	Read    int               `json:"read"`
+	Taken   int               `json:"taken"`
+	Kept    [][]byte          `json:"kept,omitempty"`  // Encoded messages, in version 1
+	Trees   []json.RawMessage `json:"trees,omitempty"` // Decoded messages, as MarshalTree writes them
+	Sources []string          `json:"sources,omitempty"`
+	Fields  []fieldCheckpoint `json:"fields"`
+}
+
+// fieldCheckpoint is the state of a fieldAccumulator.
+type fieldCheckpoint struct {
+	Path       string         `json:"path"`
+	Count      int            `json:"count"`
+	Messages   int            `json:"messages"`
+	Kinds      map[string]int `json:"kinds"`
+	Min        uint64         `json:"min"`
+	Max        uint64         `json:"max"`
+	Sum        float64        `json:"sum"`
+	Prev       uint64         `json:"prev"`
+	Increasing int            `json:"increasing"`
+	Last       int            `json:"last"`
+	Values     map[string]int `json:"values"`
+	Estimated  bool           `json:"estimated,omitempty"`
+	Registers  []byte         `json:"registers"` // Of the HyperLogLog
+}
+
+// Save writes the state of the analysis to a file, replacing it only once
+// the new state is completely written, so that an interrupted run leaves
+// the previous checkpoint intact. The messages kept for schema inference
+// are saved too, as decoded, so that they come back the same whatever
+// options decoded them: bound them with SampleOptions.Keep.
+func (a *CorpusAnalyzer) Save(name string) error {
+	random, err := a.sampler.pcg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	c := checkpoint{
+		Version: checkpointVersion,
+		Options: a.sampler.opts,
+		Random:  random,
+		Read:    a.sampler.read,
+		Taken:   a.sampler.taken,
+		Sources: a.Sources,
+		Fields:  []fieldCheckpoint{},
+	}
+	for _, fields := range a.sampler.kept {
+		tree, err := MarshalTree(fields)
+		if err != nil {
+			return err
+		}
+		c.Trees = append(c.Trees, tree)
+	}
+	for _, acc := range a.byPath {
+		c.Fields = append(c.Fields, fieldCheckpoint{
+			Path:       acc.stats.Path.String(),
+			Count:      acc.stats.Count,
+			Messages:   acc.stats.Messages,
+			Kinds:      acc.stats.Kinds,
+			Min:        acc.stats.Min,
+			Max:        acc.stats.Max,
+			Sum:        acc.sum,
+			Prev:       acc.prev,
+			Increasing: acc.increasing,
+			Last:       acc.last,
+			Values:     acc.values,
+			Estimated:  acc.stats.Estimated,
+			Registers:  acc.distinct.registers[:],
+		})
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// LoadCorpusAnalyzer resumes the analysis saved to a file by Save, with the
+// sampling options it was started with.
+func LoadCorpusAnalyzer(name string) (*CorpusAnalyzer, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if c.Version != checkpointVersion && c.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported checkpoint version %d", name, c.Version)
+	}
+	a := NewCorpusAnalyzer(c.Options)
+	a.Sources = c.Sources
+	if err := a.sampler.pcg.UnmarshalBinary(c.Random); err != nil {
+		return nil, fmt.Errorf("%s: random state: %v", name, err)
+	}
+	a.sampler.read, a.sampler.taken = c.Read, c.Taken
+	for i, data := range c.Kept {
+		fields, err := DecodeFields(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: kept message %d: %v", name, i, err)
+		}
+		a.sampler.kept = append(a.sampler.kept, fields)
+	}
+	for i, tree := range c.Trees {
+		fields, err := UnmarshalTree(tree)
+		if err != nil {
+			return nil, fmt.Errorf("%s: kept message %d: %v", name, i, err)
+		}
+		a.sampler.kept = append(a.sampler.kept, fields)
+	}
+	for _, f := range c.Fields {
+		path, err := ParseFieldPath(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: field %q: %v", name, f.Path, err)
+		}
+		if len(f.Registers) != len(hyperLogLog{}.registers) {
+			return nil, fmt.Errorf("%s: field %s: invalid registers", name, f.Path)
+		}
+		acc := &fieldAccumulator{
+			stats: FieldStats{
+				Path:      path,
+				Count:     f.Count,
+				Messages:  f.Messages,
+				Kinds:     f.Kinds,
+				Min:       f.Min,
+				Max:       f.Max,
+				Estimated: f.Estimated,
+			},
+			values:     f.Values,
+			sum:        f.Sum,
+			prev:       f.Prev,
+			increasing: f.Increasing,
+			last:       f.Last,
+		}
+		if acc.stats.Kinds == nil {
+			acc.stats.Kinds = make(map[string]int)
+		}
+		if acc.values == nil {
+			acc.values = make(map[string]int)
+		}
+		copy(acc.distinct.registers[:], f.Registers)
+		a.byPath[f.Path] = acc
+	}
+	return a, nil
+}
@@ -0,0 +1,41 @@
+package deproto
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointKeepsDecodedMessages(t *testing.T) {
+	// Field 1 would be decoded as a nested message by default, and field
+	// 2 as bytes rather than a string padded with NUL bytes.
+	data := []byte{0x0a, 0x02, 0x08, 0x01, 0x12, 0x04, 'a', 'b', 0, 0}
+	fields, err := DecodeOptions{NoNestedMessages: true, Embedded: true}.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewCorpusAnalyzer(SampleOptions{})
+	a.Add(fields)
+	name := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := a.Save(name); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCorpusAnalyzer(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.sampler.kept) != 1 {
+		t.Fatalf("%d messages kept, want 1", len(loaded.sampler.kept))
+	}
+	want, err := MarshalTree(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := MarshalTree(loaded.sampler.kept[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("kept message reloaded as\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package deproto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldKey identifies a field by its number and wire type.
+type FieldKey struct {
+	ID       int // Field number
+	WireType int // Wire type
+}
+
+// Fingerprint is the structural fingerprint of a message: the sorted set of
+// field keys it contains, ignoring values and repetition.
+type Fingerprint []FieldKey
+
+// FingerprintOf returns the structural fingerprint of the top-level fields.
+func FingerprintOf(fields []Field) Fingerprint {
+	seen := make(map[FieldKey]bool)
+	var fp Fingerprint
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		key := FieldKey{ID: base.ID, WireType: base.WireType}
+		if !seen[key] {
+			seen[key] = true
+			fp = append(fp, key)
+		}
+	}
+	sortKeys(fp)
+	return fp
+}
+
+// String returns a compact representation such as "1:0,2:2".
+func (fp Fingerprint) String() string {
+	parts := make([]string, len(fp))
+	for i, k := range fp {
+		parts[i] = fmt.Sprintf("%d:%d", k.ID, k.WireType)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Similarity returns the Jaccard similarity of two fingerprints, from 0 (no
+// keys in common) to 1 (identical).
+func (fp Fingerprint) Similarity(other Fingerprint) float64 {
+	if len(fp) == 0 && len(other) == 0 {
+		return 1
+	}
+	set := make(map[FieldKey]bool, len(fp))
+	for _, k := range fp {
+		set[k] = true
+	}
+	common := 0
+	for _, k := range other {
+		if set[k] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(fp)+len(other)-common)
+}
+
+// union returns the set union of two fingerprints.
+func (fp Fingerprint) union(other Fingerprint) Fingerprint {
+	seen := make(map[FieldKey]bool, len(fp)+len(other))
+	var out Fingerprint
+	for _, k := range append(append(Fingerprint{}, fp...), other...) {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	sortKeys(out)
+	return out
+}
+
+func sortKeys(keys []FieldKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ID != keys[j].ID {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].WireType < keys[j].WireType
+	})
+}
+
+// ClusterMember is a single nested message assigned to a cluster.
+type ClusterMember struct {
+	Sample int       // Index of the message in the corpus
+	Path   FieldPath // Path of the length-delimited field holding the message
+	Fields []Field   // The decoded sub-fields
+}
+
+// MessageCluster is a group of nested messages that appear to share a type.
+type MessageCluster struct {
+	Fingerprint Fingerprint // Union of the members' fingerprints
+	Members     []ClusterMember
+}
+
+// Paths returns the distinct field paths at which members of the cluster
+// were found, in order of first appearance.
+func (c *MessageCluster) Paths() []FieldPath {
+	seen := make(map[string]bool)
+	var paths []FieldPath
+	for _, m := range c.Members {
+		key := m.Path.String()
+		if !seen[key] {
+			seen[key] = true
+			paths = append(paths, m.Path)
+		}
+	}
+	return paths
+}
+
+// ClusterMessages groups every nested message in the corpus by structural
+// similarity. A message joins the most similar cluster whose fingerprint has a
+// similarity of at least threshold with its own; otherwise it starts a new
+// cluster. Clusters are returned largest first.
+func ClusterMessages(corpus [][]Field, threshold float64) []*MessageCluster {
+	var clusters []*MessageCluster
+	for i, fields := range corpus {
+		Walk(fields, func(path FieldPath, f Field) bool {
+			l, ok := f.(*LengthDelimitedField)
+			if !ok || len(l.SubFields) == 0 {
+				return true
+			}
+			fp := FingerprintOf(l.SubFields)
+			member := ClusterMember{Sample: i, Path: path, Fields: l.SubFields}
+
+			var best *MessageCluster
+			bestScore := threshold
+			for _, c := range clusters {
+				if score := c.Fingerprint.Similarity(fp); score >= bestScore {
+					best, bestScore = c, score
+				}
+			}
+			if best == nil {
+				best = &MessageCluster{}
+				clusters = append(clusters, best)
+			}
+			best.Fingerprint = best.Fingerprint.union(fp)
+			best.Members = append(best.Members, member)
+			return true
+		})
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i].Members) > len(clusters[j].Members)
+	})
+	return clusters
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// hintFlags collects repeated -as PATH=INTERPRETATION flags as type hints.
+type hintFlags map[string]deproto.WireHint
+
+func (h hintFlags) String() string { return "" }
+
+func (h hintFlags) Set(s string) error {
+	path, name, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%q is not in PATH=INTERPRETATION form", s)
+	}
+	p, err := deproto.ParseFieldPath(path)
+	if err != nil {
+		return err
+	}
+	hint, err := deproto.ParseWireHint(name)
+	if err != nil {
+		return err
+	}
+	h[p.String()] = hint
+	return nil
+}
+
+// printAmbiguities lists the fields that could be read more than one way as
+// comments, marking the current reading, as in
+// "# 2: message (current), string, packed-varint".
+func printAmbiguities(fields []deproto.Field) {
+	for _, a := range deproto.FindAmbiguities(fields) {
+		var names []string
+		for _, alt := range a.Alternatives {
+			name := alt.As.String()
+			if alt.As == a.Field.Interpretation() {
+				name += " (current)"
+			}
+			names = append(names, name)
+		}
+		fmt.Printf("# %s: %s\n", a.Path, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runCapture(args []string) error {
+	flags := flag.NewFlagSet("capture", flag.ContinueOnError)
+	iface := flags.String("i", "", "capture on this network interface, or on all of them with \"any\"")
+	port := flags.Int("port", 0, "keep only the packets to or from this port")
+	keylog := flags.String("keylog", os.Getenv("SSLKEYLOGFILE"), "decrypt TLS and QUIC with the secrets of this key log file, read again as it grows")
+	out := flags.String("o", "", "also write the decoded messages to this file as JSON lines")
+	esURL := flags.String("elasticsearch", "", "also index the decoded messages in the Elasticsearch or OpenSearch index at this URL, such as http://localhost:9200/traffic")
+	idle := flags.Duration("idle", 500*time.Millisecond, "decode the messages of a connection once it has been quiet this long")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || *iface == "" {
+		return fmt.Errorf("usage: deproto %s", commands["capture"].usage)
+	}
+	keys := keyLogReloader{name: *keylog}
+	if err := keys.reload(); err != nil {
+		return err
+	}
+	capture, err := deproto.OpenLive(*iface)
+	if err != nil {
+		return err
+	}
+	defer capture.Close()
+	var sink deproto.Sink
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sink = deproto.JSONSink(f)
+	}
+	var exporter *deproto.ElasticsearchExporter
+	if *esURL != "" {
+		if exporter, err = newElasticsearchExporter(*esURL); err != nil {
+			return err
+		}
+		sink = joinSinks(sink, exporter.Export)
+	}
+
+	emit := func(payloads []deproto.Packet) error {
+		for _, p := range payloads {
+			name := p.Time.Format("15:04:05.000") + " " + p.String()
+			for _, r := range deproto.PacketRecords(name, p) {
+				fields, err := deproto.DecodeFields(r.Data)
+				if err != nil {
+					fmt.Printf("# %s: %v\n", r.Name, err)
+					continue
+				}
+				fmt.Printf("# %s\n%s", r.Name, deproto.RenderFields(fields, deproto.RenderOptions{}))
+				if sink != nil {
+					r.Fields = fields
+					if err := sink(r); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if exporter != nil {
+			// Index what arrived now rather than when a batch fills up.
+			return exporter.Flush()
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	stream := deproto.NewPacketStream(*idle)
+	for ctx.Err() == nil {
+		p, ok, err := capture.ReadPacket()
+		if err != nil {
+			return err
+		}
+		if ok && (*port == 0 || int(p.Src.Port()) == *port || int(p.Dst.Port()) == *port) {
+			stream.Add(p)
+		}
+		if err := keys.reload(); err != nil {
+			return err
+		}
+		if err := emit(stream.Flush(time.Now())); err != nil {
+			return err
+		}
+	}
+	// Interrupted: decode what the connections still hold.
+	return emit(stream.Flush(time.Now().Add(*idle)))
+}
+
+// keyLogReloader registers the secrets of a key log file again whenever it
+// grows, as browsers append to it while traffic is captured.
+type keyLogReloader struct {
+	name     string
+	size     int64
+	reported string // Last malformed line reported
+}
+
+// reload registers the complete lines of the file if it grew since the
+// last call. A line still being written is left for the next call, and
+// malformed lines are reported once and skipped.
+func (k *keyLogReloader) reload() error {
+	if k.name == "" {
+		return nil
+	}
+	info, err := os.Stat(k.name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil || info.Size() == k.size {
+		return err
+	}
+	data, err := os.ReadFile(k.name)
+	if err != nil {
+		return err
+	}
+	k.size = int64(len(data))
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	if err := deproto.RegisterKeyLog(data); err != nil && err.Error() != k.reported {
+		k.reported = err.Error()
+		fmt.Fprintf(os.Stderr, "deproto: %s: %v\n", k.name, err)
+	}
+	return nil
+}
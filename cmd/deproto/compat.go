@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runCompat(args []string) error {
+	fs := flag.NewFlagSet("compat", flag.ContinueOnError)
+	message := fs.String("message", "", "compare this message instead of the first one in each file")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: deproto %s", commands["compat"].usage)
+	}
+	old, _, err := loadMessage(positional[0], *message)
+	if err != nil {
+		return err
+	}
+	new, _, err := loadMessage(positional[1], *message)
+	if err != nil {
+		return err
+	}
+
+	changes := deproto.CompareSchemas(old, new)
+	breaking := false
+	for _, c := range changes {
+		fmt.Println(c)
+		breaking = breaking || c.Breaking
+	}
+	if breaking {
+		return fmt.Errorf("%s is not wire-compatible with %s", positional[1], positional[0])
+	}
+	return nil
+}
+
+// loadMessage loads a .proto file and returns the named message, or the
+// first message declared in the file when name is empty, with the registry
+// of the file and its imports. The message may also be declared in a file
+// the named one imports.
+func loadMessage(file, name string, importPaths ...string) (*deproto.MessageSchema, *deproto.Registry, error) {
+	registry := deproto.NewRegistry(importPaths...)
+	schema, err := registry.LoadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if name == "" {
+		if len(schema.Messages) == 0 {
+			return nil, nil, fmt.Errorf("%s: no messages", file)
+		}
+		return schema.Messages[0], registry, nil
+	}
+	m := schema.Message(name)
+	if m == nil {
+		m = registry.Message(name)
+	}
+	if m == nil {
+		return nil, nil, fmt.Errorf("%s: no message %s", file, name)
+	}
+	return m, registry, nil
+}
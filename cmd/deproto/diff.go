@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// ANSI escapes for colored diff output.
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorBold  = "\x1b[1m"
+	colorReset = "\x1b[0m"
+)
+
+// diffJSON is a difference as written by diff -json.
+type diffJSON struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path"`
+	Index int    `json:"index"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the differences as a JSON array")
+	color := fs.String("color", "auto", "color the output: auto, always or never")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: deproto %s", commands["diff"].usage)
+	}
+	old, err := decodeOne(positional[0])
+	if err != nil {
+		return err
+	}
+	new, err := decodeOne(positional[1])
+	if err != nil {
+		return err
+	}
+	diffs := deproto.DiffFields(old, new)
+
+	if *asJSON {
+		out := make([]diffJSON, len(diffs))
+		for i, d := range diffs {
+			out[i] = diffJSON{Kind: d.Kind.String(), Path: d.Path.String(), Index: d.Index, Old: deproto.DescribeValue(d.Old), New: deproto.DescribeValue(d.New)}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	colored, err := useColor(*color)
+	if err != nil {
+		return err
+	}
+	printDiff(os.Stdout, positional[0], positional[1], diffs, colored)
+	return nil
+}
+
+// decodeOne reads the named file and decodes the single message it holds,
+// in any input format DetectInputFormat recognizes.
+func decodeOne(name string) ([]deproto.Field, error) {
+	data, err := readOne(name)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := deproto.DecodeFields(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return fields, nil
+}
+
+// readOne reads a file that must hold exactly one message, in any input
+// format, and returns the encoded message.
+func readOne(name string) ([]byte, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, err
+	}
+	records, err := readMessages(data, "auto")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(records) != 1 {
+		return nil, fmt.Errorf("%s: holds %d messages, want 1", name, len(records))
+	}
+	return records[0].Data, nil
+}
+
+// printDiff prints differences in the style of a unified diff: a line
+// starting with - for every old field and + for every new one.
+func printDiff(w io.Writer, oldName, newName string, diffs []deproto.Difference, colored bool) {
+	printLine(w, colored, colorBold, "--- "+oldName)
+	printLine(w, colored, colorBold, "+++ "+newName)
+	printDifferences(w, diffs, colored)
+}
+
+// printDifferences prints the lines of a diff without its header.
+func printDifferences(w io.Writer, diffs []deproto.Difference, colored bool) {
+	for _, d := range diffs {
+		path := d.Path.String()
+		if d.Index > 0 {
+			path += fmt.Sprintf("[%d]", d.Index)
+		}
+		if d.Old != nil {
+			printLine(w, colored, colorRed, "- "+path+": "+deproto.DescribeValue(d.Old))
+		}
+		if d.New != nil {
+			printLine(w, colored, colorGreen, "+ "+path+": "+deproto.DescribeValue(d.New))
+		}
+	}
+}
+
+// printLine prints a line of text, in color if colored is set.
+func printLine(w io.Writer, colored bool, color, text string) {
+	if colored {
+		text = color + text + colorReset
+	}
+	fmt.Fprintln(w, text)
+}
+
+// useColor interprets a -color flag: auto colors output to a terminal
+// unless NO_COLOR is set.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "auto":
+		return isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "", nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid -color %q: want auto, always or never", mode)
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
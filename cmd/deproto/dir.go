@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// outputSuffix is appended to the name of every decoded file to name its
+// rendered output. Files with the suffix are not decoded.
+const outputSuffix = ".deproto.txt"
+
+// dirResult is the outcome of decoding one file in a directory.
+type dirResult struct {
+	name  string
+	size  int
+	shape string // Fingerprint of the top-level fields
+	err   error
+}
+
+func runDir(args []string) error {
+	flags := flag.NewFlagSet("dir", flag.ContinueOnError)
+	outDir := flags.String("o", "", "write outputs under this directory instead of next to the inputs")
+	jobs := flags.Int("j", runtime.NumCPU(), "number of files to decode at once")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *jobs < 1 {
+		return fmt.Errorf("usage: deproto %s", commands["dir"].usage)
+	}
+	root := positional[0]
+
+	var names []string
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		hidden := name != root && strings.HasPrefix(d.Name(), ".")
+		switch {
+		case d.IsDir() && hidden:
+			return filepath.SkipDir
+		case d.Type().IsRegular() && !hidden && !strings.HasSuffix(name, outputSuffix):
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	results := make([]dirResult, len(names))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range *jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = decodeFile(root, names[i], *outDir)
+			}
+		}()
+	}
+	for i := range names {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	printDirSummary(results)
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, sourceError{r.name, r.err})
+		}
+	}
+	if len(errs) < len(results) {
+		return partial(errors.Join(errs...))
+	}
+	return errors.Join(errs...)
+}
+
+// decodeFile decodes one file and writes its rendered fields.
+func decodeFile(root, name, outDir string) dirResult {
+	result := dirResult{name: name}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.size = len(data)
+	if data, err = singleMessage(data); err != nil {
+		result.err = err
+		return result
+	}
+	fields, err := deproto.DecodeFields(data)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.shape = deproto.FingerprintOf(fields).String()
+
+	out := name + outputSuffix
+	if outDir != "" {
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		out = filepath.Join(outDir, rel+outputSuffix)
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			result.err = err
+			return result
+		}
+	}
+	result.err = os.WriteFile(out, []byte(deproto.RenderFields(fields, deproto.RenderOptions{})), 0o644)
+	return result
+}
+
+// printDirSummary prints how many files decoded and how often each top-level
+// message shape occurred. Failed files are reported with the returned error.
+func printDirSummary(results []dirResult) {
+	total := 0
+	shapes := make(map[string]int)
+	for _, r := range results {
+		total += r.size
+		if r.err == nil {
+			shapes[r.shape]++
+		}
+	}
+	failed := countFailed(results)
+	fmt.Printf("decoded %d of %d files (%d bytes)\n", len(results)-failed, len(results), total)
+
+	keys := make([]string, 0, len(shapes))
+	for shape := range shapes {
+		keys = append(keys, shape)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if shapes[keys[i]] != shapes[keys[j]] {
+			return shapes[keys[i]] > shapes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > 0 {
+		fmt.Printf("%d message shapes (field:wiretype):\n", len(keys))
+	}
+	for _, shape := range keys {
+		name := shape
+		if name == "" {
+			name = "(empty)"
+		}
+		fmt.Printf("  %6d  %s\n", shapes[shape], name)
+	}
+}
+
+func countFailed(results []dirResult) int {
+	n := 0
+	for _, r := range results {
+		if r.err != nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runEdit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	out := fs.String("o", "", "write the edited message to this file instead of back to the input")
+	protoscope := fs.Bool("protoscope", false, "edit protoscope source instead of text format")
+	canonical := fs.Bool("canonical", false, "write fields ordered by number, for reproducible output")
+	protoFile := fs.String("proto", "", "with -canonical, order the map fields of the message declared in this .proto file by key")
+	typeName := fs.String("type", "", "the message type in the -proto file (default the first one)")
+	dialect := dialectFlag(fs, "read and write")
+	maxSize := fs.Int("max-size", 0, "refuse an edited message encoding to more than this many bytes, keeping the edits")
+	var signers signFlags
+	fs.Var(&signers, "sign", signUsage())
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: deproto %s", commands["edit"].usage)
+	}
+	name := positional[0]
+	if *out == "" {
+		*out = name
+	}
+	encode := deproto.EncodeOptions{Canonical: *canonical, Dialect: *dialect}
+	if *protoFile != "" {
+		if encode.Schema, _, err = loadMessage(*protoFile, *typeName); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if data, err = singleMessage(data); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	fields, err := deproto.DecodeOptions{Dialect: *dialect}.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	format, parse, ext := deproto.FormatText, deproto.ParseText, ".txtpb"
+	if *protoscope {
+		format, parse, ext = deproto.FormatProtoscope, deproto.ParseProtoscope, ".pbscope"
+	}
+	tmp, err := os.CreateTemp("", "deproto-*"+ext)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(format(fields))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := runEditor(tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	fields, err = parse(string(edited))
+	if err != nil {
+		// Keep the file, so the edits are not lost.
+		return fmt.Errorf("%s: %v", tmp.Name(), err)
+	}
+	if err := encode.Sign(fields, signers...); err != nil {
+		return fmt.Errorf("%s: %v", tmp.Name(), err)
+	}
+	if size := encode.Size(fields); *maxSize > 0 && size > *maxSize {
+		return fmt.Errorf("%s: edited message is %d bytes, over -max-size %d by %d", tmp.Name(), size, *maxSize, size-*maxSize)
+	}
+	data, err = encode.Encode(fields)
+	if err != nil {
+		return fmt.Errorf("%s: %v", tmp.Name(), err)
+	}
+	os.Remove(tmp.Name())
+	return writeOutput(*out, data)
+}
+
+// runEditor opens a file in the editor named by $VISUAL or $EDITOR and
+// waits for it to exit.
+func runEditor(name string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// The editor may carry arguments, as in "code --wait", so let the shell
+	// split it.
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", name)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command(editor, name)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %v", editor, err)
+	}
+	return nil
+}
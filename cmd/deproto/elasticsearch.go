@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// newElasticsearchExporter returns an exporter to the index named by the
+// last path element of an Elasticsearch or OpenSearch URL, such as
+// http://localhost:9200/traffic, with an index template installed.
+func newElasticsearchExporter(rawURL string) (*deproto.ElasticsearchExporter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	index := path.Base(strings.TrimSuffix(u.Path, "/"))
+	if index == "/" || index == "." {
+		return nil, fmt.Errorf("%s: no index in the URL, as in http://localhost:9200/INDEX", rawURL)
+	}
+	u.Path = path.Dir(strings.TrimSuffix(u.Path, "/"))
+	e := &deproto.ElasticsearchExporter{URL: u.String(), Index: index}
+	if err := e.EnsureTemplate(); err != nil {
+		return nil, fmt.Errorf("index template: %v", err)
+	}
+	return e, nil
+}
+
+// joinSinks returns a sink writing each record to every non-nil sink, or
+// nil if there is none.
+func joinSinks(sinks ...deproto.Sink) deproto.Sink {
+	var all []deproto.Sink
+	for _, s := range sinks {
+		if s != nil {
+			all = append(all, s)
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return func(r *deproto.Record) error {
+		for _, s := range all {
+			if err := s(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
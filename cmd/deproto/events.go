@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runEvents(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	var opts deproto.EventOptions
+	fs.Func("field", "decode the payload at this dotted `path` in each event, such as payload or args.1 (repeatable; default every base64 or hex string)", func(path string) error {
+		opts.Fields = append(opts.Fields, path)
+		return nil
+	})
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("usage: deproto %s", commands["events"].usage)
+	}
+	in := os.Stdin
+	if name := first(positional); name != "" && name != "-" {
+		if in, err = os.Open(name); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+	_, err = deproto.EnrichEvents(in, os.Stdout, opts)
+	return err
+}
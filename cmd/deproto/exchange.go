@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runExchange(args []string) error {
+	fs := flag.NewFlagSet("exchange", flag.ContinueOnError)
+	sessionFile := fs.String("session", "", "start from the exchanges and notes saved in this session file")
+	out := fs.String("o", "", "save the session, with the new exchanges, to this file")
+	key := fs.String("key", "", "key of a REQUEST RESPONSE pair (default the file names)")
+	width := fs.Int("width", 60, "width of each column")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	session := deproto.NewSession()
+	if *sessionFile != "" {
+		if session, err = deproto.LoadSession(*sessionFile); err != nil {
+			return err
+		}
+	}
+
+	switch len(positional) {
+	case 0:
+		if *sessionFile == "" {
+			return fmt.Errorf("usage: deproto %s", commands["exchange"].usage)
+		}
+	case 1:
+		data, err := readInput(positional[0])
+		if err != nil {
+			return err
+		}
+		if !deproto.IsPcap(data) {
+			return fmt.Errorf("%s: not a capture; give a REQUEST and a RESPONSE file to pair them", positional[0])
+		}
+		if err := registerKeyLog(); err != nil {
+			return err
+		}
+		packets, err := deproto.ReadPcap(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", positional[0], err)
+		}
+		session.AddPackets(deproto.CapturePayloads(packets))
+	case 2:
+		request, err := readOne(positional[0])
+		if err != nil {
+			return err
+		}
+		response, err := readOne(positional[1])
+		if err != nil {
+			return err
+		}
+		if *key == "" {
+			*key = positional[0] + " <> " + positional[1]
+		}
+		session.AddRequest(*key, request)
+		session.AddResponse(*key, response)
+	default:
+		return fmt.Errorf("usage: deproto %s", commands["exchange"].usage)
+	}
+
+	opts := deproto.RenderOptions{Notes: session.Notes}
+	for i, e := range session.Exchanges {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(deproto.RenderExchange(e, deproto.DecodeOptions{}, opts, *width))
+	}
+	if *out != "" {
+		return session.Save(*out)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Exit codes, so that scripts and CI jobs can tell a clean decode from a
+// partial one.
+const (
+	exitOK      = 0 // Everything decoded
+	exitPartial = 1 // Some of the input decoded, but there were errors
+	exitFailed  = 2 // Nothing decoded, or the command could not run
+)
+
+// partialError marks an error after which some of the input was still
+// decoded.
+type partialError struct{ error }
+
+func (e partialError) Unwrap() error { return e.error }
+
+// partial marks err as a partial failure. It returns nil if err is nil.
+func partial(err error) error {
+	if err == nil {
+		return nil
+	}
+	return partialError{err}
+}
+
+// sourceError is an error in one message or file of the input.
+type sourceError struct {
+	source string
+	err    error
+}
+
+func (e sourceError) Error() string { return e.source + ": " + e.err.Error() }
+func (e sourceError) Unwrap() error { return e.err }
+
+// exitCode returns the exit code for the error a command returned.
+func exitCode(err error) int {
+	var p partialError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &p):
+		return exitPartial
+	default:
+		return exitFailed
+	}
+}
+
+// errorReport is the JSON written by -errors-json.
+type errorReport struct {
+	Status   string        `json:"status"` // "ok", "partial" or "failed"
+	ExitCode int           `json:"exit_code"`
+	Errors   []reportError `json:"errors"`
+}
+
+type reportError struct {
+	Source  string `json:"source,omitempty"`
+	Message string `json:"message"`
+}
+
+// newErrorReport describes the error a command returned, listing joined
+// errors one by one.
+func newErrorReport(err error) errorReport {
+	code := exitCode(err)
+	report := errorReport{Status: [...]string{"ok", "partial", "failed"}[code], ExitCode: code, Errors: []reportError{}}
+	var add func(source string, err error)
+	add = func(source string, err error) {
+		switch e := err.(type) {
+		case partialError:
+			add(source, e.error)
+		case sourceError:
+			add(e.source, e.err)
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				add(source, err)
+			}
+		default:
+			report.Errors = append(report.Errors, reportError{Source: source, Message: err.Error()})
+		}
+	}
+	if err != nil {
+		add("", err)
+	}
+	return report
+}
+
+// writeErrorReport writes the report for err to the named file, or standard
+// output when name is "-".
+func writeErrorReport(name string, err error) error {
+	data, merr := json.MarshalIndent(newErrorReport(err), "", "  ")
+	if merr != nil {
+		return merr
+	}
+	return writeOutput(name, append(data, '\n'))
+}
+
+// takeFlag removes a flag taking a value, given as -name value or
+// -name=value, from args and returns its value. It applies to every
+// subcommand, so it is handled before their own flags are parsed.
+func takeFlag(args []string, name string) ([]string, string) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || flagName != name {
+			continue
+		}
+		rest := append([]string{}, args[:i]...)
+		if hasValue {
+			return append(rest, args[i+1:]...), value
+		}
+		if i+1 < len(args) {
+			return append(rest, args[i+2:]...), args[i+1]
+		}
+		return rest, ""
+	}
+	return args, ""
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	out := fs.String("o", "", "write the bytes to this file instead of standard output")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("usage: deproto %s", commands["extract"].usage)
+	}
+	path, err := deproto.ParseFieldPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(first(positional[1:]))
+	if err != nil {
+		return err
+	}
+	value, err := deproto.Extract(data, path)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, value)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// fieldSetFlags collects repeated -include and -exclude flags, given as
+// [DEPTH:]NUMBERS, into field sets by depth. Without a depth, a set applies
+// at every depth.
+type fieldSetFlags map[int]deproto.FieldSet
+
+func (f fieldSetFlags) String() string { return "" }
+
+func (f fieldSetFlags) Set(s string) error {
+	depth := deproto.AnyDepth
+	if d, numbers, ok := strings.Cut(s, ":"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid depth %q", d)
+		}
+		depth, s = n, numbers
+	}
+	set, err := deproto.ParseFieldSet(s)
+	if err != nil {
+		return err
+	}
+	f[depth] = append(f[depth], set...)
+	return nil
+}
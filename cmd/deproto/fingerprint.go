@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// fingerprintJSON is the output of fingerprint -json.
+type fingerprintJSON struct {
+	Messages   int                    `json:"messages"`
+	OutOfOrder int                    `json:"out_of_order"`
+	Varints    map[string]int         `json:"varints,omitempty"`
+	Maps       int                    `json:"maps"`
+	SortedMaps int                    `json:"sorted_maps"`
+	Reordered  int                    `json:"reordered_maps"`
+	Defaults   int                    `json:"defaults"`
+	Scalars    int                    `json:"scalars"`
+	Unpacked   int                    `json:"unpacked"`
+	Guesses    []deproto.EncoderGuess `json:"guesses"`
+}
+
+func runFingerprint(args []string) error {
+	fs := flag.NewFlagSet("fingerprint", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the evidence and guesses as JSON")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	files := positional
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var fp deproto.EncoderFingerprint
+	err = forEachRecord(files, func(_ string, data []byte) error {
+		return fp.Check(data)
+	})
+	if fp.Messages == 0 {
+		return err
+	}
+	if *asJSON {
+		out := fingerprintJSON{
+			Messages:   fp.Messages,
+			OutOfOrder: fp.OutOfOrder,
+			Varints:    fp.Varints.Encodings,
+			Maps:       fp.Maps,
+			SortedMaps: fp.SortedMaps,
+			Reordered:  fp.Reordered,
+			Defaults:   fp.Defaults,
+			Scalars:    fp.Scalars,
+			Unpacked:   fp.Unpacked,
+			Guesses:    fp.Guess(),
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(fp.String())
+	}
+	return partial(err)
+}
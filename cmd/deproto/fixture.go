@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runFixture(args []string) error {
+	fs := flag.NewFlagSet("fixture", flag.ContinueOnError)
+	out := fs.String("o", "", "write the Go source to this file instead of standard output")
+	var opts deproto.FixtureOptions
+	fs.StringVar(&opts.Package, "package", "fixtures", "package of the generated file")
+	fs.StringVar(&opts.Name, "name", "fixture", "name of the variable holding the message")
+	fs.BoolVar(&opts.Bytes, "bytes", false, "write a byte literal commented field by field instead of MessageBuilder calls, keeping every byte as captured")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("usage: deproto %s", commands["fixture"].usage)
+	}
+
+	data, err := readInput(first(positional))
+	if err != nil {
+		return err
+	}
+	if len(positional) == 1 && positional[0] != "-" {
+		opts.Source = filepath.Base(positional[0])
+	}
+	src, err := deproto.GenerateFixture(data, opts)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, src)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runHAR(args []string) error {
+	fs := flag.NewFlagSet("har", flag.ContinueOnError)
+	out := fs.String("o", "", "also save the requests and responses as exchanges in this session file")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("usage: deproto %s", commands["har"].usage)
+	}
+	name := first(positional)
+	data, err := readInput(name)
+	if err != nil {
+		return err
+	}
+	entries, err := deproto.ReadHAR(data)
+	if err != nil {
+		return err
+	}
+
+	session := deproto.NewSession()
+	var errs []error
+	decoded := 0
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("# %s %s\n", e.Method, e.URL)
+		fmt.Printf("# status %d, started %s, took %s\n", e.Status, e.Started.Format(time.RFC3339Nano), e.Duration)
+		for _, msg := range e.Errors {
+			fmt.Printf("# error: %s\n", msg)
+			errs = append(errs, sourceError{fmt.Sprintf("entry %d", i+1), errors.New(msg)})
+		}
+		key := e.Method + " " + e.URL
+		for j, m := range e.Request {
+			fmt.Printf("## request %d (%s)\n", j+1, e.RequestType)
+			if printMessage(m, fmt.Sprintf("entry %d request %d", i+1, j+1), &errs) {
+				decoded++
+			}
+			session.AddRequest(key, m)
+		}
+		for j, m := range e.Response {
+			fmt.Printf("## response %d (%s)\n", j+1, e.ResponseType)
+			if printMessage(m, fmt.Sprintf("entry %d response %d", i+1, j+1), &errs) {
+				decoded++
+			}
+			session.AddResponse(key, m)
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Printf("# %s: no protobuf or gRPC bodies\n", name)
+	}
+	if *out != "" {
+		if err := session.Save(*out); err != nil {
+			return err
+		}
+	}
+	if err := errors.Join(errs...); err != nil && decoded > 0 {
+		return partial(err)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// printMessage decodes and renders one message, adding any error, named
+// after source, to errs. It reports whether any fields decoded.
+func printMessage(data []byte, source string, errs *[]error) bool {
+	fields, err := deproto.DecodeFields(data)
+	fmt.Print(deproto.RenderFields(fields, deproto.RenderOptions{}))
+	if err != nil {
+		fmt.Printf("[%v]\n", err)
+		*errs = append(*errs, sourceError{source, err})
+	}
+	return len(fields) > 0
+}
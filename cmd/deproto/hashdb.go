@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// loadHashDB reads a file of known digests, one per line as a hex digest
+// followed by a description, and returns a lookup over them. Blank lines and
+// lines starting with # are ignored.
+func loadHashDB(name string) (deproto.HashLookup, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	known := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest := strings.Fields(text)[0]
+		raw, err := hex.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		known[string(raw)] = strings.TrimSpace(text[len(digest):])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return func(digest []byte, _ []string) (string, bool) {
+		desc, ok := known[string(digest)]
+		return desc, ok
+	}, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runInfer(args []string) error {
+	fs := flag.NewFlagSet("infer", flag.ContinueOnError)
+	out := fs.String("out", "", "write the schema to this file instead of standard output")
+	var opts deproto.InferOptions
+	fs.StringVar(&opts.Package, "package", "", "package name of the schema")
+	fs.StringVar(&opts.MessageName, "message", "Message", "name of the root message")
+	fs.StringVar(&opts.Syntax, "syntax", "proto2", "syntax of the schema: proto2 or proto3")
+	fs.Float64Var(&opts.ShareTypes, "share", 0, "give nested messages at different paths one type when their fields are at least this similar, from 0 to 1 (0 for a type per path)")
+	sample := sampleFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if opts.Syntax != "proto2" && opts.Syntax != "proto3" {
+		return fmt.Errorf("invalid -syntax %q: want proto2 or proto3", opts.Syntax)
+	}
+	if opts.ShareTypes < 0 || opts.ShareTypes > 1 {
+		return fmt.Errorf("invalid -share %g: want a similarity between 0 and 1", opts.ShareTypes)
+	}
+	if err := checkSample(sample); err != nil {
+		return err
+	}
+	files := positional
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	sampler := deproto.NewSampler(*sample)
+	err = forEachMessage(files, func(fields []deproto.Field) bool {
+		if sampler.Take() {
+			sampler.Keep(fields)
+		}
+		return !sampler.Done()
+	})
+	if sampler.Read() == 0 {
+		return err
+	}
+	schema := deproto.InferSchema(sampler.Kept(), opts)
+	if werr := writeOutput(*out, []byte(schema.Proto())); werr != nil {
+		return werr
+	}
+	return partial(err)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runLogs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	pattern := fs.String("pattern", "", "regular expression matching the blobs, whose first group, if any, is the blob (default runs of hex or base64 text)")
+	only := fs.Bool("only", false, "print only the lines holding messages")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("usage: deproto %s", commands["logs"].usage)
+	}
+	var opts deproto.LogOptions
+	if *pattern != "" {
+		if opts.Pattern, err = regexp.Compile(*pattern); err != nil {
+			return fmt.Errorf("invalid -pattern: %v", err)
+		}
+	}
+	in := os.Stdin
+	if name := first(positional); name != "" && name != "-" {
+		if in, err = os.Open(name); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	return deproto.ScanLog(in, opts, func(line deproto.LogLine) error {
+		if *only && len(line.Blobs) == 0 {
+			return nil
+		}
+		fmt.Println(line.Text)
+		for _, blob := range line.Blobs {
+			fmt.Printf("    # %d:%d %s\n", line.Number, blob.Offset+1, blob.Wrapping)
+			rendered := deproto.RenderFields(blob.Fields, deproto.RenderOptions{})
+			for _, l := range strings.SplitAfter(strings.TrimSuffix(rendered, "\n"), "\n") {
+				fmt.Print("    " + l)
+			}
+			fmt.Println()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,669 @@
+// Command deproto decodes protobuf messages without a schema.
+//
+// Usage:
+//
+//	deproto [flags] [file]             decode a message and render its fields
+//	deproto capture -i IFACE           decode the messages of live traffic as they arrive
+//	deproto compat OLD NEW             report field changes between two .proto versions
+//	deproto decode -proto F [file]     decode a message of a known type, naming its fields
+//	deproto diff OLD NEW               show the fields that differ between two messages
+//	deproto dir DIR                    decode every file under DIR and summarize the corpus
+//	deproto edit FILE                  edit a message as text in $EDITOR and re-encode it
+//	deproto events [file]              decode base64 payloads in JSON event lines and add them to each event
+//	deproto exchange CAPTURE           pair requests with responses and render them side by side
+//	deproto extract PATH [file]        dump the raw bytes of the field at PATH
+//	deproto fingerprint [file...]      guess the protobuf library that encoded the messages
+//	deproto fixture [file]             write a message as Go source, for use as a test fixture
+//	deproto har [file]                 decode the protobuf and gRPC bodies of a HAR file
+//	deproto infer [file...]            infer a .proto schema from a corpus of messages
+//	deproto logs [file]                decode hex and base64 messages found in log lines, below each line
+//	deproto match -proto F [file]      rank the message types of F by how well the message fits them
+//	deproto note SESSION PATH TEXT     attach a note to the field at PATH, shown by -session
+//	deproto query EXPR [file...]       render or list the fields matching a query
+//	deproto replace PATH VALUE [file]  splice the bytes of VALUE into the field at PATH
+//	deproto send URL [file]            post a message over HTTP or gRPC and decode the reply
+//	deproto stats [file...]            tabulate field frequencies and values over a corpus
+//	deproto varints [file...]          report padded and widened varints, or with -bits show every varint bit by bit
+//	deproto watch BASELINE [stream]    print how each message of a stream differs from BASELINE
+//
+// Input is read from file, or from standard input when no file is given.
+// Binary messages, hex or base64 text, pcap captures, TFRecord files,
+// length-delimited streams and gRPC frames are told apart automatically;
+// -format overrides the guess.
+//
+// TLS and QUIC connections in captures are decrypted with the secrets of the
+// key log file named by $SSLKEYLOGFILE, as browsers and curl write it, and
+// the bodies of their HTTP requests and responses decoded.
+//
+// Profiles named by -profile are the built-in ones and those in the
+// directory $DEPROTO_PROFILES, by default deproto/profiles under the user
+// configuration directory: NAME.json profile files and NAME.pb compiled
+// descriptor sets.
+//
+// The exit status is 0 when everything decoded, 1 when only part of the
+// input did and 2 when nothing did or the command failed. With
+// -errors-json FILE, any command also writes its errors to FILE as JSON.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// command is a CLI subcommand.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"capture":     {"capture -i IFACE [-port N] [-keylog FILE] [-o FILE.jsonl] [-elasticsearch URL/INDEX] [-idle DURATION]", runCapture},
+		"compat":      {"compat OLD.proto NEW.proto [-message NAME]", runCompat},
+		"decode":      {"decode [file] -proto FILE [-type NAME] [-I dir] [flags]", runDecode},
+		"diff":        {"diff OLD NEW [-json] [-color auto|always|never]", runDiff},
+		"dir":         {"dir DIR [-o out-dir] [-j jobs]", runDir},
+		"edit":        {"edit FILE [-o out] [-protoscope] [-dialect SPEC] [-max-size N] [-canonical [-proto FILE [-type NAME]]] [-sign PATH=ALGORITHM[:KEY]]", runEdit},
+		"events":      {"events [file] [-field PATH]", runEvents},
+		"exchange":    {"exchange CAPTURE | REQUEST RESPONSE [-key KEY] [-session FILE] [-o FILE] [-width N]", runExchange},
+		"extract":     {"extract PATH [file] [-o out]", runExtract},
+		"fingerprint": {"fingerprint [file...] [-json]", runFingerprint},
+		"fixture":     {"fixture [file] [-o out.go] [-package NAME] [-name NAME] [-bytes]", runFixture},
+		"har":         {"har [file] [-o session.json]", runHAR},
+		"infer":       {"infer [file...] [-out schema.proto] [-package NAME] [-message NAME] [-syntax proto2|proto3] [-share F] [-rate F] [-limit N] [-keep N] [-seed N]", runInfer},
+		"logs":        {"logs [file] [-pattern REGEXP] [-only]", runLogs},
+		"match":       {"match [file] -proto FILE | -descriptors FILE [-I dir] [-n N]", runMatch},
+		"note":        {"note SESSION [PATH [TEXT...]]", runNote},
+		"query":       {"query EXPR [file...] [-values | -json] [-sticky]", runQuery},
+		"replace":     {"replace PATH VALUE-FILE [file] [-o out]", runReplace},
+		"send":        {"send URL [file] [-grpc | -grpc-web] [-text] [-H header] [-sign PATH=ALGORITHM[:KEY]]", runSend},
+		"stats":       {"stats [file...] [-json] [-no-schema] [-rate F] [-limit N] [-keep N] [-seed N] [-checkpoint FILE]", runStats},
+		"varints":     {"varints [file...] [-json | -bits]", runVarints},
+		"watch":       {"watch BASELINE [stream] [-hex] [-previous] [-color auto|always|never]", runWatch},
+	}
+}
+
+func main() {
+	args, errorsJSON := takeFlag(os.Args[1:], "errors-json")
+	run := runDecode
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			run, args = cmd.run, args[1:]
+		} else if args[0] == "help" {
+			usage()
+			return
+		}
+	}
+	err := run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		// The flag set printed the usage that was asked for.
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "deproto: %v\n", err)
+	}
+	if errorsJSON != "" {
+		if err := writeErrorReport(errorsJSON, err); err != nil {
+			fmt.Fprintf(os.Stderr, "deproto: %v\n", err)
+		}
+	}
+	os.Exit(exitCode(err))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: deproto [flags] [file]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "       deproto %s\n", commands[name].usage)
+	}
+}
+
+// parseArgs parses flags that may be interleaved with positional arguments
+// and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// readInput reads the named file, or standard input when name is empty or "-".
+func readInput(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// forEachMessage decodes the messages of the named files one file at a
+// time, of which there may be several per file in a capture or
+// length-delimited stream, and passes each to fn until fn returns false.
+// Messages that fail to decode are left out and reported in the error, as
+// is finding none.
+func forEachMessage(files []string, fn func(fields []deproto.Field) bool) error {
+	var errs []error
+	decoded := 0
+	for _, name := range files {
+		data, err := readInput(name)
+		if err != nil {
+			errs = append(errs, sourceError{name, err})
+			continue
+		}
+		records, err := readMessages(data, "auto")
+		if err != nil {
+			errs = append(errs, sourceError{name, err})
+			continue
+		}
+		for _, r := range records {
+			fields, err := deproto.DecodeFields(r.Data)
+			if err != nil {
+				source := name
+				if len(records) > 1 {
+					source += ": " + r.Name
+				}
+				errs = append(errs, sourceError{source, err})
+				continue
+			}
+			decoded++
+			if !fn(fields) {
+				return errors.Join(errs...)
+			}
+		}
+	}
+	if decoded == 0 {
+		return errors.Join(append(errs, fmt.Errorf("no messages decoded"))...)
+	}
+	return errors.Join(errs...)
+}
+
+// forEachRecord reads the messages of the named files, of which there may
+// be several per file in a capture or length-delimited stream, and passes
+// each to fn with its source: the file name, followed by the name of the
+// record when there are several. Errors of fn are collected with those of
+// reading, as is finding no messages.
+func forEachRecord(files []string, fn func(source string, data []byte) error) error {
+	var errs []error
+	ok := 0
+	for _, name := range files {
+		data, err := readInput(name)
+		if err != nil {
+			errs = append(errs, sourceError{name, err})
+			continue
+		}
+		records, err := readMessages(data, "auto")
+		if err != nil {
+			errs = append(errs, sourceError{name, err})
+			continue
+		}
+		for _, r := range records {
+			source := name
+			if len(records) > 1 {
+				source += ": " + r.Name
+			}
+			if err := fn(source, r.Data); err != nil {
+				errs = append(errs, sourceError{source, err})
+				continue
+			}
+			ok++
+		}
+	}
+	if ok == 0 {
+		return errors.Join(append(errs, fmt.Errorf("no messages decoded"))...)
+	}
+	return errors.Join(errs...)
+}
+
+// sampleFlags defines the flags that sample a corpus too large to analyze
+// whole.
+func sampleFlags(fs *flag.FlagSet) *deproto.SampleOptions {
+	var opts deproto.SampleOptions
+	fs.Float64Var(&opts.Rate, "rate", 0, "analyze this fraction of the messages, chosen at random (0 for all)")
+	fs.IntVar(&opts.Limit, "limit", 0, "stop after analyzing this many messages (0 for no limit)")
+	fs.IntVar(&opts.Keep, "keep", 0, "infer the schema from a random sample of this many messages held in memory (0 for all)")
+	fs.Uint64Var(&opts.Seed, "seed", 0, "seed of the random sampling")
+	return &opts
+}
+
+// dialectFlag defines the -dialect flag of a command that reads or writes
+// messages in a protobuf-like format.
+func dialectFlag(fs *flag.FlagSet, verb string) **deproto.Dialect {
+	var dialect *deproto.Dialect
+	fs.Func("dialect", verb+" tags as this protobuf-like `spec` writes them, such as tag=2,big-endian,wire=6:bytes for 2-byte tags with wire type 6 for length-delimited fields", func(spec string) error {
+		var err error
+		dialect, err = deproto.ParseDialect(spec)
+		return err
+	})
+	return &dialect
+}
+
+// checkSample validates the flags defined by sampleFlags.
+func checkSample(opts *deproto.SampleOptions) error {
+	if opts.Rate < 0 || opts.Rate > 1 {
+		return fmt.Errorf("invalid -rate %g: want a fraction between 0 and 1", opts.Rate)
+	}
+	return nil
+}
+
+// flagValue returns the value of the named flag in args, such as -config,
+// so that a file can be loaded before the flags that override it are
+// defined.
+func flagValue(args []string, flagName string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != flagName {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// registerUserProfiles adds the profiles of the user's profile directory,
+// if there is one, to the built-in ones.
+func registerUserProfiles() error {
+	dir := os.Getenv("DEPROTO_PROFILES")
+	if dir == "" {
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return nil
+		}
+		dir = filepath.Join(config, "deproto", "profiles")
+	}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := deproto.RegisterProfiles(os.DirFS(dir)); err != nil {
+		return fmt.Errorf("profiles in %s: %v", dir, err)
+	}
+	return nil
+}
+
+// minSchemaScore is the share of a message's fields the best of several
+// candidate schemas must explain to be used for it.
+const minSchemaScore = 0.5
+
+// keyLogOnce reads the key log once, as dir reads files concurrently.
+var (
+	keyLogOnce sync.Once
+	keyLogErr  error
+)
+
+// registerKeyLog registers the TLS secrets of the key log file named by
+// $SSLKEYLOGFILE, if set, for decrypting captures. The file is read once,
+// when the first capture is. Malformed lines are reported and skipped.
+func registerKeyLog() error {
+	keyLogOnce.Do(func() { keyLogErr = readKeyLog() })
+	return keyLogErr
+}
+
+// readKeyLog registers the key log file named by $SSLKEYLOGFILE.
+func readKeyLog() error {
+	name := os.Getenv("SSLKEYLOGFILE")
+	if name == "" {
+		return nil
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := deproto.RegisterKeyLog(data); err != nil {
+		fmt.Fprintf(os.Stderr, "deproto: %s: %v\n", name, err)
+	}
+	return nil
+}
+
+// readMessages extracts the messages of input data as
+// deproto.ReadMessages does, registering the key log first if the data is
+// a capture.
+func readMessages(data []byte, format string) ([]*deproto.Record, error) {
+	if format == deproto.InputPcap || (format == "" || format == "auto") && deproto.IsPcap(data) {
+		if err := registerKeyLog(); err != nil {
+			return nil, err
+		}
+	}
+	return deproto.ReadMessages(data, format)
+}
+
+// singleMessage extracts the one message of input data in whatever format
+// deproto.DetectInputFormat finds it in, such as hex or base64 text.
+func singleMessage(data []byte) ([]byte, error) {
+	records, err := readMessages(data, "auto")
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, fmt.Errorf("%d messages, want one", len(records))
+	}
+	return records[0].Data, nil
+}
+
+// writeOutput writes data to the named file, or standard output when name is
+// empty or "-".
+func writeOutput(name string, data []byte) error {
+	if name == "" || name == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+func runDecode(args []string) (err error) {
+	fs := flag.NewFlagSet("deproto", flag.ContinueOnError)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr, "\nflags of deproto [flags] [file] and deproto decode:")
+		fs.PrintDefaults()
+	}
+	if err := registerUserProfiles(); err != nil {
+		return err
+	}
+	profile := deproto.Profile{Heuristics: deproto.DefaultHeuristics()}
+	if name := flagValue(args, "profile"); name != "" {
+		var err error
+		if profile, err = deproto.LoadProfile(name); err != nil {
+			return err
+		}
+	}
+	heuristics := profile.Heuristics
+	if name := flagValue(args, "config"); name != "" {
+		var err error
+		if heuristics, err = deproto.LoadHeuristicsOver(heuristics, name); err != nil {
+			return err
+		}
+	}
+	fs.String("profile", "", "start from the settings of this profile ("+strings.Join(deproto.ProfileNames(), ", ")+") or JSON profile file; -config and flags override it")
+	fs.String("config", "", "read heuristic settings from this JSON or TOML file; flags override it")
+	fs.BoolVar(&heuristics.UnwrapText, "unwrap", heuristics.UnwrapText, "decode base64 and hex strings that hold messages as nested fields")
+	fs.BoolVar(&heuristics.Embedded, "embedded", heuristics.Embedded, "read NUL-padded text as strings and empty payloads as messages, as firmware encoders such as nanopb write them")
+	fs.BoolVar(&heuristics.Struct, "struct", heuristics.Struct, "render google.protobuf.Struct-shaped messages as JSON")
+	fs.BoolVar(&heuristics.Encodings, "encodings", heuristics.Encodings, "render UTF-16 and Shift-JIS byte fields as decoded text")
+	fs.BoolVar(&heuristics.Entropy, "entropy", heuristics.Entropy, "annotate byte fields with their entropy and likely contents")
+	fs.BoolVar(&heuristics.Tokens, "tokens", heuristics.Tokens, "decode JWTs and label base64 strings")
+	fs.BoolVar(&heuristics.ExpandTokens, "expand-tokens", heuristics.ExpandTokens, "like -tokens, and render base64 strings holding messages as nested fields")
+	fs.BoolVar(&heuristics.URLs, "urls", heuristics.URLs, "list the host, path and decoded parameters of URL strings")
+	fs.BoolVar(&heuristics.AnyPairs, "any", heuristics.AnyPairs, "label the field after a type URL string with its type, as in google.protobuf.Any")
+	fs.BoolVar(&heuristics.TFExample, "tf-example", heuristics.TFExample, "render messages shaped like a tf.Example as their features")
+	fs.BoolVar(&heuristics.BigEndian, "big-endian", heuristics.BigEndian, "also show fixed32 and fixed64 values read big-endian")
+	fs.BoolVar(&heuristics.HashHints, "hashes", heuristics.HashHints, "annotate digest-sized byte fields with matching hash algorithms")
+	fs.IntVar(&heuristics.MaxNestedFieldNumber, "max-nested-field-number", heuristics.MaxNestedFieldNumber, "keep payloads using higher field numbers as bytes (0 for the default, -1 for no limit)")
+	fs.IntVar(&heuristics.MaxNestedFields, "max-nested-fields", heuristics.MaxNestedFields, "keep payloads of more fields than this as bytes (0 for no limit)")
+	progress := fs.Bool("progress", false, "report decoding progress on standard error")
+	warnings := fs.Bool("warnings", false, "report soft decoding problems, such as type hints that do not fit and padded varints, on standard error")
+	traceFile := fs.String("trace", "", "write every decoding decision to this file as JSON lines")
+	jsonlFile := fs.String("jsonl", "", "also write each decoded message to this file as a line of JSON, with its source and time; - writes only that, to standard output")
+	esURL := fs.String("elasticsearch", "", "also index each decoded message, its fields flattened, in the Elasticsearch or OpenSearch index at this URL, such as http://localhost:9200/traffic")
+	hashDB := fs.String("hash-db", "", "look digest-sized byte fields up in this file of \"hex description\" lines (implies -hashes)")
+	if profile.Format == "" {
+		profile.Format = "auto"
+	}
+	format := fs.String("format", profile.Format, "input format: auto, "+strings.Join(deproto.InputFormats, ", "))
+	size := fs.Bool("size", profile.ShowSize, "show the encoded size of every field")
+	verbose := fs.Bool("verbose", profile.Verbose, "render long strings whole and byte fields as full hex dumps instead of previews")
+	sessionFile := fs.String("session", "", "show the notes saved in this session file next to their fields")
+	maxFields := fs.Int("max-fields", 0, "stop decoding after this many fields (0 for no limit)")
+	maxOutput := fs.Int("max-output", 0, "stop rendering after this many bytes of output (0 for no limit)")
+	if heuristics.TypeHints == nil {
+		heuristics.TypeHints = make(map[string]deproto.WireHint)
+	}
+	fs.Var(hintFlags(heuristics.TypeHints), "as", "read the field at PATH as bytes, string, message, packed-varint, packed-fixed32, packed-fixed64 or packed-TYPE, given as PATH=INTERPRETATION (repeatable)")
+	filter := &deproto.FieldFilter{Include: make(map[int]deproto.FieldSet), Exclude: make(map[int]deproto.FieldSet)}
+	fs.Var(fieldSetFlags(filter.Include), "include", "decode only these field numbers, given as [DEPTH:]NUMBERS such as 0:1,3-5; without DEPTH at every depth (repeatable)")
+	fs.Var(fieldSetFlags(filter.Exclude), "exclude", "skip these field numbers without decoding them, given like -include (repeatable)")
+	explain := fs.Bool("explain", false, "describe every byte range of the message in prose instead of rendering its fields, to learn the wire format")
+	ambiguous := fs.Bool("ambiguous", false, "list the fields that could be read more than one way")
+	conflicts := fs.Bool("conflicts", false, "list the fields that occur with more than one wire type")
+	protoFile := fs.String("proto", "", "decode as a message declared in this .proto file, naming its fields")
+	typeName := fs.String("type", "", "the message type in the -proto file or the -profile's files, such as pkg.Request (default the first one)")
+	var importPaths []string
+	fs.Func("I", "search this `dir` for the -proto file and its imports (repeatable)", func(dir string) error {
+		importPaths = append(importPaths, dir)
+		return nil
+	})
+	dialect := dialectFlag(fs, "read")
+	var hexOpts deproto.HexOptions
+	fs.BoolVar(&hexOpts.ASCII, "ascii", false, "show an ASCII gutter in hex dumps")
+	fs.IntVar(&hexOpts.BytesPerLine, "hex-width", 16, "bytes per hex dump line")
+	fs.IntVar(&hexOpts.GroupSize, "hex-group", 0, "bytes per hex dump group")
+	fs.IntVar(&hexOpts.MaxLines, "hex-lines", 0, "maximum hex dump lines per field")
+	var hooks scriptHooks
+	hooks.register(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("too many arguments: %s", strings.Join(positional, " "))
+	}
+	opts := heuristics.RenderOptions()
+	opts.ShowSize, opts.Hex, opts.MaxOutput, opts.Verbose = *size, hexOpts, *maxOutput, *verbose
+	opts.Dialect = *dialect
+	fs.Visit(func(f *flag.Flag) {
+		// Hex dump settings only apply to full dumps, so asking for them
+		// asks for those.
+		if strings.HasPrefix(f.Name, "hex-") || f.Name == "ascii" {
+			opts.Verbose = true
+		}
+	})
+	if *sessionFile != "" {
+		session, err := deproto.LoadSession(*sessionFile)
+		if err != nil {
+			return err
+		}
+		opts.Notes = session.Notes
+	}
+	if *hashDB != "" {
+		if opts.HashLookup, err = loadHashDB(*hashDB); err != nil {
+			return err
+		}
+		opts.HashHints = true
+	}
+	decodeOpts := heuristics.DecodeOptions()
+	decodeOpts.MaxFields = *maxFields
+	decodeOpts.Dialect = *dialect
+	if len(filter.Include) > 0 || len(filter.Exclude) > 0 {
+		decodeOpts.FieldFilter = filter
+	}
+	// With several candidate schemas, each message is decoded as the one
+	// it fits best.
+	var candidates []*deproto.MessageSchema
+	switch {
+	case *protoFile != "":
+		if opts.Schema, opts.Types, err = loadMessage(*protoFile, *typeName, importPaths...); err != nil {
+			return err
+		}
+		decodeOpts.Schema = opts.Schema
+	case len(profile.Protos) > 0 || len(profile.Descriptors) > 0:
+		if *typeName != "" {
+			profile.Types = []string{*typeName}
+		}
+		if opts.Types, candidates, err = profile.Schemas(importPaths...); err != nil {
+			return err
+		}
+		if len(candidates) == 1 {
+			opts.Schema, decodeOpts.Schema, candidates = candidates[0], candidates[0], nil
+		}
+	case *typeName != "":
+		return fmt.Errorf("-type needs -proto")
+	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		decodeOpts.Trace = func(e deproto.TraceEvent) { enc.Encode(e) }
+	}
+	if *progress {
+		decodeOpts.Progress = printProgress
+	}
+	if *warnings {
+		decodeOpts.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+
+	// With -jsonl -, JSON lines replace the rendered fields.
+	var sink deproto.Sink
+	stdout := io.Writer(os.Stdout)
+	if *jsonlFile == "-" {
+		sink, stdout = deproto.JSONSink(os.Stdout), io.Discard
+	} else if *jsonlFile != "" {
+		f, err := os.Create(*jsonlFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sink = deproto.JSONSink(f)
+	}
+	if *esURL != "" {
+		var exporter *deproto.ElasticsearchExporter
+		if exporter, err = newElasticsearchExporter(*esURL); err != nil {
+			return err
+		}
+		// Send the last batch, failing the command if it is rejected.
+		defer func() {
+			if ferr := exporter.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}()
+		sink = joinSinks(sink, exporter.Export)
+	}
+
+	decodeMessage := func(r *deproto.Record) error {
+		decodeOpts, opts := decodeOpts, opts
+		if len(candidates) > 0 {
+			// A message no candidate fits well enough is decoded
+			// without a schema rather than labeled as the best of them.
+			matches, err := deproto.MatchTypes(r.Data, candidates, 1)
+			if err == nil && matches[0].Score >= minSchemaScore {
+				opts.Schema = matches[0].Message
+				decodeOpts.Schema = opts.Schema
+				fmt.Fprintf(stdout, "# %s\n", opts.Schema.FullName)
+			}
+		}
+		if *explain {
+			text, err := decodeOpts.Explain(r.Data)
+			fmt.Fprint(stdout, text)
+			// Undecoded bytes take the last line, so more lines mean
+			// part of the message decoded.
+			if err != nil && strings.Count(text, "\n") > 1 {
+				return partial(err)
+			}
+			return err
+		}
+		fields, err := decodeOpts.Decode(r.Data)
+		if err != nil {
+			fmt.Fprint(stdout, deproto.RenderFields(fields, opts))
+			if sink != nil && len(fields) > 0 {
+				r.Fields, r.Notes = fields, append(r.Notes, "error: "+err.Error())
+				if err := sink(r); err != nil {
+					return err
+				}
+			}
+			if len(fields) > 0 {
+				return partial(err)
+			}
+			return err
+		}
+		fields, tags, keep, err := hooks.run(fields)
+		if err != nil || !keep {
+			return err
+		}
+		for _, tag := range tags {
+			fmt.Fprintf(stdout, "# %s\n", tag)
+		}
+		if sink != nil {
+			r.Fields, r.Notes = fields, append(r.Notes, tags...)
+			if err := sink(r); err != nil {
+				return err
+			}
+		}
+		if *jsonlFile == "-" {
+			return nil
+		}
+		output, err := deproto.RenderFieldsLimited(fields, opts)
+		fmt.Print(output)
+		if err != nil {
+			return partial(err)
+		}
+		if *ambiguous {
+			printAmbiguities(fields)
+		}
+		if *conflicts {
+			for _, c := range deproto.FindWireTypeConflicts(fields) {
+				fmt.Printf("# wire type conflict: %s\n", c)
+			}
+		}
+		return nil
+	}
+
+	data, err := readInput(first(positional))
+	if err != nil {
+		return err
+	}
+	if *format == "auto" {
+		*format = deproto.DetectInputFormat(data)
+	}
+	records, err := readMessages(data, *format)
+	if err != nil {
+		return err
+	}
+	if len(records) == 1 && *format != deproto.InputPcap {
+		return decodeMessage(records[0])
+	}
+	var errs []error
+	for _, r := range records {
+		fmt.Fprintf(stdout, "# %s\n", r.Name)
+		if err := decodeMessage(r); err != nil {
+			errs = append(errs, sourceError{r.Name, err})
+		}
+	}
+	if len(errs) < len(records) {
+		return partial(errors.Join(errs...))
+	}
+	return errors.Join(errs...)
+}
+
+// first returns the first element of args, or "" if there is none.
+func first(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
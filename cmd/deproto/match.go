@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runMatch(args []string) error {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	n := fs.Int("n", 5, "list this many matches (0 for all)")
+	var protos, descriptors, importPaths []string
+	fs.Func("proto", "consider the messages of this .proto `file` and its imports (repeatable)", func(name string) error {
+		protos = append(protos, name)
+		return nil
+	})
+	fs.Func("descriptors", "consider the messages of this compiled descriptor set `file` (repeatable)", func(name string) error {
+		descriptors = append(descriptors, name)
+		return nil
+	})
+	fs.Func("I", "search this `dir` for the -proto files and their imports (repeatable)", func(dir string) error {
+		importPaths = append(importPaths, dir)
+		return nil
+	})
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 || len(protos)+len(descriptors) == 0 {
+		return fmt.Errorf("usage: deproto %s", commands["match"].usage)
+	}
+	// Every message of the registry is a candidate, those of imported
+	// files included.
+	profile := deproto.Profile{Protos: protos, Descriptors: descriptors}
+	registry, _, err := profile.Schemas(importPaths...)
+	if err != nil {
+		return err
+	}
+	data, err := readOne(first(positional))
+	if err != nil {
+		return err
+	}
+	matches, err := deproto.MatchTypes(data, registry.Messages(), *n)
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		fmt.Printf("%5.1f%%  %s (%d of %d fields)\n", 100*m.Score, m.Message.FullName, m.Explained, m.Fields)
+	}
+	return nil
+}
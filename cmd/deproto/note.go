@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runNote(args []string) error {
+	flags := flag.NewFlagSet("note", flag.ContinueOnError)
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("usage: deproto %s", commands["note"].usage)
+	}
+	name := positional[0]
+	session, err := deproto.LoadSession(name)
+	if errors.Is(err, fs.ErrNotExist) && len(positional) > 1 {
+		session, err = deproto.NewSession(), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(positional) == 1 {
+		paths := make([]deproto.FieldPath, 0, len(session.Notes))
+		for s := range session.Notes {
+			path, _ := deproto.ParseFieldPath(s)
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool { return slices.Compare(paths[i], paths[j]) < 0 })
+		for _, path := range paths {
+			fmt.Printf("%s: %s\n", path, session.Notes.Get(path))
+		}
+		return nil
+	}
+	path, err := deproto.ParseFieldPath(positional[1])
+	if err != nil {
+		return err
+	}
+	session.Notes.Set(path, strings.Join(positional[2:], " "))
+	return session.Save(name)
+}
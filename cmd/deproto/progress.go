@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// printProgress reports decoding progress on standard error, overwriting
+// the previous report and ending the line when decoding is complete.
+func printProgress(done, total int) {
+	percent := 100
+	if total > 0 {
+		percent = int(int64(done) * 100 / int64(total))
+	}
+	fmt.Fprintf(os.Stderr, "\rdecoded %.1f of %.1f MiB (%d%%)", mib(done), mib(total), percent)
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func mib(n int) float64 {
+	return float64(n) / (1 << 20)
+}
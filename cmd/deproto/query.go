@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	values := fs.Bool("values", false, "print only the matched values, one per line")
+	asJSON := fs.Bool("json", false, "print the matched values as a JSON array")
+	sticky := fs.Bool("sticky", false, "read each field path the way most of the files read it")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 {
+		return fmt.Errorf("usage: deproto %s", commands["query"].usage)
+	}
+	q, err := deproto.CompileQuery(positional[0])
+	if err != nil {
+		return err
+	}
+
+	files := positional[1:]
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var sources []string
+	var messages [][]byte
+	if err := forEachRecord(files, func(source string, data []byte) error {
+		sources = append(sources, source)
+		messages = append(messages, data)
+		return nil
+	}); err != nil {
+		return err
+	}
+	corpus := make([][]deproto.Field, len(messages))
+	if *sticky {
+		if corpus, err = (deproto.DecodeOptions{}).DecodeCorpus(messages); err != nil {
+			return err
+		}
+	} else {
+		for i, data := range messages {
+			if corpus[i], err = deproto.DecodeFields(data); err != nil {
+				return fmt.Errorf("%s: %v", sources[i], err)
+			}
+		}
+	}
+
+	collected := []any{}
+	for i, name := range sources {
+		matched := q.Select(corpus[i])
+
+		switch {
+		case *asJSON:
+			for _, f := range matched {
+				collected = append(collected, deproto.JSONValue(f))
+			}
+		case *values:
+			for _, f := range matched {
+				fmt.Println(deproto.ValueString(f))
+			}
+		default:
+			if len(sources) > 1 {
+				fmt.Printf("# %s\n", name)
+			}
+			fmt.Print(deproto.RenderFields(matched, deproto.RenderOptions{}))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		return enc.Encode(collected)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runReplace(args []string) error {
+	fs := flag.NewFlagSet("replace", flag.ContinueOnError)
+	out := fs.String("o", "", "write the message to this file instead of standard output")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 || len(positional) > 3 {
+		return fmt.Errorf("usage: deproto %s", commands["replace"].usage)
+	}
+	path, err := deproto.ParseFieldPath(positional[0])
+	if err != nil {
+		return err
+	}
+	value, err := os.ReadFile(positional[1])
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(first(positional[2:]))
+	if err != nil {
+		return err
+	}
+	patched, err := deproto.Replace(data, path, value)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, patched)
+}
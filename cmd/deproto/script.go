@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// scriptHooks holds the expressions given with -filter, -transform and -tag.
+type scriptHooks struct {
+	filters    []*deproto.Expr
+	transforms []*deproto.Expr
+	tags       []namedExpr
+}
+
+type namedExpr struct {
+	name string
+	expr *deproto.Expr
+}
+
+// register adds the hook flags to fs.
+func (h *scriptHooks) register(fs *flag.FlagSet) {
+	fs.Func("filter", "only output messages for which `expr` is true (repeatable)", func(s string) error {
+		e, err := deproto.CompileExpr(s)
+		h.filters = append(h.filters, e)
+		return err
+	})
+	fs.Func("transform", "evaluate `expr` on each message for its side effects, e.g. drop(5) (repeatable)", func(s string) error {
+		e, err := deproto.CompileExpr(s)
+		h.transforms = append(h.transforms, e)
+		return err
+	})
+	fs.Func("tag", "label each message with `name=expr` (repeatable)", func(s string) error {
+		name, src, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("tag %q is not in name=expr form", s)
+		}
+		e, err := deproto.CompileExpr(src)
+		h.tags = append(h.tags, namedExpr{name: strings.TrimSpace(name), expr: e})
+		return err
+	})
+}
+
+// run applies the transforms, evaluates the tags and filters, and reports
+// whether the message should be output.
+func (h *scriptHooks) run(fields []deproto.Field) ([]deproto.Field, []string, bool, error) {
+	var err error
+	for _, e := range h.transforms {
+		if fields, err = e.Apply(fields); err != nil {
+			return fields, nil, false, err
+		}
+	}
+	for _, e := range h.filters {
+		ok, err := e.Match(fields)
+		if err != nil || !ok {
+			return fields, nil, false, err
+		}
+	}
+	var tags []string
+	for _, t := range h.tags {
+		v, err := t.expr.Eval(fields)
+		if err != nil {
+			return fields, nil, false, err
+		}
+		tags = append(tags, fmt.Sprintf("%s: %v", t.name, v))
+	}
+	return fields, tags, true, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// headerFlags collects repeated -H "Name: value" flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(s string) error {
+	key, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("header %q is not in Name: value form", s)
+	}
+	http.Header(h).Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	return nil
+}
+
+func runSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	grpc := fs.Bool("grpc", false, "send as a gRPC request over HTTP/2")
+	grpcWeb := fs.Bool("grpc-web", false, "send as a gRPC-Web request")
+	text := fs.Bool("text", false, "read the message in text format instead of binary")
+	header := make(headerFlags)
+	fs.Var(header, "H", "add a request header (repeatable)")
+	var signers signFlags
+	fs.Var(&signers, "sign", signUsage())
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("usage: deproto %s", commands["send"].usage)
+	}
+
+	data, err := readInput(first(positional[1:]))
+	if err != nil {
+		return err
+	}
+	var fields []deproto.Field
+	if *text {
+		fields, err = deproto.ParseText(string(data))
+	} else {
+		fields, err = deproto.DecodeFields(data)
+	}
+	if err != nil {
+		return err
+	}
+	if err := (deproto.EncodeOptions{}).Sign(fields, signers...); err != nil {
+		return err
+	}
+
+	opts := deproto.SendOptions{Header: http.Header(header)}
+	switch {
+	case *grpc && *grpcWeb:
+		return fmt.Errorf("-grpc and -grpc-web are mutually exclusive")
+	case *grpc:
+		opts.Protocol = deproto.ProtocolGRPC
+	case *grpcWeb:
+		opts.Protocol = deproto.ProtocolGRPCWeb
+	}
+	reply, err := deproto.Send(context.Background(), positional[0], fields, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("# HTTP %d\n", reply.StatusCode)
+	if reply.GRPCStatus != "" {
+		fmt.Printf("# grpc-status: %s %s\n", reply.GRPCStatus, reply.GRPCMessage)
+	}
+	for _, msg := range reply.Messages {
+		fields, err := deproto.DecodeFields(msg)
+		fmt.Print(deproto.RenderFields(fields, deproto.RenderOptions{}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
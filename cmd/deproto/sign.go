@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// signFlags collects repeated -sign PATH=ALGORITHM[:KEY] flags as signers.
+// KEY is hex, or @FILE to read the raw key from a file.
+type signFlags []deproto.Signer
+
+func (s *signFlags) String() string { return "" }
+
+func (s *signFlags) Set(v string) error {
+	p, spec, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("signature %q is not in PATH=ALGORITHM[:KEY] form", v)
+	}
+	path, err := deproto.ParseFieldPath(p)
+	if err != nil {
+		return err
+	}
+	algorithm, k, _ := strings.Cut(spec, ":")
+	var key []byte
+	if file, ok := strings.CutPrefix(k, "@"); ok {
+		key, err = os.ReadFile(file)
+	} else {
+		key, err = hex.DecodeString(k)
+	}
+	if err != nil {
+		return fmt.Errorf("signature key: %v", err)
+	}
+	sign, err := deproto.NewSignFunc(algorithm, key)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, deproto.Signer{Path: path, Sign: sign})
+	return nil
+}
+
+// signUsage describes the -sign flag.
+func signUsage() string {
+	return "recompute the field at PATH as a signature of the rest of its message, given as PATH=ALGORITHM[:KEY] with KEY in hex or @FILE; ALGORITHM is one of " +
+		strings.Join(deproto.SignatureNames(), ", ") + " (repeatable)"
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// statsJSON is the output of stats -json.
+type statsJSON struct {
+	Samples int              `json:"samples"`
+	Read    int              `json:"read"`
+	Kept    int              `json:"kept"`
+	Fields  []fieldStatsJSON `json:"fields"`
+	Schema  string           `json:"schema,omitempty"`
+
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+type fieldStatsJSON struct {
+	Path     string               `json:"path"`
+	Count    int                  `json:"count"`
+	Messages int                  `json:"messages"`
+	Kinds    map[string]int       `json:"kinds"`
+	Min      uint64               `json:"min"`
+	Max      uint64               `json:"max"`
+	Mean     float64              `json:"mean"`
+	Distinct int                  `json:"distinct"`
+	Top      []deproto.ValueCount `json:"top,omitempty"`
+
+	Estimated bool   `json:"estimated,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the statistics as JSON")
+	noSchema := flags.Bool("no-schema", false, "leave out the candidate schema")
+	sample := sampleFlags(flags)
+	checkpoint := flags.String("checkpoint", "", "resume the analysis saved in this file, if any, skip the files it covers and save it again after each file")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := checkSample(sample); err != nil {
+		return err
+	}
+	files := positional
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var analyzer *deproto.CorpusAnalyzer
+	if *checkpoint == "" {
+		analyzer = deproto.NewCorpusAnalyzer(*sample)
+		err = forEachMessage(files, analyzer.Add)
+	} else {
+		if analyzer, err = resumeAnalysis(*checkpoint, *sample); err != nil {
+			return err
+		}
+		var errs []error
+		for _, name := range files {
+			if analyzer.Done() {
+				break
+			}
+			if name != "-" && slices.Contains(analyzer.Sources, name) {
+				continue
+			}
+			err := forEachMessage([]string{name}, analyzer.Add)
+			errs = append(errs, err)
+			if err == nil && name != "-" {
+				analyzer.Sources = append(analyzer.Sources, name)
+			}
+			if err := analyzer.Save(*checkpoint); err != nil {
+				return err
+			}
+		}
+		err = errors.Join(errs...)
+	}
+	stats := analyzer.Stats()
+	if stats.Read == 0 {
+		return err
+	}
+	if *noSchema {
+		stats.Schema = nil
+	}
+	if *asJSON {
+		out := statsJSON{Samples: stats.Samples, Read: stats.Read, Kept: stats.Kept, Fields: []fieldStatsJSON{}}
+		for _, f := range stats.Fields {
+			out.Fields = append(out.Fields, fieldStatsJSON{f.Path.String(), f.Count, f.Messages, f.Kinds, f.Min, f.Max, f.Mean, f.Distinct, f.Top, f.Estimated, f.Role})
+		}
+		for _, c := range stats.Conflicts {
+			out.Conflicts = append(out.Conflicts, c.String())
+		}
+		if stats.Schema != nil {
+			out.Schema = stats.Schema.Proto()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(stats)
+	}
+	return partial(err)
+}
+
+// resumeAnalysis loads the analysis checkpointed in a file, or starts a new
+// one with the sampling options if the file does not exist.
+func resumeAnalysis(name string, sample deproto.SampleOptions) (*deproto.CorpusAnalyzer, error) {
+	analyzer, err := deproto.LoadCorpusAnalyzer(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return deproto.NewCorpusAnalyzer(sample), nil
+	}
+	return analyzer, err
+}
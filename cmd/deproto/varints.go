@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// varintsJSON is the output of varints -json.
+type varintsJSON struct {
+	Messages  int               `json:"messages"`
+	Varints   int               `json:"varints"`
+	Encodings map[string]int    `json:"encodings,omitempty"`
+	Issues    []varintIssueJSON `json:"issues"`
+}
+
+type varintIssueJSON struct {
+	Path     string `json:"path"`
+	Offset   int    `json:"offset"`
+	Varint   string `json:"varint"`
+	Value    uint64 `json:"value"`
+	Bytes    int    `json:"bytes"`
+	Encoding string `json:"encoding"`
+}
+
+func runVarints(args []string) error {
+	fs := flag.NewFlagSet("varints", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	showBits := fs.Bool("bits", false, "also show the bytes and bits of every key, value and length, and the value they add up to")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *asJSON && *showBits {
+		return fmt.Errorf("-json and -bits are mutually exclusive")
+	}
+	files := positional
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var report deproto.VarintReport
+	err = forEachRecord(files, func(source string, data []byte) error {
+		before := len(report.Issues)
+		if err := report.Check(data); err != nil {
+			return err
+		}
+		if *showBits {
+			bits, _ := deproto.RenderBits(data)
+			fmt.Printf("%s:\n%s", source, bits)
+		}
+		if !*asJSON {
+			for _, issue := range report.Issues[before:] {
+				fmt.Printf("%s: %s\n", source, issue)
+			}
+		}
+		return nil
+	})
+	if report.Messages == 0 {
+		return err
+	}
+	if *asJSON {
+		out := varintsJSON{Messages: report.Messages, Varints: report.Varints, Encodings: report.Encodings, Issues: []varintIssueJSON{}}
+		for _, i := range report.Issues {
+			out.Issues = append(out.Issues, varintIssueJSON{i.Path.String(), i.Offset, i.Varint, i.Value, i.Bytes, i.Encoding})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(report.String())
+	}
+	return partial(err)
+}
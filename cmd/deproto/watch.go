@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	hexLines := fs.Bool("hex", false, "read one hex message per line instead of length-delimited binary")
+	previous := fs.Bool("previous", false, "compare every message with the one before it instead of the baseline")
+	color := fs.String("color", "auto", "color the output: auto, always or never")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("usage: deproto %s", commands["watch"].usage)
+	}
+	colored, err := useColor(*color)
+	if err != nil {
+		return err
+	}
+	baseline, err := decodeOne(positional[0])
+	if err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if name := first(positional[1:]); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	next := deproto.NewDelimitedReader(in).Next
+	if *hexLines {
+		next = hexLineReader(in)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for n := 1; ; n++ {
+		data, err := next()
+		if err == io.EOF {
+			return out.Flush()
+		}
+		if err != nil {
+			out.Flush()
+			err = fmt.Errorf("message %d: %v", n, err)
+			if n > 1 {
+				return partial(err)
+			}
+			return err
+		}
+		fields, err := deproto.DecodeFields(data)
+		if err != nil {
+			fmt.Fprintf(out, "# message %d: %v\n", n, err)
+			out.Flush()
+			continue
+		}
+		diffs := deproto.DiffFields(baseline, fields)
+		if len(diffs) == 0 {
+			fmt.Fprintf(out, "# message %d: unchanged\n", n)
+		} else {
+			fmt.Fprintf(out, "# message %d: %d differences\n", n, len(diffs))
+			printDifferences(out, diffs, colored)
+		}
+		// Flush every message, so the output keeps up with a live stream.
+		out.Flush()
+		if *previous {
+			baseline = fields
+		}
+	}
+}
+
+// hexLineReader returns a function reading one message per non-empty line
+// of hex text from r, returning io.EOF at the end.
+func hexLineReader(r io.Reader) func() ([]byte, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	return func() ([]byte, error) {
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			records, err := deproto.ReadMessages(scanner.Bytes(), deproto.InputHex)
+			if err != nil {
+				return nil, err
+			}
+			return records[0].Data, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
@@ -0,0 +1,129 @@
+package deproto
+
+import "fmt"
+
+// ChangeKind classifies a difference found by CompareSchemas.
+type ChangeKind int
+
+const (
+	ChangeFieldAdded   ChangeKind = iota // Field number only in the new schema
+	ChangeFieldRemoved                   // Field number only in the old schema
+	ChangeFieldRetyped                   // Field type differs
+	ChangeLabelChanged                   // Field label differs
+	ChangeFieldRenamed                   // Field name differs
+)
+
+// String returns a short name for the change kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeFieldAdded:
+		return "added"
+	case ChangeFieldRemoved:
+		return "removed"
+	case ChangeFieldRetyped:
+		return "retyped"
+	case ChangeLabelChanged:
+		return "label-changed"
+	case ChangeFieldRenamed:
+		return "renamed"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// SchemaChange describes one difference between two versions of a message.
+type SchemaChange struct {
+	Kind     ChangeKind
+	Path     FieldPath    // Path of the field from the compared messages
+	Old      *FieldSchema // The field in the old schema, or nil if added
+	New      *FieldSchema // The field in the new schema, or nil if removed
+	Breaking bool         // Old and new peers can no longer read each other's data
+	Detail   string       // Human-readable explanation
+}
+
+// String returns a one-line description of the change.
+func (c SchemaChange) String() string {
+	s := fmt.Sprintf("%s [%s] %s", c.Path, c.Kind, c.Detail)
+	if c.Breaking {
+		s += " (breaking)"
+	}
+	return s
+}
+
+// CompareSchemas reports how a message changed between two schema versions,
+// such as schemas inferred from traffic of two app releases. Fields are
+// matched by number, and nested messages are compared recursively.
+//
+// A change is breaking when the wire type of a field changes, a numeric
+// field switches between singular and repeated (repeated numbers may be
+// packed), or a field becomes required or a required one disappears.
+func CompareSchemas(old, new *MessageSchema) []SchemaChange {
+	return compareMessages(nil, old, new, make(map[[2]*MessageSchema]bool))
+}
+
+func compareMessages(parent FieldPath, old, new *MessageSchema, seen map[[2]*MessageSchema]bool) []SchemaChange {
+	pair := [2]*MessageSchema{old, new}
+	if seen[pair] {
+		return nil
+	}
+	seen[pair] = true
+
+	var changes []SchemaChange
+	for _, a := range old.Fields {
+		path := parent.Append(a.Number)
+		b := new.Field(a.Number)
+		if b == nil {
+			changes = append(changes, SchemaChange{
+				Kind: ChangeFieldRemoved, Path: path, Old: a,
+				Breaking: a.Label == LabelRequired,
+				Detail:   fmt.Sprintf("%s %s %s removed", a.Label, a.Type, a.Name),
+			})
+			continue
+		}
+		changes = append(changes, compareFields(path, a, b, seen)...)
+	}
+	for _, b := range new.Fields {
+		if old.Field(b.Number) == nil {
+			changes = append(changes, SchemaChange{
+				Kind: ChangeFieldAdded, Path: parent.Append(b.Number), New: b,
+				Breaking: b.Label == LabelRequired,
+				Detail:   fmt.Sprintf("%s %s %s added", b.Label, b.Type, b.Name),
+			})
+		}
+	}
+	return changes
+}
+
+func compareFields(path FieldPath, a, b *FieldSchema, seen map[[2]*MessageSchema]bool) []SchemaChange {
+	var changes []SchemaChange
+	change := func(kind ChangeKind, breaking bool, format string, args ...any) {
+		changes = append(changes, SchemaChange{
+			Kind: kind, Path: path, Old: a, New: b,
+			Breaking: breaking, Detail: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if a.Name != b.Name {
+		change(ChangeFieldRenamed, false, "%s renamed to %s", a.Name, b.Name)
+	}
+	if a.Label != b.Label {
+		repeatedChanged := (a.Label == LabelRepeated) != (b.Label == LabelRepeated)
+		breaking := b.Label == LabelRequired || repeatedChanged && (packable(a) || packable(b))
+		change(ChangeLabelChanged, breaking, "%s changed from %s to %s", b.Name, a.Label, b.Label)
+	}
+	switch {
+	case a.Message != nil && b.Message != nil:
+		changes = append(changes, compareMessages(path, a.Message, b.Message, seen)...)
+	case a.Type != b.Type:
+		change(ChangeFieldRetyped, a.WireType() != b.WireType(),
+			"%s changed from %s to %s", b.Name, a.Type, b.Type)
+	}
+	return changes
+}
+
+// packable reports whether a field has a scalar type that may be encoded
+// packed, so that a repeated occurrence is a single length-delimited field.
+func packable(f *FieldSchema) bool {
+	wt, ok := scalarWireTypes[f.Type]
+	return ok && wt != WireBytes || f.Enum != nil
+}
@@ -2,11 +2,7 @@ package deproto
 
 import (
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
-	"math"
-	"strconv"
-	"strings"
 	"unicode"
 )
 
@@ -20,10 +16,22 @@ const (
 	WireFixed32    = 5
 )
 
+// Valid field numbers. Keys outside this range come from corrupt data or
+// from bytes that are not a message at all.
+const (
+	MinFieldNumber = 1
+	MaxFieldNumber = 1<<29 - 1
+)
+
 // Field interface represents a generic protobuf field.
 type Field interface {
 	// Render returns a string representation of the field with the given indentation level.
 	Render(indentLevel int) string
+	// EncodedLen returns the length of the field re-encoded by Encode,
+	// including its tag. Varints are re-encoded in their minimal form, so
+	// a field whose tag, value or length was padded on the wire took more
+	// bytes there.
+	EncodedLen() int
 }
 
 // FieldBase holds common attributes for all fields.
@@ -56,8 +64,12 @@ type VarintField struct {
 
 // Render returns a string representation of the VarintField.
 func (v *VarintField) Render(indentLevel int) string {
-	indent := strings.Repeat("    ", indentLevel)
-	return fmt.Sprintf("%s[%d %s]: %d (0x%x)\n", indent, v.ID, wireTypeString(v.WireType), v.Value, v.Value)
+	return renderField(v, indentLevel)
+}
+
+// EncodedLen returns the encoded size of the VarintField.
+func (v *VarintField) EncodedLen() int {
+	return keyLen(v.ID) + uvarintLen(v.Value)
 }
 
 // Fixed64Field represents a field with fixed64 wire type.
@@ -68,9 +80,12 @@ type Fixed64Field struct {
 
 // Render returns a string representation of the Fixed64Field.
 func (f *Fixed64Field) Render(indentLevel int) string {
-	indent := strings.Repeat("    ", indentLevel)
-	floatValue := math.Float64frombits(f.Value)
-	return fmt.Sprintf("%s[%d %s]: %d (0x%x) (%f)\n", indent, f.ID, wireTypeString(f.WireType), f.Value, f.Value, floatValue)
+	return renderField(f, indentLevel)
+}
+
+// EncodedLen returns the encoded size of the Fixed64Field.
+func (f *Fixed64Field) EncodedLen() int {
+	return keyLen(f.ID) + 8
 }
 
 // Fixed32Field represents a field with fixed32 wire type.
@@ -81,9 +96,12 @@ type Fixed32Field struct {
 
 // Render returns a string representation of the Fixed32Field.
 func (f *Fixed32Field) Render(indentLevel int) string {
-	indent := strings.Repeat("    ", indentLevel)
-	floatValue := math.Float32frombits(f.Value)
-	return fmt.Sprintf("%s[%d %s]: %d (0x%x) (%f)\n", indent, f.ID, wireTypeString(f.WireType), f.Value, f.Value, floatValue)
+	return renderField(f, indentLevel)
+}
+
+// EncodedLen returns the encoded size of the Fixed32Field.
+func (f *Fixed32Field) EncodedLen() int {
+	return keyLen(f.ID) + 4
 }
 
 // LengthDelimitedField represents a field with length-delimited wire type.
@@ -93,39 +111,71 @@ type LengthDelimitedField struct {
 	SubFields   []Field // Nested fields if any
 	IsString    bool    // Indicates if data is a printable string
 	StringValue string  // The string value if data is printable
+
+	// Wrapping is the text encoding, such as "base64" or "hex", of a
+	// message found inside a string field (see DecodeOptions.UnwrapText).
+	// Data holds the text, and SubFields the decoded message.
+	Wrapping string
+
+	// Packed holds the elements when the data is read as a packed repeated
+	// scalar field (see Reinterpret).
+	Packed *Packed
+
+	// EmptyMessage marks an empty payload read as a message without fields
+	// rather than as bytes, as embedded encoders write to mark an optional
+	// message present (see DecodeOptions.Embedded).
+	EmptyMessage bool
+
+	// Padding is the number of NUL bytes following StringValue in the
+	// payload of a string read from a fixed-size buffer (see
+	// DecodeOptions.Embedded). They are written back after it on encoding.
+	Padding int
+
+	lazy *lazyPayload // Set while the payload awaits Expand
+}
+
+// Packed is the payload of a length-delimited field read as a packed
+// repeated scalar field.
+type Packed struct {
+	Type   string   `json:"type"`   // Scalar type of the elements, such as "int64" or "fixed32"
+	Values []uint64 `json:"values"` // Raw element values
 }
 
 // Render returns a string representation of the LengthDelimitedField.
 func (l *LengthDelimitedField) Render(indentLevel int) string {
-	indent := strings.Repeat("    ", indentLevel)
-	var b strings.Builder
-	fmt.Fprintf(&b, "%s[%d %s]: (%d bytes)", indent, l.ID, wireTypeString(l.WireType), len(l.Data))
+	return renderField(l, indentLevel)
+}
 
-	if l.IsString {
-		fmt.Fprintf(&b, " %s\n", strconv.Quote(l.StringValue))
-	} else if len(l.SubFields) > 0 {
-		fmt.Fprintf(&b, "\n")
-		for _, sf := range l.SubFields {
-			b.WriteString(sf.Render(indentLevel + 1))
-		}
-	} else {
-		fmt.Fprintf(&b, " [hex] %s\n", hex.EncodeToString(l.Data))
-	}
-	return b.String()
+// EncodedLen returns the encoded size of the LengthDelimitedField.
+func (l *LengthDelimitedField) EncodedLen() int {
+	n := len(l.payload())
+	return keyLen(l.ID) + uvarintLen(uint64(n)) + n
 }
 
 // DecodeField decodes a single field from the given data.
 func DecodeField(data []byte) (Field, int, error) {
-	var fieldKey uint64
-	var n int
+	return DecodeOptions{}.decodeField(data, 0, nil)
+}
 
-	fieldKey, n = binary.Uvarint(data)
-	if n <= 0 {
-		return nil, 0, fmt.Errorf("failed to read field key varint")
+// decodeField decodes the field at the start of data, which lies at offset
+// in the input, as a child of the field at parent.
+func (o DecodeOptions) decodeField(data []byte, offset int, parent FieldPath) (Field, int, error) {
+	fieldNumber, wireType, n, fieldKey, err := o.Dialect.readTag(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Paths are only needed by these options, and building them for every
+	// field would dominate the allocations of decoding with a Pool.
+	var path FieldPath
+	if o.Trace != nil || o.Logger != nil || o.Lazy || o.UnwrapText || len(o.TypeHints) > 0 || o.FieldFilter != nil {
+		path = parent.Append(fieldNumber)
+	}
+	if o.Trace != nil {
+		o.trace(TraceTag, offset, path, "%s, tag %d bytes", wireTypeString(wireType), n)
+	}
+	if o.Dialect.varintTags() {
+		o.checkVarint("key", fieldKey, n, offset, path)
 	}
-
-	fieldNumber := int(fieldKey >> 3)
-	wireType := int(fieldKey & 0x7)
 
 	fieldBase := FieldBase{
 		ID:       fieldNumber,
@@ -138,8 +188,10 @@ func DecodeField(data []byte) (Field, int, error) {
 		if m <= 0 {
 			return nil, 0, fmt.Errorf("failed to read varint value")
 		}
+		o.checkVarint("value", value, m, offset, path)
 		totalBytesRead := n + m
-		field := &VarintField{
+		field := o.Pool.varint()
+		*field = VarintField{
 			FieldBase: fieldBase,
 			Value:     value,
 		}
@@ -151,7 +203,8 @@ func DecodeField(data []byte) (Field, int, error) {
 		}
 		value := binary.LittleEndian.Uint64(data[n : n+8])
 		totalBytesRead := n + 8
-		field := &Fixed64Field{
+		field := o.Pool.fixed64()
+		*field = Fixed64Field{
 			FieldBase: fieldBase,
 			Value:     value,
 		}
@@ -162,23 +215,26 @@ func DecodeField(data []byte) (Field, int, error) {
 		if m <= 0 {
 			return nil, 0, fmt.Errorf("failed to read length of length-delimited field")
 		}
-		totalBytesRead := n + m + int(length)
-		if len(data) < totalBytesRead {
+		// Compare before converting, as a corrupt length may overflow int.
+		if length > uint64(len(data)-n-m) {
 			return nil, 0, fmt.Errorf("not enough data for length-delimited field")
 		}
+		o.checkVarint("length", length, m, offset, path)
+		totalBytesRead := n + m + int(length)
 		bytesValue := data[n+m : totalBytesRead]
-		field := &LengthDelimitedField{
+		field := o.Pool.length()
+		*field = LengthDelimitedField{
 			FieldBase: fieldBase,
 			Data:      bytesValue,
 		}
-		// Attempt to parse as nested fields
-		subFields, err := DecodeFields(bytesValue)
-		if err == nil && len(subFields) > 0 {
-			field.SubFields = subFields
-		} else if isPrintableString(bytesValue) {
-			field.IsString = true
-			field.StringValue = string(bytesValue)
+		if o.Lazy {
+			// Expanding the payload later reports its warnings directly.
+			lazyOpts := o
+			lazyOpts.pending = nil
+			field.lazy = &lazyPayload{opts: lazyOpts, offset: offset, payloadOffset: offset + n + m, path: path}
+			return field, totalBytesRead, nil
 		}
+		o.readPayload(field, offset, offset+n+m, path)
 		return field, totalBytesRead, nil
 
 	case WireFixed32:
@@ -187,7 +243,8 @@ func DecodeField(data []byte) (Field, int, error) {
 		}
 		value := binary.LittleEndian.Uint32(data[n : n+4])
 		totalBytesRead := n + 4
-		field := &Fixed32Field{
+		field := o.Pool.fixed32()
+		*field = Fixed32Field{
 			FieldBase: fieldBase,
 			Value:     value,
 		}
@@ -200,15 +257,177 @@ func DecodeField(data []byte) (Field, int, error) {
 
 // DecodeFields decodes all fields from the given data.
 func DecodeFields(data []byte) ([]Field, error) {
+	return DecodeOptions{}.Decode(data)
+}
+
+// Decode decodes all fields from the given data, applying the options.
+func (o DecodeOptions) Decode(data []byte) ([]Field, error) {
+	if o.state == nil && o.MaxFields > 0 {
+		o.state = &decodeState{}
+	}
+	if o.Progress != nil {
+		o.progress = &progressState{total: len(data), next: progressStep}
+	}
+	fields, err := o.decode(data, 0, nil)
+	if o.state != nil && o.state.err != nil {
+		return fields, o.state.err
+	}
+	if err == nil && o.Schema != nil {
+		applySchema(fields, o.Schema)
+	}
+	if err == nil && o.Progress != nil {
+		o.Progress(len(data), len(data))
+	}
+	return fields, err
+}
+
+// readPayload decodes the payload of a length-delimited field, whose tag
+// lies at offset and payload at payloadOffset, as a message, string or bytes.
+func (o DecodeOptions) readPayload(field *LengthDelimitedField, offset, payloadOffset int, path FieldPath) {
+	if hint, ok := o.TypeHints[path.String()]; ok {
+		err := o.applyHint(field, hint, payloadOffset, path)
+		if err == nil {
+			o.trace(TraceHint, offset, path, "read as %s by hint", hint)
+			return
+		}
+		o.trace(TraceHint, offset, path, "cannot read as %s: %v", hint, err)
+		o.warn("type hint does not fit", offset, path, "hint", hint.String(), "err", err)
+	}
+	// Empty payloads are valid as every type, so no heuristic can tell
+	// what they hold; they stay bytes, unless embedded encoders are
+	// expected.
+	if len(field.Data) == 0 && o.Embedded && !o.NoNestedMessages {
+		field.EmptyMessage = true
+		o.trace(TraceMessage, offset, path, "0 bytes, empty message")
+		return
+	}
+	if len(field.Data) == 0 {
+		o.trace(TraceBytes, offset, path, "0 bytes, empty")
+		return
+	}
+	// Attempt to parse as nested fields
+	var subFields []Field
+	var err error
+	t := o.tentative()
+	if !o.NoNestedMessages {
+		subFields, err = t.decode(field.Data, payloadOffset, path)
+		if err == nil {
+			if err = o.checkNested(subFields); err != nil {
+				o.warn("payload parses as a message beyond the nested-message limits", offset, path, "reason", err)
+			} else if !o.NoStrings && scalarText(field.Data, subFields) {
+				err = fmt.Errorf("printable text parses only as scalar fields")
+			}
+		}
+	}
+	switch {
+	case err == nil && len(subFields) > 0:
+		o.keep(t)
+		field.SubFields = subFields
+		o.trace(TraceMessage, offset, path, "%d bytes parse as %d fields", len(field.Data), len(subFields))
+	case !o.NoStrings && isPrintableString(field.Data):
+		field.IsString = true
+		field.StringValue = string(field.Data)
+		o.trace(TraceString, offset, path, "%d printable bytes%s", len(field.Data), traceReason(err, o.NoNestedMessages))
+		if o.UnwrapText {
+			o.unwrap(field, path)
+		}
+	case !o.NoStrings && o.Embedded && nulPadding(field.Data) > 0:
+		field.Padding = nulPadding(field.Data)
+		field.IsString = true
+		field.StringValue = string(field.Data[:len(field.Data)-field.Padding])
+		o.trace(TraceString, offset, path, "%d printable bytes padded with %d NUL bytes", len(field.StringValue), field.Padding)
+	default:
+		o.trace(TraceBytes, offset, path, "%d bytes%s", len(field.Data), traceReason(err, o.NoNestedMessages))
+	}
+}
+
+// scalarText reports whether a payload that parses as fields is rather
+// text: printable, with no length-delimited field among them. Words read as
+// keys and values this way, as "hi" reads as field 13 holding 105, while
+// messages of scalars rarely consist of printable bytes only.
+func scalarText(data []byte, fields []Field) bool {
+	for _, f := range fields {
+		if _, ok := f.(*LengthDelimitedField); ok {
+			return false
+		}
+	}
+	return isPrintableString(data)
+}
+
+// nulPadding returns the number of NUL bytes ending data if they follow a
+// printable string, as in a fixed-size buffer, and 0 otherwise.
+func nulPadding(data []byte) int {
+	end := len(data)
+	for end > 0 && data[end-1] == 0 {
+		end--
+	}
+	if end == 0 || end == len(data) || !isPrintableString(data[:end]) {
+		return 0
+	}
+	return len(data) - end
+}
+
+// DefaultMaxNestedFieldNumber is the highest field number a payload may use
+// to be decoded as a nested message when DecodeOptions.MaxNestedFieldNumber
+// is zero. Schemas rarely number fields this high, while random bytes
+// often parse as fields with multi-byte keys and large numbers.
+const DefaultMaxNestedFieldNumber = 1<<16 - 1
+
+// checkNested applies the sanity limits on nested messages to the fields a
+// payload decoded as, returning why they are not a plausible message.
+func (o DecodeOptions) checkNested(fields []Field) error {
+	maxID := 0
+	for _, f := range fields {
+		maxID = max(maxID, fieldBase(f).ID)
+	}
+	return o.checkNestedShape(len(fields), maxID)
+}
+
+// checkNestedShape is checkNested for a payload of count fields numbered at
+// most maxID.
+func (o DecodeOptions) checkNestedShape(count, maxID int) error {
+	if o.MaxNestedFields > 0 && count > o.MaxNestedFields {
+		return fmt.Errorf("%d fields, more than %d", count, o.MaxNestedFields)
+	}
+	limit := o.MaxNestedFieldNumber
+	if limit == 0 {
+		limit = DefaultMaxNestedFieldNumber
+	}
+	if limit >= 0 && maxID > limit {
+		return fmt.Errorf("field number %d above %d", maxID, limit)
+	}
+	return nil
+}
+
+func (o DecodeOptions) decode(data []byte, offset int, parent FieldPath) ([]Field, error) {
 	var fields []Field
 	pos := 0
 	for pos < len(data) {
-		field, n, err := DecodeField(data[pos:])
+		if o.FieldFilter != nil {
+			id, _, _, end, err := fieldExtent(data[pos:], o.Dialect)
+			if err == nil && o.FieldFilter.skip(len(parent), id) {
+				pos += end
+				o.advance(offset + pos)
+				continue
+			}
+		}
+		if o.stopped() {
+			if parent == nil {
+				o.warn("decoding stopped", offset+pos, nil, "err", o.state.err)
+			}
+			return fields, o.state.err
+		}
+		field, n, err := o.decodeField(data[pos:], offset+pos, parent)
 		if err != nil {
+			o.trace(TraceError, offset+pos, parent, "%v", err)
+			if parent == nil {
+				o.warn("input cut short or corrupt", offset+pos, nil, "fields", len(fields), "err", err)
+			}
 			return fields, err
 		}
 		fields = append(fields, field)
 		pos += n
+		o.advance(offset + pos)
 	}
 	return fields, nil
 }
@@ -0,0 +1,67 @@
+package deproto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodedLenIsReEncodedLen(t *testing.T) {
+	// Field 1 holds 1 in a varint padded to three bytes, and field 2 a
+	// string behind a padded length.
+	data := []byte{0x08, 0x81, 0x80, 0x00, 0x12, 0x82, 0x00, 'h', 'i'}
+	fields, err := DecodeFields(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, f := range fields {
+		if got, want := f.EncodedLen(), len(Encode([]Field{f})); got != want {
+			t.Errorf("%s: EncodedLen %d, re-encoded %d bytes", FieldPath{fieldBase(f).ID}, got, want)
+		}
+		total += f.EncodedLen()
+	}
+	if total != 6 {
+		t.Errorf("re-encoded length %d, want 6 of the %d bytes read", total, len(data))
+	}
+}
+
+func TestSetValueBytesClearsInterpretation(t *testing.T) {
+	for _, l := range []*LengthDelimitedField{
+		{FieldBase: FieldBase{1, WireBytes}, SubFields: []Field{&VarintField{FieldBase{1, WireVarint}, 1}}, Wrapping: "base64"},
+		{FieldBase: FieldBase{1, WireBytes}, IsString: true, StringValue: "ab", Padding: 2},
+		{FieldBase: FieldBase{1, WireBytes}, EmptyMessage: true},
+	} {
+		if err := setValueBytes(l, []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(l.payload()); got != "new" {
+			t.Errorf("payload %q after setting it to \"new\"", got)
+		}
+	}
+}
+
+func TestPrintablePayloadsAreStrings(t *testing.T) {
+	for _, tc := range []struct {
+		payload string
+		message bool
+	}{
+		{"ab", false},
+		{"hi", false},
+		{strings.Repeat("x", 299) + "\n", false},
+		{"\x08\x96\x01", true},
+		{"\n\x03abc", true},
+	} {
+		data := NewMessage().Bytes(1, []byte(tc.payload)).Encode()
+		fields, err := DecodeFields(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := fields[0].(*LengthDelimitedField)
+		if message := len(l.SubFields) > 0; message != tc.message || !message && !l.IsString {
+			t.Errorf("%q decoded as %s, want a message: %v", tc.payload, renderField(l, 0), tc.message)
+		}
+		if got := nestedMessage([]byte(tc.payload)); got != tc.message {
+			t.Errorf("%q: nestedMessage = %v, want %v", tc.payload, got, tc.message)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// descriptorTypes maps the field types of google.protobuf.FieldDescriptorProto
+// to schema type names. Messages (11), groups (10) and enums (14) take their
+// type_name instead.
+var descriptorTypes = map[uint64]string{
+	1: "double", 2: "float", 3: "int64", 4: "uint64", 5: "int32",
+	6: "fixed64", 7: "fixed32", 8: "bool", 9: "string", 12: "bytes",
+	13: "uint32", 15: "sfixed32", 16: "sfixed64", 17: "sint32", 18: "sint64",
+}
+
+// descriptorFile is one file of a descriptor set.
+type descriptorFile struct {
+	name   string
+	deps   []string
+	schema *Schema
+}
+
+// AddDescriptorSet registers the files of a serialized
+// google.protobuf.FileDescriptorSet, as written by protoc
+// --descriptor_set_out, and returns their schemas in set order. Files are
+// added after the files of the set they import, whatever order the set
+// holds them in; files it imports but does not hold are loaded with
+// LoadFile, so a set built without --include_imports still resolves against
+// the embedded well-known types. Options other than packed are ignored.
+func (r *Registry) AddDescriptorSet(data []byte) ([]*Schema, error) {
+	files, err := parseDescriptorSet(data)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for i, f := range files {
+		index[f.name] = i
+	}
+	schemas := make([]*Schema, len(files))
+	visiting := make(map[string]bool)
+	var add func(i int) error
+	add = func(i int) error {
+		f := files[i]
+		if schemas[i] != nil {
+			return nil
+		}
+		if visiting[f.name] {
+			return fmt.Errorf("%s: import cycle", f.name)
+		}
+		visiting[f.name] = true
+		for _, dep := range f.deps {
+			if j, ok := index[dep]; ok {
+				if err := add(j); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, ok := r.files[dep]; ok {
+				continue
+			}
+			if _, err := r.LoadFile(dep); err != nil {
+				return fmt.Errorf("%s: %v", f.name, err)
+			}
+		}
+		if err := r.AddSchema(f.schema); err != nil {
+			return fmt.Errorf("%s: %v", f.name, err)
+		}
+		// Type names are fully qualified, with a leading dot that .proto
+		// source leaves out; once resolved, drop it for display.
+		f.schema.eachMessage(func(m *MessageSchema) {
+			for _, field := range m.Fields {
+				field.Type = strings.TrimPrefix(field.Type, ".")
+			}
+		})
+		r.files[f.name] = f.schema
+		schemas[i] = f.schema
+		return nil
+	}
+	for i := range files {
+		if err := add(i); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// descriptorFields decodes one descriptor message without looking into its
+// length-delimited fields.
+func descriptorFields(data []byte) ([]Field, error) {
+	return DecodeOptions{NoNestedMessages: true}.Decode(data)
+}
+
+func parseDescriptorSet(data []byte) ([]descriptorFile, error) {
+	fields, err := descriptorFields(data)
+	if err != nil {
+		return nil, fmt.Errorf("not a descriptor set: %v", err)
+	}
+	var files []descriptorFile
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok || l.ID != 1 {
+			return nil, fmt.Errorf("not a descriptor set: unexpected field %d", fieldBase(f).ID)
+		}
+		file, err := parseFileDescriptor(l.Data)
+		if err != nil {
+			return nil, fmt.Errorf("file %d of descriptor set: %v", len(files)+1, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func parseFileDescriptor(data []byte) (descriptorFile, error) {
+	fields, err := descriptorFields(data)
+	if err != nil {
+		return descriptorFile{}, err
+	}
+	file := descriptorFile{schema: &Schema{Syntax: "proto2"}}
+	var messages, enums [][]byte
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			continue
+		}
+		switch l.ID {
+		case 1:
+			file.name = string(l.Data)
+		case 2:
+			file.schema.Package = string(l.Data)
+		case 3:
+			file.deps = append(file.deps, string(l.Data))
+		case 4:
+			messages = append(messages, l.Data)
+		case 5:
+			enums = append(enums, l.Data)
+		case 12:
+			switch syntax := string(l.Data); syntax {
+			case "proto2", "proto3":
+				file.schema.Syntax = syntax
+			case "editions":
+				file.schema.Syntax = editionsSyntax
+			}
+		}
+	}
+	if file.name == "" {
+		return descriptorFile{}, fmt.Errorf("file without a name")
+	}
+	for _, m := range messages {
+		message, err := parseMessageDescriptor(m, file.schema.Syntax)
+		if err != nil {
+			return descriptorFile{}, fmt.Errorf("%s: %v", file.name, err)
+		}
+		file.schema.Messages = append(file.schema.Messages, message)
+	}
+	for _, e := range enums {
+		enum, err := parseEnumDescriptor(e)
+		if err != nil {
+			return descriptorFile{}, fmt.Errorf("%s: %v", file.name, err)
+		}
+		file.schema.Enums = append(file.schema.Enums, enum)
+	}
+	return file, nil
+}
+
+func parseMessageDescriptor(data []byte, syntax string) (*MessageSchema, error) {
+	fields, err := descriptorFields(data)
+	if err != nil {
+		return nil, err
+	}
+	m := &MessageSchema{}
+	var oneofs []string
+	var fieldData [][]byte
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			continue
+		}
+		switch l.ID {
+		case 1:
+			m.Name = string(l.Data)
+		case 2:
+			fieldData = append(fieldData, l.Data)
+		case 3:
+			nested, err := parseMessageDescriptor(l.Data, syntax)
+			if err != nil {
+				return nil, err
+			}
+			m.Nested = append(m.Nested, nested)
+		case 4:
+			enum, err := parseEnumDescriptor(l.Data)
+			if err != nil {
+				return nil, err
+			}
+			m.Enums = append(m.Enums, enum)
+		case 8:
+			oneof, err := descriptorFields(l.Data)
+			if err != nil {
+				return nil, err
+			}
+			name := ""
+			for _, f := range oneof {
+				if l, ok := f.(*LengthDelimitedField); ok && l.ID == 1 {
+					name = string(l.Data)
+				}
+			}
+			oneofs = append(oneofs, name)
+		}
+	}
+	for _, d := range fieldData {
+		field, err := parseFieldDescriptor(d, syntax, oneofs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", m.Name, err)
+		}
+		m.Fields = append(m.Fields, field)
+	}
+	return m, nil
+}
+
+func parseFieldDescriptor(data []byte, syntax string, oneofs []string) (*FieldSchema, error) {
+	fields, err := descriptorFields(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &FieldSchema{}
+	var typ uint64
+	oneof, packed := -1, -1
+	synthetic := false
+	for _, field := range fields {
+		switch v := field.(type) {
+		case *VarintField:
+			switch v.ID {
+			case 3:
+				f.Number = int(v.Value)
+			case 4:
+				switch v.Value {
+				case 2:
+					f.Label = LabelRequired
+				case 3:
+					f.Label = LabelRepeated
+				}
+			case 5:
+				typ = v.Value
+			case 9:
+				oneof = int(v.Value)
+			case 17:
+				synthetic = v.Value != 0
+			}
+		case *LengthDelimitedField:
+			switch v.ID {
+			case 1:
+				f.Name = string(v.Data)
+			case 6:
+				f.Type = string(v.Data)
+			case 8:
+				options, err := descriptorFields(v.Data)
+				if err != nil {
+					return nil, err
+				}
+				for _, o := range options {
+					if o, ok := o.(*VarintField); ok && o.ID == 2 {
+						packed = int(o.Value)
+					}
+				}
+			}
+		}
+	}
+	if name, ok := descriptorTypes[typ]; ok {
+		f.Type = name
+	} else if f.Type == "" {
+		return nil, fmt.Errorf("field %s: unsupported type %d", f.Name, typ)
+	}
+	if typ == 10 {
+		f.Comment = "group"
+	}
+	if oneof >= 0 && oneof < len(oneofs) && !synthetic {
+		f.Oneof = oneofs[oneof]
+	}
+	f.Proto3Optional = synthetic
+	_, scalar := descriptorTypes[typ]
+	numeric := (scalar || typ == 14) && typ != 9 && typ != 12
+	if packed < 0 {
+		// Unset: proto3 packs repeated numbers by default.
+		packed = 0
+		if syntax == "proto3" {
+			packed = 1
+		}
+	}
+	f.Packed = packed != 0 && f.Label == LabelRepeated && numeric
+	return f, nil
+}
+
+func parseEnumDescriptor(data []byte) (*EnumSchema, error) {
+	fields, err := descriptorFields(data)
+	if err != nil {
+		return nil, err
+	}
+	e := &EnumSchema{}
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			continue
+		}
+		switch l.ID {
+		case 1:
+			e.Name = string(l.Data)
+		case 2:
+			value, err := descriptorFields(l.Data)
+			if err != nil {
+				return nil, err
+			}
+			var v EnumValue
+			for _, f := range value {
+				switch f := f.(type) {
+				case *LengthDelimitedField:
+					if f.ID == 1 {
+						v.Name = string(f.Data)
+					}
+				case *VarintField:
+					if f.ID == 2 {
+						v.Number = int32(f.Value)
+					}
+				}
+			}
+			e.Values = append(e.Values, v)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,49 @@
+package deproto_test
+
+import (
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestAddDescriptorSetOutOfOrder(t *testing.T) {
+	// b.proto imports a.proto but comes first in the set.
+	b := deproto.NewMessage().
+		String(1, "b.proto").
+		String(2, "b").
+		String(3, "a.proto").
+		Message(4, deproto.NewMessage().
+			String(1, "Outer").
+			Message(2, deproto.NewMessage().
+				String(1, "inner").
+				Varint(3, 1).
+				Varint(4, 1).
+				Varint(5, 11).
+				String(6, ".a.Inner")))
+	a := deproto.NewMessage().
+		String(1, "a.proto").
+		String(2, "a").
+		Message(4, deproto.NewMessage().String(1, "Inner"))
+	set := deproto.NewMessage().Message(1, b).Message(1, a).Encode()
+
+	r := deproto.NewRegistry()
+	schemas, err := r.AddDescriptorSet(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 2 || schemas[0].Package != "b" || schemas[1].Package != "a" {
+		t.Fatalf("schemas %v, want b then a", schemas)
+	}
+	outer := r.Message("b.Outer")
+	if outer == nil || outer.Fields[0].Message != r.Message("a.Inner") {
+		t.Errorf("b.Outer.inner not linked to a.Inner")
+	}
+
+	cycle := deproto.NewMessage().
+		Message(1, deproto.NewMessage().String(1, "x.proto").String(3, "y.proto")).
+		Message(1, deproto.NewMessage().String(1, "y.proto").String(3, "x.proto")).
+		Encode()
+	if _, err := deproto.NewRegistry().AddDescriptorSet(cycle); err == nil {
+		t.Error("import cycle accepted")
+	}
+}
@@ -0,0 +1,286 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes a protobuf-like wire format that differs from protobuf
+// in its tags: their size, the number of bits holding the wire type, or
+// the numbering of wire types. Values, lengths and payloads are encoded as
+// in protobuf, and decoded fields carry the standard wire types. A nil
+// *Dialect is protobuf itself.
+type Dialect struct {
+	// TagBytes is the size of a tag when tags are fixed-size integers, from
+	// 1 to 4; 0 for varint tags.
+	TagBytes int
+
+	// BigEndian reads fixed-size tags most significant byte first.
+	BigEndian bool
+
+	// WireTypeBits is the number of low bits of a tag holding the wire
+	// type, from 1 to 8; 0 for the standard 3.
+	WireTypeBits int
+
+	// WireTypes maps wire type numbers of the dialect to the standard ones,
+	// WireVarint, WireFixed64, WireBytes and WireFixed32, where they differ.
+	// A number missing from the map stands for the same standard type.
+	WireTypes map[int]int
+}
+
+// wireTypeNames are the names of the standard wire types in dialect specs.
+var wireTypeNames = map[string]int{
+	"varint":  WireVarint,
+	"fixed64": WireFixed64,
+	"bytes":   WireBytes,
+	"fixed32": WireFixed32,
+}
+
+// ParseDialect parses a dialect from a comma-separated list of settings:
+// "tag=N" for fixed-size tags of N bytes, "big-endian", "wire-bits=N", and
+// "wire=D:S" for each dialect wire type D standing for standard type S,
+// given by number or as varint, fixed64, bytes or fixed32. For example,
+// "tag=2,big-endian,wire=6:bytes" reads 2-byte big-endian tags in which
+// wire type 6 marks length-delimited fields.
+func ParseDialect(spec string) (*Dialect, error) {
+	d := &Dialect{}
+	for _, setting := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+		var err error
+		switch name {
+		case "tag":
+			d.TagBytes, err = strconv.Atoi(value)
+		case "big-endian":
+			d.BigEndian = true
+		case "wire-bits":
+			d.WireTypeBits, err = strconv.Atoi(value)
+		case "wire":
+			from, to, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("dialect setting %q: want wire=D:S", setting)
+			}
+			var d1, s int
+			if d1, err = strconv.Atoi(from); err != nil {
+				break
+			}
+			if s, ok = wireTypeNames[to]; !ok {
+				s, err = strconv.Atoi(to)
+			}
+			if d.WireTypes == nil {
+				d.WireTypes = make(map[int]int)
+			}
+			d.WireTypes[d1] = s
+		default:
+			return nil, fmt.Errorf("unknown dialect setting %q", setting)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dialect setting %q: %v", setting, err)
+		}
+	}
+	return d, d.check()
+}
+
+// check validates the dialect.
+func (d *Dialect) check() error {
+	if d.TagBytes < 0 || d.TagBytes > 4 {
+		return fmt.Errorf("dialect tag size %d: want 1 to 4 bytes, or 0 for varints", d.TagBytes)
+	}
+	if d.WireTypeBits < 0 || d.WireTypeBits > 8 {
+		return fmt.Errorf("dialect wire type bits %d: want 1 to 8, or 0 for 3", d.WireTypeBits)
+	}
+	if d.TagBytes > 0 && d.TagBytes*8 <= d.bits() {
+		return fmt.Errorf("dialect tags of %d bytes leave no bits for the field number", d.TagBytes)
+	}
+	for from, to := range d.WireTypes {
+		if from < 0 || from >= 1<<d.bits() {
+			return fmt.Errorf("dialect wire type %d does not fit in %d bits", from, d.bits())
+		}
+		switch to {
+		case WireVarint, WireFixed64, WireBytes, WireFixed32:
+		default:
+			return fmt.Errorf("dialect wire type %d: %d is not a standard wire type", from, to)
+		}
+	}
+	return nil
+}
+
+// String returns the dialect in the form ParseDialect reads.
+func (d *Dialect) String() string {
+	if d == nil {
+		return "protobuf"
+	}
+	var settings []string
+	if d.TagBytes > 0 {
+		settings = append(settings, fmt.Sprintf("tag=%d", d.TagBytes))
+	}
+	if d.BigEndian {
+		settings = append(settings, "big-endian")
+	}
+	if d.WireTypeBits > 0 {
+		settings = append(settings, fmt.Sprintf("wire-bits=%d", d.WireTypeBits))
+	}
+	for _, from := range slices.Sorted(maps.Keys(d.WireTypes)) {
+		settings = append(settings, fmt.Sprintf("wire=%d:%s", from, wireTypeName(d.WireTypes[from])))
+	}
+	return strings.Join(settings, ",")
+}
+
+// wireTypeName returns the name of a standard wire type in dialect specs.
+func wireTypeName(wireType int) string {
+	for name, t := range wireTypeNames {
+		if t == wireType {
+			return name
+		}
+	}
+	return strconv.Itoa(wireType)
+}
+
+// bits returns the number of bits of a tag holding the wire type.
+func (d *Dialect) bits() int {
+	if d == nil || d.WireTypeBits == 0 {
+		return 3
+	}
+	return d.WireTypeBits
+}
+
+// varintTags reports whether tags are varints.
+func (d *Dialect) varintTags() bool {
+	return d == nil || d.TagBytes == 0
+}
+
+// readTag reads the tag at the start of data, returning the field number,
+// the standard wire type and the size of the tag. For varint tags, key is
+// the varint read.
+func (d *Dialect) readTag(data []byte) (id, wireType, n int, key uint64, err error) {
+	if d.varintTags() {
+		key, n = binary.Uvarint(data)
+		if n <= 0 {
+			return 0, 0, 0, 0, fmt.Errorf("failed to read field key varint")
+		}
+	} else {
+		if len(data) < d.TagBytes {
+			return 0, 0, 0, 0, fmt.Errorf("not enough data for %d-byte tag", d.TagBytes)
+		}
+		for i := range d.TagBytes {
+			if d.BigEndian {
+				key = key<<8 | uint64(data[i])
+			} else {
+				key |= uint64(data[i]) << (8 * i)
+			}
+		}
+		n = d.TagBytes
+	}
+	// The number is checked before it is converted to int, which could
+	// overflow.
+	if number := key >> d.bits(); number < MinFieldNumber || number > MaxFieldNumber {
+		return 0, 0, 0, 0, fmt.Errorf("invalid field number %d", number)
+	}
+	wireType = int(key & (1<<d.bits() - 1))
+	if d != nil {
+		if standard, ok := d.WireTypes[wireType]; ok {
+			wireType = standard
+		}
+	}
+	return int(key >> d.bits()), wireType, n, key, nil
+}
+
+// appendTag appends the tag of a field of the given number and standard
+// wire type, or fails if the number or the wire type does not fit in the
+// dialect's tags.
+func (d *Dialect) appendTag(b []byte, id, wireType int) ([]byte, error) {
+	if d == nil {
+		return appendKey(b, id, wireType), nil
+	}
+	key, err := d.key(id, wireType)
+	if err != nil {
+		return nil, err
+	}
+	if d.varintTags() {
+		return binary.AppendUvarint(b, key), nil
+	}
+	for i := range d.TagBytes {
+		if d.BigEndian {
+			b = append(b, byte(key>>(8*(d.TagBytes-1-i))))
+		} else {
+			b = append(b, byte(key>>(8*i)))
+		}
+	}
+	return b, nil
+}
+
+// key returns the tag of a field of the given number and standard wire
+// type as a number.
+func (d *Dialect) key(id, wireType int) (uint64, error) {
+	t := d.dialectWireType(wireType)
+	if t >= 1<<d.bits() {
+		return 0, fmt.Errorf("field %d: %s wire type %d does not fit in the dialect's %d bits", id, wireTypeName(wireType), t, d.bits())
+	}
+	key := uint64(id)<<d.bits() | uint64(t)
+	if !d.varintTags() && key >= 1<<(8*d.TagBytes) {
+		return 0, fmt.Errorf("field %d does not fit in the dialect's %d-byte tags", id, d.TagBytes)
+	}
+	return key, nil
+}
+
+// tagLen returns the size of the tag appendTag writes, or of a protobuf key
+// if d is nil.
+func (d *Dialect) tagLen(id, wireType int) int {
+	switch {
+	case d == nil:
+		return keyLen(id)
+	case d.varintTags():
+		return uvarintLen(uint64(id)<<d.bits() | uint64(d.dialectWireType(wireType)))
+	default:
+		return d.TagBytes
+	}
+}
+
+// dialectWireType returns the number of a standard wire type in the
+// dialect.
+func (d *Dialect) dialectWireType(wireType int) int {
+	for _, from := range slices.Sorted(maps.Keys(d.WireTypes)) {
+		if d.WireTypes[from] == wireType {
+			return from
+		}
+	}
+	return wireType
+}
+
+// appendField appends the encoding of a field other than a nested message
+// in the dialect.
+func (d *Dialect) appendField(b []byte, f Field) ([]byte, error) {
+	if d == nil {
+		return AppendField(b, f), nil
+	}
+	var err error
+	switch v := f.(type) {
+	case *VarintField:
+		if b, err = d.appendTag(b, v.ID, WireVarint); err != nil {
+			return nil, err
+		}
+		return binary.AppendUvarint(b, v.Value), nil
+	case *Fixed64Field:
+		if b, err = d.appendTag(b, v.ID, WireFixed64); err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(b, v.Value), nil
+	case *Fixed32Field:
+		if b, err = d.appendTag(b, v.ID, WireFixed32); err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(b, v.Value), nil
+	case *LengthDelimitedField:
+		payload := v.payload()
+		if b, err = d.appendTag(b, v.ID, WireBytes); err != nil {
+			return nil, err
+		}
+		b = binary.AppendUvarint(b, uint64(len(payload)))
+		return append(b, payload...), nil
+	default:
+		return b, nil
+	}
+}
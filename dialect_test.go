@@ -0,0 +1,73 @@
+package deproto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDialectRoundTrip(t *testing.T) {
+	inner := []Field{
+		&VarintField{FieldBase{1, WireVarint}, 150},
+		&LengthDelimitedField{FieldBase: FieldBase{2, WireBytes}, Data: []byte("hello world")},
+	}
+	fields := []Field{
+		&VarintField{FieldBase{3, WireVarint}, 7},
+		&Fixed32Field{FieldBase{4, WireFixed32}, 9},
+		&LengthDelimitedField{FieldBase: FieldBase{5, WireBytes}, SubFields: inner},
+		&Fixed64Field{FieldBase{300, WireFixed64}, 1},
+	}
+	for _, spec := range []string{"tag=2,big-endian,wire=6:bytes", "tag=2", "wire-bits=4,wire=9:fixed32", "tag=3,wire-bits=2,wire=3:fixed32"} {
+		d, err := ParseDialect(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if spec == "tag=3,wire-bits=2,wire=3:fixed32" {
+			// Fixed64 has no number in two bits.
+			fields = fields[:3]
+		}
+		opts := EncodeOptions{Dialect: d}
+		data, err := opts.Encode(fields)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if size := opts.Size(fields); size != len(data) {
+			t.Errorf("%s: Size returned %d, want the %d bytes encoded", spec, size, len(data))
+		}
+		got, err := DecodeOptions{Dialect: d}.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		again, err := opts.Encode(got)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("%s: re-encoded %x, want %x", spec, again, data)
+		}
+		if len(got) != len(fields) || len(got[2].(*LengthDelimitedField).SubFields) != 2 {
+			t.Errorf("%s: decoded %v", spec, got)
+		}
+		if size := (&renderer{opts: RenderOptions{Dialect: d}}).size(got...); size != len(data) {
+			t.Errorf("%s: rendered size %d, want %d", spec, size, len(data))
+		}
+	}
+}
+
+func TestDialectEncodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		spec  string
+		field Field
+	}{
+		{"wire-bits=1", &Fixed32Field{FieldBase{1, WireFixed32}, 1}},
+		{"wire-bits=2", &LengthDelimitedField{FieldBase: FieldBase{1, WireBytes}, SubFields: []Field{&Fixed32Field{FieldBase{1, WireFixed32}, 1}}}},
+		{"tag=1", &VarintField{FieldBase{32, WireVarint}, 1}},
+	} {
+		d, err := ParseDialect(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if data, err := (EncodeOptions{Dialect: d}).Encode([]Field{tc.field}); err == nil {
+			t.Errorf("%s: encoded %v as %x, want an error", tc.spec, tc.field, data)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package deproto
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// DiffKind classifies a difference found by DiffFields.
+type DiffKind int
+
+const (
+	DiffAdded   DiffKind = iota // Field only in the new message
+	DiffRemoved                 // Field only in the old message
+	DiffChanged                 // Field in both messages with another value
+)
+
+// String returns a short name for the difference kind.
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// Difference describes one field that differs between two messages.
+type Difference struct {
+	Kind  DiffKind
+	Path  FieldPath
+	Index int   // Which occurrence of a repeated field, counting from 0
+	Old   Field // The field in the old message, or nil if added
+	New   Field // The field in the new message, or nil if removed
+}
+
+// String returns a one-line description of the difference.
+func (d Difference) String() string {
+	path := d.Path.String()
+	if d.Index > 0 {
+		path += "[" + strconv.Itoa(d.Index) + "]"
+	}
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s [added] %s", path, DescribeValue(d.New))
+	case DiffRemoved:
+		return fmt.Sprintf("%s [removed] %s", path, DescribeValue(d.Old))
+	default:
+		return fmt.Sprintf("%s [%s] %s -> %s", path, d.Kind, DescribeValue(d.Old), DescribeValue(d.New))
+	}
+}
+
+// DiffFields reports the fields that differ between two decoded messages.
+// Fields are matched by number, occurrence by occurrence, and nested
+// messages are compared recursively, so a change deep in a message is
+// reported at its own path. Differences are ordered by field number.
+func DiffFields(old, new []Field) []Difference {
+	return diffFields(nil, old, new, nil)
+}
+
+func diffFields(parent FieldPath, old, new []Field, diffs []Difference) []Difference {
+	oldByID, newByID := groupByID(old), groupByID(new)
+	for _, id := range unionIDs(oldByID, newByID) {
+		path := parent.Append(id)
+		olds, news := oldByID[id], newByID[id]
+		for i := range max(len(olds), len(news)) {
+			switch {
+			case i >= len(olds):
+				diffs = append(diffs, Difference{Kind: DiffAdded, Path: path, Index: i, New: news[i]})
+			case i >= len(news):
+				diffs = append(diffs, Difference{Kind: DiffRemoved, Path: path, Index: i, Old: olds[i]})
+			default:
+				o, oMsg := olds[i].(*LengthDelimitedField)
+				n, nMsg := news[i].(*LengthDelimitedField)
+				if oMsg && nMsg && len(o.SubFields) > 0 && len(n.SubFields) > 0 {
+					diffs = diffFields(path, o.SubFields, n.SubFields, diffs)
+				} else if DescribeValue(olds[i]) != DescribeValue(news[i]) {
+					diffs = append(diffs, Difference{Kind: DiffChanged, Path: path, Index: i, Old: olds[i], New: news[i]})
+				}
+			}
+		}
+	}
+	return diffs
+}
+
+// groupByID groups fields by number, keeping the order of occurrences.
+func groupByID(fields []Field) map[int][]Field {
+	groups := make(map[int][]Field)
+	for _, f := range fields {
+		if base := fieldBase(f); base != nil {
+			groups[base.ID] = append(groups[base.ID], f)
+		}
+	}
+	return groups
+}
+
+// unionIDs returns the field numbers of either group in ascending order.
+func unionIDs(a, b map[int][]Field) []int {
+	ids := make([]int, 0, len(a)+len(b))
+	for id := range a {
+		ids = append(ids, id)
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// DescribeValue describes the wire type and value of a field as RenderStable
+// shows them, such as `varint 150` or `string "hello"`. A nested message is
+// described by its number of fields.
+func DescribeValue(f Field) string {
+	switch v := f.(type) {
+	case *VarintField:
+		return fmt.Sprintf("varint %d", v.Value)
+	case *Fixed64Field:
+		return fmt.Sprintf("fixed64 0x%016x", v.Value)
+	case *Fixed32Field:
+		return fmt.Sprintf("fixed32 0x%08x", v.Value)
+	case *LengthDelimitedField:
+		switch {
+		case len(v.SubFields) > 0:
+			return fmt.Sprintf("message (%d fields)", len(v.SubFields))
+		case v.EmptyMessage:
+			return "message (empty)"
+		case v.IsString && v.Padding > 0:
+			return fmt.Sprintf("string %s (padded with %d NUL bytes)", strconv.QuoteToASCII(v.StringValue), v.Padding)
+		case v.IsString:
+			return "string " + strconv.QuoteToASCII(v.StringValue)
+		case v.Packed != nil:
+			return fmt.Sprintf("packed %s %v", v.Packed.Type, v.Packed.Values)
+		case len(v.Data) == 0:
+			return "bytes (empty)"
+		default:
+			return fmt.Sprintf("bytes %x", v.Data)
+		}
+	default:
+		return ""
+	}
+}
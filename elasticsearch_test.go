@@ -0,0 +1,76 @@
+package deproto
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestElasticsearchFlushRetries(t *testing.T) {
+	elasticsearchBackoff = time.Millisecond
+	defer func() { elasticsearchBackoff = 500 * time.Millisecond }()
+
+	var bodies [][]byte
+	statuses := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		status := http.StatusInternalServerError
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, `{"errors":false,"items":[]}`)
+	}))
+	defer srv.Close()
+
+	e := &ElasticsearchExporter{URL: srv.URL, Index: "test"}
+	if err := e.Export(&Record{Name: "message 1", Data: []byte{0x08, 0x01}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush after two busy answers: %v", err)
+	}
+	if len(bodies) != 3 || !bytes.Equal(bodies[0], bodies[2]) {
+		t.Fatalf("sent %d bulk requests, want the batch 3 times", len(bodies))
+	}
+	if e.pending != 0 || e.body.Len() != 0 {
+		t.Errorf("batch of %d documents still pending after it was taken", e.pending)
+	}
+
+	// A cluster that keeps failing leaves the batch pending.
+	bodies = nil
+	if err := e.Export(&Record{Name: "message 2", Data: []byte{0x08, 0x02}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(); err == nil {
+		t.Fatal("Flush succeeded against a failing cluster")
+	}
+	if len(bodies) != bulkAttempts {
+		t.Errorf("sent %d bulk requests, want %d", len(bodies), bulkAttempts)
+	}
+	if e.pending != 1 || !bytes.Equal(e.body.Bytes(), bodies[0]) {
+		t.Errorf("batch not kept after a failed Flush: %d documents pending", e.pending)
+	}
+}
+
+func TestElasticsearchFlushKeepsNothingRejected(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.WriteString(w, `{"errors":true,"items":[{"index":{"error":{"type":"mapper_parsing_exception"}}}]}`)
+	}))
+	defer srv.Close()
+
+	e := &ElasticsearchExporter{URL: srv.URL, Index: "test"}
+	e.Export(&Record{Name: "message 1", Data: []byte{0x08, 0x01}})
+	if err := e.Flush(); err == nil {
+		t.Fatal("Flush hid a rejected document")
+	}
+	if requests != 1 || e.pending != 0 {
+		t.Errorf("%d requests and %d documents pending, want a rejected batch sent once and dropped", requests, e.pending)
+	}
+}
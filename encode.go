@@ -0,0 +1,319 @@
+package deproto
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"slices"
+	"sort"
+)
+
+// Encode serializes fields back into protobuf wire format.
+//
+// A LengthDelimitedField is encoded from its SubFields when it has any, so
+// edits to the nested tree are reflected; otherwise its StringValue is used
+// for strings and Data for everything else.
+func Encode(fields []Field) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = AppendField(b, f)
+	}
+	return b
+}
+
+// AppendField appends the wire encoding of a single field to b.
+func AppendField(b []byte, f Field) []byte {
+	switch v := f.(type) {
+	case *VarintField:
+		b = appendKey(b, v.ID, WireVarint)
+		return binary.AppendUvarint(b, v.Value)
+	case *Fixed64Field:
+		b = appendKey(b, v.ID, WireFixed64)
+		return binary.LittleEndian.AppendUint64(b, v.Value)
+	case *Fixed32Field:
+		b = appendKey(b, v.ID, WireFixed32)
+		return binary.LittleEndian.AppendUint32(b, v.Value)
+	case *LengthDelimitedField:
+		payload := v.payload()
+		b = appendKey(b, v.ID, WireBytes)
+		b = binary.AppendUvarint(b, uint64(len(payload)))
+		return append(b, payload...)
+	default:
+		return b
+	}
+}
+
+// payload returns the bytes a LengthDelimitedField encodes to.
+func (l *LengthDelimitedField) payload() []byte {
+	switch {
+	case len(l.SubFields) > 0 && l.Wrapping != "":
+		return wrapText(Encode(l.SubFields), l.Wrapping)
+	case len(l.SubFields) > 0:
+		return Encode(l.SubFields)
+	case l.IsString && l.Padding > 0:
+		return append([]byte(l.StringValue), make([]byte, l.Padding)...)
+	case l.IsString:
+		return []byte(l.StringValue)
+	case l.Packed != nil:
+		return l.Packed.encode()
+	default:
+		return l.Data
+	}
+}
+
+func appendKey(b []byte, id, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(id)<<3|uint64(wireType))
+}
+
+// Size returns the total encoded size of fields.
+func Size(fields []Field) int {
+	n := 0
+	for _, f := range fields {
+		n += f.EncodedLen()
+	}
+	return n
+}
+
+// EstimateSize returns the number of bytes Encode produces for fields,
+// worked out from their values without encoding them. Size measures nested
+// messages by encoding them, so EstimateSize is the one to call after every
+// edit of a large tree, as when fitting a crafted payload to a length limit.
+func EstimateSize(fields []Field) int {
+	return estimateSize(fields, nil)
+}
+
+// estimateSize returns the encoded size of fields with the tags of a
+// dialect, or protobuf's if it is nil.
+func estimateSize(fields []Field, d *Dialect) int {
+	n := 0
+	for _, f := range fields {
+		switch v := f.(type) {
+		case *VarintField:
+			n += d.tagLen(v.ID, WireVarint) + uvarintLen(v.Value)
+		case *Fixed64Field:
+			n += d.tagLen(v.ID, WireFixed64) + 8
+		case *Fixed32Field:
+			n += d.tagLen(v.ID, WireFixed32) + 4
+		case *LengthDelimitedField:
+			size := payloadSize(v, d)
+			n += d.tagLen(v.ID, WireBytes) + uvarintLen(uint64(size)) + size
+		}
+	}
+	return n
+}
+
+// payloadSize returns the length of the payload of a LengthDelimitedField,
+// as payload would return it, with nested messages in a dialect if it is
+// not nil.
+func payloadSize(l *LengthDelimitedField, d *Dialect) int {
+	switch {
+	case len(l.SubFields) > 0 && l.Wrapping != "":
+		return wrappedLen(estimateSize(l.SubFields, d), l.Wrapping)
+	case len(l.SubFields) > 0:
+		return estimateSize(l.SubFields, d)
+	case l.IsString:
+		return len(l.StringValue) + l.Padding
+	case l.Packed != nil:
+		return l.Packed.size()
+	default:
+		return len(l.Data)
+	}
+}
+
+// keyLen returns the encoded size of a field key.
+func keyLen(id int) int {
+	return uvarintLen(uint64(id) << 3)
+}
+
+// uvarintLen returns the number of bytes needed to encode v as a varint.
+func uvarintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// syncData recomputes the Data of every length-delimited field holding a
+// nested message, so that it matches SubFields after the tree was edited.
+func syncData(fields []Field) {
+	for _, f := range fields {
+		if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+			syncData(l.SubFields)
+			l.Data = l.payload()
+		}
+	}
+}
+
+// EncodeOptions control Encode beyond plain re-serialization. Varints are
+// always written in their minimal form.
+type EncodeOptions struct {
+	// Canonical writes the fields of every message ordered by number,
+	// keeping the order of a repeated field's occurrences, so that equal
+	// trees encode to equal bytes whatever order their fields were decoded
+	// or edited in: for reproducible fixtures, and for payloads that are
+	// signed or hashed.
+	Canonical bool
+
+	// Schema, if set, identifies the map fields of the message, whose
+	// entries Canonical orders by key, and the fields declared as bytes or
+	// strings, whose payloads are written as read even when they decode as
+	// messages. Without it, every payload decoded as a message is ordered
+	// as one, and maps cannot be told from repeated messages and keep their
+	// order.
+	Schema *MessageSchema
+
+	// Dialect, if set, writes tags in a protobuf-like format with its own
+	// tag size or wire type numbering, the inverse of
+	// DecodeOptions.Dialect.
+	Dialect *Dialect
+}
+
+// Encode serializes fields into protobuf wire format, applying the
+// options. It fails if a field cannot be written in the dialect.
+func (o EncodeOptions) Encode(fields []Field) ([]byte, error) {
+	if !o.Canonical && o.Dialect == nil {
+		return Encode(fields), nil
+	}
+	return o.appendFields(nil, fields, o.Schema)
+}
+
+// Size returns the number of bytes Encode produces for fields, worked out
+// from their values as EstimateSize does, with the tags of the dialect.
+func (o EncodeOptions) Size(fields []Field) int {
+	return estimateSize(fields, o.Dialect)
+}
+
+// appendFields appends the encoding of a message's fields, described by
+// schema if known.
+func (o EncodeOptions) appendFields(b []byte, fields []Field, schema *MessageSchema) ([]byte, error) {
+	if o.Canonical {
+		fields = canonicalOrder(fields, schema)
+	}
+	var err error
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok || len(l.SubFields) == 0 {
+			if b, err = o.Dialect.appendField(b, f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var sub *MessageSchema
+		fs := schemaField(schema, l)
+		if fs != nil {
+			sub = fs.Message
+		}
+		var payload []byte
+		if fs != nil && sub == nil {
+			// Declared as bytes or a string, the payload only looked like
+			// a message, and reordering it would change opaque data.
+			payload = l.Data
+		} else if payload, err = o.appendFields(nil, l.SubFields, sub); err != nil {
+			return nil, err
+		}
+		if l.Wrapping != "" {
+			payload = wrapText(payload, l.Wrapping)
+		}
+		if b, err = o.Dialect.appendTag(b, l.ID, WireBytes); err != nil {
+			return nil, err
+		}
+		b = binary.AppendUvarint(b, uint64(len(payload)))
+		b = append(b, payload...)
+	}
+	return b, nil
+}
+
+// canonicalOrder returns a copy of a message's fields ordered by number,
+// with the entries of its maps ordered by key.
+func canonicalOrder(fields []Field, schema *MessageSchema) []Field {
+	sorted := slices.Clone(fields)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return fieldBase(sorted[i]).ID < fieldBase(sorted[j]).ID
+	})
+	for i := 0; i < len(sorted); {
+		id := fieldBase(sorted[i]).ID
+		j := i + 1
+		for j < len(sorted) && fieldBase(sorted[j]).ID == id {
+			j++
+		}
+		if fs := schemaField(schema, sorted[i]); fs != nil && fs.IsMap() {
+			sortMapEntries(sorted[i:j], fs.Message.Field(1))
+		}
+		i = j
+	}
+	return sorted
+}
+
+// sortMapEntries orders the entries of a map field by key. Entries whose
+// key cannot be read sort first, in their original order.
+func sortMapEntries(entries []Field, key *FieldSchema) {
+	keys := make(map[Field]Field, len(entries))
+	for _, e := range entries {
+		l, ok := e.(*LengthDelimitedField)
+		if !ok {
+			continue
+		}
+		sub := l.SubFields
+		if len(sub) == 0 {
+			sub, _ = DecodeFields(l.Data)
+		}
+		for _, f := range sub {
+			if fieldBase(f).ID == 1 {
+				keys[e] = f
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := keys[entries[i]], keys[entries[j]]
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return compareMapKeys(a, b, key.Type) < 0
+	})
+}
+
+// compareMapKeys compares two map keys of the given type. Keys of the
+// wrong wire type compare equal.
+func compareMapKeys(a, b Field, typ string) int {
+	switch a := a.(type) {
+	case *VarintField:
+		b, ok := b.(*VarintField)
+		if !ok {
+			return 0
+		}
+		switch typ {
+		case "int32", "int64":
+			return cmp.Compare(int64(a.Value), int64(b.Value))
+		case "sint32", "sint64":
+			return cmp.Compare(int64(a.Value>>1)^-int64(a.Value&1), int64(b.Value>>1)^-int64(b.Value&1))
+		}
+		return cmp.Compare(a.Value, b.Value)
+	case *Fixed64Field:
+		b, ok := b.(*Fixed64Field)
+		if !ok {
+			return 0
+		}
+		if typ == "sfixed64" {
+			return cmp.Compare(int64(a.Value), int64(b.Value))
+		}
+		return cmp.Compare(a.Value, b.Value)
+	case *Fixed32Field:
+		b, ok := b.(*Fixed32Field)
+		if !ok {
+			return 0
+		}
+		if typ == "sfixed32" {
+			return cmp.Compare(int32(a.Value), int32(b.Value))
+		}
+		return cmp.Compare(a.Value, b.Value)
+	case *LengthDelimitedField:
+		b, ok := b.(*LengthDelimitedField)
+		if !ok {
+			return 0
+		}
+		return bytes.Compare(a.payload(), b.payload())
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package deproto_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestCanonicalKeepsDeclaredBytes(t *testing.T) {
+	schema, err := deproto.NewRegistry().AddSource("blob.proto", `
+syntax = "proto3";
+package blob;
+message Inner {
+  int32 a = 1;
+  int32 b = 2;
+}
+message M {
+  bytes blob = 1;
+  Inner inner = 2;
+  string text = 3;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields 1, 2 and 3 all hold 2:1 before 1:1.
+	data, _ := hex.DecodeString("0a0410010801" + "120410010801" + "1a0410010801")
+	fields, err := deproto.DecodeFields(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		schema *deproto.MessageSchema
+		want   string
+	}{
+		{"schema", schema.Messages[1], "0a0410010801" + "120408011001" + "1a0410010801"},
+		{"no schema", nil, "0a0408011001" + "120408011001" + "1a0408011001"},
+	} {
+		got, err := deproto.EncodeOptions{Canonical: true, Schema: tc.schema}.Encode(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(got) != tc.want {
+			t.Errorf("%s: canonical encoding %x, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package deproto
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Encoder libraries EncoderFingerprint tells apart.
+const (
+	EncoderGo         = "protobuf-go"
+	EncoderJava       = "protobuf-java"
+	EncoderNanopb     = "nanopb"
+	EncoderHandRolled = "hand-rolled"
+)
+
+// EncoderGuess is an encoder library and how well the messages fit it:
+// the higher the score, the better.
+type EncoderGuess struct {
+	Library string `json:"library"`
+	Score   int    `json:"score"`
+}
+
+// EncoderFingerprint gathers the choices left to encoders that show in the
+// wire format of messages, to guess the library that wrote them:
+//
+//   - protobuf-go and protobuf-java write fields in number order with
+//     minimal varints, and leave out proto3 fields holding their default.
+//     Go iterates maps in random order, so the same keys come out in
+//     different orders, where Java keeps the order of insertion.
+//   - nanopb writes fields in number order with minimal varints, but
+//     repeated scalars unpacked unless declared packed, and often default
+//     values, as proto2 fields with presence flags set.
+//   - Hand-rolled encoders give themselves away with fields out of order,
+//     padded varints, such as lengths reserved before the payload is
+//     written, and negative numbers not sign-extended to 64 bits.
+//
+// Go and Java can only be told apart by their maps. The zero value is an
+// empty fingerprint; Check adds messages to it.
+type EncoderFingerprint struct {
+	Messages   int
+	OutOfOrder int // Messages with a field number lower than its predecessor
+	Defaults   int // Scalar fields holding 0 or an empty value
+	Scalars    int
+	Unpacked   int // Runs of a repeated scalar field written unpacked
+	Maps       int // Runs of two or more map entries
+	SortedMaps int // Maps whose keys are in ascending order
+	Reordered  int // Maps whose keys came in another order before
+	Varints    VarintReport
+
+	mapOrders map[string]string // Keys of the maps by path and key set, in the order first seen
+}
+
+// Check adds a message to the fingerprint.
+func (e *EncoderFingerprint) Check(data []byte) error {
+	fields, err := DecodeFields(data)
+	if err != nil {
+		return err
+	}
+	e.Messages++
+	e.Varints.Messages++
+	e.Varints.scan(data, 0, fields, nil)
+	outOfOrder := false
+	e.scan(fields, nil, &outOfOrder)
+	if outOfOrder {
+		e.OutOfOrder++
+	}
+	return nil
+}
+
+// scan gathers the fingerprint of the fields of a message at parent.
+func (e *EncoderFingerprint) scan(fields []Field, parent FieldPath, outOfOrder *bool) {
+	prevID := 0
+	for i := 0; i < len(fields); {
+		base := fieldBase(fields[i])
+		if base == nil {
+			i++
+			continue
+		}
+		if base.ID < prevID {
+			*outOfOrder = true
+		}
+		prevID = base.ID
+		run := i + 1
+		for run < len(fields) && fieldBase(fields[run]) != nil && fieldBase(fields[run]).ID == base.ID {
+			run++
+		}
+		path := parent.Append(base.ID)
+		if run-i > 1 && isScalar(fields[i]) {
+			if _, ok := fields[i].(*LengthDelimitedField); !ok {
+				e.Unpacked++
+			}
+		}
+		if keys, ok := mapKeys(fields[i:run]); ok && run-i > 1 {
+			e.checkMap(path, keys)
+		}
+		for _, f := range fields[i:run] {
+			if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+				e.scan(l.SubFields, path, outOfOrder)
+				continue
+			}
+			e.Scalars++
+			if measure(f) == 0 {
+				e.Defaults++
+			}
+		}
+		i = run
+	}
+}
+
+// checkMap records the order of the keys of a map at path.
+func (e *EncoderFingerprint) checkMap(path FieldPath, keys []string) {
+	e.Maps++
+	if slices.IsSorted(keys) {
+		e.SortedMaps++
+	}
+	sorted := slices.Sorted(slices.Values(keys))
+	set := path.String() + "\x00" + strings.Join(sorted, "\x00")
+	order := strings.Join(keys, "\x00")
+	if e.mapOrders == nil {
+		e.mapOrders = make(map[string]string)
+	}
+	if first, ok := e.mapOrders[set]; !ok {
+		e.mapOrders[set] = order
+	} else if first != order {
+		e.Reordered++
+	}
+}
+
+// mapKeys returns the keys of a run of repeated fields that look like map
+// entries: messages holding at most a key numbered 1 and a value numbered
+// 2, the key being a scalar and distinct from the others. Keys are compared as strings, numbers padded
+// to sort by value.
+func mapKeys(run []Field) ([]string, bool) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, f := range run {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok || len(l.SubFields) == 0 || len(l.SubFields) > 2 {
+			return nil, false
+		}
+		key, prevID := "", 0
+		for _, sub := range l.SubFields {
+			base := fieldBase(sub)
+			if base == nil || base.ID <= prevID || base.ID > 2 {
+				return nil, false
+			}
+			prevID = base.ID
+			if base.ID != 1 {
+				continue
+			}
+			switch k := sub.(type) {
+			case *VarintField:
+				key = fmt.Sprintf("%020d", k.Value)
+			case *LengthDelimitedField:
+				if len(k.SubFields) > 0 {
+					return nil, false
+				}
+				key = string(k.Data)
+			default:
+				key = fmt.Sprintf("%020d", measure(k))
+			}
+		}
+		if seen[key] {
+			return nil, false
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+// Guess scores the encoder libraries by how well the messages checked so
+// far fit them, the most likely first.
+func (e *EncoderFingerprint) Guess() []EncoderGuess {
+	scores := map[string]int{EncoderGo: 0, EncoderJava: 0, EncoderNanopb: 0, EncoderHandRolled: 0}
+	add := func(score int, libraries ...string) {
+		for _, library := range libraries {
+			scores[library] += score
+		}
+	}
+	if e.Varints.Encodings[VarintNonMinimal] > 0 {
+		add(4, EncoderHandRolled)
+		add(-4, EncoderGo, EncoderJava, EncoderNanopb)
+	}
+	if e.Varints.Encodings[VarintTruncated] > 0 {
+		add(1, EncoderHandRolled)
+	}
+	if e.Varints.Encodings[VarintSignExtended] > 0 {
+		add(1, EncoderGo, EncoderJava, EncoderNanopb)
+	}
+	if e.OutOfOrder > 0 {
+		add(3, EncoderHandRolled)
+		add(-2, EncoderGo, EncoderJava, EncoderNanopb)
+	}
+	if e.Reordered > 0 {
+		add(3, EncoderGo)
+		add(-1, EncoderJava)
+		add(-2, EncoderNanopb)
+	} else if e.Maps > 1 && e.SortedMaps < e.Maps {
+		add(1, EncoderJava)
+	}
+	if e.Defaults > 0 {
+		add(2, EncoderNanopb)
+		add(1, EncoderHandRolled)
+	}
+	if e.Unpacked > 0 {
+		add(1, EncoderNanopb, EncoderHandRolled)
+	}
+	var guesses []EncoderGuess
+	for _, library := range []string{EncoderGo, EncoderJava, EncoderNanopb, EncoderHandRolled} {
+		guesses = append(guesses, EncoderGuess{library, scores[library]})
+	}
+	sort.SliceStable(guesses, func(i, j int) bool { return guesses[i].Score > guesses[j].Score })
+	return guesses
+}
+
+// String describes the evidence gathered and the guesses it leads to.
+func (e *EncoderFingerprint) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d messages\n", e.Messages)
+	if e.OutOfOrder > 0 {
+		fmt.Fprintf(&b, "  fields out of number order in %d messages\n", e.OutOfOrder)
+	} else {
+		b.WriteString("  fields in number order\n")
+	}
+	if n := e.Varints.Encodings[VarintNonMinimal]; n > 0 {
+		fmt.Fprintf(&b, "  %d padded varints\n", n)
+	} else {
+		b.WriteString("  minimal varints\n")
+	}
+	if n := e.Varints.Encodings[VarintSignExtended]; n > 0 {
+		fmt.Fprintf(&b, "  %d negative numbers sign-extended to 64 bits\n", n)
+	}
+	if n := e.Varints.Encodings[VarintTruncated]; n > 0 {
+		fmt.Fprintf(&b, "  %d values that may be negative numbers kept to 32 bits\n", n)
+	}
+	if e.Maps > 0 {
+		fmt.Fprintf(&b, "  %d maps, %d with sorted keys, %d in a new order for the same keys\n", e.Maps, e.SortedMaps, e.Reordered)
+	}
+	fmt.Fprintf(&b, "  %d of %d scalars hold a default value\n", e.Defaults, e.Scalars)
+	if e.Unpacked > 0 {
+		fmt.Fprintf(&b, "  %d unpacked repeated scalars\n", e.Unpacked)
+	}
+	b.WriteString("guesses:")
+	for _, g := range e.Guess() {
+		fmt.Fprintf(&b, " %s %+d", g.Library, g.Score)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
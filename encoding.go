@@ -0,0 +1,205 @@
+package deproto
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// DetectEncoding reports whether data looks like text in an encoding other
+// than UTF-8: UTF-16 in either byte order (as written by Windows and Java
+// APIs) or Shift-JIS (common in Japanese apps). It returns the decoded text
+// and the encoding name, "utf-16le", "utf-16be" or "shift-jis".
+//
+// Data shorter than four bytes or readable as a UTF-8 string is never
+// reported, and the checks are strict enough that binary data is rarely
+// mistaken for text: every character must be printable and come from a
+// commonly used block, and the letters must be from one writing system.
+func DetectEncoding(data []byte) (text, encoding string, ok bool) {
+	if len(data) < 4 || utf8.Valid(data) && isPrintableString(data) {
+		return "", "", false
+	}
+	if text, encoding, ok := detectUTF16(data); ok {
+		return text, encoding, true
+	}
+	if text, ok := detectShiftJIS(data); ok {
+		return text, "shift-jis", true
+	}
+	return "", "", false
+}
+
+func detectUTF16(data []byte) (string, string, bool) {
+	if len(data)%2 != 0 {
+		return "", "", false
+	}
+	switch {
+	case data[0] == 0xff && data[1] == 0xfe:
+		text, _, ok := decodeUTF16(data[2:], false)
+		return text, "utf-16le", ok
+	case data[0] == 0xfe && data[1] == 0xff:
+		text, _, ok := decodeUTF16(data[2:], true)
+		return text, "utf-16be", ok
+	}
+	le, leASCII, leOK := decodeUTF16(data, false)
+	be, beASCII, beOK := decodeUTF16(data, true)
+	switch {
+	case leOK && (!beOK || leASCII >= beASCII):
+		return le, "utf-16le", true
+	case beOK:
+		return be, "utf-16be", true
+	}
+	return "", "", false
+}
+
+// decodeUTF16 decodes data as UTF-16 and reports whether the result is
+// plausible text, along with the number of ASCII characters in it.
+func decodeUTF16(data []byte, bigEndian bool) (string, int, bool) {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	runes := utf16.Decode(units)
+	ascii := 0
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			ascii++
+		}
+	}
+	// Short runs of arbitrary bytes easily decode to a few ideographs, so
+	// text without ASCII must be longer to be believed.
+	if len(runes) < 2 || ascii*2 < len(runes) && len(runes) < minUTF16Text {
+		return "", 0, false
+	}
+	if !plausibleText(runes) {
+		return "", 0, false
+	}
+	return string(runes), ascii, true
+}
+
+// minUTF16Text is the number of characters needed before UTF-16 text that
+// is mostly outside ASCII is reported.
+const minUTF16Text = 6
+
+// detectShiftJIS checks the byte structure of Shift-JIS text and decodes it.
+// Random bytes easily pass the structural checks, so at least three
+// characters and half of the data must be double-byte, half-width katakana
+// may not outnumber them, and some kana must appear.
+func detectShiftJIS(data []byte) (string, bool) {
+	double, halfWidth := 0, 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+		case c >= 0xa1 && c <= 0xdf:
+			halfWidth++
+		case c >= 0x81 && c <= 0x9f || c >= 0xe0 && c <= 0xef:
+			if i+1 >= len(data) {
+				return "", false
+			}
+			t := data[i+1]
+			if t < 0x40 || t == 0x7f || t > 0xfc {
+				return "", false
+			}
+			i++
+			double++
+		default:
+			return "", false
+		}
+	}
+	if double < 3 || 4*double < len(data) || halfWidth > double {
+		return "", false
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+		return "", false
+	}
+	runes := []rune(string(decoded))
+	if !plausibleText(runes) || !containsKana(runes) {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// containsKana reports whether runes include full-width hiragana or
+// katakana, which nearly all Japanese text does.
+func containsKana(runes []rune) bool {
+	for _, r := range runes {
+		if r >= 0x3040 && r <= 0x30ff {
+			return true
+		}
+	}
+	return false
+}
+
+// textBlocks are the Unicode ranges accepted as text outside ASCII.
+var textBlocks = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a0, Hi: 0x00ff, Stride: 1}, // Latin-1 Supplement
+		{Lo: 0x0370, Hi: 0x04ff, Stride: 1}, // Greek, Cyrillic
+		{Lo: 0x0590, Hi: 0x06ff, Stride: 1}, // Hebrew, Arabic
+		{Lo: 0x0e00, Hi: 0x0e7f, Stride: 1}, // Thai
+		{Lo: 0x2000, Hi: 0x206f, Stride: 1}, // General Punctuation
+		{Lo: 0x3000, Hi: 0x30ff, Stride: 1}, // CJK Punctuation, Hiragana, Katakana
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1}, // CJK Unified Ideographs
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1}, // Hangul Syllables
+		{Lo: 0xff00, Hi: 0xffef, Stride: 1}, // Halfwidth and Fullwidth Forms
+	},
+}
+
+// plausibleText reports whether runes read as natural-language text.
+func plausibleText(runes []rune) bool {
+	if len(runes) == 0 {
+		return false
+	}
+	scripts := make(map[string]bool)
+	for _, r := range runes {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			continue
+		case r < utf8.RuneSelf:
+			if !unicode.IsPrint(r) {
+				return false
+			}
+			continue
+		case !unicode.IsPrint(r) || !unicode.Is(textBlocks, r):
+			return false
+		}
+		if script := scriptOf(r); script != "" {
+			scripts[script] = true
+		}
+	}
+	return len(scripts) <= 1
+}
+
+// scriptOf groups a letter into a writing system, treating the scripts
+// used together in Japanese as one. Punctuation and symbols return "".
+func scriptOf(r rune) string {
+	switch {
+	case !unicode.IsLetter(r):
+		return ""
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+		return "japanese-chinese"
+	case unicode.Is(unicode.Hangul, r):
+		return "korean"
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	case unicode.Is(unicode.Greek, r):
+		return "greek"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Hebrew, r):
+		return "hebrew"
+	case unicode.Is(unicode.Arabic, r):
+		return "arabic"
+	case unicode.Is(unicode.Thai, r):
+		return "thai"
+	}
+	return "other"
+}
@@ -0,0 +1,90 @@
+package deproto
+
+import (
+	"fmt"
+	"math"
+)
+
+// ByteClass is a guess at what kind of data a byte field holds, made from
+// its entropy.
+type ByteClass int
+
+const (
+	ByteClassUnknown      ByteClass = iota // Too short to tell
+	ByteClassCompressible                  // Structured data, text or padding
+	ByteClassRandom                        // Compressed or encrypted data
+	ByteClassSecret                        // Random and of a key, nonce or hash length
+)
+
+// String returns a short description of the class.
+func (c ByteClass) String() string {
+	switch c {
+	case ByteClassUnknown:
+		return "unknown"
+	case ByteClassCompressible:
+		return "compressible"
+	case ByteClassRandom:
+		return "random"
+	case ByteClassSecret:
+		return "key/nonce/hash"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(c))
+	}
+}
+
+// ByteStats summarizes the randomness of a byte field.
+type ByteStats struct {
+	Entropy float64 // Shannon entropy in bits per byte
+	Density float64 // Entropy as a fraction of the most the length allows
+	Class   ByteClass
+}
+
+// String returns the stats as "entropy 3.9 bits/byte, key/nonce/hash".
+func (s ByteStats) String() string {
+	return fmt.Sprintf("entropy %.1f bits/byte, %s", s.Entropy, s.Class)
+}
+
+// Thresholds for AnalyzeBytes.
+const (
+	minClassifiedBytes = 8    // Shorter data is ByteClassUnknown
+	randomDensity      = 0.85 // Density from which data is considered random
+)
+
+// secretLengths are the sizes of common keys, nonces and digests: 128-bit
+// keys and MD5, SHA-1, SHA-256 and SHA-512.
+var secretLengths = map[int]bool{16: true, 20: true, 32: true, 64: true}
+
+// AnalyzeBytes computes the entropy of data and classifies it. Since n
+// bytes can hold at most log2(n) bits of entropy per byte, short data is
+// judged by its density, the entropy relative to that maximum. High-density
+// data of 16, 20, 32 or 64 bytes is likely a key, nonce or hash; other
+// high-density data is likely compressed or encrypted.
+func AnalyzeBytes(data []byte) ByteStats {
+	var counts [256]int
+	for _, c := range data {
+		counts[c]++
+	}
+	var entropy float64
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	stats := ByteStats{Entropy: entropy}
+	if max := math.Log2(float64(min(len(data), 256))); max > 0 {
+		stats.Density = entropy / max
+	}
+
+	switch {
+	case len(data) < minClassifiedBytes:
+		stats.Class = ByteClassUnknown
+	case stats.Density < randomDensity:
+		stats.Class = ByteClassCompressible
+	case secretLengths[len(data)]:
+		stats.Class = ByteClassSecret
+	default:
+		stats.Class = ByteClassRandom
+	}
+	return stats
+}
@@ -0,0 +1,172 @@
+package deproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EventOptions controls EnrichEvents.
+type EventOptions struct {
+	// Fields names the members of each event that hold payloads, as dotted
+	// paths such as "payload" or "args.1" for the second element of an
+	// array. If empty, every string in the event that is base64 or hex
+	// text encoding a plausible message is decoded.
+	Fields []string
+
+	// Decode controls how payloads are decoded.
+	Decode DecodeOptions
+}
+
+// eventPayload is a decoded payload added to an event by EnrichEvents.
+type eventPayload struct {
+	Wrapping string      `json:"wrapping,omitempty"` // The text encoding of the payload, such as "base64"
+	Fields   []fieldJSON `json:"fields,omitempty"`   // The decoded fields, as written by MarshalTree
+	Error    string      `json:"error,omitempty"`    // Why the payload did not decode
+}
+
+// EnrichEvents reads newline-delimited JSON events, such as those printed
+// by Frida hooks, and writes each one back with its decoded payloads added
+// under a "deproto" member, keyed by the path of the payload in the event,
+// as in "deproto":{"payload":{"wrapping":"base64","fields":[...]}}. Fields
+// take the form MarshalTree writes; a payload named in opts.Fields that
+// does not decode has an "error" instead. Events are otherwise copied as they are, and lines that are not JSON
+// objects or hold no payloads are copied unchanged, so the output can
+// replace the input in a pipeline. It returns the number of events
+// enriched.
+func EnrichEvents(r io.Reader, w io.Writer, opts EventOptions) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	enriched := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		out := line
+		if payloads := eventPayloads(line, opts); len(payloads) > 0 {
+			extra, err := json.Marshal(payloads)
+			if err != nil {
+				return enriched, err
+			}
+			trimmed := bytes.TrimRight(line, " \t\r")
+			out = append(trimmed[:len(trimmed)-1:len(trimmed)-1], `,"deproto":`...)
+			out = append(append(out, extra...), '}')
+			enriched++
+		}
+		if _, err := w.Write(append(out, '\n')); err != nil {
+			return enriched, err
+		}
+	}
+	return enriched, scanner.Err()
+}
+
+// eventPayloads decodes the payloads of one event line, returning nil if it
+// is not a JSON object or holds none.
+func eventPayloads(line []byte, opts EventOptions) map[string]eventPayload {
+	var event map[string]any
+	if json.Unmarshal(line, &event) != nil || event == nil {
+		return nil
+	}
+	payloads := make(map[string]eventPayload)
+	if len(opts.Fields) > 0 {
+		for _, path := range opts.Fields {
+			s, ok := jsonLookup(event, path).(string)
+			if !ok {
+				continue
+			}
+			payloads[path] = decodeEventPayload(s, true, opts.Decode)
+		}
+		return payloads
+	}
+	walkJSONStrings(event, "", func(path, s string) {
+		if p := decodeEventPayload(s, false, opts.Decode); p.Error == "" {
+			payloads[path] = p
+		}
+	})
+	return payloads
+}
+
+// decodeEventPayload decodes a base64 or hex payload. A named payload may
+// be text of any length; other strings must look like encoded data, as
+// for DecodeOptions.UnwrapText.
+func decodeEventPayload(s string, named bool, opts DecodeOptions) eventPayload {
+	data, wrapping, ok := unwrapText(s)
+	if !ok && named {
+		data, wrapping, ok = decodeText(s)
+	}
+	if !ok {
+		return eventPayload{Error: "not base64 or hex text"}
+	}
+	fields, err := opts.Decode(data)
+	if err != nil {
+		return eventPayload{Wrapping: wrapping, Error: err.Error()}
+	}
+	if !plausibleMessage(fields) {
+		return eventPayload{Wrapping: wrapping, Error: "not a plausible message"}
+	}
+	return eventPayload{Wrapping: wrapping, Fields: marshalFields(fields)}
+}
+
+// decodeText decodes hex text, or base64 text in any of the variants of
+// textWrappings.
+func decodeText(s string) ([]byte, string, bool) {
+	if data, err := hex.DecodeString(s); err == nil {
+		return data, "hex", true
+	}
+	for _, w := range textWrappings {
+		if data, err := w.enc.DecodeString(s); err == nil {
+			return data, w.name, true
+		}
+	}
+	return nil, "", false
+}
+
+// jsonLookup returns the value at a dotted path in decoded JSON, or nil.
+func jsonLookup(v any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case map[string]any:
+			v = x[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil
+			}
+			v = x[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// walkJSONStrings calls fn with every string in decoded JSON and its dotted
+// path, visiting object members in sorted order.
+func walkJSONStrings(v any, path string, fn func(path, s string)) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch x := v.(type) {
+	case string:
+		fn(path, x)
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkJSONStrings(x[key], join(key), fn)
+		}
+	case []any:
+		for i, elem := range x {
+			walkJSONStrings(elem, join(strconv.Itoa(i)), fn)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Exchange is a request and the response to it, paired as a proxy captures
+// them. Either side may be missing.
+type Exchange struct {
+	Key      string `json:"key"` // What paired them, such as a connection or stream ID
+	Request  []byte `json:"request,omitempty"`
+	Response []byte `json:"response,omitempty"`
+}
+
+// AddRequest starts a new exchange with a request under key.
+func (s *Session) AddRequest(key string, data []byte) *Exchange {
+	e := &Exchange{Key: key, Request: data}
+	s.Exchanges = append(s.Exchanges, e)
+	return e
+}
+
+// AddResponse pairs a response with the earliest request under key that
+// has none yet, as responses come back in the order of their requests on a
+// connection, or records it alone if there is no such request.
+func (s *Session) AddResponse(key string, data []byte) *Exchange {
+	for _, e := range s.Exchanges {
+		if e.Key == key && e.Response == nil && e.Request != nil {
+			e.Response = data
+			return e
+		}
+	}
+	e := &Exchange{Key: key, Response: data}
+	s.Exchanges = append(s.Exchanges, e)
+	return e
+}
+
+// AddPackets pairs the payloads of captured packets by connection. On each
+// connection, the payloads sent by the side that sent first are requests
+// and those sent back are responses. Exchanges are keyed by the connection,
+// as in "tcp 10.0.0.2:50000 <> 10.0.0.1:443", the client first, and by the
+// stream for HTTP/2 and HTTP/3 bodies.
+func (s *Session) AddPackets(packets []Packet) {
+	clients := make(map[string]string) // Client endpoint by unordered connection
+	for _, p := range packets {
+		if len(p.Payload) == 0 {
+			continue
+		}
+		a, b := p.Src.String(), p.Dst.String()
+		if a > b {
+			a, b = b, a
+		}
+		conn := p.Protocol + " " + a + " " + b
+		client, ok := clients[conn]
+		if !ok {
+			client = p.Src.String()
+			clients[conn] = client
+		}
+		stream := ""
+		if p.hasStream() {
+			stream = fmt.Sprintf(" stream %d", p.Stream)
+		}
+		if p.Src.String() == client {
+			s.AddRequest(fmt.Sprintf("%s %s <> %s%s", p.Protocol, p.Src, p.Dst, stream), p.Payload)
+		} else {
+			s.AddResponse(fmt.Sprintf("%s %s <> %s%s", p.Protocol, p.Dst, p.Src, stream), p.Payload)
+		}
+	}
+}
+
+// Decode decodes both sides of the exchange. Missing sides decode to no
+// fields. Fields decoded before an error are returned with it.
+func (e *Exchange) Decode(opts DecodeOptions) (request, response []Field, err error) {
+	if e.Request != nil {
+		if request, err = opts.Decode(e.Request); err != nil {
+			err = fmt.Errorf("request: %v", err)
+		}
+	}
+	if e.Response != nil {
+		var rerr error
+		if response, rerr = opts.Decode(e.Response); rerr != nil && err == nil {
+			err = fmt.Errorf("response: %v", rerr)
+		}
+	}
+	return request, response, err
+}
+
+// RenderExchange decodes an exchange and renders the request and the
+// response side by side, in columns of width runes below a header naming
+// the key. Longer lines are cut. A side that fails to decode ends with its
+// error.
+func RenderExchange(e *Exchange, opts DecodeOptions, ropts RenderOptions, width int) string {
+	side := func(data []byte, name string) []string {
+		if data == nil {
+			return []string{"(no " + name + ")"}
+		}
+		fields, err := opts.Decode(data)
+		s := RenderFields(fields, ropts)
+		if err != nil {
+			s += fmt.Sprintf("[%v]\n", err)
+		}
+		return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+	left, right := side(e.Request, "request"), side(e.Response, "response")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", e.Key)
+	column := func(s string) string {
+		if utf8.RuneCountInString(s) > width {
+			runes := []rune(s)
+			s = string(runes[:max(0, width-3)]) + "..."
+		}
+		return s + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s)))
+	}
+	fmt.Fprintf(&b, "%s | %s\n", column("request"), "response")
+	fmt.Fprintf(&b, "%s-+-%s\n", strings.Repeat("-", width), strings.Repeat("-", width))
+	for i := range max(len(left), len(right)) {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		line := column(l) + " | " + r
+		if utf8.RuneCountInString(r) > width {
+			line = column(l) + " | " + column(r)
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Explain describes the encoding of a message in prose, one line per byte
+// range, as in "bytes 0-1: tag, field 3, wire type 2 (length-delimited)"
+// and "byte 2: length 14", descending into nested messages. Payloads are
+// read as Decode reads them with the options, and fields are named after
+// the Schema if one is set. Every byte is accounted for, so FieldFilter
+// and Lazy are ignored. Bytes past a decoding error are described as such,
+// and the error is returned with the description.
+func (o DecodeOptions) Explain(data []byte) (string, error) {
+	var b strings.Builder
+	err := o.explainSpans(data, func(s explainSpan) {
+		fmt.Fprintf(&b, "%s%s: %s\n", strings.Repeat("    ", s.depth), byteRange(s.start, s.end), s.text)
+	})
+	return b.String(), err
+}
+
+// explainSpan is a byte range of a message with its description. A span
+// holding a nested message is followed by the spans of its fields, one
+// level deeper.
+type explainSpan struct {
+	start, end int
+	depth      int
+	text       string
+	message    bool
+}
+
+// explainSpans decodes data as Explain does and passes emit the spans of
+// its bytes in order, the bytes past a decoding error last.
+func (o DecodeOptions) explainSpans(data []byte, emit func(explainSpan)) error {
+	o.FieldFilter, o.Lazy = nil, false
+	fields, err := o.Decode(data)
+	end := o.explain(data, 0, fields, o.Schema, 0, emit)
+	if end < len(data) {
+		emit(explainSpan{start: end, end: len(data), text: fmt.Sprintf("not decoded: %v", err)})
+	}
+	return err
+}
+
+// explain describes the encoding of fields, found at offset in the
+// message, and returns the offset of the first byte past them.
+func (o DecodeOptions) explain(data []byte, offset int, fields []Field, schema *MessageSchema, depth int, emit func(explainSpan)) int {
+	line := func(start, end int, format string, args ...any) {
+		emit(explainSpan{start: offset + start, end: offset + end, depth: depth, text: fmt.Sprintf(format, args...)})
+	}
+	pos := 0
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		_, _, n, _, err := o.Dialect.readTag(data[pos:])
+		if err != nil {
+			break
+		}
+		name := ""
+		fs := schemaField(schema, f)
+		if fs != nil {
+			name = " " + fs.Name
+		}
+		line(pos, pos+n, "tag, field %d%s, wire type %d (%s)", base.ID, name, base.WireType, strings.ToLower(wireTypeString(base.WireType)))
+		pos += n
+		switch v := f.(type) {
+		case *VarintField:
+			_, m := binary.Uvarint(data[pos:])
+			line(pos, pos+m, "varint value %d%s", v.Value, varintNote(v.Value, m))
+			pos += m
+		case *Fixed64Field:
+			line(pos, pos+8, "fixed64 value %d, little-endian, or %g as a double", v.Value, math.Float64frombits(v.Value))
+			pos += 8
+		case *Fixed32Field:
+			line(pos, pos+4, "fixed32 value %d, little-endian, or %g as a float", v.Value, math.Float32frombits(v.Value))
+			pos += 4
+		case *LengthDelimitedField:
+			length, m := binary.Uvarint(data[pos:])
+			note := varintNote(length, m)
+			switch {
+			case v.EmptyMessage:
+				note += ": an empty message"
+			case length == 0:
+				note += ": an empty string, bytes or message"
+			}
+			line(pos, pos+m, "length %d%s", length, note)
+			pos += m
+			start, end := pos, pos+int(length)
+			var sub *MessageSchema
+			if fs != nil {
+				sub = fs.Message
+			}
+			switch {
+			case length == 0:
+			case len(v.SubFields) > 0 && v.Wrapping != "":
+				line(start, end, "%s text holding %s", v.Wrapping, messageOf(v.SubFields))
+			case len(v.SubFields) > 0:
+				emit(explainSpan{start: offset + start, end: offset + end, depth: depth, text: messageOf(v.SubFields) + ":", message: true})
+				o.explain(data[start:end], offset+start, v.SubFields, sub, depth+1, emit)
+			case v.IsString:
+				text := end - v.Padding
+				quoted, note := (&renderer{}).quote(v.StringValue)
+				line(start, text, "string %s%s", quoted, note)
+				if v.Padding > 0 {
+					line(text, end, "NUL bytes padding the string")
+				}
+			case v.Packed != nil:
+				line(start, end, "%d packed %s values", len(v.Packed.Values), v.Packed.Type)
+			default:
+				line(start, end, "%d bytes of binary data", length)
+			}
+			pos = end
+		}
+	}
+	return pos
+}
+
+// messageOf names a nested message by its number of fields.
+func messageOf(fields []Field) string {
+	if len(fields) == 1 {
+		return "a message of 1 field"
+	}
+	return fmt.Sprintf("a message of %d fields", len(fields))
+}
+
+// varintNote flags a varint value encoded in n bytes when it is padded or
+// reads as a negative 64-bit number.
+func varintNote(v uint64, n int) string {
+	var note string
+	if int64(v) < 0 {
+		note = fmt.Sprintf(", or %d as a signed 64-bit number", int64(v))
+	}
+	if n > uvarintLen(v) {
+		note += fmt.Sprintf(", padded to %d bytes where %d would do", n, uvarintLen(v))
+	}
+	return note
+}
+
+// byteRange names the bytes from start up to end, as "byte 2" or "bytes
+// 3-16".
+func byteRange(start, end int) string {
+	if end-start == 1 {
+		return fmt.Sprintf("byte %d", start)
+	}
+	return fmt.Sprintf("bytes %d-%d", start, end-1)
+}
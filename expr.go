@@ -0,0 +1,852 @@
+package deproto
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled expression evaluated against a decoded message, used to
+// filter, tag or transform messages in pipelines:
+//
+//	field(1) == 42 && has("3.2")
+//	contains(field(2), "token") || count(4) > 10
+//	drop(5)
+//
+// Literals are decimal integers, floats, quoted strings, true and false.
+// Operators are || && ! == != < <= > >= + - * / % with the usual precedence.
+// Integers are 64-bit and signed, so varints are read in two's complement.
+//
+// Field functions take a field path as a number or dotted string:
+//
+//	field(p)    value of the first field at p (int, string or bytes), or null
+//	has(p)      whether any field exists at p
+//	count(p)    number of fields at p
+//	sint(p)     first field at p as a zigzag-decoded integer
+//	float(p)    first fixed32 field at p as a float
+//	double(p)   first fixed64 field at p as a double
+//	drop(p)     remove all fields at p, returning how many were removed
+//	set(p, v)   replace the value of the first field at p, returning true
+//
+// In query predicates, value() and id() return the value and field number of
+// the field being tested. Other functions: len(s), contains(s, sub),
+// startsWith(s, prefix), endsWith(s, suffix), matches(s, regexp) and
+// string(v).
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// CompileExpr parses an expression.
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != exprEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against a message. The result is nil, a
+// bool, an int64, a float64 or a string. Functions such as drop and set
+// modify fields in place.
+func (e *Expr) Eval(fields []Field) (any, error) {
+	env := &exprEnv{fields: fields}
+	return e.root.eval(env)
+}
+
+// Match evaluates the expression and reports whether the result is truthy:
+// true, a non-zero number or a non-empty string.
+func (e *Expr) Match(fields []Field) (bool, error) {
+	v, err := e.Eval(fields)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// Apply evaluates the expression for its side effects and returns the
+// possibly modified message. Use it for expressions that call drop or set.
+func (e *Expr) Apply(fields []Field) ([]Field, error) {
+	env := &exprEnv{fields: fields}
+	_, err := e.root.eval(env)
+	syncData(env.fields)
+	return env.fields, err
+}
+
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	default:
+		return false
+	}
+}
+
+// exprEnv is the state an expression is evaluated against.
+type exprEnv struct {
+	fields []Field
+	self   Field // The field a query predicate is applied to, if any
+}
+
+type exprNode interface {
+	eval(env *exprEnv) (any, error)
+}
+
+type literalNode struct{ value any }
+
+func (n literalNode) eval(*exprEnv) (any, error) { return n.value, nil }
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n unaryNode) eval(env *exprEnv) (any, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(v), nil
+	}
+	switch x := v.(type) {
+	case int64:
+		return -x, nil
+	case float64:
+		return -x, nil
+	}
+	return nil, fmt.Errorf("cannot negate %s", typeName(v))
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n binaryNode) eval(env *exprEnv) (any, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := n.right.eval(env)
+		return truthy(r), err
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := n.right.eval(env)
+		return truthy(r), err
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return compareValues(l, r) == 0, nil
+	case "!=":
+		return compareValues(l, r) != 0, nil
+	case "<", "<=", ">", ">=":
+		if !orderable(l, r) {
+			return false, nil
+		}
+		c := compareValues(l, r)
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+	return arithmetic(n.op, l, r)
+}
+
+// orderable reports whether two values can be ordered.
+func orderable(a, b any) bool {
+	_, aNum := toFloat(a)
+	_, bNum := toFloat(b)
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	return aNum && bNum || aStr && bStr
+}
+
+// compareValues orders two values, returning -1, 0 or 1. Values of different
+// kinds compare unequal.
+func compareValues(a, b any) int {
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok && x == y {
+			return 0
+		}
+	}
+	if a == nil && b == nil {
+		return 0
+	}
+	return 1
+}
+
+func toFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+func arithmetic(op string, l, r any) (any, error) {
+	if op == "+" {
+		if x, ok := l.(string); ok {
+			if y, ok := r.(string); ok {
+				return x + y, nil
+			}
+		}
+	}
+	if x, ok := l.(int64); ok {
+		if y, ok := r.(int64); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "/", "%":
+				if y == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				if op == "/" {
+					return x / y, nil
+				}
+				return x % y, nil
+			}
+		}
+	}
+	x, lok := toFloat(l)
+	y, rok := toFloat(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("invalid operands for %s: %s and %s", op, typeName(l), typeName(r))
+	}
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		return x / y, nil
+	default:
+		return math.Mod(x, y), nil
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n callNode) eval(env *exprEnv) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	fn := exprFuncs[n.name]
+	return fn.call(env, args)
+}
+
+// matchNode is a call of matches with a literal pattern, compiled once.
+type matchNode struct {
+	subject exprNode
+	re      *regexp.Regexp
+}
+
+func (n matchNode) eval(env *exprEnv) (any, error) {
+	v, err := n.subject.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	return ok && n.re.MatchString(s), nil
+}
+
+type exprFunc struct {
+	arity int
+	call  func(env *exprEnv, args []any) (any, error)
+}
+
+var exprFuncs map[string]exprFunc
+
+func init() {
+	exprFuncs = map[string]exprFunc{
+		"field": {1, func(env *exprEnv, args []any) (any, error) {
+			f, err := env.first(args[0])
+			if f == nil || err != nil {
+				return nil, err
+			}
+			return fieldValue(f), nil
+		}},
+		"has": {1, func(env *exprEnv, args []any) (any, error) {
+			found, err := env.find(args[0])
+			return len(found) > 0, err
+		}},
+		"count": {1, func(env *exprEnv, args []any) (any, error) {
+			found, err := env.find(args[0])
+			return int64(len(found)), err
+		}},
+		"sint": {1, func(env *exprEnv, args []any) (any, error) {
+			f, err := env.first(args[0])
+			if v, ok := f.(*VarintField); ok {
+				return int64(v.Value>>1) ^ -int64(v.Value&1), nil
+			}
+			return nil, err
+		}},
+		"float": {1, func(env *exprEnv, args []any) (any, error) {
+			f, err := env.first(args[0])
+			if v, ok := f.(*Fixed32Field); ok {
+				return float64(math.Float32frombits(v.Value)), nil
+			}
+			return nil, err
+		}},
+		"double": {1, func(env *exprEnv, args []any) (any, error) {
+			f, err := env.first(args[0])
+			if v, ok := f.(*Fixed64Field); ok {
+				return math.Float64frombits(v.Value), nil
+			}
+			return nil, err
+		}},
+		"drop": {1, func(env *exprEnv, args []any) (any, error) {
+			path, err := exprPath(args[0])
+			if err != nil {
+				return nil, err
+			}
+			var removed int
+			env.fields, removed = removeFields(env.fields, path)
+			return int64(removed), nil
+		}},
+		"set": {2, func(env *exprEnv, args []any) (any, error) {
+			f, err := env.first(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if f == nil {
+				return false, nil
+			}
+			return true, setFieldValue(f, args[1])
+		}},
+		"value": {0, func(env *exprEnv, args []any) (any, error) {
+			if env.self == nil {
+				return nil, nil
+			}
+			return fieldValue(env.self), nil
+		}},
+		"id": {0, func(env *exprEnv, args []any) (any, error) {
+			if env.self == nil {
+				return nil, nil
+			}
+			return int64(fieldBase(env.self).ID), nil
+		}},
+		"len": {1, func(env *exprEnv, args []any) (any, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return int64(0), nil
+			}
+			return int64(len(s)), nil
+		}},
+		"contains":   {2, stringPredicate(strings.Contains)},
+		"startsWith": {2, stringPredicate(strings.HasPrefix)},
+		"endsWith":   {2, stringPredicate(strings.HasSuffix)},
+		"matches": {2, func(env *exprEnv, args []any) (any, error) {
+			s, ok1 := args[0].(string)
+			pattern, ok2 := args[1].(string)
+			if !ok1 || !ok2 {
+				return false, nil
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(s), nil
+		}},
+		"string": {1, func(env *exprEnv, args []any) (any, error) {
+			if args[0] == nil {
+				return "", nil
+			}
+			return fmt.Sprint(args[0]), nil
+		}},
+	}
+}
+
+func stringPredicate(fn func(s, arg string) bool) func(*exprEnv, []any) (any, error) {
+	return func(env *exprEnv, args []any) (any, error) {
+		s, ok1 := args[0].(string)
+		arg, ok2 := args[1].(string)
+		return ok1 && ok2 && fn(s, arg), nil
+	}
+}
+
+// exprPath converts a path argument (an integer or dotted string) to a FieldPath.
+func exprPath(v any) (FieldPath, error) {
+	switch x := v.(type) {
+	case int64:
+		return FieldPath{int(x)}, nil
+	case string:
+		return ParseFieldPath(x)
+	}
+	return nil, fmt.Errorf("invalid field path %v", v)
+}
+
+func (env *exprEnv) find(arg any) ([]Field, error) {
+	path, err := exprPath(arg)
+	if err != nil {
+		return nil, err
+	}
+	return Find(env.fields, path), nil
+}
+
+func (env *exprEnv) first(arg any) (Field, error) {
+	found, err := env.find(arg)
+	if len(found) == 0 {
+		return nil, err
+	}
+	return found[0], nil
+}
+
+// fieldValue returns the expression value of a field: an int64 for numeric
+// fields and a string for length-delimited ones.
+func fieldValue(f Field) any {
+	switch v := f.(type) {
+	case *VarintField:
+		return int64(v.Value)
+	case *Fixed64Field:
+		return int64(v.Value)
+	case *Fixed32Field:
+		return int64(v.Value)
+	case *LengthDelimitedField:
+		if v.IsString {
+			return v.StringValue
+		}
+		return string(v.Data)
+	}
+	return nil
+}
+
+// setFieldValue assigns an expression value to a field.
+func setFieldValue(f Field, value any) error {
+	switch v := f.(type) {
+	case *VarintField:
+		n, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("cannot assign %s to varint field %d", typeName(value), v.ID)
+		}
+		v.Value = uint64(n)
+	case *Fixed64Field:
+		switch x := value.(type) {
+		case int64:
+			v.Value = uint64(x)
+		case float64:
+			v.Value = math.Float64bits(x)
+		default:
+			return fmt.Errorf("cannot assign %s to fixed64 field %d", typeName(value), v.ID)
+		}
+	case *Fixed32Field:
+		switch x := value.(type) {
+		case int64:
+			v.Value = uint32(x)
+		case float64:
+			v.Value = math.Float32bits(float32(x))
+		default:
+			return fmt.Errorf("cannot assign %s to fixed32 field %d", typeName(value), v.ID)
+		}
+	case *LengthDelimitedField:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("cannot assign %s to length-delimited field %d", typeName(value), v.ID)
+		}
+		setValueBytes(v, []byte(s))
+		if isPrintableString(v.Data) {
+			v.IsString = true
+			v.StringValue = s
+		}
+	}
+	return nil
+}
+
+// removeFields removes every field at path and returns the remaining fields
+// together with the number removed.
+func removeFields(fields []Field, path FieldPath) ([]Field, int) {
+	if len(path) == 0 {
+		return fields, 0
+	}
+	removed := 0
+	kept := fields[:0:0]
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil || base.ID != path[0] {
+			kept = append(kept, f)
+			continue
+		}
+		if len(path) == 1 {
+			removed++
+			continue
+		}
+		if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+			var n int
+			l.SubFields, n = removeFields(l.SubFields, path[1:])
+			if len(l.SubFields) == 0 {
+				l.Data = nil
+			}
+			removed += n
+		}
+		kept = append(kept, f)
+	}
+	return kept, removed
+}
+
+// Expression parsing.
+
+type exprTokenKind int
+
+const (
+	exprEOF exprTokenKind = iota
+	exprNumber
+	exprString
+	exprIdent
+	exprOp
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value any
+	pos   int
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok exprToken
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("expression: column %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+var exprOps = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+// scan reads the next token into p.tok.
+func (p *exprParser) scan() error {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	p.tok = exprToken{pos: p.pos}
+	if p.pos >= len(p.src) {
+		return nil
+	}
+	rest := p.src[p.pos:]
+	c := rest[0]
+
+	switch {
+	case c == '"' || c == '\'':
+		end := 1
+		for end < len(rest) && rest[end] != c {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return p.errorf("unterminated string")
+		}
+		raw := rest[:end+1]
+		if c == '\'' {
+			raw = `"` + strings.ReplaceAll(raw[1:end], `"`, `\"`) + `"`
+		}
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return p.errorf("invalid string literal %s", rest[:end+1])
+		}
+		p.tok.kind, p.tok.text, p.tok.value = exprString, rest[:end+1], s
+		p.pos += end + 1
+		return nil
+
+	case c >= '0' && c <= '9' || c == '.':
+		end := 0
+		for end < len(rest) && (isNumberChar(rest[end]) && rest[end] != '-' && rest[end] != '+' ||
+			end > 0 && (rest[end] == '-' || rest[end] == '+') && (rest[end-1] == 'e' || rest[end-1] == 'E')) {
+			end++
+		}
+		text := rest[:end]
+		p.tok.kind, p.tok.text = exprNumber, text
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			p.tok.value = n
+		} else if u, err := strconv.ParseUint(text, 10, 64); err == nil {
+			p.tok.value = int64(u)
+		} else if f, err := strconv.ParseFloat(text, 64); err == nil {
+			p.tok.value = f
+		} else {
+			return p.errorf("invalid number %q", text)
+		}
+		p.pos += end
+		return nil
+
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		end := 0
+		for end < len(rest) && (rest[end] == '_' || rest[end] >= 'a' && rest[end] <= 'z' ||
+			rest[end] >= 'A' && rest[end] <= 'Z' || rest[end] >= '0' && rest[end] <= '9') {
+			end++
+		}
+		p.tok.kind, p.tok.text = exprIdent, rest[:end]
+		p.pos += end
+		return nil
+	}
+
+	for _, op := range exprOps {
+		if strings.HasPrefix(rest, op) {
+			p.tok.kind, p.tok.text = exprOp, op
+			p.pos += len(op)
+			return nil
+		}
+	}
+	return p.errorf("unexpected character %q", c)
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	if p.tok.kind != exprOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBinary parses a left-associative chain of operators at one precedence level.
+func (p *exprParser) parseBinary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(ops...) {
+		op := p.tok.text
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseNot, "&&")
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.isOp("!") {
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "!", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.parseBinary(p.parseAdditive, "==", "!=", "<", "<=", ">", ">=")
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("-") {
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case exprNumber, exprString:
+		return literalNode{tok.value}, p.scan()
+
+	case exprIdent:
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		}
+		fn, ok := exprFuncs[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("expression: column %d: unknown function %q", tok.pos+1, tok.text)
+		}
+		if !p.isOp("(") {
+			return nil, p.errorf("expected '(' after %s", tok.text)
+		}
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		var args []exprNode
+		for !p.isOp(")") {
+			if len(args) > 0 {
+				if !p.isOp(",") {
+					return nil, p.errorf("expected ',' or ')'")
+				}
+				if err := p.scan(); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		if len(args) != fn.arity {
+			return nil, fmt.Errorf("expression: column %d: %s takes %d argument(s), got %d", tok.pos+1, tok.text, fn.arity, len(args))
+		}
+		if tok.text == "matches" {
+			// A literal pattern is compiled here rather than on every
+			// evaluation.
+			if lit, ok := args[1].(literalNode); ok {
+				if pattern, ok := lit.value.(string); ok {
+					re, err := regexp.Compile(pattern)
+					if err != nil {
+						return nil, fmt.Errorf("expression: column %d: %v", tok.pos+1, err)
+					}
+					return matchNode{subject: args[0], re: re}, p.scan()
+				}
+			}
+		}
+		return callNode{name: tok.text, args: args}, p.scan()
+
+	case exprOp:
+		if tok.text == "(" {
+			if err := p.scan(); err != nil {
+				return nil, err
+			}
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, p.errorf("expected ')'")
+			}
+			return inner, p.scan()
+		}
+	case exprEOF:
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
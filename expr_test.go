@@ -0,0 +1,36 @@
+package deproto_test
+
+import (
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestExprEval(t *testing.T) {
+	fields := deproto.NewMessage().String(1, "aaa").Varint(2, 10).Build()
+	for src, want := range map[string]any{
+		"010":                         int64(10),
+		"010 == field(2)":             true,
+		"1.5e1":                       15.0,
+		`matches(field(1), "^a+$")`:   true,
+		`matches(field(1), "^b")`:     false,
+		`matches(field(2), "1")`:      false,
+		`matches(field(1), field(1))`: true,
+		`field(1) < 5`:                false,
+		`field(2) < 11`:               true,
+	} {
+		e, err := deproto.CompileExpr(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got, err := e.Eval(fields); err != nil || got != want {
+			t.Errorf("%s = %v (%v), want %v", src, got, err, want)
+		}
+	}
+	for _, src := range []string{`matches(field(1), "(")`, "0x10"} {
+		if _, err := deproto.CompileExpr(src); err == nil {
+			t.Errorf("%s compiled, want an error", src)
+		}
+	}
+}
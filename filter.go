@@ -0,0 +1,81 @@
+package deproto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldRange is an inclusive range of field numbers.
+type FieldRange struct {
+	Min, Max int
+}
+
+// FieldSet is a set of field numbers, as a list of ranges.
+type FieldSet []FieldRange
+
+// ParseFieldSet parses a comma-separated list of field numbers and ranges,
+// such as "1,3-5,100".
+func ParseFieldSet(s string) (FieldSet, error) {
+	var set FieldSet
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			hi = lo
+		}
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field number %q", lo)
+		}
+		last, err := strconv.Atoi(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field number %q", hi)
+		}
+		if first < MinFieldNumber || last > MaxFieldNumber || first > last {
+			return nil, fmt.Errorf("invalid field range %q", part)
+		}
+		set = append(set, FieldRange{first, last})
+	}
+	return set, nil
+}
+
+// Contains reports whether the set holds the field number.
+func (s FieldSet) Contains(number int) bool {
+	for _, r := range s {
+		if number >= r.Min && number <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyDepth is the FieldFilter depth whose sets apply at every depth.
+const AnyDepth = -1
+
+// FieldFilter selects the fields decoded by field number and depth, the
+// top level being depth 0. Fields filtered out are skipped using their
+// lengths, without decoding their payloads, and left out of the result, so
+// a decoded message filtered this way does not encode back to its input.
+// A payload whose fields are all filtered out is not a message.
+type FieldFilter struct {
+	// Include, if it has a set for a depth or AnyDepth, limits the fields
+	// decoded at that depth to the numbers in the set.
+	Include map[int]FieldSet
+
+	// Exclude skips the field numbers in the set for a depth or AnyDepth.
+	Exclude map[int]FieldSet
+}
+
+// skip reports whether the field with the given number at depth is
+// filtered out.
+func (f *FieldFilter) skip(depth, number int) bool {
+	for _, d := range [2]int{depth, AnyDepth} {
+		if set, ok := f.Include[d]; ok && !set.Contains(number) {
+			return true
+		}
+		if f.Exclude[d].Contains(number) {
+			return true
+		}
+	}
+	return false
+}
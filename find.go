@@ -0,0 +1,289 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Find returns every field located at path, in the order they appear. A path
+// segment matches all occurrences of a repeated field, so several fields may
+// be returned.
+func Find(fields []Field, path FieldPath) []Field {
+	var found []Field
+	Walk(fields, func(p FieldPath, f Field) bool {
+		if len(p) > len(path) || !p.Equal(path[:len(p)]) {
+			return false
+		}
+		if len(p) == len(path) {
+			found = append(found, f)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// DecodePath decodes only the fields located at path, like Find applied to
+// the result of DecodeFields. Other fields are skipped using their lengths
+// without being decoded, and only the messages along the path are parsed,
+// so extracting a few fields from a large message is cheap.
+func DecodePath(data []byte, path FieldPath) ([]Field, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	var found []Field
+	if err := decodePath(data, path, &found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// decodePath appends the fields at path within data to found.
+func decodePath(data []byte, path FieldPath, found *[]Field) error {
+	for len(data) > 0 {
+		id, wireType, start, end, err := fieldExtent(data, nil)
+		if err != nil {
+			return err
+		}
+		switch {
+		case id != path[0]:
+		case len(path) == 1:
+			f, _, err := DecodeField(data[:end])
+			if err != nil {
+				return err
+			}
+			*found = append(*found, f)
+		case wireType == WireBytes && nestedMessage(data[start:end]):
+			if err := decodePath(data[start:end], path[1:], found); err != nil {
+				return err
+			}
+		}
+		data = data[end:]
+	}
+	return nil
+}
+
+// nestedMessage reports whether DecodeFields reads a payload as a nested
+// message: one or more fields that cover all of its bytes, within the
+// limits of checkNested, and not text as scalarText tells it. Anything else
+// is a string or bytes.
+func nestedMessage(payload []byte) bool {
+	count, maxID := 0, 0
+	scalars := true
+	for pos := 0; pos < len(payload); count++ {
+		id, wireType, _, end, err := fieldExtent(payload[pos:], nil)
+		if err != nil {
+			return false
+		}
+		maxID = max(maxID, id)
+		scalars = scalars && wireType != WireBytes
+		pos += end
+	}
+	if scalars && isPrintableString(payload) {
+		return false
+	}
+	return count > 0 && DecodeOptions{}.checkNestedShape(count, maxID) == nil
+}
+
+// fieldExtent reads the key of the field at the start of data, written in
+// dialect d, and returns its number and wire type, where its value starts
+// and where the field ends.
+func fieldExtent(data []byte, d *Dialect) (id, wireType, start, end int, err error) {
+	id, wireType, n, _, err := d.readTag(data)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	switch wireType {
+	case WireVarint:
+		_, m := binary.Uvarint(data[n:])
+		if m <= 0 {
+			return 0, 0, 0, 0, fmt.Errorf("failed to read varint value")
+		}
+		return id, wireType, n, n + m, nil
+	case WireFixed64:
+		if len(data) < n+8 {
+			return 0, 0, 0, 0, fmt.Errorf("not enough data for fixed64")
+		}
+		return id, wireType, n, n + 8, nil
+	case WireFixed32:
+		if len(data) < n+4 {
+			return 0, 0, 0, 0, fmt.Errorf("not enough data for fixed32")
+		}
+		return id, wireType, n, n + 4, nil
+	case WireBytes:
+		length, m := binary.Uvarint(data[n:])
+		if m <= 0 {
+			return 0, 0, 0, 0, fmt.Errorf("failed to read length of length-delimited field")
+		}
+		if length > uint64(len(data)-n-m) {
+			return 0, 0, 0, 0, fmt.Errorf("not enough data for length-delimited field")
+		}
+		return id, wireType, n + m, n + m + int(length), nil
+	default:
+		return 0, 0, 0, 0, fmt.Errorf("unknown wire type %d", wireType)
+	}
+}
+
+// Extract returns the raw value bytes of the first field at path in data:
+// the payload of a length-delimited field, the varint bytes of a varint
+// field, or the little-endian bytes of a fixed-width field.
+func Extract(data []byte, path FieldPath) ([]byte, error) {
+	found, err := DecodePath(data, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no field at path %s", path)
+	}
+	return valueBytes(found[0]), nil
+}
+
+// valueBytes returns the encoded value of a field, without its tag.
+func valueBytes(f Field) []byte {
+	switch v := f.(type) {
+	case *VarintField:
+		return binary.AppendUvarint(nil, v.Value)
+	case *Fixed64Field:
+		return binary.LittleEndian.AppendUint64(nil, v.Value)
+	case *Fixed32Field:
+		return binary.LittleEndian.AppendUint32(nil, v.Value)
+	case *LengthDelimitedField:
+		return v.payload()
+	default:
+		return nil
+	}
+}
+
+// Replace replaces the value of the first field at path in data with value
+// and returns the patched message. A length-delimited field takes value as
+// its new payload; a varint field requires value to be a single varint, and
+// fixed-width fields require exactly 4 or 8 little-endian bytes. Fields are
+// found as DecodeFields finds them. The value is spliced in place and only
+// the length prefixes of the field and the messages enclosing it are
+// rewritten, keeping their width where the new length fits, so every other
+// byte of the message is kept as it was.
+func Replace(data []byte, path FieldPath, value []byte) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	patched, ok, err := replaceIn(data, path, value)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no field at path %s", path)
+	}
+	return patched, nil
+}
+
+// replaceIn replaces the value of the first field at path within the
+// message data, reporting whether there is one. Every field of data is
+// read, so that a corrupt message is rejected as DecodeFields rejects it.
+func replaceIn(data []byte, path FieldPath, value []byte) ([]byte, bool, error) {
+	var patched []byte
+	found := false
+	for pos := 0; pos < len(data); {
+		id, wireType, start, end, err := fieldExtent(data[pos:], nil)
+		if err != nil {
+			return nil, false, err
+		}
+		field, rest := data[pos:pos+end], data[pos+end:]
+		switch {
+		case found || id != path[0]:
+		case len(path) == 1:
+			if err := checkValueBytes(wireType, value); err != nil {
+				return nil, false, fmt.Errorf("field %s: %v", path, err)
+			}
+			patched, found = spliceValue(data[:pos], field, start, wireType, value, rest), true
+		case wireType == WireBytes && nestedMessage(field[start:]):
+			sub, ok, err := replaceIn(field[start:], path[1:], value)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				patched, found = spliceValue(data[:pos], field, start, wireType, sub, rest), true
+			}
+		}
+		pos += end
+	}
+	return patched, found, nil
+}
+
+// spliceValue returns the message made of head, the field with its value
+// replaced and rest. The value of field starts at start; a length-delimited
+// field gets a new length prefix, as wide as the old one if it fits.
+func spliceValue(head, field []byte, start, wireType int, value, rest []byte) []byte {
+	out := append([]byte(nil), head...)
+	if wireType != WireBytes {
+		out = append(out, field[:start]...)
+	} else {
+		_, n := binary.Uvarint(field)
+		out = append(out, field[:n]...)
+		out = appendUvarintWidth(out, uint64(len(value)), start-n)
+	}
+	out = append(out, value...)
+	return append(out, rest...)
+}
+
+// appendUvarintWidth appends v as a varint padded with continuation bytes to
+// width bytes, or in its minimal form if it does not fit.
+func appendUvarintWidth(b []byte, v uint64, width int) []byte {
+	if uvarintLen(v) >= width {
+		return binary.AppendUvarint(b, v)
+	}
+	for range width - 1 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// checkValueBytes checks that value can be the encoded value of a field of
+// the given wire type.
+func checkValueBytes(wireType int, value []byte) error {
+	switch wireType {
+	case WireVarint:
+		if _, n := binary.Uvarint(value); n <= 0 || n != len(value) {
+			return fmt.Errorf("value is not a single varint")
+		}
+	case WireFixed64:
+		if len(value) != 8 {
+			return fmt.Errorf("fixed64 value must be 8 bytes, got %d", len(value))
+		}
+	case WireFixed32:
+		if len(value) != 4 {
+			return fmt.Errorf("fixed32 value must be 4 bytes, got %d", len(value))
+		}
+	}
+	return nil
+}
+
+// setValueBytes is the inverse of valueBytes.
+func setValueBytes(f Field, value []byte) error {
+	base := fieldBase(f)
+	if base == nil {
+		return fmt.Errorf("unsupported field type %T", f)
+	}
+	if err := checkValueBytes(base.WireType, value); err != nil {
+		return err
+	}
+	switch v := f.(type) {
+	case *VarintField:
+		v.Value, _ = binary.Uvarint(value)
+	case *Fixed64Field:
+		v.Value = binary.LittleEndian.Uint64(value)
+	case *Fixed32Field:
+		v.Value = binary.LittleEndian.Uint32(value)
+	case *LengthDelimitedField:
+		v.Data = value
+		v.SubFields = nil
+		v.IsString = false
+		v.StringValue = ""
+		v.Packed = nil
+		v.Wrapping = ""
+		v.Padding = 0
+		v.EmptyMessage = false
+		v.lazy = nil
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package deproto_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+	"github.com/bluefalconhd/deproto/protobridge"
+)
+
+func TestDecodePathMatchesFind(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 20000 {
+		data := protobridge.RandomMessage(r, 3)
+		fields, err := deproto.DecodeFields(data)
+		if err != nil {
+			t.Fatalf("%x: %v", data, err)
+		}
+		// Follow the fields of a random branch, so that paths lead
+		// somewhere, and also ask for a field past its end.
+		var path deproto.FieldPath
+		for level := fields; len(level) > 0; {
+			f := level[r.Intn(len(level))]
+			path = append(path, fieldID(f))
+			level = nil
+			if l, ok := f.(*deproto.LengthDelimitedField); ok && l.Wrapping == "" {
+				level = l.SubFields
+			}
+		}
+		if len(path) == 0 {
+			continue
+		}
+		path = append(path, 1+r.Intn(20))
+		for n := 1; n <= len(path); n++ {
+			want := deproto.Encode(deproto.Find(fields, path[:n]))
+			found, err := deproto.DecodePath(data, path[:n])
+			if err != nil {
+				t.Fatalf("%x %s: %v", data, path[:n], err)
+			}
+			if got := deproto.Encode(found); !bytes.Equal(got, want) {
+				t.Fatalf("%x %s: DecodePath finds %x, Find %x", data, path[:n], got, want)
+			}
+		}
+	}
+}
+
+// fieldID returns the number of a field.
+func fieldID(f deproto.Field) int {
+	switch v := f.(type) {
+	case *deproto.VarintField:
+		return v.ID
+	case *deproto.Fixed64Field:
+		return v.ID
+	case *deproto.Fixed32Field:
+		return v.ID
+	case *deproto.LengthDelimitedField:
+		return v.ID
+	}
+	return 0
+}
+
+func TestReplaceKeepsOtherBytes(t *testing.T) {
+	// Field 1 holds 1 in a padded varint, and field 3 a message whose
+	// length, 4, is padded to two bytes, holding the string "ab".
+	data := []byte{0x08, 0x81, 0x00, 0x1a, 0x84, 0x00, 0x0a, 0x02, 'a', 'b', 0x20, 0x07}
+	got, err := deproto.Replace(data, deproto.FieldPath{3, 1}, []byte("xyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x08, 0x81, 0x00, 0x1a, 0x85, 0x00, 0x0a, 0x03, 'x', 'y', 'z', 0x20, 0x07}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	got, err = deproto.Replace(data, deproto.FieldPath{4}, []byte{0x82, 0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(data[:11:11], 0x82, 0x01); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	if _, err := deproto.Replace(data, deproto.FieldPath{4}, []byte{0x82}); err == nil {
+		t.Error("replacing a varint with a truncated one succeeded")
+	}
+	if _, err := deproto.Replace(data, deproto.FieldPath{5}, []byte("x")); err == nil {
+		t.Error("replacing a missing field succeeded")
+	}
+}
+
+func TestReplaceRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 5000 {
+		data := protobridge.RandomMessage(r, 3)
+		fields, err := deproto.DecodeFields(data)
+		if err != nil || len(fields) == 0 {
+			continue
+		}
+		var path deproto.FieldPath
+		var target deproto.Field
+		for level := fields; len(level) > 0; {
+			target = level[r.Intn(len(level))]
+			path = append(path, fieldID(target))
+			level = nil
+			if l, ok := target.(*deproto.LengthDelimitedField); ok && l.Wrapping == "" && r.Intn(2) == 0 {
+				level = l.SubFields
+			}
+		}
+		if _, ok := deproto.Find(fields, path)[0].(*deproto.LengthDelimitedField); !ok {
+			continue
+		}
+		value := make([]byte, r.Intn(200))
+		for i := range value {
+			value[i] = byte(' ' + r.Intn(95))
+		}
+		patched, err := deproto.Replace(data, path, value)
+		if err != nil {
+			t.Fatalf("%x %s: %v", data, path, err)
+		}
+		if got, err := deproto.Extract(patched, path); err != nil || !bytes.Equal(got, value) {
+			t.Fatalf("%x %s: patched to %x, which holds %q (%v)", data, path, patched, got, err)
+		}
+	}
+}
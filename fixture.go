@@ -0,0 +1,180 @@
+package deproto
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FixtureOptions controls GenerateFixture.
+type FixtureOptions struct {
+	Package string // Package of the generated file; "fixtures" if empty
+	Name    string // Variable holding the message; "fixture" if empty
+	Source  string // Where the message came from, named in the variable's comment
+
+	// Bytes writes the message as a byte literal, a line per key, value,
+	// length or payload commented as Explain describes it, instead of as
+	// MessageBuilder calls. Byte literals keep every byte of a message,
+	// including those MessageBuilder cannot reproduce.
+	Bytes bool
+}
+
+// fixtureBytesPerLine is how many bytes of a long span a line of a byte
+// literal fixture holds.
+const fixtureBytesPerLine = 12
+
+// GenerateFixture returns Go source declaring a variable that holds a
+// message, to use a captured message in unit tests as a readable fixture.
+// By default the variable is built with MessageBuilder calls, which name
+// each field's number and value, and nested messages are built in place:
+//
+//	var fixture = deproto.NewMessage().
+//		Varint(1, 150).
+//		Message(2, deproto.NewMessage().
+//			String(1, "hello")).
+//		Encode()
+//
+// Messages that MessageBuilder would not encode to the same bytes, such as
+// those with padded varints or that do not decode, are only written as byte
+// literals.
+func GenerateFixture(data []byte, opts FixtureOptions) ([]byte, error) {
+	if opts.Package == "" {
+		opts.Package = "fixtures"
+	}
+	if opts.Name == "" {
+		opts.Name = "fixture"
+	}
+	for _, name := range []string{opts.Package, opts.Name} {
+		if !isIdentifier(name) {
+			return nil, fmt.Errorf("%q is not a Go identifier", name)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\n", opts.Package)
+	if !opts.Bytes {
+		b.WriteString("import \"github.com/bluefalconhd/deproto\"\n\n")
+	}
+	if opts.Source != "" {
+		fmt.Fprintf(&b, "// %s holds the message of %s, generated by deproto.\n", opts.Name, opts.Source)
+	} else {
+		fmt.Fprintf(&b, "// %s was generated by deproto.\n", opts.Name)
+	}
+	fmt.Fprintf(&b, "var %s = ", opts.Name)
+	if opts.Bytes {
+		fixtureBytes(&b, data)
+	} else {
+		fields, err := DecodeFields(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v; write the message as bytes instead", err)
+		}
+		if !bytes.Equal(Encode(fields), data) {
+			return nil, fmt.Errorf("message does not re-encode to the same bytes, as with padded varints; write it as bytes instead")
+		}
+		fixtureBuilder(&b, fields, 0)
+		b.WriteString(".\n\tEncode()\n")
+	}
+
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// fixtureBytes writes data as a byte literal commented span by span. Gofmt
+// lines up the elements of the literal, so nesting shows only in the
+// comments on nested messages.
+func fixtureBytes(b *strings.Builder, data []byte) {
+	b.WriteString("[]byte{\n")
+	DecodeOptions{}.explainSpans(data, func(s explainSpan) {
+		const indent = "\t"
+		if s.message || s.end-s.start > fixtureBytesPerLine {
+			fmt.Fprintf(b, "%s// %s: %s\n", indent, byteRange(s.start, s.end), s.text)
+		}
+		if s.message {
+			return
+		}
+		for start := s.start; start < s.end; start += fixtureBytesPerLine {
+			b.WriteString(indent)
+			for i, c := range data[start:min(start+fixtureBytesPerLine, s.end)] {
+				if i > 0 {
+					b.WriteByte(' ')
+				}
+				fmt.Fprintf(b, "0x%02x,", c)
+			}
+			if s.end-s.start <= fixtureBytesPerLine {
+				fmt.Fprintf(b, " // %s: %s", byteRange(s.start, s.end), s.text)
+			}
+			b.WriteByte('\n')
+		}
+	})
+	b.WriteString("}\n")
+}
+
+// fixtureBuilder writes a MessageBuilder chain building fields, its calls
+// indented one level deeper than depth. The chain is left open, for the
+// caller to close.
+func fixtureBuilder(b *strings.Builder, fields []Field, depth int) {
+	indent := strings.Repeat("\t", depth+1)
+	b.WriteString("deproto.NewMessage()")
+	for _, f := range fields {
+		b.WriteString(".\n")
+		switch v := f.(type) {
+		case *VarintField:
+			if int64(v.Value) < 0 {
+				fmt.Fprintf(b, "%sInt(%d, %d)", indent, v.ID, int64(v.Value))
+			} else {
+				fmt.Fprintf(b, "%sVarint(%d, %d)", indent, v.ID, v.Value)
+			}
+		case *Fixed64Field:
+			if x := math.Float64frombits(v.Value); plainFloat(x, 64) {
+				fmt.Fprintf(b, "%sDouble(%d, %s)", indent, v.ID, strconv.FormatFloat(x, 'g', -1, 64))
+			} else {
+				fmt.Fprintf(b, "%sFixed64(%d, 0x%x)", indent, v.ID, v.Value)
+			}
+		case *Fixed32Field:
+			if x := float64(math.Float32frombits(v.Value)); plainFloat(x, 32) {
+				fmt.Fprintf(b, "%sFloat(%d, %s)", indent, v.ID, strconv.FormatFloat(x, 'g', -1, 32))
+			} else {
+				fmt.Fprintf(b, "%sFixed32(%d, 0x%x)", indent, v.ID, v.Value)
+			}
+		case *LengthDelimitedField:
+			switch {
+			case v.EmptyMessage:
+				fmt.Fprintf(b, "%sMessage(%d, deproto.NewMessage())", indent, v.ID)
+			case len(v.SubFields) > 0 && v.Wrapping == "":
+				fmt.Fprintf(b, "%sMessage(%d, ", indent, v.ID)
+				fixtureBuilder(b, v.SubFields, depth+1)
+				b.WriteString(")")
+			case v.IsString && v.Padding == 0:
+				fmt.Fprintf(b, "%sString(%d, %s)", indent, v.ID, strconv.Quote(v.StringValue))
+			case len(v.SubFields) > 0:
+				fmt.Fprintf(b, "%s// %s text holding %s\n", indent, v.Wrapping, messageOf(v.SubFields))
+				fmt.Fprintf(b, "%sBytes(%d, []byte(%s))", indent, v.ID, strconv.Quote(string(v.payload())))
+			case len(v.Data) == 0 && v.Padding == 0:
+				fmt.Fprintf(b, "%sBytes(%d, nil)", indent, v.ID)
+			default:
+				fmt.Fprintf(b, "%sBytes(%d, []byte(%s))", indent, v.ID, strconv.Quote(string(v.payload())))
+			}
+		}
+	}
+}
+
+// plainFloat reports whether x, a float of the given bit size, is a number
+// that reads naturally in decimal and converts back to the same bits, so
+// that a fixture can show it as a float rather than as bits.
+func plainFloat(x float64, bitSize int) bool {
+	if math.IsNaN(x) || math.IsInf(x, 0) || x == 0 && math.Signbit(x) {
+		return false
+	}
+	if x != 0 && (math.Abs(x) < 1e-6 || math.Abs(x) >= 1e15) {
+		return false
+	}
+	s := strconv.FormatFloat(x, 'g', -1, bitSize)
+	back, err := strconv.ParseFloat(s, bitSize)
+	return err == nil && back == x && len(s) <= 20
+}
@@ -0,0 +1,75 @@
+package deproto
+
+import "fmt"
+
+// FramingKind is the way messages are framed in a buffer.
+type FramingKind int
+
+const (
+	FramingUnknown   FramingKind = iota // No framing fits: not protobuf, or corrupt
+	FramingRaw                          // A single message without framing
+	FramingDelimited                    // Messages each preceded by a varint length
+	FramingGRPC                         // gRPC or gRPC-Web frames: a flag byte and a big-endian 32-bit length
+)
+
+// String returns a short name for the framing kind.
+func (k FramingKind) String() string {
+	switch k {
+	case FramingUnknown:
+		return "unknown"
+	case FramingRaw:
+		return "raw"
+	case FramingDelimited:
+		return "delimited"
+	case FramingGRPC:
+		return "grpc"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// DetectFraming guesses how the messages in a binary buffer are framed, so
+// that a payload can be routed before it is decoded, and returns the guess
+// with a rough confidence between 0 and 1. Data that decodes as one message
+// is raw, with less confidence when it also splits into several
+// varint-delimited messages; otherwise data that splits exactly into gRPC
+// frames or varint-delimited messages, each of which decodes, is framed so.
+// Text encodings and captures are not considered; see DetectInputFormat.
+func DetectFraming(data []byte) (FramingKind, float64) {
+	if len(data) == 0 {
+		return FramingRaw, 0
+	}
+	delimited := countMessages(SplitDelimited(data))
+	if _, err := DecodeFields(data); err == nil {
+		if delimited > 1 {
+			return FramingRaw, 0.6
+		}
+		return FramingRaw, 0.9
+	}
+	// A gRPC header starts with a flag byte that is never a valid key, so
+	// framed data cannot also be a raw message.
+	if frames, _, err := parseGRPCFrames(data); countMessages(frames, err) > 0 {
+		return FramingGRPC, 0.95
+	}
+	switch {
+	case delimited > 1:
+		return FramingDelimited, 0.9
+	case delimited == 1:
+		return FramingDelimited, 0.7
+	}
+	return FramingUnknown, 0
+}
+
+// countMessages returns the number of messages a framing split data into,
+// or 0 if the split failed or any of them does not decode.
+func countMessages(messages [][]byte, err error) int {
+	if err != nil {
+		return 0
+	}
+	for _, m := range messages {
+		if _, err := DecodeFields(m); err != nil {
+			return 0
+		}
+	}
+	return len(messages)
+}
@@ -1 +1,8 @@
-module github.com/bluefalconhd/deproto
\ No newline at end of file
+module github.com/bluefalconhd/deproto
+
+go 1.24
+
+require (
+	golang.org/x/text v0.25.0
+	google.golang.org/protobuf v1.36.12
+)
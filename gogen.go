@@ -0,0 +1,291 @@
+package deproto
+
+import (
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// GenerateGo returns Go source for package pkg declaring a struct for every
+// message in the schema, with Marshal and Unmarshal methods built on
+// google.golang.org/protobuf/encoding/protowire, and a named integer type
+// with constants for every enum.
+//
+// Nested types are named Parent_Child. Fields use plain Go types; singular
+// fields are written when they are non-zero or required, and oneof members
+// become ordinary fields. Fields that a struct does not declare are kept in
+// its UnknownFields and written back by Marshal. A field whose Go name is
+// taken, by UnknownFields, a method or another field, gets a trailing
+// underscore, as protoc-gen-go does.
+func GenerateGo(s *Schema, pkg string) ([]byte, error) {
+	g := &goGenerator{schema: s, names: make(map[string]string)}
+	s.eachMessage(func(m *MessageSchema) { g.names[m.FullName] = flatName(s, m.FullName) })
+	eachEnum(s, func(e *EnumSchema) { g.names[e.FullName] = flatName(s, e.FullName) })
+
+	var body strings.Builder
+	g.b = &body
+	eachEnum(s, g.enum)
+	var err error
+	s.eachMessage(func(m *MessageSchema) {
+		if err == nil {
+			err = g.message(m)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out strings.Builder
+	out.WriteString("// Code generated by deproto. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg)
+	if g.usesMath {
+		out.WriteString("\t\"math\"\n\n")
+	}
+	out.WriteString("\t\"google.golang.org/protobuf/encoding/protowire\"\n)\n")
+	out.WriteString(body.String())
+	src, err := format.Source([]byte(out.String()))
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// eachEnum calls fn for every enum in the schema, top-level ones first.
+func eachEnum(s *Schema, fn func(e *EnumSchema)) {
+	for _, e := range s.Enums {
+		fn(e)
+	}
+	s.eachMessage(func(m *MessageSchema) {
+		for _, e := range m.Enums {
+			fn(e)
+		}
+	})
+}
+
+type goGenerator struct {
+	schema   *Schema
+	names    map[string]string // Full names of declared types to Go type names
+	b        *strings.Builder
+	usesMath bool
+}
+
+// flatName derives a type name for generated code from a full name by
+// dropping the package and joining nesting levels with underscores.
+func flatName(s *Schema, fullName string) string {
+	if s.Package != "" {
+		fullName = strings.TrimPrefix(fullName, s.Package+".")
+	}
+	return strings.ReplaceAll(fullName, ".", "_")
+}
+
+func (g *goGenerator) enum(e *EnumSchema) {
+	name := g.names[e.FullName]
+	fmt.Fprintf(g.b, "\ntype %s int32\n\nconst (\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(g.b, "\t%s_%s %s = %d\n", name, v.Name, name, v.Number)
+	}
+	g.b.WriteString(")\n")
+}
+
+// goScalar describes how a scalar type maps to Go and to protowire.
+type goScalar struct {
+	goType  string
+	wire    string // protowire wire type constant
+	consume string // protowire function reading the value
+	decode  string // Converts the consumed value x to goType
+	encode  string // Converts the Go value v for appending
+	append  string // protowire function appending the value
+	zero    string // Zero-value comparison for v
+}
+
+var goScalars = map[string]goScalar{
+	"int32":    {"int32", "VarintType", "ConsumeVarint", "int32(x)", "uint64(v)", "AppendVarint", "v != 0"},
+	"int64":    {"int64", "VarintType", "ConsumeVarint", "int64(x)", "uint64(v)", "AppendVarint", "v != 0"},
+	"uint32":   {"uint32", "VarintType", "ConsumeVarint", "uint32(x)", "uint64(v)", "AppendVarint", "v != 0"},
+	"uint64":   {"uint64", "VarintType", "ConsumeVarint", "x", "v", "AppendVarint", "v != 0"},
+	"sint32":   {"int32", "VarintType", "ConsumeVarint", "int32(protowire.DecodeZigZag(x))", "protowire.EncodeZigZag(int64(v))", "AppendVarint", "v != 0"},
+	"sint64":   {"int64", "VarintType", "ConsumeVarint", "protowire.DecodeZigZag(x)", "protowire.EncodeZigZag(v)", "AppendVarint", "v != 0"},
+	"bool":     {"bool", "VarintType", "ConsumeVarint", "protowire.DecodeBool(x)", "protowire.EncodeBool(v)", "AppendVarint", "v"},
+	"fixed32":  {"uint32", "Fixed32Type", "ConsumeFixed32", "x", "v", "AppendFixed32", "v != 0"},
+	"sfixed32": {"int32", "Fixed32Type", "ConsumeFixed32", "int32(x)", "uint32(v)", "AppendFixed32", "v != 0"},
+	"float":    {"float32", "Fixed32Type", "ConsumeFixed32", "math.Float32frombits(x)", "math.Float32bits(v)", "AppendFixed32", "v != 0"},
+	"fixed64":  {"uint64", "Fixed64Type", "ConsumeFixed64", "x", "v", "AppendFixed64", "v != 0"},
+	"sfixed64": {"int64", "Fixed64Type", "ConsumeFixed64", "int64(x)", "uint64(v)", "AppendFixed64", "v != 0"},
+	"double":   {"float64", "Fixed64Type", "ConsumeFixed64", "math.Float64frombits(x)", "math.Float64bits(v)", "AppendFixed64", "v != 0"},
+	"string":   {"string", "BytesType", "ConsumeString", "x", "v", "AppendString", `v != ""`},
+	"bytes":    {"[]byte", "BytesType", "ConsumeBytes", "append([]byte(nil), x...)", "v", "AppendBytes", "len(v) > 0"},
+}
+
+// scalar returns the Go mapping of a non-message field.
+func (g *goGenerator) scalar(f *FieldSchema) (goScalar, error) {
+	if sc, ok := goScalars[f.Type]; ok {
+		if f.Type == "float" || f.Type == "double" {
+			g.usesMath = true
+		}
+		return sc, nil
+	}
+	if f.Enum != nil {
+		name, ok := g.names[f.Enum.FullName]
+		if !ok {
+			return goScalar{}, fmt.Errorf("field %s: enum %s is not declared in the schema", f.Name, f.Enum.FullName)
+		}
+		return goScalar{name, "VarintType", "ConsumeVarint", name + "(x)", "uint64(v)", "AppendVarint", "v != 0"}, nil
+	}
+	return goScalar{}, fmt.Errorf("field %s: unresolved type %s", f.Name, f.Type)
+}
+
+func (g *goGenerator) message(m *MessageSchema) error {
+	name := g.names[m.FullName]
+	type goField struct {
+		*FieldSchema
+		goName  string
+		goType  string // Element type for repeated fields
+		sc      goScalar
+		message bool
+	}
+	// Field names must not collide with each other, nor with the
+	// UnknownFields field and the methods generated for every message.
+	taken := map[string]bool{"UnknownFields": true, "Marshal": true, "Unmarshal": true}
+	var fields []goField
+	for _, f := range m.Fields {
+		gf := goField{FieldSchema: f, goName: goFieldName(f.Name)}
+		for taken[gf.goName] {
+			gf.goName += "_"
+		}
+		taken[gf.goName] = true
+		if f.Message != nil {
+			typ, ok := g.names[f.Message.FullName]
+			if !ok {
+				return fmt.Errorf("field %s: message %s is not declared in the schema", f.Name, f.Message.FullName)
+			}
+			gf.goType, gf.message = "*"+typ, true
+		} else {
+			sc, err := g.scalar(f)
+			if err != nil {
+				return err
+			}
+			gf.goType, gf.sc = sc.goType, sc
+		}
+		fields = append(fields, gf)
+	}
+
+	b := g.b
+	fmt.Fprintf(b, "\ntype %s struct {\n", name)
+	for _, f := range fields {
+		typ := f.goType
+		if f.Label == LabelRepeated {
+			typ = "[]" + typ
+		}
+		fmt.Fprintf(b, "\t%s %s // %d\n", f.goName, typ, f.Number)
+	}
+	b.WriteString("\n\t// UnknownFields holds fields not declared in the schema, as raw wire data.\n")
+	b.WriteString("\tUnknownFields []byte\n}\n")
+
+	fmt.Fprintf(b, "\n// Marshal encodes the message in the protobuf wire format.\n")
+	fmt.Fprintf(b, "func (m *%s) Marshal() ([]byte, error) {\n\treturn m.appendWire(nil), nil\n}\n", name)
+	fmt.Fprintf(b, "\nfunc (m *%s) appendWire(b []byte) []byte {\n", name)
+	for _, f := range fields {
+		value := "m." + f.goName
+		switch {
+		case f.message && f.Label == LabelRepeated:
+			fmt.Fprintf(b, "\tfor _, v := range %s {\n", value)
+			fmt.Fprintf(b, "\t\tb = protowire.AppendTag(b, %d, protowire.BytesType)\n", f.Number)
+			b.WriteString("\t\tb = protowire.AppendBytes(b, v.appendWire(nil))\n\t}\n")
+		case f.message:
+			fmt.Fprintf(b, "\tif v := %s; v != nil {\n", value)
+			fmt.Fprintf(b, "\t\tb = protowire.AppendTag(b, %d, protowire.BytesType)\n", f.Number)
+			b.WriteString("\t\tb = protowire.AppendBytes(b, v.appendWire(nil))\n\t}\n")
+		case f.Label == LabelRepeated && f.Packed:
+			fmt.Fprintf(b, "\tif len(%s) > 0 {\n\t\tvar p []byte\n", value)
+			fmt.Fprintf(b, "\t\tfor _, v := range %s {\n\t\t\tp = protowire.%s(p, %s)\n\t\t}\n", value, f.sc.append, f.sc.encode)
+			fmt.Fprintf(b, "\t\tb = protowire.AppendTag(b, %d, protowire.BytesType)\n", f.Number)
+			b.WriteString("\t\tb = protowire.AppendBytes(b, p)\n\t}\n")
+		case f.Label == LabelRepeated:
+			fmt.Fprintf(b, "\tfor _, v := range %s {\n", value)
+			fmt.Fprintf(b, "\t\tb = protowire.AppendTag(b, %d, protowire.%s)\n", f.Number, f.sc.wire)
+			fmt.Fprintf(b, "\t\tb = protowire.%s(b, %s)\n\t}\n", f.sc.append, f.sc.encode)
+		default:
+			cond := f.sc.zero
+			if f.Label == LabelRequired {
+				cond = "true"
+			}
+			fmt.Fprintf(b, "\tif v := %s; %s {\n", value, cond)
+			fmt.Fprintf(b, "\t\tb = protowire.AppendTag(b, %d, protowire.%s)\n", f.Number, f.sc.wire)
+			fmt.Fprintf(b, "\t\tb = protowire.%s(b, %s)\n\t}\n", f.sc.append, f.sc.encode)
+		}
+	}
+	b.WriteString("\treturn append(b, m.UnknownFields...)\n}\n")
+
+	fmt.Fprintf(b, "\n// Unmarshal decodes the message from the protobuf wire format, replacing\n// its contents.\n")
+	fmt.Fprintf(b, "func (m *%s) Unmarshal(b []byte) error {\n\t*m = %s{}\n", name, name)
+	b.WriteString("\tfor len(b) > 0 {\n\t\tnum, typ, n := protowire.ConsumeTag(b)\n")
+	b.WriteString("\t\tif n < 0 {\n\t\t\treturn protowire.ParseError(n)\n\t\t}\n")
+	b.WriteString("\t\tfield := b\n\t\tb = b[n:]\n\t\tswitch {\n")
+	for _, f := range fields {
+		value := "m." + f.goName
+		switch {
+		case f.message:
+			fmt.Fprintf(b, "\t\tcase num == %d && typ == protowire.BytesType:\n", f.Number)
+			b.WriteString("\t\t\tx, n := protowire.ConsumeBytes(b)\n")
+			b.WriteString("\t\t\tif n < 0 {\n\t\t\t\treturn protowire.ParseError(n)\n\t\t\t}\n")
+			fmt.Fprintf(b, "\t\t\tv := new(%s)\n", strings.TrimPrefix(f.goType, "*"))
+			b.WriteString("\t\t\tif err := v.Unmarshal(x); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n")
+			if f.Label == LabelRepeated {
+				fmt.Fprintf(b, "\t\t\t%s = append(%s, v)\n", value, value)
+			} else {
+				fmt.Fprintf(b, "\t\t\t%s = v\n", value)
+			}
+			b.WriteString("\t\t\tb = b[n:]\n")
+		default:
+			fmt.Fprintf(b, "\t\tcase num == %d && typ == protowire.%s:\n", f.Number, f.sc.wire)
+			fmt.Fprintf(b, "\t\t\tx, n := protowire.%s(b)\n", f.sc.consume)
+			b.WriteString("\t\t\tif n < 0 {\n\t\t\t\treturn protowire.ParseError(n)\n\t\t\t}\n")
+			if f.Label == LabelRepeated {
+				fmt.Fprintf(b, "\t\t\t%s = append(%s, %s)\n", value, value, f.sc.decode)
+			} else {
+				fmt.Fprintf(b, "\t\t\t%s = %s\n", value, f.sc.decode)
+			}
+			b.WriteString("\t\t\tb = b[n:]\n")
+			if f.Label == LabelRepeated && f.sc.wire != "BytesType" {
+				// Accept both packed and unpacked encodings, as parsers must.
+				fmt.Fprintf(b, "\t\tcase num == %d && typ == protowire.BytesType:\n", f.Number)
+				b.WriteString("\t\t\tp, n := protowire.ConsumeBytes(b)\n")
+				b.WriteString("\t\t\tif n < 0 {\n\t\t\t\treturn protowire.ParseError(n)\n\t\t\t}\n")
+				b.WriteString("\t\t\tfor len(p) > 0 {\n")
+				fmt.Fprintf(b, "\t\t\t\tx, n := protowire.%s(p)\n", f.sc.consume)
+				b.WriteString("\t\t\t\tif n < 0 {\n\t\t\t\t\treturn protowire.ParseError(n)\n\t\t\t\t}\n")
+				fmt.Fprintf(b, "\t\t\t\t%s = append(%s, %s)\n", value, value, f.sc.decode)
+				b.WriteString("\t\t\t\tp = p[n:]\n\t\t\t}\n")
+				b.WriteString("\t\t\tb = b[n:]\n")
+			}
+		}
+	}
+	b.WriteString("\t\tdefault:\n\t\t\tn := protowire.ConsumeFieldValue(num, typ, b)\n")
+	b.WriteString("\t\t\tif n < 0 {\n\t\t\t\treturn protowire.ParseError(n)\n\t\t\t}\n")
+	b.WriteString("\t\t\tb = b[n:]\n")
+	b.WriteString("\t\t\tm.UnknownFields = append(m.UnknownFields, field[:len(field)-len(b)]...)\n")
+	b.WriteString("\t\t}\n\t}\n\treturn nil\n}\n")
+	return nil
+}
+
+// goFieldName converts a field name such as user_id to an exported Go name
+// such as UserId.
+func goFieldName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	if b.Len() == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "F" + b.String()
+	}
+	return b.String()
+}
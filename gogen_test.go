@@ -0,0 +1,61 @@
+package deproto_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestGenerateGoNameCollisions(t *testing.T) {
+	schema, _, err := deproto.ParseProto("collide.proto", `
+syntax = "proto3";
+package collide;
+message M {
+  string unknown_fields = 1;
+  int32 UnknownFields = 2;
+  bool marshal = 3;
+  bytes foo_bar = 4;
+  uint64 FooBar = 5;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := deproto.GenerateGo(schema, "collide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "collide.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+			names[fn.Name.Name] = true
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		st, ok := n.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		for _, f := range st.Fields.List {
+			for _, name := range f.Names {
+				if names[name.Name] {
+					t.Errorf("%s declared twice", name.Name)
+				}
+				names[name.Name] = true
+			}
+		}
+		return false
+	})
+	for _, want := range []string{"UnknownFields_", "UnknownFields__", "Marshal_", "FooBar", "FooBar_"} {
+		if !names[want] {
+			t.Errorf("no field %s in\n%s", want, src)
+		}
+	}
+}
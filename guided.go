@@ -0,0 +1,143 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DecodeMessage decodes data as the given message type. Length-delimited
+// fields declared in the schema are interpreted as it says (nested message,
+// string, bytes or packed scalars) instead of by heuristics; fields missing
+// from the schema are decoded as usual. Render the result with
+// RenderOptions.Schema set to show field names and typed values.
+func DecodeMessage(data []byte, schema *MessageSchema) ([]Field, error) {
+	return DecodeOptions{Schema: schema}.Decode(data)
+}
+
+// applySchema reinterprets length-delimited fields according to schema.
+func applySchema(fields []Field, schema *MessageSchema) {
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok {
+			continue
+		}
+		fs := schema.Field(l.ID)
+		if fs == nil {
+			continue
+		}
+		switch {
+		case fs.Message != nil:
+			sub, err := DecodeFields(l.Data)
+			if err != nil {
+				continue
+			}
+			applySchema(sub, fs.Message)
+			l.SubFields, l.IsString, l.StringValue = sub, false, ""
+		case fs.Type == "string":
+			l.SubFields, l.IsString, l.StringValue = nil, true, string(l.Data)
+		default:
+			l.SubFields, l.IsString, l.StringValue = nil, false, ""
+		}
+	}
+}
+
+// schemaField returns the schema of a field if it is declared in schema and
+// its wire data is compatible with the declaration.
+func schemaField(schema *MessageSchema, f Field) *FieldSchema {
+	if schema == nil {
+		return nil
+	}
+	base := fieldBase(f)
+	if base == nil {
+		return nil
+	}
+	fs := schema.Field(base.ID)
+	if fs == nil {
+		return nil
+	}
+	if base.WireType == fs.WireType() || fs.Label == LabelRepeated && base.WireType == WireBytes {
+		return fs
+	}
+	return nil
+}
+
+// formatScalar formats a varint or fixed-width value as the declared type.
+func formatScalar(value uint64, fs *FieldSchema) string {
+	switch fs.Type {
+	case "int32":
+		return strconv.FormatInt(int64(int32(value)), 10)
+	case "int64", "sfixed64":
+		return strconv.FormatInt(int64(value), 10)
+	case "sfixed32":
+		return strconv.FormatInt(int64(int32(uint32(value))), 10)
+	case "sint32", "sint64":
+		return strconv.FormatInt(int64(value>>1)^-int64(value&1), 10)
+	case "bool":
+		return strconv.FormatBool(value != 0)
+	case "double":
+		return strconv.FormatFloat(math.Float64frombits(value), 'g', -1, 64)
+	case "float":
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(value))), 'g', -1, 32)
+	}
+	if fs.Enum != nil {
+		n := int32(value)
+		for _, v := range fs.Enum.Values {
+			if v.Number == n {
+				return fmt.Sprintf("%s (%d)", v.Name, n)
+			}
+		}
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatUint(value, 10)
+}
+
+// formatPacked decodes a packed repeated scalar field and formats its values.
+func formatPacked(data []byte, fs *FieldSchema) (string, error) {
+	values, err := decodePacked(data, fs)
+	if err != nil {
+		return "", err
+	}
+	return formatValues(values, fs), nil
+}
+
+// formatValues formats the elements of a packed field as "[1, 2, 3]".
+func formatValues(values []uint64, fs *FieldSchema) string {
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		formatted[i] = formatScalar(v, fs)
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
+
+// decodePacked decodes the elements of a packed repeated scalar field.
+func decodePacked(data []byte, fs *FieldSchema) ([]uint64, error) {
+	var values []uint64
+	for len(data) > 0 {
+		var value uint64
+		switch fs.WireType() {
+		case WireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid packed varint")
+			}
+			value, data = v, data[n:]
+		case WireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated packed fixed64")
+			}
+			value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case WireFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated packed fixed32")
+			}
+			value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return nil, fmt.Errorf("type %s cannot be packed", fs.Type)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
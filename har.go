@@ -0,0 +1,155 @@
+package deproto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// HAREntry is a request of a HAR file, as exported from browser developer
+// tools, with the protobuf messages found in its bodies.
+type HAREntry struct {
+	Method   string
+	URL      string
+	Status   int
+	Started  time.Time
+	Duration time.Duration // Total time of the request, as the browser measured it
+
+	RequestType, ResponseType string   // Content types of the bodies
+	Request, Response         [][]byte // Messages in the bodies, gRPC framing removed
+	Errors                    []string // Bodies that were expected to hold messages but did not
+}
+
+// harFile holds the parts of a HAR file used by ReadHAR.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Time            float64   `json:"time"` // Milliseconds
+			Request         struct {
+				Method   string `json:"method"`
+				URL      string `json:"url"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ReadHAR returns the entries of a HAR file whose request or response body
+// has a protobuf, gRPC or gRPC-Web content type, in the order of the file.
+// gRPC framing is removed, so a body may hold several messages; the
+// trailers of gRPC-Web responses are dropped. Browsers save some binary
+// bodies as text rather than base64, and those may have been altered.
+func ReadHAR(data []byte) ([]HAREntry, error) {
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %v", err)
+	}
+	var entries []HAREntry
+	for _, e := range har.Log.Entries {
+		entry := HAREntry{
+			Method:       e.Request.Method,
+			URL:          e.Request.URL,
+			Status:       e.Response.Status,
+			Started:      e.StartedDateTime,
+			Duration:     time.Duration(e.Time * float64(time.Millisecond)),
+			ResponseType: e.Response.Content.MimeType,
+		}
+		found := false
+		if p := e.Request.PostData; p != nil && isProtoType(p.MimeType) {
+			found = true
+			entry.RequestType = p.MimeType
+			messages, err := harBody(p.MimeType, p.Text, p.Encoding)
+			if err != nil {
+				entry.Errors = append(entry.Errors, "request: "+err.Error())
+			}
+			entry.Request = messages
+		}
+		if c := e.Response.Content; isProtoType(c.MimeType) {
+			found = true
+			messages, err := harBody(c.MimeType, c.Text, c.Encoding)
+			if err != nil {
+				entry.Errors = append(entry.Errors, "response: "+err.Error())
+			}
+			entry.Response = messages
+		}
+		if found {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// isProtoType reports whether a content type is one of those used for
+// protobuf bodies, such as application/x-protobuf or
+// application/grpc-web+proto.
+func isProtoType(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(t, "protobuf") || strings.HasSuffix(t, "+proto") ||
+		t == "application/grpc" || strings.HasPrefix(t, "application/grpc-web")
+}
+
+// harBody returns the messages in a body saved in a HAR file.
+func harBody(contentType, text, encoding string) ([][]byte, error) {
+	body := []byte(text)
+	if encoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(text); err != nil {
+			return nil, fmt.Errorf("invalid base64 body: %v", err)
+		}
+	}
+	t, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(t, "application/grpc-web-text") {
+		var err error
+		if body, err = decodeGRPCWebText(body); err != nil {
+			return nil, err
+		}
+	}
+	if strings.HasPrefix(t, "application/grpc") {
+		return GRPCUnframe(body)
+	}
+	return [][]byte{body}, nil
+}
+
+// decodeGRPCWebText decodes a grpc-web-text body: base64 text, in which
+// every frame may be encoded separately with its own padding.
+func decodeGRPCWebText(text []byte) ([]byte, error) {
+	var out []byte
+	s := strings.TrimSpace(string(text))
+	for s != "" {
+		end := strings.Index(s, "=")
+		for end >= 0 && end+1 < len(s) && s[end+1] == '=' {
+			end++
+		}
+		chunk := s
+		if end >= 0 {
+			chunk, s = s[:end+1], s[end+1:]
+		} else {
+			s = ""
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc-web-text body: %v", err)
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+)
+
+// StructureHash returns a hash of the structural shape of a message: which
+// field numbers and wire types it contains, recursively for nested messages.
+// Values, field order and repetition are ignored, so two messages of the same
+// type usually hash equally even when their contents differ.
+func StructureHash(fields []Field) uint64 {
+	type entry struct {
+		key    FieldKey
+		nested uint64
+	}
+	seen := make(map[entry]bool)
+	var entries []entry
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		e := entry{key: FieldKey{ID: base.ID, WireType: base.WireType}}
+		if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+			e.nested = StructureHash(l.SubFields)
+		}
+		if !seen[e] {
+			seen[e] = true
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.key.ID != b.key.ID {
+			return a.key.ID < b.key.ID
+		}
+		if a.key.WireType != b.key.WireType {
+			return a.key.WireType < b.key.WireType
+		}
+		return a.nested < b.nested
+	})
+
+	h := fnv.New64a()
+	var buf [24]byte
+	for _, e := range entries {
+		binary.LittleEndian.PutUint64(buf[0:], uint64(e.key.ID))
+		binary.LittleEndian.PutUint64(buf[8:], uint64(e.key.WireType))
+		binary.LittleEndian.PutUint64(buf[16:], e.nested)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
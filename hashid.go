@@ -0,0 +1,48 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// digestNames lists common digest algorithms by output length in bytes.
+var digestNames = map[int][]string{
+	16: {"md5"},
+	20: {"sha-1", "ripemd-160"},
+	28: {"sha-224", "sha3-224"},
+	32: {"sha-256", "sha3-256", "blake2s"},
+	48: {"sha-384", "sha3-384"},
+	64: {"sha-512", "sha3-512", "blake2b"},
+}
+
+// HashCandidates returns the common digest algorithms whose output length
+// matches data, such as md5 for 16 bytes or sha-256 for 32. Only data that
+// looks random is considered, so structured values of the same length
+// return nil.
+func HashCandidates(data []byte) []string {
+	names := digestNames[len(data)]
+	if names == nil || AnalyzeBytes(data).Density < randomDensity {
+		return nil
+	}
+	return names
+}
+
+// HashLookup checks a possible digest against a database of known hashes,
+// such as a table of password or file hashes, and returns a description of
+// what it is a hash of. candidates are the algorithms matching its length.
+type HashLookup func(digest []byte, candidates []string) (desc string, ok bool)
+
+// hashNote returns the annotation for a possible digest: the lookup result
+// if there is one, and otherwise the candidate algorithms.
+func hashNote(data []byte, lookup HashLookup) string {
+	candidates := HashCandidates(data)
+	if candidates == nil {
+		return ""
+	}
+	if lookup != nil {
+		if desc, ok := lookup(data, candidates); ok {
+			return fmt.Sprintf(" (hash: %s)", desc)
+		}
+	}
+	return fmt.Sprintf(" (maybe %s)", strings.Join(candidates, "/"))
+}
@@ -0,0 +1,142 @@
+package deproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Heuristics selects the content heuristics used when decoding and
+// rendering, in one place, so that a configuration can be saved and every
+// run interprets data the same way. Guesses about field contents beyond
+// the basic message and string detection are off by default.
+type Heuristics struct {
+	NestedMessages bool `json:"nested_messages"` // Decode bytes that parse as messages as nested messages
+	Strings        bool `json:"strings"`         // Decode printable bytes as strings
+	UnwrapText     bool `json:"unwrap_text"`     // See DecodeOptions.UnwrapText
+	Embedded       bool `json:"embedded"`        // See DecodeOptions.Embedded
+	Struct         bool `json:"struct"`          // See RenderOptions.DetectStruct
+	Encodings      bool `json:"encodings"`       // See RenderOptions.DetectEncodings
+	Entropy        bool `json:"entropy"`         // See RenderOptions.Entropy
+	HashHints      bool `json:"hash_hints"`      // See RenderOptions.HashHints
+	Tokens         bool `json:"tokens"`          // See RenderOptions.DetectTokens
+	ExpandTokens   bool `json:"expand_tokens"`   // See RenderOptions.ExpandTokens
+	URLs           bool `json:"urls"`            // See RenderOptions.ExpandURLs
+	BigEndian      bool `json:"big_endian"`      // See RenderOptions.BigEndian
+	AnyPairs       bool `json:"any_pairs"`       // See RenderOptions.DetectAny
+	TFExample      bool `json:"tf_example"`      // See RenderOptions.DetectExample
+
+	// See DecodeOptions.MaxNestedFieldNumber and MaxNestedFields.
+	MaxNestedFieldNumber int `json:"max_nested_field_number,omitempty"`
+	MaxNestedFields      int `json:"max_nested_fields,omitempty"`
+
+	// TypeHints fixes how the fields at given paths are read, as in
+	// {"3.2": "packed-sfixed32", "5": "bytes"}. See DecodeOptions.TypeHints.
+	TypeHints map[string]WireHint `json:"type_hints,omitempty"`
+}
+
+// DefaultHeuristics returns the heuristics used by DecodeFields and
+// RenderFields with zero options: nested messages and strings only.
+func DefaultHeuristics() Heuristics {
+	return Heuristics{NestedMessages: true, Strings: true}
+}
+
+// DecodeOptions returns decode options applying the heuristics.
+func (h Heuristics) DecodeOptions() DecodeOptions {
+	return DecodeOptions{
+		NoNestedMessages:     !h.NestedMessages,
+		NoStrings:            !h.Strings,
+		UnwrapText:           h.UnwrapText,
+		Embedded:             h.Embedded,
+		TypeHints:            h.TypeHints,
+		MaxNestedFieldNumber: h.MaxNestedFieldNumber,
+		MaxNestedFields:      h.MaxNestedFields,
+	}
+}
+
+// RenderOptions returns render options applying the heuristics, with all
+// other options at their zero values.
+func (h Heuristics) RenderOptions() RenderOptions {
+	return RenderOptions{
+		DetectStruct:    h.Struct,
+		DetectEncodings: h.Encodings,
+		Entropy:         h.Entropy,
+		HashHints:       h.HashHints,
+		DetectTokens:    h.Tokens,
+		ExpandTokens:    h.ExpandTokens,
+		ExpandURLs:      h.URLs,
+		BigEndian:       h.BigEndian,
+		DetectAny:       h.AnyPairs,
+		DetectExample:   h.TFExample,
+	}
+}
+
+// LoadHeuristics reads heuristics from a JSON file, or from a TOML file if
+// the name ends in .toml. Settings missing from the file keep their
+// defaults, and unknown settings are an error. TOML files are limited to
+// top-level "name = true" or "name = 10" settings and comments, so type
+// hints can only be given in JSON.
+func LoadHeuristics(name string) (Heuristics, error) {
+	return LoadHeuristicsOver(DefaultHeuristics(), name)
+}
+
+// LoadHeuristicsOver is like LoadHeuristics, but settings missing from the
+// file keep their values in base rather than their defaults.
+func LoadHeuristicsOver(base Heuristics, name string) (Heuristics, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Heuristics{}, err
+	}
+	if strings.EqualFold(filepath.Ext(name), ".toml") {
+		if data, err = tomlToJSON(data); err != nil {
+			return Heuristics{}, fmt.Errorf("%s:%v", name, err)
+		}
+	}
+	h := base
+	h.TypeHints = maps.Clone(base.TypeHints)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&h); err != nil {
+		return Heuristics{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return h, nil
+}
+
+// tomlToJSON converts flat TOML of boolean and integer settings to a JSON
+// object.
+func tomlToJSON(data []byte) ([]byte, error) {
+	settings := make(map[string]any)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%d: expected name = value", line)
+		}
+		value = strings.TrimSpace(value)
+		if value == "true" || value == "false" {
+			settings[strings.TrimSpace(key)] = value == "true"
+		} else if n, err := strconv.Atoi(value); err == nil {
+			settings[strings.TrimSpace(key)] = n
+		} else {
+			return nil, fmt.Errorf("%d: %s is not true, false or an integer", line, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(settings)
+}
@@ -0,0 +1,77 @@
+package deproto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// HexOptions controls how raw bytes are rendered.
+type HexOptions struct {
+	BytesPerLine int  // Bytes shown per line; 0 means 16
+	GroupSize    int  // Bytes per space-separated group; 0 means no grouping
+	ASCII        bool // Append an ASCII gutter to each line
+	MaxLines     int  // Lines shown before truncating; 0 means no limit
+}
+
+func (o HexOptions) bytesPerLine() int {
+	if o.BytesPerLine <= 0 {
+		return 16
+	}
+	return o.BytesPerLine
+}
+
+// FormatHex returns data as hex dump lines. Data that fits on one line is
+// returned as a single line without an offset column; longer data gets one
+// line per BytesPerLine bytes, each prefixed with its offset.
+func FormatHex(data []byte, opts HexOptions) []string {
+	perLine := opts.bytesPerLine()
+	if len(data) <= perLine {
+		return []string{hexLine(data, perLine, opts, false)}
+	}
+
+	var lines []string
+	for off := 0; off < len(data); off += perLine {
+		if opts.MaxLines > 0 && len(lines) == opts.MaxLines {
+			lines = append(lines, fmt.Sprintf("... (%d more bytes)", len(data)-off))
+			break
+		}
+		end := min(off+perLine, len(data))
+		lines = append(lines, fmt.Sprintf("%04x: %s", off, hexLine(data[off:end], perLine, opts, true)))
+	}
+	return lines
+}
+
+// hexLine formats one line of bytes. When pad is set, short lines are padded
+// so that the ASCII gutter stays aligned with full lines.
+func hexLine(data []byte, perLine int, opts HexOptions, pad bool) string {
+	var b strings.Builder
+	group := opts.GroupSize
+	for i, c := range data {
+		if group > 0 && i > 0 && i%group == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(hex.EncodeToString([]byte{c}))
+	}
+	if !opts.ASCII {
+		return b.String()
+	}
+	if pad {
+		for i := len(data); i < perLine; i++ {
+			if group > 0 && i > 0 && i%group == 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString("  ")
+		}
+	}
+	b.WriteString("  |")
+	for _, c := range data {
+		if c >= 0x20 && c < 0x7f {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('.')
+		}
+	}
+	b.WriteString("|")
+	return b.String()
+}
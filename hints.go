@@ -0,0 +1,95 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// WireHint fixes how the decoder reads a length-delimited field, overriding
+// its heuristics (see DecodeOptions.TypeHints).
+type WireHint struct {
+	As Interpretation
+
+	// Type is the element type for the packed interpretations, such as
+	// "sint32" or "sfixed32". It defaults to uint64, fixed32 or fixed64.
+	Type string
+}
+
+// ParseWireHint parses a hint written as an interpretation name, such as
+// "bytes" or "packed-varint", or as "packed-" followed by a scalar type, such
+// as "packed-sfixed32".
+func ParseWireHint(s string) (WireHint, error) {
+	if as, err := ParseInterpretation(s); err == nil {
+		return WireHint{As: as, Type: packedTypes[as]}, nil
+	}
+	typ, ok := strings.CutPrefix(s, "packed-")
+	wireType, packable := packedWireType(typ)
+	if !ok || !packable {
+		return WireHint{}, fmt.Errorf("unknown type hint %q", s)
+	}
+	as := AsPackedVarint
+	switch wireType {
+	case WireFixed32:
+		as = AsPackedFixed32
+	case WireFixed64:
+		as = AsPackedFixed64
+	}
+	return WireHint{As: as, Type: typ}, nil
+}
+
+// String returns the hint in the form accepted by ParseWireHint.
+func (h WireHint) String() string {
+	if h.Type != "" && h.Type != packedTypes[h.As] {
+		return "packed-" + h.Type
+	}
+	return h.As.String()
+}
+
+// MarshalText encodes the hint as its String form.
+func (h WireHint) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes a hint with ParseWireHint.
+func (h *WireHint) UnmarshalText(text []byte) error {
+	hint, err := ParseWireHint(string(text))
+	if err != nil {
+		return err
+	}
+	*h = hint
+	return nil
+}
+
+// applyHint reads the payload of a length-delimited field as the hint says.
+// It returns an error, leaving the field untouched, if the payload cannot be
+// read that way.
+func (o DecodeOptions) applyHint(l *LengthDelimitedField, hint WireHint, offset int, path FieldPath) error {
+	switch hint.As {
+	case AsBytes:
+	case AsString:
+		if !utf8.Valid(l.Data) {
+			return fmt.Errorf("payload is not valid UTF-8")
+		}
+		l.IsString, l.StringValue = true, string(l.Data)
+	case AsMessage:
+		fields, err := o.decode(l.Data, offset, path)
+		if err != nil {
+			return err
+		}
+		l.SubFields = fields
+	case AsPackedVarint, AsPackedFixed32, AsPackedFixed64:
+		typ := hint.Type
+		if typ == "" {
+			typ = packedTypes[hint.As]
+		}
+		values, err := decodePacked(l.Data, &FieldSchema{Type: typ})
+		if err != nil {
+			return err
+		}
+		l.Packed = &Packed{Type: typ, Values: values}
+	default:
+		return fmt.Errorf("unknown interpretation %s", hint.As)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package deproto
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of hash bits a hyperLogLog uses to pick a
+// register; 2^12 registers give estimates within about 1.6%.
+const hllPrecision = 12
+
+// hyperLogLog estimates the number of distinct strings added to it in a
+// fixed 4 KiB, using the HyperLogLog algorithm of Flajolet et al. with the
+// linear counting correction for small cardinalities.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+// add adds a value to the set.
+func (h *hyperLogLog) add(value string) {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	x := mix64(f.Sum64())
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// estimate returns the estimated number of distinct values added.
+func (h *hyperLogLog) estimate() int {
+	const m = float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(e))
+}
+
+// mix64 is the finalizer of SplitMix64, which spreads the bits of an FNV
+// hash evenly enough for the leading zero counts HyperLogLog relies on.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
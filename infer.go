@@ -0,0 +1,526 @@
+package deproto
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// InferOptions controls schema inference.
+type InferOptions struct {
+	Package     string // Package name of the generated schema
+	MessageName string // Name of the root message; "Message" if empty
+	Syntax      string // "proto2" (default) or "proto3"
+
+	// Naming overrides generated names, keeping them stable when a schema
+	// is regenerated from new captures. See SchemaNaming.
+	Naming *Naming
+
+	// ShareTypes, if positive, is the similarity from 0 to 1 at which nested
+	// messages found at different paths are believed to be of one type, as
+	// ClusterMessages groups them. Such messages get a single top-level
+	// message type, inferred from all of them, instead of one per path.
+	ShareTypes float64
+}
+
+// Naming maps field paths to the names used for them in an inferred schema.
+type Naming struct {
+	Messages map[string]string `json:"messages,omitempty"` // Path of a message field to its type name
+	Fields   map[string]string `json:"fields,omitempty"`   // Path of a field to its field name
+}
+
+// InferSchema infers a schema from a corpus of messages of the same type.
+//
+// Field types are chosen from the observed wire data: varints become int64
+// (or bool when only 0 and 1 occur), fixed-width fields become double or
+// float when every value is a plausible number and fixed64/fixed32
+// otherwise, and length-delimited fields become nested messages, strings or
+// bytes. A field is repeated if it occurs more than once in any message, and
+// required if it occurs in every one of at least two messages. Runs of
+// optional fields that never occur together are emitted as oneofs.
+//
+// Nested messages are named after a constant string they contain when there
+// is one (for example a type URL or kind tag), and Msg_<path> otherwise.
+// With ShareTypes, messages of one cluster share the type named after the
+// first path it is found at.
+func InferSchema(corpus [][]Field, opts InferOptions) *Schema {
+	name := opts.MessageName
+	if name == "" {
+		name = "Message"
+	}
+	syntax := opts.Syntax
+	if syntax == "" {
+		syntax = "proto2"
+	}
+	n := newInferrer(opts.Naming, 2)
+	if opts.ShareTypes > 0 {
+		n.share(ClusterMessages(corpus, opts.ShareTypes))
+	}
+	return n.schema(name, syntax, opts.Package, corpus)
+}
+
+// setFullNames fills in the FullName of every message and enum.
+func setFullNames(s *Schema) {
+	var visit func(prefix string, msgs []*MessageSchema, enums []*EnumSchema)
+	visit = func(prefix string, msgs []*MessageSchema, enums []*EnumSchema) {
+		for _, e := range enums {
+			e.FullName = prefix + e.Name
+		}
+		for _, m := range msgs {
+			m.FullName = prefix + m.Name
+			visit(m.FullName+".", m.Nested, m.Enums)
+		}
+	}
+	prefix := ""
+	if s.Package != "" {
+		prefix = s.Package + "."
+	}
+	visit(prefix, s.Messages, s.Enums)
+}
+
+// fieldObservation accumulates what was seen of one field number across the
+// instances of a message.
+type fieldObservation struct {
+	number     int
+	instances  int // Instances containing the field
+	maxPerMsg  int // Most occurrences within one instance
+	wireTypes  map[int]int
+	nonBool    bool // A varint other than 0 or 1 was seen
+	implausFP  bool // A fixed value that is not a plausible float was seen
+	ldMessages int
+	ldStrings  int
+	ldBytes    int
+	children   [][]Field
+}
+
+func inferMessage(name string, path FieldPath, instances [][]Field, n *inferrer) *MessageSchema {
+	msg := &MessageSchema{Name: name}
+	fillMessage(msg, path, instances, n)
+	return msg
+}
+
+// fillMessage infers the fields of msg, the type of the instances found at
+// path.
+func fillMessage(msg *MessageSchema, path FieldPath, instances [][]Field, n *inferrer) {
+	observations := make(map[int]*fieldObservation)
+	presence := make([]map[int]int, 0, len(instances))
+	for _, fields := range instances {
+		counts := make(map[int]int)
+		presence = append(presence, counts)
+		for _, f := range fields {
+			base := fieldBase(f)
+			if base == nil {
+				continue
+			}
+			obs, ok := observations[base.ID]
+			if !ok {
+				obs = &fieldObservation{number: base.ID, wireTypes: make(map[int]int)}
+				observations[base.ID] = obs
+			}
+			counts[base.ID]++
+			obs.wireTypes[base.WireType]++
+			observeValue(obs, f)
+		}
+		for id, n := range counts {
+			obs := observations[id]
+			obs.instances++
+			obs.maxPerMsg = max(obs.maxPerMsg, n)
+		}
+	}
+
+	numbers := make([]int, 0, len(observations))
+	for id := range observations {
+		numbers = append(numbers, id)
+	}
+	sort.Ints(numbers)
+	for _, id := range numbers {
+		obs := observations[id]
+		fieldPath := path.Append(id)
+		field := &FieldSchema{Name: n.fieldName(fieldPath), Number: id}
+		switch {
+		case obs.maxPerMsg > 1:
+			field.Label = LabelRepeated
+		case obs.instances == len(instances) && len(instances) >= n.minRequired:
+			field.Label = LabelRequired
+		}
+
+		wireType := dominantWireType(obs.wireTypes)
+		if len(obs.wireTypes) > 1 {
+			field.Comment = "wire types varied: " + describeWireTypes(obs.wireTypes)
+		}
+		field.Type = inferType(obs, wireType)
+		if field.Type == "" {
+			nested := n.sharedMessage(fieldPath)
+			if nested == nil {
+				nested = inferMessage(n.messageName(fieldPath, obs.children), fieldPath, obs.children, n)
+				msg.Nested = append(msg.Nested, nested)
+			}
+			field.Type = nested.Name
+			field.Message = nested
+		}
+		msg.Fields = append(msg.Fields, field)
+	}
+	detectOneofs(msg, presence)
+}
+
+// minOneofInstances is the number of message instances needed before fields
+// that never co-occur are believed to be mutually exclusive.
+const minOneofInstances = 4
+
+// detectOneofs groups fields into oneofs. A group is a run of consecutive
+// optional fields (by field number) of which no instance contains more than
+// one; such runs are how oneofs are typically declared.
+func detectOneofs(msg *MessageSchema, presence []map[int]int) {
+	if len(presence) < minOneofInstances {
+		return
+	}
+	exclusive := func(a, b int) bool {
+		for _, counts := range presence {
+			if counts[a] > 0 && counts[b] > 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	var group []*FieldSchema
+	flush := func() {
+		if len(group) >= 2 {
+			name := fmt.Sprintf("oneof_%d", group[0].Number)
+			for _, f := range group {
+				f.Oneof = name
+			}
+		}
+		group = nil
+	}
+	for _, f := range msg.Fields {
+		if f.Label != LabelOptional {
+			flush()
+			continue
+		}
+		for _, member := range group {
+			if !exclusive(member.Number, f.Number) {
+				flush()
+				break
+			}
+		}
+		group = append(group, f)
+	}
+	flush()
+}
+
+// inferrer holds the state of one schema inference.
+type inferrer struct {
+	naming      *Naming
+	used        map[string]bool // Message names already taken
+	minRequired int             // Instances needed before a field can be required
+
+	shared   map[string]*sharedType // Types shared by several paths, by path
+	topLevel []*MessageSchema       // Shared types inferred so far
+}
+
+// sharedType is a message type found at several paths.
+type sharedType struct {
+	instances [][]Field // The messages at all of its paths
+	message   *MessageSchema
+}
+
+func newInferrer(naming *Naming, minRequired int) *inferrer {
+	if naming == nil {
+		naming = &Naming{}
+	}
+	return &inferrer{naming: naming, used: make(map[string]bool), minRequired: minRequired}
+}
+
+func (n *inferrer) schema(name, syntax, pkg string, corpus [][]Field) *Schema {
+	n.used[name] = true
+	root := inferMessage(name, nil, corpus, n)
+	schema := &Schema{Syntax: syntax, Package: pkg, Messages: append([]*MessageSchema{root}, n.topLevel...)}
+	setFullNames(schema)
+	return schema
+}
+
+// share makes the clusters found at more than one path shared types. Each
+// path belongs to the cluster holding most of the messages found at it.
+func (n *inferrer) share(clusters []*MessageCluster) {
+	counts := make(map[string]map[*MessageCluster]int)
+	members := make(map[string][][]Field)
+	for _, c := range clusters {
+		for _, m := range c.Members {
+			key := m.Path.String()
+			if counts[key] == nil {
+				counts[key] = make(map[*MessageCluster]int)
+			}
+			counts[key][c]++
+			members[key] = append(members[key], m.Fields)
+		}
+	}
+	paths := make(map[*MessageCluster][]string)
+	for _, c := range clusters {
+		for _, path := range c.Paths() {
+			key := path.String()
+			best := c
+			for other, count := range counts[key] {
+				if count > counts[key][best] || count == counts[key][best] && slices.Index(clusters, other) < slices.Index(clusters, best) {
+					best = other
+				}
+			}
+			if best == c {
+				paths[c] = append(paths[c], key)
+			}
+		}
+	}
+	n.shared = make(map[string]*sharedType)
+	for _, c := range clusters {
+		if len(paths[c]) < 2 {
+			continue
+		}
+		t := &sharedType{}
+		for _, key := range paths[c] {
+			t.instances = append(t.instances, members[key]...)
+			n.shared[key] = t
+		}
+	}
+}
+
+// sharedMessage returns the shared type of the messages at path, inferring
+// it when it is first met, or nil if they have a type of their own.
+func (n *inferrer) sharedMessage(path FieldPath) *MessageSchema {
+	t := n.shared[path.String()]
+	if t == nil {
+		return nil
+	}
+	if t.message == nil {
+		// The type is recorded before its fields are inferred, as it may
+		// contain itself.
+		t.message = &MessageSchema{Name: n.messageName(path, t.instances)}
+		n.topLevel = append(n.topLevel, t.message)
+		fillMessage(t.message, path, t.instances, n)
+	}
+	return t.message
+}
+
+func (n *inferrer) fieldName(path FieldPath) string {
+	if name := n.naming.Fields[path.String()]; name != "" {
+		return name
+	}
+	return fmt.Sprintf("field_%d", path[len(path)-1])
+}
+
+// messageName picks a unique name for the message type at path, preferring
+// the naming map, then a hint from the message contents, then Msg_<path>.
+func (n *inferrer) messageName(path FieldPath, instances [][]Field) string {
+	name := n.naming.Messages[path.String()]
+	if name == "" {
+		name = nameHint(instances)
+	}
+	if name == "" {
+		name = "Msg_" + strings.ReplaceAll(path.String(), ".", "_")
+	}
+	unique := name
+	for i := 2; n.used[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	n.used[unique] = true
+	return unique
+}
+
+// nameHint derives a message name from a string field that holds the same
+// value in every instance, such as "type.googleapis.com/acme.User" or
+// "user_profile", returning "" if there is none.
+func nameHint(instances [][]Field) string {
+	if len(instances) < 2 {
+		return ""
+	}
+	values := make(map[int]string)
+	constant := make(map[int]bool)
+	seen := make(map[int]int)
+	for _, fields := range instances {
+		for _, f := range fields {
+			l, ok := f.(*LengthDelimitedField)
+			if !ok || !l.IsString {
+				continue
+			}
+			seen[l.ID]++
+			if prev, ok := values[l.ID]; !ok {
+				values[l.ID], constant[l.ID] = l.StringValue, true
+			} else if prev != l.StringValue {
+				constant[l.ID] = false
+			}
+		}
+	}
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if !constant[id] || seen[id] != len(instances) {
+			continue
+		}
+		if name := identifierName(values[id]); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// identifierName converts a type-like string to a CamelCase message name: the
+// last segment after any '/' or '.', with '_' and '-' removed. It returns ""
+// when the segment is not a plausible identifier.
+func identifierName(s string) string {
+	if i := strings.LastIndexAny(s, "/."); i >= 0 {
+		s = s[i+1:]
+	}
+	if len(s) < 2 || len(s) > 40 || s[0] >= '0' && s[0] <= '9' {
+		return ""
+	}
+	var b strings.Builder
+	upper := true
+	for _, c := range s {
+		switch {
+		case c == '_' || c == '-':
+			upper = true
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			if upper {
+				b.WriteString(strings.ToUpper(string(c)))
+				upper = false
+			} else {
+				b.WriteRune(c)
+			}
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// SchemaNaming returns the naming map of an inferred schema, keyed by field
+// path from its first message. Save it, edit it, and pass it back through
+// InferOptions.Naming to keep names stable across regenerations.
+func SchemaNaming(s *Schema) *Naming {
+	naming := &Naming{Messages: make(map[string]string), Fields: make(map[string]string)}
+	if len(s.Messages) == 0 {
+		return naming
+	}
+	var visit func(path FieldPath, m *MessageSchema, seen map[*MessageSchema]bool)
+	visit = func(path FieldPath, m *MessageSchema, seen map[*MessageSchema]bool) {
+		if seen[m] {
+			return
+		}
+		seen[m] = true
+		for _, f := range m.Fields {
+			fieldPath := path.Append(f.Number)
+			naming.Fields[fieldPath.String()] = f.Name
+			if f.Message != nil {
+				naming.Messages[fieldPath.String()] = f.Message.Name
+				visit(fieldPath, f.Message, seen)
+			}
+		}
+		delete(seen, m)
+	}
+	visit(nil, s.Messages[0], make(map[*MessageSchema]bool))
+	return naming
+}
+
+// observeValue records the properties of one field occurrence.
+func observeValue(obs *fieldObservation, f Field) {
+	switch v := f.(type) {
+	case *VarintField:
+		if v.Value > 1 {
+			obs.nonBool = true
+		}
+	case *Fixed64Field:
+		if !plausibleFloat(math.Float64frombits(v.Value)) {
+			obs.implausFP = true
+		}
+	case *Fixed32Field:
+		if !plausibleFloat(float64(math.Float32frombits(v.Value))) {
+			obs.implausFP = true
+		}
+	case *LengthDelimitedField:
+		switch {
+		case len(v.SubFields) > 0 || v.EmptyMessage:
+			obs.ldMessages++
+			obs.children = append(obs.children, v.SubFields)
+		case v.IsString && len(v.Data) > 0:
+			obs.ldStrings++
+		case len(v.Data) > 0:
+			obs.ldBytes++
+		}
+	}
+}
+
+// inferType picks a scalar type for an observed field, or returns "" when the
+// field holds a nested message.
+func inferType(obs *fieldObservation, wireType int) string {
+	switch wireType {
+	case WireVarint:
+		if !obs.nonBool && obs.instances > 1 {
+			return "bool"
+		}
+		return "int64"
+	case WireFixed64:
+		if obs.implausFP {
+			return "fixed64"
+		}
+		return "double"
+	case WireFixed32:
+		if obs.implausFP {
+			return "fixed32"
+		}
+		return "float"
+	default:
+		// The decoder only falls back to a string or raw bytes when the data
+		// does not parse as a message, so a single such occurrence rules the
+		// message interpretation out.
+		switch {
+		case obs.ldBytes > 0:
+			return "bytes"
+		case obs.ldStrings > 0:
+			return "string"
+		case obs.ldMessages > 0:
+			return ""
+		default:
+			return "bytes"
+		}
+	}
+}
+
+// plausibleFloat reports whether a value looks like a deliberately stored
+// float rather than reinterpreted integer bits.
+func plausibleFloat(f float64) bool {
+	if f == 0 {
+		return true
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return false
+	}
+	abs := math.Abs(f)
+	return abs >= 1e-9 && abs <= 1e15
+}
+
+func dominantWireType(counts map[int]int) int {
+	best, bestCount := 0, -1
+	for wt, n := range counts {
+		if n > bestCount || n == bestCount && wt < best {
+			best, bestCount = wt, n
+		}
+	}
+	return best
+}
+
+func describeWireTypes(counts map[int]int) string {
+	types := make([]int, 0, len(counts))
+	for wt := range counts {
+		types = append(types, wt)
+	}
+	sort.Ints(types)
+	parts := make([]string, len(types))
+	for i, wt := range types {
+		parts[i] = fmt.Sprintf("%s x%d", wireTypeString(wt), counts[wt])
+	}
+	return strings.Join(parts, ", ")
+}
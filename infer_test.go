@@ -0,0 +1,71 @@
+package deproto_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestInferSchemaSharesTypes(t *testing.T) {
+	user := func(i int) *deproto.MessageBuilder {
+		return deproto.NewMessage().Varint(1, uint64(i)).String(2, fmt.Sprintf("user%d", i))
+	}
+	var corpus [][]deproto.Field
+	for i := range 4 {
+		data := deproto.NewMessage().
+			Message(1, user(i)).
+			Message(2, user(i+10)).
+			Message(3, deproto.NewMessage().Message(2, user(i+20))).
+			Message(4, deproto.NewMessage().Fixed32(5, 1)).
+			Encode()
+		fields, err := deproto.DecodeFields(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus = append(corpus, fields)
+	}
+
+	schema := deproto.InferSchema(corpus, deproto.InferOptions{ShareTypes: 0.9})
+	root := schema.Messages[0]
+	owner, creator, wrapper, other := root.Field(1), root.Field(2), root.Field(3), root.Field(4)
+	if owner.Message == nil || owner.Message != creator.Message || wrapper.Message.Field(2).Message != owner.Message {
+		t.Errorf("fields 1, 2 and 3.2 have types %s, %s and %s, want one shared type", owner.Type, creator.Type, wrapper.Message.Field(2).Type)
+	}
+	if other.Message == nil || len(root.Nested) != 2 || root.Nested[1] != other.Message {
+		t.Errorf("field 4 has type %s, want its own nested type", other.Type)
+	}
+	if len(schema.Messages) != 2 {
+		t.Errorf("schema has %d top-level messages, want the root and the shared type:\n%s", len(schema.Messages), schema.Proto())
+	}
+	if _, err := deproto.NewRegistry().AddSource("inferred.proto", schema.Proto()); err != nil {
+		t.Errorf("inferred schema does not load: %v\n%s", err, schema.Proto())
+	}
+
+	unshared := deproto.InferSchema(corpus, deproto.InferOptions{})
+	if root := unshared.Messages[0]; root.Field(1).Message == root.Field(2).Message {
+		t.Errorf("fields 1 and 2 share a type without ShareTypes")
+	}
+}
+
+func TestBestSchemaNoFit(t *testing.T) {
+	r := deproto.NewRegistry()
+	if _, err := r.AddSource("m.proto", `syntax = "proto3"; message M { string name = 1; }`); err != nil {
+		t.Fatal(err)
+	}
+	candidates := []*deproto.MessageSchema{r.Message("M")}
+	fits, err := deproto.DecodeFields(deproto.NewMessage().String(1, "x").Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deproto.BestSchema(fits, candidates); got != candidates[0] {
+		t.Errorf("BestSchema = %v, want M", got)
+	}
+	misfit, err := deproto.DecodeFields(deproto.NewMessage().Fixed32(7, 1).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deproto.BestSchema(misfit, candidates); got != nil {
+		t.Errorf("BestSchema = %s for a message it explains nothing of, want nil", got.FullName)
+	}
+}
@@ -0,0 +1,210 @@
+package deproto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Input formats recognized by DetectInputFormat and ReadMessages.
+const (
+	InputBinary    = "binary"    // A single encoded message
+	InputHex       = "hex"       // A message as hex text, as copied from a debugger or log
+	InputBase64    = "base64"    // A message as base64 text
+	InputPcap      = "pcap"      // A pcap or pcapng capture; each TCP or UDP payload is a message
+	InputDelimited = "delimited" // Messages each preceded by a varint length
+	InputGRPC      = "grpc"      // Messages in gRPC frames, as in a captured gRPC or gRPC-Web body
+	InputTFRecord  = "tfrecord"  // A TFRecord file of messages, such as tf.Example records
+	InputSnappy    = "snappy"    // A snappy-compressed message, as in a Prometheus remote write body
+)
+
+// InputFormats lists the input formats, in the order DetectInputFormat tries
+// them. Snappy compression is never detected, so it comes last.
+var InputFormats = []string{InputPcap, InputTFRecord, InputHex, InputBase64, InputBinary, InputDelimited, InputGRPC, InputSnappy}
+
+// DetectInputFormat guesses the format of input data. Captures are recognized
+// by their magic number, TFRecord files by the checksum of their first
+// header and text formats by their alphabet, unless the data decodes as
+// protobuf and the text it spells does not. Other data is framed as
+// DetectFraming reports: binary if it decodes as one message or nothing
+// fits, and otherwise a delimited stream or gRPC frames.
+func DetectInputFormat(data []byte) string {
+	switch {
+	case IsPcap(data):
+		return InputPcap
+	case IsTFRecord(data):
+		return InputTFRecord
+	case isHexText(data) && !rawNotText(data, parseHexText):
+		return InputHex
+	case isBase64Text(data) && !rawNotText(data, parseBase64Text):
+		return InputBase64
+	}
+	switch kind, _ := DetectFraming(data); kind {
+	case FramingDelimited:
+		return InputDelimited
+	case FramingGRPC:
+		return InputGRPC
+	}
+	return InputBinary
+}
+
+// ReadMessages extracts the encoded messages from input data in the given
+// format, or in the format DetectInputFormat reports if format is "" or "auto".
+// Each message is returned as a Record named after its position, or after
+// the packet for captures. The payloads of a capture are those
+// CapturePayloads returns, and payloads holding several gRPC frames or
+// delimited messages are split into them.
+func ReadMessages(data []byte, format string) ([]*Record, error) {
+	if format == "" || format == "auto" {
+		format = DetectInputFormat(data)
+	}
+	switch format {
+	case InputBinary:
+		return []*Record{{Name: "message 1", Data: data}}, nil
+	case InputHex:
+		decoded, err := parseHexText(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*Record{{Name: "message 1", Data: decoded}}, nil
+	case InputBase64:
+		decoded, err := parseBase64Text(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*Record{{Name: "message 1", Data: decoded}}, nil
+	case InputPcap:
+		packets, err := ReadPcap(data)
+		if err != nil {
+			return nil, err
+		}
+		var records []*Record
+		for i, p := range CapturePayloads(packets) {
+			records = append(records, PacketRecords("packet "+strconv.Itoa(i+1)+" "+p.String(), p)...)
+		}
+		return records, nil
+	case InputDelimited:
+		messages, err := SplitDelimited(data)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]*Record, len(messages))
+		for i, m := range messages {
+			records[i] = &Record{Name: "message " + strconv.Itoa(i+1), Data: m}
+		}
+		return records, nil
+	case InputTFRecord:
+		messages, err := ReadTFRecords(data)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]*Record, len(messages))
+		for i, m := range messages {
+			records[i] = &Record{Name: "record " + strconv.Itoa(i+1), Data: m}
+		}
+		return records, nil
+	case InputGRPC:
+		messages, err := GRPCUnframe(data)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]*Record, len(messages))
+		for i, m := range messages {
+			records[i] = &Record{Name: "message " + strconv.Itoa(i+1), Data: m}
+		}
+		return records, nil
+	case InputSnappy:
+		decoded, err := DecodeSnappy(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*Record{{Name: "message 1", Data: decoded}}, nil
+	default:
+		return nil, fmt.Errorf("unknown input format %q", format)
+	}
+}
+
+// rawNotText reports whether data, text that parse decodes, is rather a
+// message whose bytes all happen to be hex digits, base64 characters or
+// whitespace: data decodes as protobuf and the decoded text does not.
+func rawNotText(data []byte, parse func([]byte) ([]byte, error)) bool {
+	if decoded, err := parse(data); err == nil && isEncoded(decoded) {
+		return false
+	}
+	return isEncoded(data)
+}
+
+// isEncoded reports whether data decodes as a message or as framed
+// messages.
+func isEncoded(data []byte) bool {
+	kind, _ := DetectFraming(data)
+	return kind != FramingUnknown
+}
+
+// isHexText reports whether data is hex text (see parseHexText).
+func isHexText(data []byte) bool {
+	decoded, err := parseHexText(data)
+	return err == nil && len(decoded) > 0
+}
+
+// parseHexText decodes hex text as copied from a debugger or log, ignoring
+// whitespace, colons and 0x prefixes.
+func parseHexText(data []byte) ([]byte, error) {
+	text := strings.NewReplacer("0x", "", "0X", "", ":", "").Replace(string(data))
+	decoded, err := hex.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %v", err)
+	}
+	return decoded, nil
+}
+
+// isBase64Text reports whether data is base64 text, allowing line breaks.
+// Short or single-case text is not taken for base64 (see DecodeBase64).
+func isBase64Text(data []byte) bool {
+	_, ok := DecodeBase64(strings.Join(strings.Fields(string(data)), ""))
+	return ok
+}
+
+// parseBase64Text decodes base64 text in any of the variants of
+// textWrappings, ignoring line breaks.
+func parseBase64Text(data []byte) ([]byte, error) {
+	text := strings.Join(strings.Fields(string(data)), "")
+	for _, w := range textWrappings {
+		if decoded, err := w.enc.DecodeString(text); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64")
+}
+
+// PacketRecords returns the messages of a captured payload as records
+// named after it: the gRPC frames or delimited messages DetectFraming finds
+// in it, named "NAME message N" if there are several, or the whole payload.
+// The records take the time of the packet, and its protocol, addresses and
+// stream as metadata.
+func PacketRecords(name string, p Packet) []*Record {
+	var messages [][]byte
+	var err error
+	switch kind, _ := DetectFraming(p.Payload); kind {
+	case FramingGRPC:
+		messages, err = GRPCUnframe(p.Payload)
+	case FramingDelimited:
+		messages, err = SplitDelimited(p.Payload)
+	}
+	if err != nil || len(messages) == 0 {
+		messages = [][]byte{p.Payload}
+	}
+	meta := map[string]string{"protocol": p.Protocol, "src": p.Src.String(), "dst": p.Dst.String()}
+	if p.hasStream() {
+		meta["stream"] = strconv.FormatUint(p.Stream, 10)
+	}
+	records := make([]*Record, len(messages))
+	for i, m := range messages {
+		records[i] = &Record{Name: name, Time: p.Time, Meta: meta, Data: m}
+		if len(messages) > 1 {
+			records[i].Name += " message " + strconv.Itoa(i+1)
+		}
+	}
+	return records
+}
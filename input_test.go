@@ -0,0 +1,36 @@
+package deproto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectInputFormat(t *testing.T) {
+	// Field 1 holding a 65-byte string: every byte is whitespace or a hex
+	// digit, but the hex it spells is not protobuf.
+	hexLike := append([]byte{0x0a, 0x41}, bytes.Repeat([]byte{'A'}, 65)...)
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"hex-like message", hexLike, InputBinary},
+		{"hex", []byte("0a 03 61 62 63\n"), InputHex},
+		{"hex with prefixes", []byte("0x08 0x96 0x01"), InputHex},
+		{"base64", []byte("CgVoZWxsbxIFd29ybGQ="), InputBase64},
+		{"binary", []byte{0x08, 0x96, 0x01}, InputBinary},
+	} {
+		if got := DetectInputFormat(tc.data); got != tc.want {
+			t.Errorf("%s: DetectInputFormat(%q) = %s, want %s", tc.name, tc.data, got, tc.want)
+		}
+	}
+
+	records, err := ReadMessages(hexLike, "auto")
+	if err != nil || len(records) != 1 || !bytes.Equal(records[0].Data, hexLike) {
+		t.Fatalf("ReadMessages returned %v, %v, want the message as is", records, err)
+	}
+	fields, err := DecodeFields(records[0].Data)
+	if err != nil || len(fields) != 1 {
+		t.Errorf("decoded %v, %v, want one string field", fields, err)
+	}
+}
@@ -0,0 +1,105 @@
+package deproto
+
+import "encoding/binary"
+
+// Iterator reads the fields of a message one at a time without allocating:
+// values are returned as numbers or as views into the input, and nothing is
+// decoded beyond the current field's key and value. It is meant for hot
+// paths that inspect a few fields of many messages; nested messages are read
+// by iterating over a length-delimited value.
+//
+//	it := deproto.NewIterator(data)
+//	for it.Next() {
+//		if it.ID() == 2 && it.WireType() == deproto.WireBytes {
+//			name = it.Bytes()
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	data     []byte
+	pos      int
+	err      error
+	offset   int // Offset of the current field
+	id       int
+	wireType int
+	value    []byte // Value bytes of the current field, without the key or length
+}
+
+// NewIterator returns an iterator over the fields encoded in data.
+func NewIterator(data []byte) Iterator {
+	return Iterator{data: data}
+}
+
+// Next advances to the next field and reports whether there is one. It
+// returns false at the end of the data or on malformed input; Err tells
+// the two apart.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.pos >= len(it.data) {
+		return false
+	}
+	id, wireType, start, end, err := fieldExtent(it.data[it.pos:], nil)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.offset = it.pos
+	it.id, it.wireType = id, wireType
+	it.value = it.data[it.pos+start : it.pos+end]
+	it.pos += end
+	return true
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// ID returns the field number of the current field.
+func (it *Iterator) ID() int {
+	return it.id
+}
+
+// WireType returns the wire type of the current field.
+func (it *Iterator) WireType() int {
+	return it.wireType
+}
+
+// Offset returns the offset of the current field's key in the data.
+func (it *Iterator) Offset() int {
+	return it.offset
+}
+
+// Uint returns the value of a varint or fixed-width field. Fixed-width
+// values are the little-endian bits, as in Fixed32Field and Fixed64Field.
+// It returns 0 for length-delimited fields.
+func (it *Iterator) Uint() uint64 {
+	switch it.wireType {
+	case WireVarint:
+		v, _ := binary.Uvarint(it.value)
+		return v
+	case WireFixed64:
+		return binary.LittleEndian.Uint64(it.value)
+	case WireFixed32:
+		return uint64(binary.LittleEndian.Uint32(it.value))
+	default:
+		return 0
+	}
+}
+
+// Bytes returns the value bytes of the current field: the payload of a
+// length-delimited field, or the encoded value of other fields. The slice
+// refers to the input and is valid as long as it is.
+func (it *Iterator) Bytes() []byte {
+	return it.value
+}
+
+// Message returns an iterator over the payload of the current field, read
+// as a nested message.
+func (it *Iterator) Message() Iterator {
+	if it.wireType != WireBytes {
+		return Iterator{}
+	}
+	return NewIterator(it.value)
+}
@@ -0,0 +1,93 @@
+package deproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// keyLog holds TLS secrets by label, such as CLIENT_TRAFFIC_SECRET_0, then
+// by the hex client random of the connection they belong to. It is safe
+// for concurrent use, so that key logs can be registered while captures
+// are decrypted.
+type keyLog struct {
+	mu      sync.RWMutex
+	secrets map[string]map[string][]byte
+}
+
+// tlsSecrets holds the TLS secrets registered with RegisterKeyLog.
+var tlsSecrets keyLog
+
+// add registers a secret.
+func (k *keyLog) add(label, random string, secret []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.secrets == nil {
+		k.secrets = make(map[string]map[string][]byte)
+	}
+	if k.secrets[label] == nil {
+		k.secrets[label] = make(map[string][]byte)
+	}
+	k.secrets[label][random] = secret
+}
+
+// secret returns the secret of a label for a client random.
+func (k *keyLog) secret(label, random string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	secret, ok := k.secrets[label][random]
+	return secret, ok
+}
+
+// all returns a copy of the secrets of a label, by client random.
+func (k *keyLog) all(label string) map[string][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return maps.Clone(k.secrets[label])
+}
+
+// RegisterKeyLog adds the TLS secrets of a key log file, in the NSS format
+// browsers and curl write to $SSLKEYLOGFILE, to those DecryptTLS and
+// DecryptQUIC use. Lines of other labels than the master secrets of TLS 1.2
+// and the traffic secrets of TLS 1.3 are ignored. Malformed lines are
+// skipped, and the first is reported in the error returned once the other
+// lines are registered. Key logs may be registered at any time, also while
+// captures are decrypted, as a PacketStream does.
+func RegisterKeyLog(data []byte) error {
+	var bad error
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 3 {
+			if bad == nil {
+				bad = fmt.Errorf("key log line %d: want LABEL CLIENT_RANDOM SECRET", line)
+			}
+			continue
+		}
+		switch parts[0] {
+		case "CLIENT_RANDOM", "CLIENT_TRAFFIC_SECRET_0", "SERVER_TRAFFIC_SECRET_0", "CLIENT_EARLY_TRAFFIC_SECRET":
+		default:
+			continue
+		}
+		secret, err := hex.DecodeString(parts[2])
+		if err != nil {
+			if bad == nil {
+				bad = fmt.Errorf("key log line %d: invalid secret", line)
+			}
+			continue
+		}
+		tlsSecrets.add(parts[0], strings.ToLower(parts[1]), secret)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bad
+}
@@ -0,0 +1,60 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegisterKeyLogSkipsMalformedLines(t *testing.T) {
+	log := "# comment\n" +
+		"CLIENT_RANDOM aa01 0102\n" +
+		"CLIENT_RANDOM aa02\n" +
+		"CLIENT_RANDOM aa03 zz\n" +
+		"CLIENT_TRAFFIC_SECRET_0 AA04 0304\n" +
+		"CLIENT_RANDOM aa05 05"
+	err := RegisterKeyLog([]byte(log))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("error %v, want one naming line 3", err)
+	}
+	for _, s := range []struct {
+		label, random string
+		want          string
+	}{
+		{"CLIENT_RANDOM", "aa01", "\x01\x02"},
+		{"CLIENT_TRAFFIC_SECRET_0", "aa04", "\x03\x04"},
+		{"CLIENT_RANDOM", "aa05", "\x05"},
+	} {
+		if got, ok := tlsSecrets.secret(s.label, s.random); !ok || string(got) != s.want {
+			t.Errorf("%s %s: got %x, %v", s.label, s.random, got, ok)
+		}
+	}
+	for _, random := range []string{"aa02", "aa03"} {
+		if _, ok := tlsSecrets.secret("CLIENT_RANDOM", random); ok {
+			t.Errorf("malformed line of %s registered", random)
+		}
+	}
+}
+
+func TestRegisterKeyLogWhileDecrypting(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				RegisterKeyLog(fmt.Appendf(nil, "CLIENT_RANDOM %02x%04x 00\n", i, j))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				tlsSecrets.secret("CLIENT_RANDOM", fmt.Sprintf("%02x%04x", i, j))
+				for range tlsSecrets.all("CLIENT_RANDOM") {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
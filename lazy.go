@@ -0,0 +1,40 @@
+package deproto
+
+// lazyPayload records what is needed to decode a payload skipped by
+// DecodeOptions.Lazy.
+type lazyPayload struct {
+	opts          DecodeOptions
+	offset        int // Offset of the field's tag in the input
+	payloadOffset int
+	path          FieldPath
+}
+
+// Expand decodes the payload of a field left undecoded by DecodeOptions.Lazy
+// as a message, string or bytes, as decoding without Lazy would have. The
+// length-delimited fields of a nested message are in turn left for Expand.
+// Expand does nothing if the payload has already been decoded.
+func (l *LengthDelimitedField) Expand() {
+	if l.lazy == nil {
+		return
+	}
+	p := l.lazy
+	l.lazy = nil
+	p.opts.progress, p.opts.state = nil, nil
+	p.opts.readPayload(l, p.offset, p.payloadOffset, p.path)
+}
+
+// Expanded reports whether the field's payload has been decoded.
+func (l *LengthDelimitedField) Expanded() bool {
+	return l.lazy == nil
+}
+
+// ExpandAll expands every length-delimited field in the tree, giving the
+// tree that decoding without DecodeOptions.Lazy produces.
+func ExpandAll(fields []Field) {
+	for _, f := range fields {
+		if l, ok := f.(*LengthDelimitedField); ok {
+			l.Expand()
+			ExpandAll(l.SubFields)
+		}
+	}
+}
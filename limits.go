@@ -0,0 +1,45 @@
+package deproto
+
+import (
+	"context"
+	"fmt"
+)
+
+// LimitError reports that decoding or rendering stopped because it reached a
+// limit set in DecodeOptions or RenderOptions.
+type LimitError struct {
+	Limit string // What was limited, "fields" or "output bytes"
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("exceeded the limit of %d %s", e.Max, e.Limit)
+}
+
+// decodeState is shared by the nested calls of one Decode.
+type decodeState struct {
+	ctx    context.Context // Set by DecodeContext
+	fields int             // Number of fields decoded so far
+	err    error           // Set once decoding must stop
+}
+
+// stopped counts a field about to be decoded and reports whether decoding
+// must stop instead, because the context is done or MaxFields is reached.
+// Nested decoding swallows errors, so the reason is kept in the state for
+// every level to see.
+func (o DecodeOptions) stopped() bool {
+	s := o.state
+	if s == nil {
+		return false
+	}
+	if s.err == nil {
+		s.fields++
+		switch {
+		case o.MaxFields > 0 && s.fields > o.MaxFields:
+			s.err = &LimitError{Limit: "fields", Max: o.MaxFields}
+		case s.ctx != nil && s.fields%cancelCheckInterval == 0:
+			s.err = s.ctx.Err()
+		}
+	}
+	return s.err != nil
+}
@@ -0,0 +1,145 @@
+package deproto
+
+import (
+	"sort"
+	"time"
+)
+
+// streamExpiry is how long a PacketStream keeps a quiet connection before
+// forgetting it.
+const streamExpiry = 5 * time.Minute
+
+// PacketStream turns packets captured live into the payloads of the
+// messages they carry, as CapturePayloads does. Packets are held by
+// connection until it has been quiet for the idle time, so that messages
+// split across packets and TLS records come out whole. Each flush of a
+// connection processes only the packets added since the last: TLS and QUIC
+// connections keep their keys and the data of incomplete records and
+// frames, and nothing is returned twice.
+type PacketStream struct {
+	idle  time.Duration
+	conns map[string]*streamConn
+	order []string // Connection keys, in the order they were first seen
+}
+
+// streamConn holds the packets of one connection of a PacketStream.
+type streamConn struct {
+	packets []Packet  // Packets added since the last flush
+	last    time.Time // Time of the last packet
+	flushed time.Time // Time of the last packet when last flushed
+	count   int       // Turns and datagrams processed, to order payloads
+
+	next map[string]uint32 // TCP sequence number after the last turn, by direction
+	tls  *tlsConn          // Nil for TCP connections found not to be TLS that can be decrypted
+	held []Packet          // Turns held until the TLS handshake is complete
+	quic *quicConn         // Nil for TCP connections
+}
+
+// NewPacketStream returns a PacketStream that flushes a connection once
+// no packet has arrived on it for idle.
+func NewPacketStream(idle time.Duration) *PacketStream {
+	return &PacketStream{idle: idle, conns: make(map[string]*streamConn)}
+}
+
+// Add adds a captured packet to its connection.
+func (s *PacketStream) Add(p Packet) {
+	a, b := p.Src.String(), p.Dst.String()
+	if a > b {
+		a, b = b, a
+	}
+	key := p.Protocol + " " + a + " " + b
+	c := s.conns[key]
+	if c == nil {
+		c = &streamConn{next: make(map[string]uint32)}
+		if p.Protocol == "udp" {
+			c.quic = newQUICConn(p.Src)
+		} else {
+			c.tls = &tlsConn{clientAddr: p.Src}
+		}
+		s.conns[key] = c
+		s.order = append(s.order, key)
+	}
+	c.packets = append(c.packets, p)
+	c.last = p.Time
+}
+
+// Flush returns the payloads of the connections that have been quiet since
+// now less the idle time, from the packets added since they were last
+// flushed, in capture order per connection. A turn continued after a pause
+// is returned as a payload of its own. Connections quiet for several
+// minutes are forgotten; flush them all first with a time far enough ahead.
+func (s *PacketStream) Flush(now time.Time) []Packet {
+	var out []Packet
+	keep := s.order[:0]
+	for _, key := range s.order {
+		c := s.conns[key]
+		if now.Sub(c.last) >= s.idle && c.last.After(c.flushed) {
+			c.flushed = c.last
+			out = append(out, c.flush()...)
+		}
+		if now.Sub(c.last) > streamExpiry {
+			delete(s.conns, key)
+			continue
+		}
+		keep = append(keep, key)
+	}
+	s.order = keep
+	return out
+}
+
+// flush returns the payloads of the packets added since the last flush.
+func (c *streamConn) flush() []Packet {
+	packets := c.packets
+	c.packets = nil
+	type entry struct {
+		index  int
+		packet Packet
+	}
+	var out []entry
+	switch {
+	case c.quic != nil:
+		for _, p := range packets {
+			c.quic.receive(c.count, p)
+			c.count++
+		}
+		if !c.quic.decrypted {
+			return packets
+		}
+		c.quic.bodies(func(index int, p Packet) {
+			out = append(out, entry{index, p})
+		})
+	case c.tls != nil:
+		turns := reassembleTCP(packets, c.next)
+		for _, t := range turns {
+			c.tls.add(c.count, t)
+			c.count++
+		}
+		messages := c.tls.decrypt()
+		switch c.tls.state {
+		case tlsWaiting:
+			c.held = append(c.held, turns...)
+			return nil
+		case tlsFailed:
+			turns = append(c.held, turns...)
+			c.tls, c.held = nil, nil
+			return turns
+		}
+		c.held = nil
+		for _, m := range messages {
+			out = append(out, entry{m.index, m.payload()})
+		}
+	default:
+		return reassembleTCP(packets, c.next)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].index != out[j].index {
+			return out[i].index < out[j].index
+		}
+		return out[i].packet.Stream < out[j].packet.Stream
+	})
+	result := make([]Packet, len(out))
+	for i, e := range out {
+		result[i] = e.packet
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+//go:build linux
+
+package deproto
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Hardware types of the link-layer addresses of packet sockets.
+const (
+	arphrdEther    = 1
+	arphrdLoopback = 772
+	arphrdNone     = 0xfffe
+)
+
+// livePoll is how long ReadPacket waits for a packet before returning.
+const livePoll = 100 * time.Millisecond
+
+// LiveCapture reads the packets crossing a network interface as they
+// arrive. It needs the privilege to open raw sockets, such as root or the
+// CAP_NET_RAW capability.
+type LiveCapture struct {
+	fd  int
+	buf []byte
+}
+
+// OpenLive starts capturing on the named interface, or on every interface
+// if the name is "any".
+func OpenLive(iface string) (*LiveCapture, error) {
+	index := 0
+	if iface != "any" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, err
+		}
+		index = ifi.Index
+	}
+	protocol := htons(syscall.ETH_P_ALL)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(protocol))
+	if err != nil {
+		return nil, fmt.Errorf("open packet socket: %v", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: protocol, Ifindex: index}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("bind to %s: %v", iface, err)
+	}
+	timeout := syscall.NsecToTimeval(int64(livePoll))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &LiveCapture{fd: fd, buf: make([]byte, 1<<16)}, nil
+}
+
+// ReadPacket returns the next TCP or UDP packet with a payload. It reports
+// false if none arrived within a short time, so that callers can do other
+// work between packets.
+func (c *LiveCapture) ReadPacket() (Packet, bool, error) {
+	for {
+		n, from, err := syscall.Recvfrom(c.fd, c.buf, 0)
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			return Packet{}, false, nil
+		}
+		if err != nil {
+			return Packet{}, false, err
+		}
+		sll, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok {
+			continue
+		}
+		link := linkRaw
+		switch sll.Hatype {
+		case arphrdEther:
+			link = linkEthernet
+		case arphrdLoopback:
+			// The loopback interface shows each packet twice, as sent and
+			// as received.
+			if sll.Pkttype == syscall.PACKET_OUTGOING {
+				continue
+			}
+			link = linkEthernet
+		case arphrdNone:
+		default:
+			continue
+		}
+		p, ok := parseFrame(append([]byte(nil), c.buf[:n]...), link)
+		if !ok {
+			continue
+		}
+		p.Time = time.Now()
+		return p, true, nil
+	}
+}
+
+// Close stops the capture.
+func (c *LiveCapture) Close() error {
+	return syscall.Close(c.fd)
+}
+
+// htons converts a 16-bit value to network byte order.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package deproto
+
+import "fmt"
+
+// LiveCapture reads the packets crossing a network interface as they
+// arrive. It is only supported on Linux.
+type LiveCapture struct{}
+
+// OpenLive starts capturing on the named interface. It always fails on this
+// platform.
+func OpenLive(iface string) (*LiveCapture, error) {
+	return nil, fmt.Errorf("live capture is only supported on Linux")
+}
+
+// ReadPacket returns the next TCP or UDP packet with a payload.
+func (c *LiveCapture) ReadPacket() (Packet, bool, error) {
+	return Packet{}, false, fmt.Errorf("live capture is only supported on Linux")
+}
+
+// Close stops the capture.
+func (c *LiveCapture) Close() error {
+	return nil
+}
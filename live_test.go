@@ -0,0 +1,267 @@
+package deproto
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testClient = netip.MustParseAddrPort("10.0.0.1:5000")
+	testServer = netip.MustParseAddrPort("10.0.0.2:443")
+)
+
+// recordingConn records what a client connection sends and receives.
+type recordingConn struct {
+	net.Conn
+	mu      *sync.Mutex
+	packets *[]Packet
+	seq     map[netip.AddrPort]uint32
+}
+
+func (c recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(testServer, testClient, b[:n])
+	return n, err
+}
+
+func (c recordingConn) Write(b []byte) (int, error) {
+	c.record(testClient, testServer, b)
+	return c.Conn.Write(b)
+}
+
+// record adds data sent from src to dst as TCP segments of at most 700
+// bytes.
+func (c recordingConn) record(src, dst netip.AddrPort, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(data) > 0 {
+		n := min(len(data), 700)
+		*c.packets = append(*c.packets, Packet{Protocol: "tcp", Src: src, Dst: dst, Seq: c.seq[src], Payload: bytes.Clone(data[:n])})
+		c.seq[src] += uint32(n)
+		data = data[n:]
+	}
+}
+
+// tlsExchange records the TCP packets of a connection on which a client
+// posts two protobuf messages over TLS and the server echoes them back,
+// registering the secrets of the connection. It returns the packets, those
+// of request i timed i minutes after the first, and how many packets had
+// been sent at the end of each request.
+func tlsExchange(t *testing.T, http2 bool, version uint16) (packets []Packet, marks []int) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(append([]byte{0x0a, 0x04, 'e', 'c', 'h', 'o'}, body...))
+	}))
+	srv.EnableHTTP2 = http2
+	srv.StartTLS()
+	defer srv.Close()
+
+	var keyLog bytes.Buffer
+	var mu sync.Mutex
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			KeyLogWriter:       &keyLog,
+			MaxVersion:         version,
+			CipherSuites:       []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+		ForceAttemptHTTP2: http2,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := net.Dial(network, addr)
+			return recordingConn{c, &mu, &packets, map[netip.AddrPort]uint32{testClient: 1000, testServer: 9000}}, err
+		},
+	}
+	client := &http.Client{Transport: transport}
+	for i := byte(1); i <= 2; i++ {
+		resp, err := client.Post(srv.URL, "application/x-protobuf", bytes.NewReader([]byte{0x08, i, 0x12, 0x03, 'a', 'b', 'c'}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		mu.Lock()
+		marks = append(marks, len(packets))
+		mu.Unlock()
+	}
+	transport.CloseIdleConnections()
+
+	mu.Lock()
+	defer mu.Unlock()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := 0
+	for i := range packets {
+		if request < len(marks) && i == marks[request] {
+			request++
+		}
+		packets[i].Time = start.Add(time.Duration(request)*time.Minute + time.Duration(i)*time.Millisecond)
+	}
+	if err := RegisterKeyLog(keyLog.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return packets, marks
+}
+
+// streamPayloads adds packets to a PacketStream, flushing it once the
+// packets before each mark and then the rest have been added.
+func streamPayloads(s *PacketStream, packets []Packet, marks []int) []Packet {
+	var out []Packet
+	start := 0
+	for _, end := range append(marks, len(packets)) {
+		for _, p := range packets[start:end] {
+			s.Add(p)
+		}
+		if end > start {
+			out = append(out, s.Flush(packets[end-1].Time.Add(time.Second))...)
+		}
+		start = end
+	}
+	return out
+}
+
+func TestPacketStreamTLS(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		http2   bool
+		version uint16
+	}{
+		{"http1 tls1.2", false, tls.VersionTLS12},
+		{"http1 tls1.3", false, tls.VersionTLS13},
+		{"http2 tls1.2", true, tls.VersionTLS12},
+		{"http2 tls1.3", true, tls.VersionTLS13},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			packets, marks := tlsExchange(t, tc.http2, tc.version)
+			want := CapturePayloads(packets)
+			if len(want) != 4 {
+				t.Fatalf("CapturePayloads returned %d payloads, want the 4 bodies: %v", len(want), want)
+			}
+			s := NewPacketStream(time.Second)
+			got := streamPayloads(s, packets, marks)
+			// A turn split by a flush starts later than in the whole
+			// capture, so the payloads may be timed later.
+			for _, payloads := range [][]Packet{got, want} {
+				for i := range payloads {
+					payloads[i].Time = time.Time{}
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("PacketStream returned %v, want %v", got, want)
+			}
+			if len(s.conns) != 1 {
+				t.Fatalf("%d connections, want 1", len(s.conns))
+			}
+			for _, c := range s.conns {
+				if c.tls == nil {
+					t.Fatal("connection not decrypted")
+				}
+				for _, side := range []*tlsSide{&c.tls.client, &c.tls.server} {
+					if len(c.packets) > 0 || len(c.held) > 0 || len(side.records.data) > 0 || len(side.data.data) > 0 {
+						t.Errorf("kept %d packets, %d turns, %d bytes of records and %d of data after the last flush",
+							len(c.packets), len(c.held), len(side.records.data), len(side.data.data))
+					}
+				}
+			}
+		})
+	}
+}
+
+// sealQUIC protects a 1-RTT QUIC packet with a 2-byte packet number.
+func sealQUIC(k *quicKeys, dcid []byte, pn int64, payload []byte) []byte {
+	header := append([]byte{0x41}, dcid...)
+	header = append(header, byte(pn>>8), byte(pn))
+	nonce := bytes.Clone(k.iv)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	out := k.aead.Seal(bytes.Clone(header), nonce, payload, header)
+	pnOffset := 1 + len(dcid)
+	mask := make([]byte, 16)
+	k.hp.Encrypt(mask, out[pnOffset+4:pnOffset+20])
+	out[0] ^= mask[0] & 0x1f
+	out[pnOffset] ^= mask[1]
+	out[pnOffset+1] ^= mask[2]
+	return out
+}
+
+// http3Frame encodes a short HTTP/3 frame.
+func http3Frame(typ byte, payload []byte) []byte {
+	return append([]byte{typ, byte(len(payload))}, payload...)
+}
+
+// quicStreamFrame encodes a STREAM frame with an offset and a length.
+func quicStreamFrame(id, offset byte, data []byte) []byte {
+	return append([]byte{0x0e, id, offset, byte(len(data))}, data...)
+}
+
+// quicExchange returns the UDP packets of a gRPC call over HTTP/3, the
+// request split across two packets, and registers the secrets of the
+// connection.
+func quicExchange(t *testing.T) (packets []Packet, request, response []byte) {
+	t.Helper()
+	clientSecret, serverSecret := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	random := "00112233"
+	keyLog := "CLIENT_TRAFFIC_SECRET_0 " + random + " " + hex.EncodeToString(clientSecret) + "\n" +
+		"SERVER_TRAFFIC_SECRET_0 " + random + " " + hex.EncodeToString(serverSecret) + "\n"
+	if err := RegisterKeyLog([]byte(keyLog)); err != nil {
+		t.Fatal(err)
+	}
+	clientKeys, err := newQUICKeys(clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKeys, err := newQUICKeys(serverSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request = GRPCFrame([]byte{0x08, 0x96, 0x01, 0x12, 0x02, 'h', 'i'})
+	response = GRPCFrame([]byte{0x0a, 0x02, 'o', 'k'})
+	req := append(http3Frame(1, []byte{0, 0, 0xd1}), http3Frame(0, request)...)
+	resp := append(http3Frame(1, []byte{0, 0, 0xd9}), http3Frame(0, response)...)
+	serverCID, clientCID := []byte{9, 9, 9, 9, 9, 9, 9, 9}, []byte{7, 7, 7, 7}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	packets = []Packet{
+		{Time: start, Src: testClient, Dst: testServer, Payload: sealQUIC(clientKeys, serverCID, 0, append([]byte{1}, quicStreamFrame(0, 0, req[:6])...))},
+		{Time: start.Add(time.Millisecond), Src: testServer, Dst: testClient, Payload: sealQUIC(serverKeys, clientCID, 0, quicStreamFrame(0, 0, resp))},
+		{Time: start.Add(time.Minute), Src: testClient, Dst: testServer, Payload: sealQUIC(clientKeys, serverCID, 1, append(quicStreamFrame(0, 6, req[6:]), make([]byte, 20)...))},
+	}
+	for i := range packets {
+		packets[i].Protocol = "udp"
+	}
+	return packets, request, response
+}
+
+func TestPacketStreamQUIC(t *testing.T) {
+	packets, request, response := quicExchange(t)
+	want := CapturePayloads(packets)
+	if len(want) != 2 || !bytes.Equal(want[0].Payload, request) || !bytes.Equal(want[1].Payload, response) {
+		t.Fatalf("CapturePayloads returned %v, want the request and the response", want)
+	}
+
+	s := NewPacketStream(time.Second)
+	got := streamPayloads(s, packets, []int{2})
+	// The first flush completes the response, the second the request.
+	if len(got) != 2 || !bytes.Equal(got[0].Payload, response) || !bytes.Equal(got[1].Payload, request) {
+		t.Fatalf("PacketStream returned %v, want the response then the request", got)
+	}
+	for _, c := range s.conns {
+		for key, stream := range c.quic.streams {
+			if len(stream.segments) > 0 {
+				t.Errorf("stream %d of %s kept %d segments after the last flush", key.id, key.sender, len(stream.segments))
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package deproto
+
+// warning is a message for DecodeOptions.Logger, with its attributes.
+type warning struct {
+	msg  string
+	args []any
+}
+
+// warn reports a soft problem at offset and path to the Logger, if any.
+// While a payload is tentatively decoded as a message, warnings are held
+// back, since they are only worth reporting if the payload is kept as one.
+func (o DecodeOptions) warn(msg string, offset int, path FieldPath, args ...any) {
+	if o.Logger == nil {
+		return
+	}
+	args = append([]any{"offset", offset, "path", path.String()}, args...)
+	o.report([]warning{{msg, args}})
+}
+
+// report passes warnings on to the Logger, or holds them back if the
+// decode is tentative.
+func (o DecodeOptions) report(warnings []warning) {
+	if o.pending != nil {
+		*o.pending = append(*o.pending, warnings...)
+		return
+	}
+	for _, w := range warnings {
+		o.Logger.Warn(w.msg, w.args...)
+	}
+}
+
+// tentative returns options for a tentative decode, which hold warnings
+// back until keep is called with them.
+func (o DecodeOptions) tentative() DecodeOptions {
+	if o.Logger != nil {
+		o.pending = new([]warning)
+	}
+	return o
+}
+
+// keep reports the warnings held back by a tentative decode with the
+// options t, once its result is kept.
+func (o DecodeOptions) keep(t DecodeOptions) {
+	if t.pending != nil {
+		o.report(*t.pending)
+	}
+}
+
+// checkVarint warns about a varint of n bytes holding a value that fits in
+// fewer. Encoders write minimal varints, so padded ones point to a custom
+// encoder or to bytes that are not what they seem.
+func (o DecodeOptions) checkVarint(what string, v uint64, n, offset int, path FieldPath) {
+	if o.Logger != nil && n > uvarintLen(v) {
+		o.warn("non-minimal varint", offset, path, "varint", what, "bytes", n, "value", v)
+	}
+}
@@ -0,0 +1,79 @@
+package deproto
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+)
+
+// DefaultLogPattern matches runs of hex or base64 text long enough to
+// hold a message, as logged by Android's logcat or Apple's os_log.
+var DefaultLogPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+
+// LogOptions controls ScanLog.
+type LogOptions struct {
+	// Pattern finds candidate blobs in each line. If it has a capturing
+	// group, the first group is the blob, so that the text around it can
+	// anchor it, as in `payload=(\S+)`. Blobs matched by a given pattern
+	// may be hex or base64 of any length; those matched by the default,
+	// DefaultLogPattern, must look like encoded data as for
+	// DecodeOptions.UnwrapText.
+	Pattern *regexp.Regexp
+
+	// Decode controls how blobs are decoded.
+	Decode DecodeOptions
+}
+
+// LogLine is a line of a log with the messages found in it.
+type LogLine struct {
+	Number int // Starting at 1
+	Text   string
+	Blobs  []LogBlob
+}
+
+// LogBlob is a message found in a log line.
+type LogBlob struct {
+	Offset   int    // Byte offset of the blob in the line
+	Text     string // The blob as logged
+	Wrapping string // The text encoding, "hex" or a base64 variant
+	Fields   []Field
+}
+
+// ScanLog reads a log and calls fn with every line, in order, along with
+// the blobs in it that decode as plausible messages, so that the decoded
+// messages can be shown in the context of the log. It stops at the first
+// error from fn.
+func ScanLog(r io.Reader, opts LogOptions, fn func(LogLine) error) error {
+	pattern, named := opts.Pattern, true
+	if pattern == nil {
+		pattern, named = DefaultLogPattern, false
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := LogLine{Number: n, Text: scanner.Text()}
+		for _, m := range pattern.FindAllStringSubmatchIndex(line.Text, -1) {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			text := line.Text[start:end]
+			data, wrapping, ok := unwrapText(text)
+			if !ok && named {
+				data, wrapping, ok = decodeText(text)
+			}
+			if !ok {
+				continue
+			}
+			fields, err := opts.Decode.Decode(data)
+			if err != nil || !plausibleMessage(fields) {
+				continue
+			}
+			line.Blobs = append(line.Blobs, LogBlob{Offset: start, Text: text, Wrapping: wrapping, Fields: fields})
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,155 @@
+package deproto
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// TypeMatch scores how well a message type fits a payload; see MatchTypes.
+type TypeMatch struct {
+	Message   *MessageSchema
+	Score     float64 // Explained / Fields: 1 when the type accounts for every field
+	Explained int     // Fields declared by the type, with a fitting wire type and a valid value
+	Fields    int     // Fields of the payload, nested ones included, and missing required fields
+}
+
+// MatchTypes scores each candidate message type against an encoded
+// message and returns the n best matches, best first, or all of them if n
+// is 0. A field counts for a type when the type declares its number with a
+// compatible wire type and the value is valid: a declared enum value, UTF-8
+// for a string, a message for a message field, whose own fields then count
+// in turn. Undeclared fields, and everything nested in them, count against
+// the type, as do missing required fields and repeated singular fields.
+// So does what the heuristics find nested in a field declared as bytes or
+// packed numbers, so that a type reading the structure of a payload beats
+// one that keeps it opaque.
+//
+// Types that score the same are ranked by how many fields they explain,
+// then by how few fields they declare, so the simplest full explanation
+// comes first.
+func MatchTypes(data []byte, candidates []*MessageSchema, n int) ([]TypeMatch, error) {
+	fields, err := DecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	matches := matchFields(fields, candidates)
+	if n > 0 && n < len(matches) {
+		matches = matches[:n]
+	}
+	return matches, nil
+}
+
+// BestSchema returns the candidate a decoded message fits best, as ranked by
+// MatchTypes, or nil if no candidate explains any of its fields.
+func BestSchema(fields []Field, candidates []*MessageSchema) *MessageSchema {
+	matches := matchFields(fields, candidates)
+	if len(matches) == 0 || matches[0].Score == 0 {
+		return nil
+	}
+	return matches[0].Message
+}
+
+func matchFields(fields []Field, candidates []*MessageSchema) []TypeMatch {
+	matches := make([]TypeMatch, len(candidates))
+	for i, schema := range candidates {
+		var s typeScore
+		s.message(fields, schema)
+		matches[i] = TypeMatch{Message: schema, Explained: s.explained, Fields: s.fields}
+		if s.fields > 0 {
+			matches[i].Score = float64(s.explained) / float64(s.fields)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Explained != b.Explained {
+			return a.Explained > b.Explained
+		}
+		return len(a.Message.Fields) < len(b.Message.Fields)
+	})
+	return matches
+}
+
+// typeScore counts the fields of a payload and those a type explains.
+type typeScore struct {
+	explained, fields int
+}
+
+func (s *typeScore) message(fields []Field, schema *MessageSchema) {
+	counts := make(map[int]int)
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		s.fields++
+		counts[base.ID]++
+		fs := schema.Field(base.ID)
+		if fs == nil || (counts[base.ID] > 1 && fs.Label != LabelRepeated) {
+			s.unexplained(f)
+			continue
+		}
+		expected := fs.WireType()
+		packed := fs.Label == LabelRepeated && expected != WireBytes && base.WireType == WireBytes
+		if base.WireType != expected && !packed {
+			s.unexplained(f)
+			continue
+		}
+		switch v := f.(type) {
+		case *VarintField:
+			if fs.Enum != nil && !enumHasValue(fs.Enum, int32(v.Value)) {
+				continue
+			}
+		case *LengthDelimitedField:
+			switch {
+			case packed:
+				if _, err := decodePacked(v.Data, fs); err != nil {
+					continue
+				}
+				s.unexplained(f)
+			case fs.Message != nil:
+				sub := v.SubFields
+				if len(sub) == 0 && len(v.Data) > 0 {
+					var err error
+					if sub, err = DecodeFields(v.Data); err != nil {
+						continue
+					}
+				}
+				s.explained++
+				s.message(sub, fs.Message)
+				continue
+			case fs.Type == "string":
+				if !utf8.Valid(v.Data) {
+					continue
+				}
+			default:
+				s.unexplained(f)
+			}
+		}
+		s.explained++
+	}
+	for _, fs := range schema.Fields {
+		if fs.Label == LabelRequired && counts[fs.Number] == 0 {
+			s.fields++
+		}
+	}
+}
+
+// unexplained counts the fields nested in a field against the type.
+func (s *typeScore) unexplained(f Field) {
+	if l, ok := f.(*LengthDelimitedField); ok {
+		s.fields += countFields(l.SubFields)
+	}
+}
+
+// countFields returns the number of fields in a tree.
+func countFields(fields []Field) int {
+	n := 0
+	Walk(fields, func(FieldPath, Field) bool {
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,94 @@
+package deproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Notes holds free-text notes on fields, keyed by the string form of their
+// paths, as in {"3.1": "user id"}. A note applies to every occurrence of
+// its path. Rendered with RenderOptions.Notes, a note follows its field's
+// line as a "// note" comment.
+type Notes map[string]string
+
+// Set attaches a note to the field at path, replacing any note it had. An
+// empty text removes the note.
+func (n Notes) Set(path FieldPath, text string) {
+	if text == "" {
+		delete(n, path.String())
+		return
+	}
+	n[path.String()] = text
+}
+
+// Get returns the note attached to the field at path, or "".
+func (n Notes) Get(path FieldPath) string {
+	return n[path.String()]
+}
+
+// sessionVersion is the version of the format written by Session.Save.
+const sessionVersion = 1
+
+// Session is the analyst's work on a kind of message that outlives a run,
+// saved as a JSON file: notes on its fields, and captured exchanges of
+// requests and responses.
+type Session struct {
+	Version   int         `json:"version"`
+	Notes     Notes       `json:"notes,omitempty"`
+	Exchanges []*Exchange `json:"exchanges,omitempty"`
+}
+
+// NewSession returns an empty session.
+func NewSession() *Session {
+	return &Session{Version: sessionVersion, Notes: make(Notes)}
+}
+
+// LoadSession reads a session file written by Save.
+func LoadSession(name string) (*Session, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSession()
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if s.Version != sessionVersion {
+		return nil, fmt.Errorf("%s: unsupported session version %d", name, s.Version)
+	}
+	if s.Notes == nil {
+		s.Notes = make(Notes)
+	}
+	for path := range s.Notes {
+		if _, err := ParseFieldPath(path); err != nil {
+			return nil, fmt.Errorf("%s: note on %q: %v", name, path, err)
+		}
+	}
+	return s, nil
+}
+
+// Save writes the session to a file as indented JSON, so that it can be
+// kept under version control and merged by hand.
+func (s *Session) Save(name string) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	return os.WriteFile(name, b.Bytes(), 0o644)
+}
+
+// noteComment returns the note on the field at the renderer's current path
+// as " // note", on one line, or "" if it has none.
+func (r *renderer) noteComment() string {
+	text := r.opts.Notes.Get(r.path)
+	if text == "" {
+		return ""
+	}
+	return " // " + strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,97 @@
+package deproto
+
+import "log/slog"
+
+// DecodeOptions controls the heuristics applied while decoding. The zero
+// value decodes like DecodeFields. See also Heuristics.
+type DecodeOptions struct {
+	// NoNestedMessages and NoStrings keep length-delimited fields as raw
+	// bytes instead of decoding them as nested messages or strings.
+	NoNestedMessages bool
+	NoStrings        bool
+
+	// UnwrapText decodes string fields whose content is base64 or hex
+	// encoding a plausible protobuf message. The message becomes the
+	// field's SubFields, and the encoding is recorded in Wrapping so that
+	// re-encoding the field wraps the message the same way.
+	UnwrapText bool
+
+	// Embedded tolerates the quirks of the encoders of embedded firmware,
+	// such as nanopb: printable text padded with NUL bytes to the size of
+	// its buffer is read as a string, with the padding in Padding, and an
+	// empty payload as a message without fields marking an optional
+	// message present, with EmptyMessage set.
+	Embedded bool
+
+	// Dialect, if set, reads the tags of a protobuf-like format with its
+	// own tag size or wire type numbering instead of protobuf's.
+	Dialect *Dialect
+
+	// MaxNestedFieldNumber and MaxNestedFields are sanity limits on the
+	// payloads decoded as nested messages. A payload is only a message if
+	// its fields cover all of its bytes, no field number exceeds
+	// MaxNestedFieldNumber and it holds at most MaxNestedFields fields;
+	// otherwise it is kept as a string or bytes. Zero selects
+	// DefaultMaxNestedFieldNumber and no limit on fields respectively, and
+	// a negative MaxNestedFieldNumber lifts the limit. Whatever the limits,
+	// a printable payload that parses only as varint and fixed-width
+	// fields is text, unless NoStrings is set. Type hints are not subject
+	// to these limits.
+	MaxNestedFieldNumber int
+	MaxNestedFields      int
+
+	// TypeHints fixes how the length-delimited fields at the given paths
+	// are read, keyed by path in FieldPath.String form, such as "3.2".
+	// A path covers every occurrence of a repeated field. If a field's
+	// payload cannot be read as its hint says, the heuristics apply.
+	TypeHints map[string]WireHint
+
+	// FieldFilter, if set, skips fields by number and depth without
+	// decoding them, such as a large image that is of no interest.
+	FieldFilter *FieldFilter
+
+	// Lazy leaves the payloads of length-delimited fields undecoded, as
+	// raw bytes, until LengthDelimitedField.Expand is called, so that
+	// callers who only inspect the top level of a message do not pay for
+	// decoding the levels below it. Fields keep referring to the input, so
+	// it must not be modified until they are expanded. See also ExpandAll.
+	Lazy bool
+
+	// Pool, if set, supplies the decoded fields. Call its Release method
+	// once a decoded tree is no longer needed to make the fields available
+	// to later decodes.
+	Pool *FieldPool
+
+	// Progress, if set, is called as decoding advances through the input,
+	// with the number of bytes decoded so far and the size of the input. It
+	// is called at most once per MiB, and once more when Decode succeeds,
+	// so that the decoding of very large inputs can be followed.
+	Progress func(done, total int)
+	progress *progressState
+
+	// MaxFields, if positive, limits the number of fields decoded, so that
+	// small inputs that expand into enormous trees are rejected with a
+	// LimitError. Fields of payloads that turn out not to be messages count
+	// too, as decoding them is work done. Fields decoded later by Expand
+	// are not counted.
+	MaxFields int
+
+	state *decodeState
+
+	// Schema, if set, is the type of the decoded message: its declared
+	// length-delimited fields are read as it says, as by DecodeMessage.
+	Schema *MessageSchema
+
+	// Trace, if set, is called with every decoding decision. See
+	// TraceEvent.
+	Trace func(TraceEvent)
+
+	// Logger, if set, is warned about soft problems: type hints that do not
+	// fit, payloads that parse as messages beyond the nested-message
+	// limits, padded varints and input cut short. Warnings carry the offset
+	// and path of the field as attributes. Problems met while a payload is
+	// tentatively decoded as a message are only reported if it is kept as
+	// one.
+	Logger  *slog.Logger
+	pending *[]warning
+}
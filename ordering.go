@@ -0,0 +1,126 @@
+package deproto
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// OrderingIssueKind classifies a problem found by AnalyzeOrdering.
+type OrderingIssueKind int
+
+const (
+	IssueOutOfOrder OrderingIssueKind = iota // Field number lower than its predecessor
+	IssueDuplicate                           // Field repeated in separate, non-adjacent runs
+	IssueConflict                            // Duplicate scalar with differing values; the last one wins
+)
+
+// String returns a short name for the issue kind.
+func (k OrderingIssueKind) String() string {
+	switch k {
+	case IssueOutOfOrder:
+		return "out-of-order"
+	case IssueDuplicate:
+		return "duplicate"
+	case IssueConflict:
+		return "conflict"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// OrderingIssue describes a field ordering or duplication problem.
+type OrderingIssue struct {
+	Kind    OrderingIssueKind
+	Path    FieldPath // Path of the offending field
+	Index   int       // Position of the offending field within its message
+	Message string    // Human-readable explanation
+}
+
+// String returns a one-line description of the issue.
+func (i OrderingIssue) String() string {
+	return fmt.Sprintf("%s [%s]: %s", i.Path, i.Kind, i.Message)
+}
+
+// AnalyzeOrdering reports fields that standard encoders would not produce:
+// field numbers that go backwards, fields that reappear after other fields
+// (repeated fields are normally written in one run) and scalar fields whose
+// later occurrence silently overrides an earlier, different value. These
+// often indicate message concatenation or smuggling attempts.
+func AnalyzeOrdering(fields []Field) []OrderingIssue {
+	return analyzeOrdering(nil, fields)
+}
+
+func analyzeOrdering(parent FieldPath, fields []Field) []OrderingIssue {
+	var issues []OrderingIssue
+	prevID := 0
+	lastIndex := make(map[int]int) // Index of the most recent occurrence of each field number
+	for i, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		path := parent.Append(base.ID)
+
+		if base.ID < prevID {
+			issues = append(issues, OrderingIssue{
+				Kind:    IssueOutOfOrder,
+				Path:    path,
+				Index:   i,
+				Message: fmt.Sprintf("field %d follows field %d", base.ID, prevID),
+			})
+		}
+		prevID = base.ID
+
+		if prev, ok := lastIndex[base.ID]; ok && prev != i-1 {
+			issues = append(issues, OrderingIssue{
+				Kind:    IssueDuplicate,
+				Path:    path,
+				Index:   i,
+				Message: fmt.Sprintf("field %d reappears at index %d after index %d", base.ID, i, prev),
+			})
+			if earlier := fields[prev]; isScalar(f) && !sameValue(earlier, f) {
+				issues = append(issues, OrderingIssue{
+					Kind:    IssueConflict,
+					Path:    path,
+					Index:   i,
+					Message: fmt.Sprintf("value at index %d overrides different value at index %d", i, prev),
+				})
+			}
+		}
+		lastIndex[base.ID] = i
+
+		if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+			issues = append(issues, analyzeOrdering(path, l.SubFields)...)
+		}
+	}
+	return issues
+}
+
+// isScalar reports whether a field holds a single value that a decoder would
+// overwrite, rather than merge, when it is repeated.
+func isScalar(f Field) bool {
+	if l, ok := f.(*LengthDelimitedField); ok {
+		return len(l.SubFields) == 0
+	}
+	return true
+}
+
+// sameValue reports whether two fields have the same wire type and value.
+func sameValue(a, b Field) bool {
+	switch x := a.(type) {
+	case *VarintField:
+		y, ok := b.(*VarintField)
+		return ok && x.Value == y.Value
+	case *Fixed64Field:
+		y, ok := b.(*Fixed64Field)
+		return ok && x.Value == y.Value
+	case *Fixed32Field:
+		y, ok := b.(*Fixed32Field)
+		return ok && x.Value == y.Value
+	case *LengthDelimitedField:
+		y, ok := b.(*LengthDelimitedField)
+		return ok && bytes.Equal(x.Data, y.Data)
+	default:
+		return false
+	}
+}
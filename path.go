@@ -0,0 +1,97 @@
+package deproto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldPath identifies a field inside a nested message by the field numbers
+// leading to it, outermost first. For example, 3.2.1 is field 1 of the message
+// in field 2 of the message in field 3.
+type FieldPath []int
+
+// String returns the dotted representation of the path.
+func (p FieldPath) String() string {
+	parts := make([]string, len(p))
+	for i, id := range p {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Append returns a new path with id appended, leaving p unmodified.
+func (p FieldPath) Append(id int) FieldPath {
+	out := make(FieldPath, len(p)+1)
+	copy(out, p)
+	out[len(p)] = id
+	return out
+}
+
+// Equal reports whether p and other contain the same field numbers.
+func (p FieldPath) Equal(other FieldPath) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	for i := range p {
+		if p[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseFieldPath parses a dotted field path such as "3.2.1".
+func ParseFieldPath(s string) (FieldPath, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+	parts := strings.Split(s, ".")
+	path := make(FieldPath, len(parts))
+	for i, part := range parts {
+		id, err := strconv.Atoi(part)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid field number %q in path %q", part, s)
+		}
+		path[i] = id
+	}
+	return path, nil
+}
+
+// fieldBase returns the FieldBase embedded in a field.
+func fieldBase(f Field) *FieldBase {
+	switch v := f.(type) {
+	case *VarintField:
+		return &v.FieldBase
+	case *Fixed64Field:
+		return &v.FieldBase
+	case *Fixed32Field:
+		return &v.FieldBase
+	case *LengthDelimitedField:
+		return &v.FieldBase
+	default:
+		return nil
+	}
+}
+
+// Walk calls fn for every field in the tree in depth-first order, along with
+// the path leading to it. If fn returns false the field's children are skipped.
+func Walk(fields []Field, fn func(path FieldPath, f Field) bool) {
+	walk(nil, fields, fn)
+}
+
+func walk(parent FieldPath, fields []Field, fn func(path FieldPath, f Field) bool) {
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		path := parent.Append(base.ID)
+		if !fn(path, f) {
+			continue
+		}
+		if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+			walk(path, l.SubFields, fn)
+		}
+	}
+}
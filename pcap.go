@@ -0,0 +1,264 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Packet is the transport payload of a captured packet.
+type Packet struct {
+	Time     time.Time
+	Protocol string // "tcp" or "udp"; "tls", "http1", "http2" or "http3" once decrypted
+	Src, Dst netip.AddrPort
+	Seq      uint32 // TCP sequence number of the first payload byte
+	Stream   uint64 // Stream ID of an HTTP/2 or HTTP/3 body
+	Payload  []byte
+}
+
+// String describes the packet as "tcp 10.0.0.1:443 > 10.0.0.2:50000", with
+// the stream of HTTP/2 and HTTP/3 bodies, as in "http3 10.0.0.1:443 >
+// 10.0.0.2:50000 stream 4".
+func (p Packet) String() string {
+	if p.hasStream() {
+		return fmt.Sprintf("%s %s > %s stream %d", p.Protocol, p.Src, p.Dst, p.Stream)
+	}
+	return fmt.Sprintf("%s %s > %s", p.Protocol, p.Src, p.Dst)
+}
+
+// hasStream reports whether the packet is the body of a stream of a
+// multiplexed connection.
+func (p Packet) hasStream() bool {
+	return p.Protocol == "http2" || p.Protocol == "http3"
+}
+
+// Link types of the captures understood by ReadPcap.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+)
+
+// IsPcap reports whether data starts like a pcap or pcapng capture.
+func IsPcap(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1, 0x0a0d0d0a:
+		return true
+	}
+	return false
+}
+
+// ReadPcap returns the TCP and UDP payloads of the packets in a capture
+// file, in pcap or pcapng format, so that messages sent over the wire can be
+// decoded. Packets are not reassembled: each packet with a payload is
+// returned on its own; see CapturePayloads. Packets other than IPv4 or IPv6
+// carrying TCP or UDP are skipped.
+func ReadPcap(data []byte) ([]Packet, error) {
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == 0x0a0d0d0a {
+		return readPcapNG(data)
+	}
+	if len(data) < 24 {
+		return nil, fmt.Errorf("truncated pcap header")
+	}
+	var order binary.ByteOrder
+	nano := false
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0x4d3cb2a1:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcap file")
+	}
+	link := int(order.Uint32(data[20:24]) & 0xffff)
+
+	var packets []Packet
+	for pos := 24; pos < len(data); {
+		if len(data)-pos < 16 {
+			return packets, fmt.Errorf("truncated pcap record at offset %d", pos)
+		}
+		sec, frac := order.Uint32(data[pos:]), order.Uint32(data[pos+4:])
+		length := int(order.Uint32(data[pos+8:]))
+		pos += 16
+		if len(data)-pos < length {
+			return packets, fmt.Errorf("truncated pcap record at offset %d", pos-16)
+		}
+		if !nano {
+			frac *= 1000
+		}
+		t := time.Unix(int64(sec), int64(frac)).UTC()
+		if p, ok := parseFrame(data[pos:pos+length], link); ok {
+			p.Time = t
+			packets = append(packets, p)
+		}
+		pos += length
+	}
+	return packets, nil
+}
+
+// CapturePayloads turns the packets ReadPcap returns into the payloads of
+// the messages they carry: TCP turns reassembled by ReassembleTCP, TLS
+// connections decrypted by DecryptTLS and HTTP/3 bodies taken from QUIC
+// connections by DecryptQUIC, with the registered key logs.
+func CapturePayloads(packets []Packet) []Packet {
+	return DecryptTLS(ReassembleTCP(DecryptQUIC(packets)))
+}
+
+// readPcapNG reads the enhanced and simple packet blocks of a pcapng file.
+// Timestamps assume the default resolution of microseconds.
+func readPcapNG(data []byte) ([]Packet, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	var links []int
+	var packets []Packet
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 12 {
+			return packets, fmt.Errorf("truncated pcapng block at offset %d", pos)
+		}
+		blockType := binary.LittleEndian.Uint32(data[pos:])
+		if blockType == 0x0a0d0d0a {
+			// The byte order magic of a section header decides the byte
+			// order of the section, including the block's own length.
+			if binary.LittleEndian.Uint32(data[pos+8:]) == 0x1a2b3c4d {
+				order = binary.LittleEndian
+			} else {
+				order = binary.BigEndian
+			}
+			links = links[:0]
+		}
+		blockType = order.Uint32(data[pos:])
+		length := int(order.Uint32(data[pos+4:]))
+		if length < 12 || length%4 != 0 || len(data)-pos < length {
+			return packets, fmt.Errorf("invalid pcapng block at offset %d", pos)
+		}
+		body := data[pos+8 : pos+length-4]
+		switch blockType {
+		case 1: // Interface description
+			if len(body) >= 2 {
+				links = append(links, int(order.Uint16(body)))
+			}
+		case 6: // Enhanced packet
+			if len(body) < 20 {
+				break
+			}
+			iface := int(order.Uint32(body))
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			captured := int(order.Uint32(body[12:]))
+			if iface >= len(links) || len(body)-20 < captured {
+				break
+			}
+			if p, ok := parseFrame(body[20:20+captured], links[iface]); ok {
+				p.Time = time.UnixMicro(int64(ts)).UTC()
+				packets = append(packets, p)
+			}
+		case 3: // Simple packet
+			if len(body) < 4 || len(links) == 0 {
+				break
+			}
+			if p, ok := parseFrame(body[4:], links[0]); ok {
+				packets = append(packets, p)
+			}
+		}
+		pos += length
+	}
+	return packets, nil
+}
+
+// parseFrame extracts the transport payload of a captured frame.
+func parseFrame(frame []byte, link int) (Packet, bool) {
+	var etherType uint16
+	switch link {
+	case linkEthernet:
+		if len(frame) < 14 {
+			return Packet{}, false
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[12:]), frame[14:]
+		for etherType == 0x8100 || etherType == 0x88a8 { // VLAN tags
+			if len(frame) < 4 {
+				return Packet{}, false
+			}
+			etherType, frame = binary.BigEndian.Uint16(frame[2:]), frame[4:]
+		}
+	case linkLinuxSLL:
+		if len(frame) < 16 {
+			return Packet{}, false
+		}
+		etherType, frame = binary.BigEndian.Uint16(frame[14:]), frame[16:]
+	case linkNull:
+		if len(frame) < 4 {
+			return Packet{}, false
+		}
+		frame = frame[4:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		return Packet{}, false
+	}
+	if etherType != 0 && etherType != 0x0800 && etherType != 0x86dd {
+		return Packet{}, false
+	}
+	return parseIP(frame)
+}
+
+// parseIP extracts the TCP or UDP payload of an IPv4 or IPv6 packet.
+func parseIP(packet []byte) (Packet, bool) {
+	if len(packet) < 1 {
+		return Packet{}, false
+	}
+	var src, dst netip.Addr
+	var proto byte
+	switch packet[0] >> 4 {
+	case 4:
+		headerLen := int(packet[0]&0x0f) * 4
+		if len(packet) < 20 || headerLen < 20 || len(packet) < headerLen {
+			return Packet{}, false
+		}
+		if total := int(binary.BigEndian.Uint16(packet[2:])); total >= headerLen && total < len(packet) {
+			packet = packet[:total] // Drop Ethernet padding
+		}
+		src = netip.AddrFrom4([4]byte(packet[12:16]))
+		dst = netip.AddrFrom4([4]byte(packet[16:20]))
+		proto, packet = packet[9], packet[headerLen:]
+	case 6:
+		if len(packet) < 40 {
+			return Packet{}, false
+		}
+		src = netip.AddrFrom16([16]byte(packet[8:24]))
+		dst = netip.AddrFrom16([16]byte(packet[24:40]))
+		proto, packet = packet[6], packet[40:]
+	default:
+		return Packet{}, false
+	}
+
+	p := Packet{}
+	switch proto {
+	case 6:
+		if len(packet) < 20 {
+			return Packet{}, false
+		}
+		headerLen := int(packet[12]>>4) * 4
+		if headerLen < 20 || len(packet) < headerLen {
+			return Packet{}, false
+		}
+		p.Protocol, p.Seq, p.Payload = "tcp", binary.BigEndian.Uint32(packet[4:]), packet[headerLen:]
+	case 17:
+		if len(packet) < 8 {
+			return Packet{}, false
+		}
+		p.Protocol, p.Payload = "udp", packet[8:]
+	default:
+		return Packet{}, false
+	}
+	p.Src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(packet))
+	p.Dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(packet[2:]))
+	return p, len(p.Payload) > 0
+}
@@ -0,0 +1,159 @@
+package deproto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Record is a message passing through a Pipeline.
+type Record struct {
+	Name   string            // Where the message came from, such as a file name
+	Time   time.Time         // When the message was sent, if known, as for captured packets
+	Meta   map[string]string // Details of the source, such as the addresses of a captured packet
+	Data   []byte            // The encoded message
+	Fields []Field           // The decoded fields, once a Decoder stage has run
+	Notes  []string          // Annotations added by stages
+}
+
+// Source produces the records of a pipeline, returning io.EOF after the
+// last one.
+type Source func() (*Record, error)
+
+// Stage processes a record in a pipeline: it may change it, and it reports
+// whether the record should continue to the next stage.
+type Stage func(r *Record) (keep bool, err error)
+
+// Sink consumes the records that pass every stage of a pipeline.
+type Sink func(r *Record) error
+
+// Pipeline reads records from a source, passes each through the stages in
+// order and writes the records that pass all of them to the sink:
+//
+//	p := deproto.Pipeline{
+//		Source: deproto.FileSource(names...),
+//		Stages: []deproto.Stage{deproto.Decoder(deproto.DecodeOptions{}), deproto.QueryFilter(q)},
+//		Sink:   deproto.JSONSink(os.Stdout),
+//	}
+//	err := p.Run()
+type Pipeline struct {
+	Source Source
+	Stages []Stage
+	Sink   Sink
+}
+
+// Run processes every record of the source. It stops at the first error,
+// naming the record it occurred on.
+func (p *Pipeline) Run() error {
+	for {
+		r, err := p.Source()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		keep := true
+		for _, stage := range p.Stages {
+			if keep, err = stage(r); err != nil {
+				return fmt.Errorf("%s: %v", r.Name, err)
+			}
+			if !keep {
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		if err := p.Sink(r); err != nil {
+			return fmt.Errorf("%s: %v", r.Name, err)
+		}
+	}
+}
+
+// FileSource returns a source reading each named file as one message.
+func FileSource(names ...string) Source {
+	return func() (*Record, error) {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+		name := names[0]
+		names = names[1:]
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return &Record{Name: name, Data: data}, nil
+	}
+}
+
+// HexParser returns a stage that replaces the data of a record, hex text as
+// copied from a debugger or log, with the bytes it encodes. Whitespace,
+// colons and 0x prefixes are ignored.
+func HexParser() Stage {
+	return func(r *Record) (bool, error) {
+		data, err := parseHexText(r.Data)
+		if err != nil {
+			return false, err
+		}
+		r.Data = data
+		return true, nil
+	}
+}
+
+// Decoder returns a stage that decodes the data of a record into its
+// fields. Records that do not decode are errors.
+func Decoder(opts DecodeOptions) Stage {
+	return func(r *Record) (bool, error) {
+		fields, err := opts.Decode(r.Data)
+		if err != nil {
+			return false, err
+		}
+		r.Fields = fields
+		return true, nil
+	}
+}
+
+// QueryFilter returns a stage that keeps only the records in which the
+// query matches at least one field.
+func QueryFilter(q *CompiledQuery) Stage {
+	return func(r *Record) (bool, error) {
+		return len(q.Select(r.Fields)) > 0, nil
+	}
+}
+
+// StructureAnnotator returns a stage that notes the StructureHash of every
+// record, so that records of the same message type can be grouped.
+func StructureAnnotator() Stage {
+	return func(r *Record) (bool, error) {
+		r.Notes = append(r.Notes, fmt.Sprintf("structure %016x", StructureHash(r.Fields)))
+		return true, nil
+	}
+}
+
+// recordJSON is a record as written by JSONSink.
+type recordJSON struct {
+	Name   string            `json:"name"`
+	Time   string            `json:"time,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	Size   int               `json:"size"`
+	Fields []fieldJSON       `json:"fields"`
+	Notes  []string          `json:"notes,omitempty"`
+}
+
+// JSONSink returns a sink writing every record to w as a line of JSON, as
+// search and analytics stores ingest them: its name, time in RFC 3339
+// format if known, metadata, encoded size, fields in the form used by
+// MarshalTree, and notes.
+func JSONSink(w io.Writer) Sink {
+	enc := json.NewEncoder(w)
+	return func(r *Record) error {
+		out := recordJSON{Name: r.Name, Meta: r.Meta, Size: len(r.Data), Fields: marshalFields(r.Fields), Notes: r.Notes}
+		if !r.Time.IsZero() {
+			out.Time = r.Time.Format(time.RFC3339Nano)
+		}
+		return enc.Encode(out)
+	}
+}
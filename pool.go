@@ -0,0 +1,88 @@
+package deproto
+
+import "sync"
+
+// Reset clears the field to its zero value so that it can be reused.
+func (v *VarintField) Reset() { *v = VarintField{} }
+
+// Reset clears the field to its zero value so that it can be reused.
+func (f *Fixed64Field) Reset() { *f = Fixed64Field{} }
+
+// Reset clears the field to its zero value so that it can be reused.
+func (f *Fixed32Field) Reset() { *f = Fixed32Field{} }
+
+// Reset clears the field to its zero value so that it can be reused. Nested
+// fields are dropped, not reset.
+func (l *LengthDelimitedField) Reset() { *l = LengthDelimitedField{} }
+
+// FieldPool recycles Field values between decodes (see DecodeOptions.Pool),
+// so that services decoding many messages allocate fewer fields. The zero
+// value is ready to use, and a pool may be shared between goroutines.
+type FieldPool struct {
+	varints  sync.Pool
+	fixed64s sync.Pool
+	fixed32s sync.Pool
+	lengths  sync.Pool
+}
+
+// Release resets every field in the tree and returns it to the pool. The
+// fields, including any taken from the tree before, must not be used
+// afterwards.
+func (p *FieldPool) Release(fields []Field) {
+	for _, f := range fields {
+		switch v := f.(type) {
+		case *VarintField:
+			v.Reset()
+			p.varints.Put(v)
+		case *Fixed64Field:
+			v.Reset()
+			p.fixed64s.Put(v)
+		case *Fixed32Field:
+			v.Reset()
+			p.fixed32s.Put(v)
+		case *LengthDelimitedField:
+			p.Release(v.SubFields)
+			v.Reset()
+			p.lengths.Put(v)
+		}
+	}
+}
+
+// The allocation methods below take fields from the pool, or allocate them
+// when p is nil or empty.
+
+func (p *FieldPool) varint() *VarintField {
+	if p != nil {
+		if v, ok := p.varints.Get().(*VarintField); ok {
+			return v
+		}
+	}
+	return new(VarintField)
+}
+
+func (p *FieldPool) fixed64() *Fixed64Field {
+	if p != nil {
+		if f, ok := p.fixed64s.Get().(*Fixed64Field); ok {
+			return f
+		}
+	}
+	return new(Fixed64Field)
+}
+
+func (p *FieldPool) fixed32() *Fixed32Field {
+	if p != nil {
+		if f, ok := p.fixed32s.Get().(*Fixed32Field); ok {
+			return f
+		}
+	}
+	return new(Fixed32Field)
+}
+
+func (p *FieldPool) length() *LengthDelimitedField {
+	if p != nil {
+		if l, ok := p.lengths.Get().(*LengthDelimitedField); ok {
+			return l
+		}
+	}
+	return new(LengthDelimitedField)
+}
@@ -0,0 +1,315 @@
+package deproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Profile bundles the settings suited to a kind of data under a name: the
+// heuristics, the input format, the render settings and, for data of a
+// known protocol, its schema.
+type Profile struct {
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Heuristics  Heuristics `json:"heuristics"`
+	Format      string     `json:"format,omitempty"` // Input format for ReadMessages; "" or "auto" to detect it
+	ShowSize    bool       `json:"show_size"`        // See RenderOptions.ShowSize
+	Verbose     bool       `json:"verbose"`          // See RenderOptions.Verbose
+
+	// Protos names .proto files, embedded or on disk, and Descriptors
+	// compiled descriptor sets, declaring the messages of the protocol.
+	// Types names the messages the data may be, by full name; without it,
+	// the data may be any top-level message of those files. See
+	// Profile.Schemas.
+	Protos      []string `json:"protos,omitempty"`
+	Descriptors []string `json:"descriptors,omitempty"`
+	Types       []string `json:"types,omitempty"`
+
+	fsys fs.FS // Files of a profile registered with RegisterProfiles
+}
+
+// profiles are the built-in profiles and those added by RegisterProfiles,
+// by name.
+var profiles = map[string]Profile{
+	"grpc-traffic": {
+		Description: "gRPC and gRPC-Web bodies: framed messages carrying tokens, URLs and encoded payloads",
+		Heuristics: Heuristics{
+			NestedMessages: true,
+			Strings:        true,
+			UnwrapText:     true,
+			Tokens:         true,
+			URLs:           true,
+			AnyPairs:       true,
+		},
+		Format: InputGRPC,
+	},
+	"otlp": {
+		Description: "OpenTelemetry export requests of traces, metrics or logs, each decoded as the one it fits",
+		Heuristics:  schemaHeuristics,
+		Protos: []string{
+			"opentelemetry/proto/collector/trace/v1/trace_service.proto",
+			"opentelemetry/proto/collector/metrics/v1/metrics_service.proto",
+			"opentelemetry/proto/collector/logs/v1/logs_service.proto",
+		},
+		Types: []string{
+			"opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest",
+			"opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest",
+			"opentelemetry.proto.collector.logs.v1.ExportLogsServiceRequest",
+		},
+	},
+	"otlp-traces": {
+		Description: "OpenTelemetry trace export requests",
+		Heuristics:  schemaHeuristics,
+		Protos:      []string{"opentelemetry/proto/collector/trace/v1/trace_service.proto"},
+		Types:       []string{"opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest"},
+	},
+	"otlp-metrics": {
+		Description: "OpenTelemetry metric export requests",
+		Heuristics:  schemaHeuristics,
+		Protos:      []string{"opentelemetry/proto/collector/metrics/v1/metrics_service.proto"},
+		Types:       []string{"opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest"},
+	},
+	"otlp-logs": {
+		Description: "OpenTelemetry log export requests",
+		Heuristics:  schemaHeuristics,
+		Protos:      []string{"opentelemetry/proto/collector/logs/v1/logs_service.proto"},
+		Types:       []string{"opentelemetry.proto.collector.logs.v1.ExportLogsServiceRequest"},
+	},
+	"prometheus-remote-write": {
+		Description: "Prometheus remote write bodies: snappy-compressed WriteRequest messages",
+		Heuristics:  schemaHeuristics,
+		Format:      InputSnappy,
+		Protos:      []string{"prometheus/prompb/remote.proto"},
+		Types:       []string{"prometheus.WriteRequest"},
+	},
+	"maps-url": {
+		Description: "messages taken from URLs: base64 or hex text whose strings hold more URLs and encoded messages",
+		Heuristics: Heuristics{
+			NestedMessages: true,
+			Strings:        true,
+			UnwrapText:     true,
+			ExpandTokens:   true,
+			URLs:           true,
+		},
+	},
+	"tfrecord": {
+		Description: "TFRecord files of tf.Example records, shown as their features",
+		Heuristics: Heuristics{
+			NestedMessages: true,
+			Strings:        true,
+			TFExample:      true,
+		},
+		Format: InputTFRecord,
+	},
+	"firmware-carve": {
+		Description: "messages cut from firmware images: strict nesting, embedded encoder quirks, byte fields analyzed in full, big-endian values shown",
+		Heuristics: Heuristics{
+			NestedMessages:       true,
+			Strings:              true,
+			Embedded:             true,
+			Encodings:            true,
+			Entropy:              true,
+			HashHints:            true,
+			BigEndian:            true,
+			MaxNestedFieldNumber: 1<<10 - 1,
+			MaxNestedFields:      1000,
+		},
+		Format:   InputBinary,
+		ShowSize: true,
+		Verbose:  true,
+	},
+}
+
+// schemaHeuristics are the heuristics of the profiles of known protocols,
+// whose schemas name the fields and leave little to guess.
+var schemaHeuristics = Heuristics{
+	NestedMessages: true,
+	Strings:        true,
+}
+
+// ProfileNames returns the names of the built-in and registered profiles,
+// sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupProfile returns the built-in or registered profile with the given
+// name.
+func LookupProfile(name string) (Profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	p.Name = name
+	return p, nil
+}
+
+// LoadProfile returns the built-in profile with the given name, or reads a
+// profile from the JSON file of that name. Settings missing from the file
+// keep their defaults, and unknown settings are an error.
+func LoadProfile(name string) (Profile, error) {
+	if p, err := LookupProfile(name); err == nil {
+		return p, nil
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Profile{}, fmt.Errorf("unknown profile %q: not built in and no such file", name)
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+	return parseProfile(name, data)
+}
+
+// parseProfile parses a JSON profile file.
+func parseProfile(name string, data []byte) (Profile, error) {
+	p := Profile{Name: name, Heuristics: DefaultHeuristics()}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Profile{}, fmt.Errorf("%s: %v", name, err)
+	}
+	if p.Format != "" && p.Format != "auto" && !slices.Contains(InputFormats, p.Format) {
+		return Profile{}, fmt.Errorf("%s: unknown input format %q", name, p.Format)
+	}
+	if len(p.Types) > 0 && len(p.Protos) == 0 && len(p.Descriptors) == 0 {
+		return Profile{}, fmt.Errorf("%s: types without protos or descriptors", name)
+	}
+	return p, nil
+}
+
+// descriptorSetExts are the file extensions RegisterProfiles takes for
+// descriptor sets.
+var descriptorSetExts = []string{".pb", ".binpb", ".desc", ".protoset"}
+
+// RegisterProfiles adds the profiles in the top level of a directory, such
+// as one embedded with go:embed or opened with os.DirFS, to the built-in
+// ones, replacing those of the same names. A file NAME.json is a profile
+// file, as read by LoadProfile, whose protos and descriptors are files of
+// the directory. A descriptor set NAME.pb (or .binpb, .desc, .protoset),
+// as written by protoc --descriptor_set_out, is a profile of its messages
+// named NAME, each message decoded as the type it fits best. Register
+// profiles at start-up, before they are looked up.
+func RegisterProfiles(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		file := entry.Name()
+		ext := path.Ext(file)
+		name := strings.TrimSuffix(file, ext)
+		var p Profile
+		switch {
+		case entry.IsDir():
+			continue
+		case ext == ".json":
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return err
+			}
+			if p, err = parseProfile(file, data); err != nil {
+				return err
+			}
+		case slices.Contains(descriptorSetExts, ext):
+			p = Profile{
+				Description: "messages of the descriptor set " + file,
+				Heuristics:  schemaHeuristics,
+				Descriptors: []string{file},
+			}
+		default:
+			continue
+		}
+		p.Name, p.fsys = "", fsys
+		profiles[name] = p
+	}
+	return nil
+}
+
+// DecodeOptions returns decode options applying the profile.
+func (p Profile) DecodeOptions() DecodeOptions {
+	return p.Heuristics.DecodeOptions()
+}
+
+// RenderOptions returns render options applying the profile, with all
+// other options at their zero values.
+func (p Profile) RenderOptions() RenderOptions {
+	opts := p.Heuristics.RenderOptions()
+	opts.ShowSize, opts.Verbose = p.ShowSize, p.Verbose
+	return opts
+}
+
+// Schemas loads the profile's .proto files and descriptor sets into a
+// registry, searching importPaths and then the embedded files for imports,
+// and returns the registry and the schemas of the messages the data may be.
+// It returns nils if the profile names no files.
+func (p Profile) Schemas(importPaths ...string) (*Registry, []*MessageSchema, error) {
+	if len(p.Protos) == 0 && len(p.Descriptors) == 0 {
+		return nil, nil, nil
+	}
+	registry := NewRegistry(importPaths...)
+	var files []*Schema
+	for _, name := range p.Protos {
+		var schema *Schema
+		var err error
+		if p.fsys != nil {
+			var src []byte
+			if src, err = fs.ReadFile(p.fsys, name); err == nil {
+				schema, err = registry.AddSource(name, string(src))
+			}
+		} else {
+			schema, err = registry.LoadFile(name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, schema)
+	}
+	for _, name := range p.Descriptors {
+		var data []byte
+		var err error
+		if p.fsys != nil {
+			data, err = fs.ReadFile(p.fsys, name)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		schemas, err := registry.AddDescriptorSet(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		files = append(files, schemas...)
+	}
+	if len(p.Types) == 0 {
+		var schemas []*MessageSchema
+		for _, file := range files {
+			schemas = append(schemas, file.Messages...)
+		}
+		if len(schemas) == 0 {
+			return nil, nil, fmt.Errorf("profile %s: no messages", p.Name)
+		}
+		return registry, schemas, nil
+	}
+	schemas := make([]*MessageSchema, len(p.Types))
+	for i, name := range p.Types {
+		if schemas[i] = registry.Message(name); schemas[i] == nil {
+			return nil, nil, fmt.Errorf("profile %s: no message %s", p.Name, name)
+		}
+	}
+	return registry, schemas, nil
+}
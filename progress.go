@@ -0,0 +1,22 @@
+package deproto
+
+// progressStep is the number of input bytes between calls to
+// DecodeOptions.Progress.
+const progressStep = 1 << 20
+
+// progressState tracks the progress reported during one Decode call.
+type progressState struct {
+	total int
+	next  int // Offset at which progress is next reported
+}
+
+// advance reports progress if decoding has reached offset done since the
+// last report.
+func (o DecodeOptions) advance(done int) {
+	p := o.progress
+	if p == nil || done < p.next {
+		return
+	}
+	p.next = done + progressStep
+	o.Progress(done, p.total)
+}
@@ -0,0 +1,205 @@
+package protobridge
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+
+	"github.com/bluefalconhd/deproto"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Divergence is an input on which deproto and the protowire package of the
+// official runtime disagree.
+type Divergence struct {
+	Input  []byte
+	Path   deproto.FieldPath // The message where they disagree; nil for the top level
+	Reason string
+}
+
+// Error describes the divergence, so that it can be reported as an error.
+func (d *Divergence) Error() string {
+	where := "top level"
+	if len(d.Path) > 0 {
+		where = "field " + d.Path.String()
+	}
+	return fmt.Sprintf("%s: %s (input %x)", where, d.Reason, d.Input)
+}
+
+// CompareDecoders decodes data with deproto.DecodeFields and with protowire
+// and returns their first disagreement, or nil if they agree. They agree
+// when both reject the data, or when both accept it and read the same
+// fields with the same values. Payloads that deproto decodes as nested
+// messages must parse as messages with protowire too, and are compared in
+// turn. Data containing groups, which deproto does not decode, is not
+// compared.
+func CompareDecoders(data []byte) *Divergence {
+	fields, err := deproto.DecodeFields(data)
+	d := compareLevel(nil, data, fields, err)
+	if d != nil {
+		d.Input = data
+	}
+	return d
+}
+
+func compareLevel(path deproto.FieldPath, data []byte, fields []deproto.Field, err error) *Divergence {
+	want, werr := wireFields(data)
+	switch {
+	case werr == errGroup:
+		return nil
+	case werr != nil && err == nil:
+		return &Divergence{Path: path, Reason: fmt.Sprintf("deproto accepts data protowire rejects: %v", werr)}
+	case werr == nil && err != nil:
+		return &Divergence{Path: path, Reason: fmt.Sprintf("deproto rejects data protowire accepts: %v", err)}
+	case werr != nil:
+		return nil
+	}
+	if len(fields) != len(want) {
+		return &Divergence{Path: path, Reason: fmt.Sprintf("deproto reads %d fields, protowire %d", len(fields), len(want))}
+	}
+	for i, f := range fields {
+		w := want[i]
+		got := wireField{}
+		switch v := f.(type) {
+		case *deproto.VarintField:
+			got = wireField{v.ID, protowire.VarintType, v.Value, nil}
+		case *deproto.Fixed64Field:
+			got = wireField{v.ID, protowire.Fixed64Type, v.Value, nil}
+		case *deproto.Fixed32Field:
+			got = wireField{v.ID, protowire.Fixed32Type, uint64(v.Value), nil}
+		case *deproto.LengthDelimitedField:
+			got = wireField{v.ID, protowire.BytesType, 0, v.Data}
+		}
+		if got.num != w.num || got.typ != w.typ || got.value != w.value || !bytes.Equal(got.data, w.data) {
+			return &Divergence{Path: path, Reason: fmt.Sprintf("field %d: deproto reads %s, protowire %s", i, got, w)}
+		}
+		if l, ok := f.(*deproto.LengthDelimitedField); ok && len(l.SubFields) > 0 && l.Wrapping == "" {
+			if d := compareLevel(path.Append(l.ID), l.Data, l.SubFields, nil); d != nil {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// wireField is a field as protowire reads it.
+type wireField struct {
+	num   int
+	typ   protowire.Type
+	value uint64
+	data  []byte
+}
+
+func (f wireField) String() string {
+	if f.typ == protowire.BytesType {
+		return fmt.Sprintf("%d:%d %x", f.num, f.typ, f.data)
+	}
+	return fmt.Sprintf("%d:%d %d", f.num, f.typ, f.value)
+}
+
+// errGroup reports data that holds a group.
+var errGroup = fmt.Errorf("groups are not compared")
+
+// wireFields parses the fields of a message with protowire.
+func wireFields(data []byte) ([]wireField, error) {
+	var fields []wireField
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		// protowire allows numbers up to MaxInt32 for MessageSet; deproto
+		// keeps to the range valid in messages.
+		if num > protowire.MaxValidNumber {
+			return nil, fmt.Errorf("invalid field number %d", num)
+		}
+		data = data[n:]
+		f := wireField{num: int(num), typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.value = uint64(v)
+		case protowire.BytesType:
+			f.data, n = protowire.ConsumeBytes(data)
+		case protowire.StartGroupType, protowire.EndGroupType:
+			return nil, errGroup
+		default:
+			return nil, fmt.Errorf("invalid wire type %d", typ)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		fields = append(fields, f)
+		data = data[n:]
+	}
+	return fields, nil
+}
+
+// RandomMessage returns a random well-formed message of up to eight fields
+// of every wire type except groups, with messages nested up to depth
+// levels deep and strings and bytes among the length-delimited payloads.
+func RandomMessage(r *rand.Rand, depth int) []byte {
+	var b []byte
+	for range r.Intn(9) {
+		num := protowire.Number(1 + r.Intn(20))
+		if r.Intn(10) == 0 {
+			num = protowire.Number(1 + r.Int31n(int32(protowire.MaxValidNumber)))
+		}
+		switch r.Intn(6) {
+		case 0:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, r.Uint64()>>r.Intn(64))
+		case 1:
+			b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, r.Uint64())
+		case 2:
+			b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, r.Uint32())
+		case 3:
+			text := make([]byte, r.Intn(12))
+			for i := range text {
+				text[i] = byte(' ' + r.Intn(95))
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, text)
+		case 4:
+			raw := make([]byte, r.Intn(12))
+			r.Read(raw)
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, raw)
+		case 5:
+			if depth == 0 {
+				continue
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, RandomMessage(r, depth-1))
+		}
+	}
+	return b
+}
+
+// CompareRandom compares the decoders on n random messages from
+// RandomMessage, half of them corrupted by truncation or a changed byte so
+// that error handling is compared too, and returns the divergences found.
+func CompareRandom(r *rand.Rand, n int) []*Divergence {
+	var found []*Divergence
+	for i := range n {
+		data := RandomMessage(r, 3)
+		if i%2 == 1 && len(data) > 0 {
+			if r.Intn(2) == 0 {
+				data = data[:r.Intn(len(data))]
+			} else {
+				data[r.Intn(len(data))] = byte(r.Intn(256))
+			}
+		}
+		if d := CompareDecoders(data); d != nil {
+			found = append(found, d)
+		}
+	}
+	return found
+}
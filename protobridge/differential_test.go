@@ -0,0 +1,28 @@
+package protobridge_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bluefalconhd/deproto/protobridge"
+)
+
+func TestCompareRandom(t *testing.T) {
+	for _, d := range protobridge.CompareRandom(rand.New(rand.NewSource(1)), 5000) {
+		t.Error(d)
+	}
+}
+
+func FuzzCompareDecoders(f *testing.F) {
+	r := rand.New(rand.NewSource(1))
+	for range 20 {
+		f.Add(protobridge.RandomMessage(r, 3))
+	}
+	f.Add([]byte{0x0a, 0x80})
+	f.Add([]byte{0x0b, 0x08, 0x01, 0x0c})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if d := protobridge.CompareDecoders(data); d != nil {
+			t.Error(d)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package protobridge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bluefalconhd/deproto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ToDynamic converts decoded fields into a dynamic message of the type
+// described by md. Fields that md does not declare are kept as unknown
+// fields. It fails if a field's wire data does not fit its declared type.
+func ToDynamic(fields []deproto.Field, md protoreflect.MessageDescriptor) (*dynamicpb.Message, error) {
+	m := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(deproto.Encode(fields), m); err != nil {
+		return nil, fmt.Errorf("%s: %v", md.FullName(), err)
+	}
+	return m, nil
+}
+
+// FromMessage converts any message, generated or dynamic, into decoded
+// fields.
+func FromMessage(m proto.Message) ([]deproto.Field, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return deproto.DecodeFields(data)
+}
+
+// FileDescriptor builds a protobuf-go file descriptor from a schema, inferred
+// or parsed, so its messages can be used with ToDynamic. path is the file
+// name recorded in the descriptor. Message and enum types the schema refers
+// to but does not declare, such as well-known types, are looked up in
+// protoregistry.GlobalFiles.
+func FileDescriptor(s *deproto.Schema, path string) (protoreflect.FileDescriptor, error) {
+	syntax := s.Syntax
+	if syntax == "" {
+		syntax = "proto2"
+	}
+	b := &descriptorBuilder{schema: s, deps: make(map[string]bool)}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:   proto.String(path),
+		Syntax: proto.String(syntax),
+	}
+	if s.Package != "" {
+		file.Package = proto.String(s.Package)
+	}
+	for _, m := range s.Messages {
+		file.MessageType = append(file.MessageType, b.message(m, syntax))
+	}
+	for _, e := range s.Enums {
+		file.EnumType = append(file.EnumType, enumDescriptor(e))
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	for dep := range b.deps {
+		file.Dependency = append(file.Dependency, dep)
+	}
+	sort.Strings(file.Dependency)
+	return protodesc.NewFile(file, protoregistry.GlobalFiles)
+}
+
+// descriptorBuilder converts schema messages to descriptor protos, noting
+// the files that declare types from outside the schema.
+type descriptorBuilder struct {
+	schema *deproto.Schema
+	deps   map[string]bool
+	err    error
+}
+
+func (b *descriptorBuilder) message(m *deproto.MessageSchema, syntax string) *descriptorpb.DescriptorProto {
+	d := &descriptorpb.DescriptorProto{Name: proto.String(m.Name)}
+	oneofs := make(map[string]int32)
+	for _, f := range m.Fields {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(f.Name),
+			Number:   proto.Int32(int32(f.Number)),
+			JsonName: proto.String(jsonName(f.Name)),
+		}
+		switch {
+		case f.Label == deproto.LabelRepeated:
+			fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		case f.Label == deproto.LabelRequired && syntax != "proto3":
+			fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+		default:
+			fd.Label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+		}
+		b.fieldType(fd, f)
+		if f.Packed && syntax != "proto3" {
+			fd.Options = &descriptorpb.FieldOptions{Packed: proto.Bool(true)}
+		}
+		if f.Oneof != "" {
+			index, ok := oneofs[f.Oneof]
+			if !ok {
+				index = int32(len(d.OneofDecl))
+				oneofs[f.Oneof] = index
+				d.OneofDecl = append(d.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(f.Oneof)})
+			}
+			fd.OneofIndex = proto.Int32(index)
+		}
+		d.Field = append(d.Field, fd)
+	}
+	// A proto3 optional field is alone in a synthetic oneof, declared
+	// after the real ones as protoc does.
+	for i, f := range m.Fields {
+		if f.Proto3Optional && f.Oneof == "" && syntax == "proto3" {
+			d.Field[i].Proto3Optional = proto.Bool(true)
+			d.Field[i].OneofIndex = proto.Int32(int32(len(d.OneofDecl)))
+			d.OneofDecl = append(d.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + f.Name)})
+		}
+	}
+	entries := make(map[*deproto.MessageSchema]bool)
+	for _, f := range m.Fields {
+		if f.IsMap() {
+			entries[f.Message] = true
+		}
+	}
+	for _, n := range m.Nested {
+		nd := b.message(n, syntax)
+		if entries[n] {
+			nd.Options = &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)}
+		}
+		d.NestedType = append(d.NestedType, nd)
+	}
+	for _, e := range m.Enums {
+		d.EnumType = append(d.EnumType, enumDescriptor(e))
+	}
+	return d
+}
+
+func (b *descriptorBuilder) fieldType(fd *descriptorpb.FieldDescriptorProto, f *deproto.FieldSchema) {
+	if t, ok := scalarTypes[f.Type]; ok {
+		fd.Type = t.Enum()
+		return
+	}
+	var fullName string
+	switch {
+	case f.Message != nil:
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fullName = f.Message.FullName
+	case f.Enum != nil:
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+		fullName = f.Enum.FullName
+	default:
+		if b.err == nil {
+			b.err = fmt.Errorf("field %s: unresolved type %s", f.Name, f.Type)
+		}
+		return
+	}
+	fd.TypeName = proto.String("." + fullName)
+	if b.schema.Message(fullName) != nil || b.declaresEnum(fullName) {
+		return
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(fullName))
+	if err != nil {
+		if b.err == nil {
+			b.err = fmt.Errorf("field %s: type %s: %v", f.Name, fullName, err)
+		}
+		return
+	}
+	b.deps[desc.ParentFile().Path()] = true
+}
+
+// declaresEnum reports whether the schema declares the enum fullName.
+func (b *descriptorBuilder) declaresEnum(fullName string) bool {
+	var found bool
+	var visit func(msgs []*deproto.MessageSchema, enums []*deproto.EnumSchema)
+	visit = func(msgs []*deproto.MessageSchema, enums []*deproto.EnumSchema) {
+		for _, e := range enums {
+			found = found || e.FullName == fullName
+		}
+		for _, m := range msgs {
+			visit(m.Nested, m.Enums)
+		}
+	}
+	visit(b.schema.Messages, b.schema.Enums)
+	return found
+}
+
+func enumDescriptor(e *deproto.EnumSchema) *descriptorpb.EnumDescriptorProto {
+	d := &descriptorpb.EnumDescriptorProto{Name: proto.String(e.Name)}
+	for _, v := range e.Values {
+		d.Value = append(d.Value, &descriptorpb.EnumValueDescriptorProto{
+			Name:   proto.String(v.Name),
+			Number: proto.Int32(v.Number),
+		})
+	}
+	return d
+}
+
+var scalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+}
+
+// jsonName returns the lowerCamelCase JSON name protoc derives from a field
+// name.
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package protobridge_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+	"github.com/bluefalconhd/deproto/protobridge"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestFileDescriptorMapsAndPresence(t *testing.T) {
+	schema, err := deproto.NewRegistry().AddSource("m.proto", `
+syntax = "proto3";
+package test;
+message M {
+  map<string, int32> counts = 1;
+  optional int32 x = 2;
+  int32 y = 3;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protobridge.FileDescriptor(schema, "m.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("M")
+	fields := md.Fields()
+	if !fields.ByName("counts").IsMap() {
+		t.Error("counts is not a map")
+	}
+	if !fields.ByName("x").HasPresence() {
+		t.Error("optional x has no presence")
+	}
+	if fields.ByName("y").HasPresence() {
+		t.Error("y has presence")
+	}
+
+	entry := deproto.NewMessage().String(1, "a").Int(2, 2)
+	data := deproto.NewMessage().Message(1, entry).Int(2, 0).Encode()
+	decoded, err := deproto.DecodeFields(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := protobridge.ToDynamic(decoded, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := protojson.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	// The zero x is written, as it was set.
+	want := map[string]any{"counts": map[string]any{"a": 2.0}, "x": 0.0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("protojson wrote %s, want %v", out, want)
+	}
+}
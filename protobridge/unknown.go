@@ -0,0 +1,119 @@
+// Package protobridge connects deproto to the google.golang.org/protobuf
+// runtime, so that bytes a generated message does not understand can be
+// inspected, and decoded fields can be used with the official APIs.
+package protobridge
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bluefalconhd/deproto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DecodeUnknown decodes the unknown fields of m: the fields that were in
+// the data m was unmarshaled from but are not declared in its descriptor.
+// It returns nil if there are none.
+func DecodeUnknown(m proto.Message) ([]deproto.Field, error) {
+	return deproto.DecodeFields(m.ProtoReflect().GetUnknown())
+}
+
+// Unknown holds the decoded unknown fields of one message within a tree.
+type Unknown struct {
+	Path   string // Path of the message from the root, e.g. "user.addresses[2]"; "" for the root
+	Raw    []byte
+	Fields []deproto.Field
+	Err    error // Why Raw does not decode, as when it holds a group; Fields is nil then
+}
+
+// CollectUnknown returns the unknown fields of m and of every message nested
+// in it, in field number order and map entries in key order, decoding each
+// set. Messages without unknown fields are omitted. A set that does not
+// decode is returned with Err set and the walk goes on; CollectUnknown then
+// also returns the first such error.
+func CollectUnknown(m proto.Message) ([]Unknown, error) {
+	var found []Unknown
+	collect(m.ProtoReflect(), "", &found)
+	for _, u := range found {
+		if u.Err != nil {
+			return found, u.Err
+		}
+	}
+	return found, nil
+}
+
+func collect(m protoreflect.Message, path string, found *[]Unknown) {
+	if raw := m.GetUnknown(); len(raw) > 0 {
+		u := Unknown{Path: path, Raw: raw}
+		u.Fields, u.Err = deproto.DecodeFields(raw)
+		if u.Err != nil {
+			u.Fields, u.Err = nil, fmt.Errorf("unknown fields of %s: %v", describe(m, path), u.Err)
+		}
+		*found = append(*found, u)
+	}
+
+	// Range visits fields, and maps their entries, in no defined order.
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number() < fields[j].Number() })
+	for _, fd := range fields {
+		name := string(fd.Name())
+		if path != "" {
+			name = path + "." + name
+		}
+		v := m.Get(fd)
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			for _, k := range sortedKeys(v.Map(), fd.MapKey().Kind()) {
+				collect(v.Map().Get(k).Message(), fmt.Sprintf("%s[%v]", name, k.Interface()), found)
+			}
+		case fd.IsList():
+			if fd.Message() == nil {
+				continue
+			}
+			list := v.List()
+			for i := range list.Len() {
+				collect(list.Get(i).Message(), fmt.Sprintf("%s[%d]", name, i), found)
+			}
+		case fd.Message() != nil:
+			collect(v.Message(), name, found)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map field in ascending order.
+func sortedKeys(m protoreflect.Map, kind protoreflect.Kind) []protoreflect.MapKey {
+	var keys []protoreflect.MapKey
+	m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch kind {
+		case protoreflect.BoolKind:
+			return !a.Bool() && b.Bool()
+		case protoreflect.StringKind:
+			return a.String() < b.String()
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+			return a.Uint() < b.Uint()
+		default:
+			return a.Int() < b.Int()
+		}
+	})
+	return keys
+}
+
+func describe(m protoreflect.Message, path string) string {
+	if path == "" {
+		return string(m.Descriptor().FullName())
+	}
+	return path
+}
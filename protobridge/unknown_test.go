@@ -0,0 +1,60 @@
+package protobridge_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+	"github.com/bluefalconhd/deproto/protobridge"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestCollectUnknownOrderAndGroups(t *testing.T) {
+	schema, err := deproto.NewRegistry().AddSource("m.proto", `
+syntax = "proto3";
+package test;
+message Inner { int32 a = 1; }
+message M {
+  map<string, Inner> by_name = 1;
+  Inner first = 2;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protobridge.FileDescriptor(schema, "m.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("M")
+
+	// Field 2 holds an unknown group (field 5), which deproto cannot decode.
+	data := []byte{0x12, 2, 0x2b, 0x2c}
+	for _, key := range []string{"c", "a", "b"} {
+		entry := deproto.NewMessage().String(1, key).Message(2, deproto.NewMessage().Varint(9, 1))
+		data = append(data, deproto.NewMessage().Message(1, entry).Encode()...)
+	}
+
+	m := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, m); err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		found, err := protobridge.CollectUnknown(m)
+		if err == nil {
+			t.Error("CollectUnknown returned no error for an unknown group")
+		}
+		var paths []string
+		for _, u := range found {
+			paths = append(paths, u.Path)
+		}
+		want := []string{"by_name[a]", "by_name[b]", "by_name[c]", "first"}
+		if !reflect.DeepEqual(paths, want) {
+			t.Fatalf("CollectUnknown paths %q, want %q", paths, want)
+		}
+		if last := found[3]; last.Err == nil || last.Fields != nil {
+			t.Errorf("first: fields %v, error %v; want only an error", last.Fields, last.Err)
+		}
+	}
+}
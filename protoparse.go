@@ -0,0 +1,613 @@
+package deproto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// editionsSyntax is the syntax given to schemas of editions files, which
+// default to proto3-style packed encoding.
+const editionsSyntax = "proto3"
+
+// ParseProto parses .proto source into a Schema. Imports are recorded but not
+// loaded, and type names are left unresolved; use a Registry to load files
+// together with their imports and resolve references between them.
+//
+// Messages, enums, nested definitions, oneofs, map fields and field options
+// relevant to decoding (packed) are supported. Services, extensions, custom
+// options and reserved ranges are parsed and skipped.
+func ParseProto(name, src string) (*Schema, []string, error) {
+	p := &protoParser{name: name, lex: protoLexer{src: src, line: 1}}
+	schema := &Schema{Syntax: "proto2"}
+	var imports []string
+
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t.text {
+		case "":
+			setFullNames(schema)
+			return schema, imports, nil
+		case ";":
+		case "syntax", "edition":
+			if err := p.expect("="); err != nil {
+				return nil, nil, err
+			}
+			value, err := p.expectString()
+			if err != nil {
+				return nil, nil, err
+			}
+			if t.text == "syntax" {
+				schema.Syntax = value
+			} else {
+				schema.Syntax = editionsSyntax
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, nil, err
+			}
+		case "package":
+			pkg, err := p.expectIdent()
+			if err != nil {
+				return nil, nil, err
+			}
+			schema.Package = pkg
+			if err := p.expect(";"); err != nil {
+				return nil, nil, err
+			}
+		case "import":
+			if next, err := p.peek(); err != nil {
+				return nil, nil, err
+			} else if next.text == "public" || next.text == "weak" {
+				p.next()
+			}
+			path, err := p.expectString()
+			if err != nil {
+				return nil, nil, err
+			}
+			imports = append(imports, path)
+			if err := p.expect(";"); err != nil {
+				return nil, nil, err
+			}
+		case "option":
+			if err := p.skipStatement(); err != nil {
+				return nil, nil, err
+			}
+		case "message":
+			m, err := p.parseMessage(schema.Syntax)
+			if err != nil {
+				return nil, nil, err
+			}
+			schema.Messages = append(schema.Messages, m)
+		case "enum":
+			e, err := p.parseEnum()
+			if err != nil {
+				return nil, nil, err
+			}
+			schema.Enums = append(schema.Enums, e)
+		case "service", "extend":
+			if err := p.skipStatement(); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, p.errorf(t, "unexpected %q", t.text)
+		}
+	}
+}
+
+// protoToken is a lexical token of .proto source. Quoted strings have quoted
+// set and hold their unescaped value.
+type protoToken struct {
+	text   string
+	quoted bool
+	line   int
+}
+
+type protoLexer struct {
+	src    string
+	pos    int
+	line   int
+	peeked *protoToken
+}
+
+func (l *protoLexer) scan() (protoToken, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return protoToken{}, fmt.Errorf("line %d: unterminated comment", l.line)
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return l.token()
+		}
+	}
+	return protoToken{line: l.line}, nil
+}
+
+func (l *protoLexer) token() (protoToken, error) {
+	t := protoToken{line: l.line}
+	rest := l.src[l.pos:]
+	c := rest[0]
+	switch {
+	case c == '"' || c == '\'':
+		end := 1
+		for end < len(rest) && rest[end] != c && rest[end] != '\n' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) || rest[end] != c {
+			return t, fmt.Errorf("line %d: unterminated string", l.line)
+		}
+		raw := rest[:end+1]
+		if c == '\'' {
+			raw = `"` + strings.ReplaceAll(raw[1:end], `"`, `\"`) + `"`
+		}
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return t, fmt.Errorf("line %d: invalid string literal", l.line)
+		}
+		t.text, t.quoted = value, true
+		l.pos += end + 1
+	case isIdentChar(c) || c == '.' || c == '-' || c == '+':
+		end := 1
+		for end < len(rest) && (isIdentChar(rest[end]) || rest[end] == '.' ||
+			(rest[end] == '-' || rest[end] == '+') && (rest[end-1] == 'e' || rest[end-1] == 'E')) {
+			end++
+		}
+		t.text = rest[:end]
+		l.pos += end
+	default:
+		t.text = rest[:1]
+		l.pos++
+	}
+	return t, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+type protoParser struct {
+	name string
+	lex  protoLexer
+}
+
+func (p *protoParser) errorf(t protoToken, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.name, t.line, fmt.Sprintf(format, args...))
+}
+
+func (p *protoParser) peek() (protoToken, error) {
+	if p.lex.peeked == nil {
+		t, err := p.lex.scan()
+		if err != nil {
+			return t, fmt.Errorf("%s: %v", p.name, err)
+		}
+		p.lex.peeked = &t
+	}
+	return *p.lex.peeked, nil
+}
+
+func (p *protoParser) next() (protoToken, error) {
+	t, err := p.peek()
+	p.lex.peeked = nil
+	return t, err
+}
+
+func (p *protoParser) expect(text string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.text != text || t.quoted {
+		return p.errorf(t, "expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *protoParser) expectString() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if !t.quoted {
+		return "", p.errorf(t, "expected string, got %q", t.text)
+	}
+	// Adjacent string literals are concatenated.
+	for {
+		next, err := p.peek()
+		if err != nil || !next.quoted {
+			return t.text, err
+		}
+		p.next()
+		t.text += next.text
+	}
+}
+
+func (p *protoParser) expectIdent() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.quoted || t.text == "" || !isIdentChar(t.text[0]) && t.text[0] != '.' {
+		return "", p.errorf(t, "expected identifier, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *protoParser) expectInt() (int, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(t.text, 0, 64)
+	if err != nil || t.quoted {
+		return 0, p.errorf(t, "expected integer, got %q", t.text)
+	}
+	return int(n), nil
+}
+
+// skipStatement skips tokens up to and including the next ';' at the current
+// nesting level, or a balanced {...} block, whichever ends the statement.
+func (p *protoParser) skipStatement() error {
+	depth := 0
+	for {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+		if t.quoted {
+			continue
+		}
+		switch t.text {
+		case "":
+			return p.errorf(t, "unexpected end of file")
+		case "{":
+			depth++
+		case "}":
+			if depth--; depth == 0 {
+				if next, err := p.peek(); err == nil && next.text == ";" && !next.quoted {
+					p.next()
+				}
+				return nil
+			}
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseMessage(syntax string) (*MessageSchema, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	m := &MessageSchema{Name: name}
+	return m, p.parseMessageBody(m, syntax, "")
+}
+
+// parseMessageBody parses message members up to the closing brace. Inside a
+// oneof block, oneof holds its name.
+func (p *protoParser) parseMessageBody(m *MessageSchema, syntax, oneof string) error {
+	for {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+		if t.quoted {
+			return p.errorf(t, "unexpected string")
+		}
+		switch t.text {
+		case "":
+			return p.errorf(t, "unexpected end of file in message %s", m.Name)
+		case "}":
+			return nil
+		case ";":
+		case "message":
+			nested, err := p.parseMessage(syntax)
+			if err != nil {
+				return err
+			}
+			m.Nested = append(m.Nested, nested)
+		case "enum":
+			e, err := p.parseEnum()
+			if err != nil {
+				return err
+			}
+			m.Enums = append(m.Enums, e)
+		case "oneof":
+			name, err := p.expectIdent()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			if err := p.parseMessageBody(m, syntax, name); err != nil {
+				return err
+			}
+		case "option", "reserved", "extensions", "extend":
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		case "map":
+			if err := p.parseMapField(m, syntax); err != nil {
+				return err
+			}
+		default:
+			f := &FieldSchema{Oneof: oneof}
+			typeName := t.text
+			switch t.text {
+			case "optional":
+				f.Label = LabelOptional
+				f.Proto3Optional = syntax == "proto3"
+				typeName = ""
+			case "required":
+				f.Label = LabelRequired
+				typeName = ""
+			case "repeated":
+				f.Label = LabelRepeated
+				typeName = ""
+			}
+			if typeName == "" {
+				if typeName, err = p.expectIdent(); err != nil {
+					return err
+				}
+			}
+			if typeName == "group" {
+				if err := p.parseGroup(m, f, syntax); err != nil {
+					return err
+				}
+				continue
+			}
+			f.Type = typeName
+			if err := p.parseFieldRest(f, syntax); err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, f)
+		}
+	}
+}
+
+// parseFieldRest parses "name = number [options];" after a field's type.
+func (p *protoParser) parseFieldRest(f *FieldSchema, syntax string) error {
+	var err error
+	if f.Name, err = p.expectIdent(); err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	if f.Number, err = p.expectInt(); err != nil {
+		return err
+	}
+	_, numeric := scalarWireTypes[f.Type]
+	numeric = numeric && f.Type != "string" && f.Type != "bytes"
+	f.Packed = syntax == "proto3" && f.Label == LabelRepeated && numeric
+
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.text == "[" && !t.quoted {
+		if err := p.parseFieldOptions(f); err != nil {
+			return err
+		}
+		if t, err = p.next(); err != nil {
+			return err
+		}
+	}
+	if t.text != ";" || t.quoted {
+		return p.errorf(t, "expected \";\" after field %s, got %q", f.Name, t.text)
+	}
+	return nil
+}
+
+// parseFieldOptions parses the bracketed option list of a field, keeping
+// only the packed option.
+func (p *protoParser) parseFieldOptions(f *FieldSchema) error {
+	for {
+		name, err := p.next()
+		if err != nil {
+			return err
+		}
+		if name.text == "(" {
+			// Custom option name such as (foo.bar).baz.
+			for name.text != ")" && name.text != "" {
+				if name, err = p.next(); err != nil {
+					return err
+				}
+			}
+			if next, err := p.peek(); err == nil && strings.HasPrefix(next.text, ".") {
+				p.next()
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+		value, err := p.next()
+		if err != nil {
+			return err
+		}
+		if value.text == "{" && !value.quoted {
+			depth := 1
+			for depth > 0 {
+				t, err := p.next()
+				if err != nil {
+					return err
+				}
+				if t.text == "" {
+					return p.errorf(t, "unexpected end of file in field options")
+				}
+				if !t.quoted && t.text == "{" {
+					depth++
+				} else if !t.quoted && t.text == "}" {
+					depth--
+				}
+			}
+		}
+		if name.text == "packed" {
+			f.Packed = value.text == "true"
+		}
+
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case t.text == "]" && !t.quoted:
+			return nil
+		case t.text == "," && !t.quoted:
+		default:
+			return p.errorf(t, "expected \",\" or \"]\" in field options, got %q", t.text)
+		}
+	}
+}
+
+// parseMapField parses "map<K, V> name = number;" into a repeated field of a
+// synthesized entry message, which is how maps are encoded.
+func (p *protoParser) parseMapField(m *MessageSchema, syntax string) error {
+	if err := p.expect("<"); err != nil {
+		return err
+	}
+	keyType, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(","); err != nil {
+		return err
+	}
+	valueType, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(">"); err != nil {
+		return err
+	}
+	f := &FieldSchema{Label: LabelRepeated}
+	if err := p.parseFieldRest(f, syntax); err != nil {
+		return err
+	}
+	entry := &MessageSchema{
+		Name: mapEntryName(f.Name),
+		Fields: []*FieldSchema{
+			{Name: "key", Number: 1, Type: keyType},
+			{Name: "value", Number: 2, Type: valueType},
+		},
+	}
+	f.Type = entry.Name
+	f.Packed = false
+	m.Nested = append(m.Nested, entry)
+	m.Fields = append(m.Fields, f)
+	return nil
+}
+
+// mapEntryName returns the name protoc gives the entry message of a map
+// field: the field name in CamelCase followed by "Entry".
+func mapEntryName(field string) string {
+	var b strings.Builder
+	upper := true
+	for _, c := range field {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteString(strings.ToUpper(string(c)))
+			upper = false
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	b.WriteString("Entry")
+	return b.String()
+}
+
+// parseGroup parses a proto2 group as a nested message and a field of that
+// type.
+func (p *protoParser) parseGroup(m *MessageSchema, f *FieldSchema, syntax string) error {
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	if f.Number, err = p.expectInt(); err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	nested := &MessageSchema{Name: name}
+	if err := p.parseMessageBody(nested, syntax, ""); err != nil {
+		return err
+	}
+	f.Name = strings.ToLower(name)
+	f.Type = name
+	f.Comment = "group"
+	m.Nested = append(m.Nested, nested)
+	m.Fields = append(m.Fields, f)
+	return nil
+}
+
+func (p *protoParser) parseEnum() (*EnumSchema, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	e := &EnumSchema{Name: name}
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "":
+			return nil, p.errorf(t, "unexpected end of file in enum %s", name)
+		case "}":
+			return e, nil
+		case ";":
+		case "option", "reserved":
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		default:
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			n, err := p.expectInt()
+			if err != nil {
+				return nil, err
+			}
+			e.Values = append(e.Values, EnumValue{Name: t.text, Number: int32(n)})
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseProtoscope assembles protoscope source and decodes the result into a
+// field tree. See AssembleProtoscope for the supported syntax.
+func ParseProtoscope(s string) ([]Field, error) {
+	data, err := AssembleProtoscope(s)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFields(data)
+}
+
+// AssembleProtoscope converts protoscope source into wire-format bytes.
+//
+// The supported subset covers what is needed to hand-author test vectors:
+//
+//	1:VARINT 150        # tags with explicit types: VARINT, I64, LEN, I32
+//	2: {"testing"}      # omitted types are inferred from the following token
+//	3: { 1: 5 2: 6z }   # braces length-prefix their contents; z is zigzag
+//	4: 1.5 5: true      # floats are doubles, or floats with an i32 suffix
+//	6: 7i32 7: -1i64    # i32/i64 suffixes select fixed-width little-endian
+//	`0a0b` long-form:2 1  # raw hex bytes and padded varints
+//
+// Groups, which DecodeFields does not read, are not supported; a numeric
+// wire type such as 1:3 writes any tag, for hand-authoring malformed input.
+func AssembleProtoscope(s string) ([]byte, error) {
+	tokens, err := scanProtoscope(s)
+	if err != nil {
+		return nil, err
+	}
+	a := &protoscopeAssembler{tokens: tokens}
+	out, err := a.assemble(false)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FormatProtoscope renders fields as protoscope source that
+// AssembleProtoscope turns back into the same bytes. Fixed-width values are
+// written in hex, strings as quoted literals, raw bytes as hex literals and
+// packed fields as lists of values.
+func FormatProtoscope(fields []Field) string {
+	var b strings.Builder
+	formatProtoscope(&b, fields, 0)
+	return b.String()
+}
+
+func formatProtoscope(b *strings.Builder, fields []Field, indentLevel int) {
+	indent := strings.Repeat("  ", indentLevel)
+	for _, f := range fields {
+		switch v := f.(type) {
+		case *VarintField:
+			fmt.Fprintf(b, "%s%d: %d\n", indent, v.ID, v.Value)
+		case *Fixed64Field:
+			fmt.Fprintf(b, "%s%d: 0x%016xi64\n", indent, v.ID, v.Value)
+		case *Fixed32Field:
+			fmt.Fprintf(b, "%s%d: 0x%08xi32\n", indent, v.ID, v.Value)
+		case *LengthDelimitedField:
+			switch {
+			case len(v.SubFields) > 0 && v.Wrapping == "":
+				fmt.Fprintf(b, "%s%d: {\n", indent, v.ID)
+				formatProtoscope(b, v.SubFields, indentLevel+1)
+				fmt.Fprintf(b, "%s}\n", indent)
+			case v.Packed != nil:
+				format := "%d"
+				switch (&FieldSchema{Type: v.Packed.Type}).WireType() {
+				case WireFixed64:
+					format = "0x%016xi64"
+				case WireFixed32:
+					format = "0x%08xi32"
+				}
+				values := make([]string, len(v.Packed.Values))
+				for i, value := range v.Packed.Values {
+					values[i] = fmt.Sprintf(format, value)
+				}
+				fmt.Fprintf(b, "%s%d: { %s }\n", indent, v.ID, strings.Join(values, " "))
+			case v.IsString || v.Wrapping != "":
+				fmt.Fprintf(b, "%s%d: {%s}\n", indent, v.ID, strconv.Quote(string(v.payload())))
+			case len(v.Data) == 0:
+				fmt.Fprintf(b, "%s%d: {}\n", indent, v.ID)
+			default:
+				fmt.Fprintf(b, "%s%d: {`%x`}\n", indent, v.ID, v.payload())
+			}
+		}
+	}
+}
+
+type protoscopeToken struct {
+	text      string
+	quoted    bool // A string literal; text holds the unquoted value
+	line, col int
+}
+
+func scanProtoscope(s string) ([]protoscopeToken, error) {
+	var tokens []protoscopeToken
+	line, col := 1, 1
+	advance := func(n int) {
+		for _, c := range s[:n] {
+			if c == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+		}
+		s = s[n:]
+	}
+
+	for len(s) > 0 {
+		c := s[0]
+		switch {
+		case c == '#':
+			end := strings.IndexByte(s, '\n')
+			if end < 0 {
+				end = len(s)
+			}
+			advance(end)
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			advance(1)
+		case c == '{' || c == '}':
+			tokens = append(tokens, protoscopeToken{text: s[:1], line: line, col: col})
+			advance(1)
+		case strings.HasPrefix(s, "!{"):
+			tokens = append(tokens, protoscopeToken{text: "!{", line: line, col: col})
+			advance(2)
+		case c == '"':
+			end := 1
+			for end < len(s) && s[end] != '"' && s[end] != '\n' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) || s[end] != '"' {
+				return nil, fmt.Errorf("%d:%d: unterminated string", line, col)
+			}
+			value, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("%d:%d: invalid string literal: %v", line, col, err)
+			}
+			tokens = append(tokens, protoscopeToken{text: value, quoted: true, line: line, col: col})
+			advance(end + 1)
+		default:
+			end := 0
+			for end < len(s) && !strings.ContainsRune(" \t\r\n{}#\"", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, protoscopeToken{text: s[:end], line: line, col: col})
+			advance(end)
+		}
+	}
+	return tokens, nil
+}
+
+// protoscopeAssembler converts a token stream into bytes.
+type protoscopeAssembler struct {
+	tokens []protoscopeToken
+	pos    int
+}
+
+var protoscopeWireTypes = map[string]int{
+	"VARINT": WireVarint,
+	"I64":    WireFixed64,
+	"LEN":    WireBytes,
+	"I32":    WireFixed32,
+}
+
+func (a *protoscopeAssembler) errorf(t protoscopeToken, format string, args ...any) error {
+	return fmt.Errorf("%d:%d: %s", t.line, t.col, fmt.Sprintf(format, args...))
+}
+
+// assemble consumes tokens until the end of input, or until a closing brace
+// when nested is set.
+func (a *protoscopeAssembler) assemble(nested bool) ([]byte, error) {
+	var out []byte
+	longForm := 0
+	for a.pos < len(a.tokens) {
+		t := a.tokens[a.pos]
+		a.pos++
+
+		if t.quoted {
+			out = append(out, t.text...)
+			continue
+		}
+
+		switch {
+		case t.text == "}":
+			if !nested {
+				return nil, a.errorf(t, "unexpected '}'")
+			}
+			return out, nil
+
+		case t.text == "{":
+			inner, err := a.assemble(true)
+			if err != nil {
+				return nil, err
+			}
+			out = appendPaddedUvarint(out, uint64(len(inner)), longForm)
+			out = append(out, inner...)
+			longForm = 0
+
+		case t.text == "!{":
+			return nil, a.errorf(t, "groups are not supported")
+
+		case strings.HasPrefix(t.text, "long-form:"):
+			n, err := strconv.Atoi(strings.TrimPrefix(t.text, "long-form:"))
+			if err != nil || n < 0 || n > 9 {
+				return nil, a.errorf(t, "invalid long-form prefix %q", t.text)
+			}
+			longForm = n
+
+		case strings.HasPrefix(t.text, "`"):
+			if len(t.text) < 2 || !strings.HasSuffix(t.text, "`") {
+				return nil, a.errorf(t, "unterminated hex literal")
+			}
+			raw, err := hex.DecodeString(t.text[1 : len(t.text)-1])
+			if err != nil {
+				return nil, a.errorf(t, "invalid hex literal: %v", err)
+			}
+			out = append(out, raw...)
+
+		case isProtoscopeTag(t.text):
+			var err error
+			if out, err = a.assembleTag(out, t, longForm); err != nil {
+				return nil, err
+			}
+			longForm = 0
+
+		default:
+			var err error
+			if out, err = appendProtoscopeNumber(out, t.text, longForm); err != nil {
+				return nil, a.errorf(t, "%v", err)
+			}
+			longForm = 0
+		}
+	}
+	if nested {
+		return nil, fmt.Errorf("unexpected end of input: missing '}'")
+	}
+	return out, nil
+}
+
+// isProtoscopeTag reports whether a word looks like a field tag "N:" or "N:TYPE".
+func isProtoscopeTag(word string) bool {
+	i := strings.IndexByte(word, ':')
+	if i <= 0 {
+		return false
+	}
+	_, err := strconv.ParseUint(word[:i], 10, 32)
+	return err == nil
+}
+
+func (a *protoscopeAssembler) assembleTag(out []byte, t protoscopeToken, longForm int) ([]byte, error) {
+	i := strings.IndexByte(t.text, ':')
+	id, _ := strconv.ParseUint(t.text[:i], 10, 32)
+	typeName := t.text[i+1:]
+
+	wireType, ok := protoscopeWireTypes[typeName]
+	if !ok {
+		if n, err := strconv.Atoi(typeName); err == nil && n >= 0 && n <= 7 {
+			wireType, ok = n, true
+		}
+	}
+	if !ok && typeName != "" {
+		return nil, a.errorf(t, "unknown wire type %q", typeName)
+	}
+	if typeName == "" {
+		if a.pos >= len(a.tokens) {
+			return nil, a.errorf(t, "cannot infer wire type at end of input")
+		}
+		next := a.tokens[a.pos]
+		switch {
+		case next.quoted || strings.HasPrefix(next.text, "`"):
+			return nil, a.errorf(next, "cannot infer wire type; wrap the value in {...}")
+		case next.text == "{":
+			wireType = WireBytes
+		case next.text == "!{":
+			return nil, a.errorf(next, "groups are not supported")
+		case strings.HasSuffix(next.text, "i32"):
+			wireType = WireFixed32
+		case strings.HasSuffix(next.text, "i64") || isProtoscopeFloat(next.text):
+			wireType = WireFixed64
+		default:
+			wireType = WireVarint
+		}
+	}
+	return appendPaddedUvarint(out, id<<3|uint64(wireType), longForm), nil
+}
+
+// isProtoscopeFloat reports whether a word is a float literal, which starts
+// with a digit or a point, unlike identifiers such as true.
+func isProtoscopeFloat(word string) bool {
+	word = strings.TrimLeft(word, "+-")
+	if strings.HasPrefix(word, "inf") || strings.HasPrefix(word, "nan") {
+		return true
+	}
+	if word == "" || word[0] != '.' && (word[0] < '0' || word[0] > '9') {
+		return false
+	}
+	return !strings.HasPrefix(word, "0x") && strings.ContainsAny(word, ".eE")
+}
+
+// appendProtoscopeNumber encodes an integer, float or boolean literal.
+func appendProtoscopeNumber(out []byte, word string, longForm int) ([]byte, error) {
+	switch word {
+	case "true":
+		return appendPaddedUvarint(out, 1, longForm), nil
+	case "false":
+		return appendPaddedUvarint(out, 0, longForm), nil
+	}
+
+	width := 0
+	switch {
+	case strings.HasSuffix(word, "i32"):
+		width, word = 32, strings.TrimSuffix(word, "i32")
+	case strings.HasSuffix(word, "i64"):
+		width, word = 64, strings.TrimSuffix(word, "i64")
+	}
+
+	if isProtoscopeFloat(word) {
+		value, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float literal %q", word)
+		}
+		if width == 32 {
+			return binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(value))), nil
+		}
+		return binary.LittleEndian.AppendUint64(out, math.Float64bits(value)), nil
+	}
+
+	zigzag := width == 0 && strings.HasSuffix(word, "z")
+	word = strings.TrimSuffix(word, "z")
+	var value uint64
+	if signed, err := strconv.ParseInt(word, 0, 64); err == nil {
+		value = uint64(signed)
+	} else if value, err = strconv.ParseUint(word, 0, 64); err != nil {
+		return nil, fmt.Errorf("invalid number %q", word)
+	}
+
+	switch {
+	case width == 32:
+		return binary.LittleEndian.AppendUint32(out, uint32(value)), nil
+	case width == 64:
+		return binary.LittleEndian.AppendUint64(out, value), nil
+	case zigzag:
+		value = value<<1 ^ uint64(int64(value)>>63)
+	}
+	return appendPaddedUvarint(out, value, longForm), nil
+}
+
+// appendPaddedUvarint appends a varint followed by extra redundant
+// continuation bytes, producing a non-minimal encoding when extra > 0.
+func appendPaddedUvarint(out []byte, value uint64, extra int) []byte {
+	if extra == 0 {
+		return binary.AppendUvarint(out, value)
+	}
+	out = binary.AppendUvarint(out, value)
+	out[len(out)-1] |= 0x80
+	for i := 1; i < extra; i++ {
+		out = append(out, 0x80)
+	}
+	return append(out, 0x00)
+}
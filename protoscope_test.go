@@ -0,0 +1,50 @@
+package deproto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestProtoscopeRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{"1: true 2: 5", "08011005"},
+		{"1: false 2: -false", ""},
+		{"1: 1.5 2: 1e3 3: -2.5i32", "09000000000000f83f" + "110000000000408f40" + "1d000020c0"},
+		{`1: { 2: true 3: {"hi"} }`, "0a0610011a026869"},
+	} {
+		data, err := AssembleProtoscope(tc.src)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%q: assembled %x, want an error", tc.src, data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.src, err)
+			continue
+		}
+		if hex.EncodeToString(data) != tc.want {
+			t.Errorf("%q: assembled %x, want %s", tc.src, data, tc.want)
+		}
+		fields, err := ParseProtoscope(tc.src)
+		if err != nil {
+			t.Errorf("%q: %v", tc.src, err)
+			continue
+		}
+		again, err := AssembleProtoscope(FormatProtoscope(fields))
+		if err != nil || hex.EncodeToString(again) != tc.want {
+			t.Errorf("%q: formatted as %q, which assembles to %x, %v", tc.src, FormatProtoscope(fields), again, err)
+		}
+	}
+}
+
+func TestProtoscopeGroupsUnsupported(t *testing.T) {
+	for _, src := range []string{"1: !{ 2: 1 }", "!{ }"} {
+		if _, err := AssembleProtoscope(src); err == nil || !strings.Contains(err.Error(), "groups are not supported") {
+			t.Errorf("%q: error %v, want groups to be unsupported", src, err)
+		}
+	}
+}
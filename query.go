@@ -0,0 +1,288 @@
+package deproto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompiledQuery is a parsed query selecting fields from a decoded tree.
+//
+// A query is a sequence of steps separated by '.', each matching fields one
+// level deeper than the previous step:
+//
+//	2.4          field 4 inside field 2
+//	*.1          field 1 inside any top-level message field
+//	..5          field 5 at any depth
+//	3..5         field 5 anywhere below field 3
+//	..*:string   every string field
+//	3[has(1)].2  field 2 of those field 3 messages that contain field 1
+//	1[value() > 10]
+//
+// A step is a field number or '*', optionally followed by a ':' type filter
+// (varint, fixed32, fixed64, len, string, bytes or message) and any number
+// of [expr] predicates. Predicates are expressions (see Expr) evaluated
+// against the matched field's nested message, where value() returns the
+// matched field's own value and id() its field number.
+type CompiledQuery struct {
+	src   string
+	steps []queryStep
+}
+
+type queryStep struct {
+	recursive bool   // Match at any depth below the current level
+	id        int    // Field number, or -1 for any
+	kind      string // Type filter, or "" for any
+	preds     []*Expr
+}
+
+var queryKinds = map[string]bool{
+	"varint": true, "fixed32": true, "fixed64": true,
+	"len": true, "string": true, "bytes": true, "message": true,
+}
+
+// Query selects the fields matching a query string.
+func Query(fields []Field, query string) ([]Field, error) {
+	q, err := CompileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return q.Select(fields), nil
+}
+
+// QueryValues selects the fields matching a query string and returns their
+// values, as described for Values.
+func QueryValues(fields []Field, query string) ([]any, error) {
+	found, err := Query(fields, query)
+	if err != nil {
+		return nil, err
+	}
+	return Values(found), nil
+}
+
+// Values returns the value of each field: an int64 for varint and fixed
+// fields, and a string for length-delimited fields.
+func Values(fields []Field) []any {
+	values := make([]any, len(fields))
+	for i, f := range fields {
+		values[i] = fieldValue(f)
+	}
+	return values
+}
+
+// ValueString formats the value of a field for line-oriented output: numbers
+// in decimal, strings verbatim and other length-delimited data in hex.
+func ValueString(f Field) string {
+	switch v := f.(type) {
+	case *VarintField:
+		return strconv.FormatUint(v.Value, 10)
+	case *Fixed64Field:
+		return strconv.FormatUint(v.Value, 10)
+	case *Fixed32Field:
+		return strconv.FormatUint(uint64(v.Value), 10)
+	case *LengthDelimitedField:
+		if v.IsString {
+			return v.StringValue
+		}
+		return hex.EncodeToString(v.Data)
+	}
+	return ""
+}
+
+// JSONValue returns the value of a field in a form suitable for JSON
+// encoding: a uint64 for numeric fields, the string for string fields and a
+// hex string for other length-delimited data.
+func JSONValue(f Field) any {
+	switch v := f.(type) {
+	case *VarintField:
+		return v.Value
+	case *Fixed64Field:
+		return v.Value
+	case *Fixed32Field:
+		return uint64(v.Value)
+	case *LengthDelimitedField:
+		if v.IsString {
+			return v.StringValue
+		}
+		return hex.EncodeToString(v.Data)
+	}
+	return nil
+}
+
+// CompileQuery parses a query.
+func CompileQuery(query string) (*CompiledQuery, error) {
+	q := &CompiledQuery{src: query}
+	s := query
+	for first := true; s != "" || first; first = false {
+		var step queryStep
+		switch {
+		case strings.HasPrefix(s, ".."):
+			step.recursive = true
+			s = s[2:]
+		case strings.HasPrefix(s, "."):
+			if first {
+				s = s[1:]
+			} else if s = s[1:]; s == "" {
+				return nil, fmt.Errorf("query %q: trailing '.'", query)
+			}
+		case !first:
+			return nil, fmt.Errorf("query %q: expected '.' before %q", query, s)
+		}
+
+		end := strings.IndexAny(s, ".:[")
+		if end < 0 {
+			end = len(s)
+		}
+		switch name := s[:end]; name {
+		case "*":
+			step.id = -1
+		case "":
+			return nil, fmt.Errorf("query %q: missing field number", query)
+		default:
+			id, err := strconv.Atoi(name)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("query %q: invalid field number %q", query, name)
+			}
+			step.id = id
+		}
+		s = s[end:]
+
+		if strings.HasPrefix(s, ":") {
+			end := strings.IndexAny(s[1:], ".[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			step.kind = s[1 : end+1]
+			if !queryKinds[step.kind] {
+				return nil, fmt.Errorf("query %q: unknown type %q", query, step.kind)
+			}
+			s = s[end+1:]
+		}
+
+		for strings.HasPrefix(s, "[") {
+			end := matchingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("query %q: unterminated '['", query)
+			}
+			pred, err := CompileExpr(s[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("query %q: %v", query, err)
+			}
+			step.preds = append(step.preds, pred)
+			s = s[end+1:]
+		}
+		q.steps = append(q.steps, step)
+	}
+	return q, nil
+}
+
+// matchingBracket returns the index of the ']' closing the '[' at s[0],
+// skipping brackets inside quoted strings, or -1.
+func matchingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// String returns the source of the query.
+func (q *CompiledQuery) String() string {
+	return q.src
+}
+
+// Select returns the fields matching the query, in tree order.
+func (q *CompiledQuery) Select(fields []Field) []Field {
+	contexts := [][]Field{fields}
+	var matched []Field
+	for i, step := range q.steps {
+		matched = nil
+		for _, ctx := range contexts {
+			if step.recursive {
+				Walk(ctx, func(_ FieldPath, f Field) bool {
+					if step.matches(f) {
+						matched = append(matched, f)
+					}
+					return true
+				})
+			} else {
+				for _, f := range ctx {
+					if step.matches(f) {
+						matched = append(matched, f)
+					}
+				}
+			}
+		}
+		if i == len(q.steps)-1 {
+			break
+		}
+		contexts = contexts[:0]
+		for _, f := range matched {
+			if l, ok := f.(*LengthDelimitedField); ok && len(l.SubFields) > 0 {
+				contexts = append(contexts, l.SubFields)
+			}
+		}
+	}
+	return matched
+}
+
+func (s *queryStep) matches(f Field) bool {
+	base := fieldBase(f)
+	if base == nil || s.id >= 0 && base.ID != s.id {
+		return false
+	}
+	if s.kind != "" && fieldKind(f) != s.kind && !(s.kind == "len" && base.WireType == WireBytes) {
+		return false
+	}
+	for _, pred := range s.preds {
+		env := &exprEnv{self: f}
+		if l, ok := f.(*LengthDelimitedField); ok {
+			env.fields = l.SubFields
+		}
+		v, err := pred.root.eval(env)
+		if err != nil || !truthy(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldKind returns the query type name of a field.
+func fieldKind(f Field) string {
+	switch v := f.(type) {
+	case *VarintField:
+		return "varint"
+	case *Fixed32Field:
+		return "fixed32"
+	case *Fixed64Field:
+		return "fixed64"
+	case *LengthDelimitedField:
+		switch {
+		case len(v.SubFields) > 0:
+			return "message"
+		case v.IsString:
+			return "string"
+		default:
+			return "bytes"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,594 @@
+package deproto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// quicVersion1 is the QUIC version DecryptQUIC reads, that of RFC 9000.
+const quicVersion1 = 1
+
+// maxConnectionIDLength is the longest connection ID QUIC version 1 allows.
+const maxConnectionIDLength = 20
+
+// DecryptQUIC decrypts the QUIC connections of a capture with the TLS
+// secrets registered by RegisterKeyLog, and replaces their UDP packets with
+// the bodies of the HTTP/3 requests and responses they carry: the DATA
+// frames of each request stream, put back in order, which for gRPC over
+// HTTP/3 are gRPC frames. Each body is returned as an "http3" packet timed
+// and addressed like the first packet of its stream, with the stream ID set.
+//
+// Only QUIC version 1 and the AES-GCM cipher suites are supported. Packets
+// of connections that no registered secret decrypts are returned unchanged,
+// as are TCP packets, and the result is in capture order.
+func DecryptQUIC(packets []Packet) []Packet {
+	type entry struct {
+		index  int
+		packet Packet
+	}
+	var out []entry
+	conns := make(map[string]*quicConn)
+	var order []*quicConn
+	for i, p := range packets {
+		if p.Protocol != "udp" {
+			out = append(out, entry{i, p})
+			continue
+		}
+		key := p.Src.String() + " " + p.Dst.String()
+		if p.Dst.String() < p.Src.String() {
+			key = p.Dst.String() + " " + p.Src.String()
+		}
+		c := conns[key]
+		if c == nil {
+			c = newQUICConn(p.Src)
+			conns[key] = c
+			order = append(order, c)
+		}
+		c.packets = append(c.packets, i)
+		c.receive(i, p)
+	}
+	for _, c := range order {
+		if !c.decrypted {
+			for _, i := range c.packets {
+				out = append(out, entry{i, packets[i]})
+			}
+			continue
+		}
+		c.bodies(func(index int, p Packet) {
+			out = append(out, entry{index, p})
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].index != out[j].index {
+			return out[i].index < out[j].index
+		}
+		return out[i].packet.Stream < out[j].packet.Stream
+	})
+	result := make([]Packet, len(out))
+	for i, e := range out {
+		result[i] = e.packet
+	}
+	return result
+}
+
+// quicConn is the state of one QUIC connection, between two UDP endpoints.
+type quicConn struct {
+	client    netip.AddrPort
+	packets   []int                          // Positions of the connection's packets in the capture
+	cidLength map[netip.AddrPort]int         // Length of the connection IDs of packets sent to an endpoint, when known
+	senders   map[netip.AddrPort]*quicSender // By the endpoint sending
+	streams   map[quicStreamKey]*quicStream
+	decrypted bool
+}
+
+// quicSender holds the keys of one side of a connection.
+type quicSender struct {
+	keys, early *quicKeys // 1-RTT and 0-RTT packet protection, once known
+	largest     int64     // Largest packet number decrypted, -1 before any
+}
+
+type quicStreamKey struct {
+	sender netip.AddrPort
+	id     uint64
+}
+
+func newQUICConn(client netip.AddrPort) *quicConn {
+	return &quicConn{
+		client:    client,
+		cidLength: make(map[netip.AddrPort]int),
+		senders:   make(map[netip.AddrPort]*quicSender),
+		streams:   make(map[quicStreamKey]*quicStream),
+	}
+}
+
+func (c *quicConn) sender(addr netip.AddrPort) *quicSender {
+	s := c.senders[addr]
+	if s == nil {
+		s = &quicSender{largest: -1}
+		c.senders[addr] = s
+	}
+	return s
+}
+
+// receive decrypts the QUIC packets of a datagram it can and collects the
+// stream data they carry.
+func (c *quicConn) receive(index int, p Packet) {
+	data := p.Payload
+	for len(data) > 0 {
+		var payload []byte
+		if data[0]&0x80 != 0 {
+			h, ok := parseLongHeader(data)
+			if !ok {
+				return
+			}
+			c.cidLength[p.Src] = h.scidLength
+			if h.packetType == 1 && p.Src == c.client {
+				payload = c.openEarly(p, data[:h.end], h.pnOffset)
+			}
+			data = data[h.end:]
+		} else {
+			payload = c.openShort(p, data)
+			data = nil
+		}
+		if payload == nil {
+			continue
+		}
+		c.decrypted = true
+		quicFrames(payload, func(id, offset uint64, b []byte) {
+			// HTTP/3 requests and responses travel on the client's
+			// bidirectional streams.
+			if id&3 != 0 {
+				return
+			}
+			key := quicStreamKey{p.Src, id}
+			s := c.streams[key]
+			if s == nil {
+				s = &quicStream{index: index, packet: Packet{Time: p.Time, Protocol: "http3", Src: p.Src, Dst: p.Dst, Stream: id}}
+				c.streams[key] = s
+			}
+			s.segments = append(s.segments, quicSegment{offset, b})
+		})
+	}
+}
+
+// openEarly decrypts a 0-RTT packet with the client's early traffic secret.
+func (c *quicConn) openEarly(p Packet, packet []byte, pnOffset int) []byte {
+	s := c.sender(p.Src)
+	if s.early == nil {
+		for _, secret := range tlsSecrets.all("CLIENT_EARLY_TRAFFIC_SECRET") {
+			keys, err := newQUICKeys(secret)
+			if err != nil {
+				continue
+			}
+			if pn, payload, err := keys.open(packet, pnOffset, s.largest); err == nil {
+				s.early, s.largest = keys, max(s.largest, pn)
+				return payload
+			}
+		}
+		return nil
+	}
+	pn, payload, err := s.early.open(packet, pnOffset, s.largest)
+	if err != nil {
+		return nil
+	}
+	s.largest = max(s.largest, pn)
+	return payload
+}
+
+// openShort decrypts a 1-RTT packet, which takes up the rest of its
+// datagram. The first packet of each side is tried against every
+// registered secret and connection ID length until one fits.
+func (c *quicConn) openShort(p Packet, packet []byte) []byte {
+	s := c.sender(p.Src)
+	lengths := []int{c.cidLength[p.Dst]}
+	if _, ok := c.cidLength[p.Dst]; !ok {
+		lengths = lengths[:0]
+		for n := 0; n <= maxConnectionIDLength; n++ {
+			lengths = append(lengths, n)
+		}
+	}
+	if s.keys == nil {
+		label, peerLabel := "SERVER_TRAFFIC_SECRET_0", "CLIENT_TRAFFIC_SECRET_0"
+		if p.Src == c.client {
+			label, peerLabel = peerLabel, label
+		}
+		for random, secret := range tlsSecrets.all(label) {
+			keys, err := newQUICKeys(secret)
+			if err != nil {
+				continue
+			}
+			for _, n := range lengths {
+				pn, payload, err := keys.open(packet, 1+n, s.largest)
+				if err != nil {
+					continue
+				}
+				s.keys, s.largest = keys, max(s.largest, pn)
+				c.cidLength[p.Dst] = n
+				if peerSecret, ok := tlsSecrets.secret(peerLabel, random); ok {
+					if peerKeys, err := newQUICKeys(peerSecret); err == nil {
+						c.sender(p.Dst).keys = peerKeys
+					}
+				}
+				return payload
+			}
+		}
+		return nil
+	}
+	for _, n := range lengths {
+		pn, payload, err := s.keys.open(packet, 1+n, s.largest)
+		if err != nil {
+			// After a key update, the next generation of keys protects
+			// the packets.
+			next, nerr := s.keys.next()
+			if nerr != nil {
+				continue
+			}
+			if pn, payload, err = next.open(packet, 1+n, s.largest); err != nil {
+				continue
+			}
+			s.keys = next
+		}
+		s.largest = max(s.largest, pn)
+		c.cidLength[p.Dst] = n
+		return payload
+	}
+	return nil
+}
+
+// bodies passes emit the HTTP/3 bodies completed on the connection's
+// streams since the last call, each timed and addressed like the first
+// packet of its stream, with that packet's position.
+func (c *quicConn) bodies(emit func(index int, p Packet)) {
+	for _, s := range c.streams {
+		if body := s.take(); len(body) > 0 {
+			p := s.packet
+			p.Payload = body
+			emit(s.index, p)
+		}
+	}
+}
+
+// quicLongHeader is the layout of a long header packet.
+type quicLongHeader struct {
+	packetType int // 0 Initial, 1 0-RTT, 2 Handshake, 3 Retry
+	scidLength int // Length of the source connection ID
+	pnOffset   int // Offset of the packet number
+	end        int // Length of the packet within its datagram
+}
+
+// parseLongHeader reads the long header of a QUIC version 1 packet.
+func parseLongHeader(data []byte) (quicLongHeader, bool) {
+	if len(data) < 7 || binary.BigEndian.Uint32(data[1:]) != quicVersion1 {
+		return quicLongHeader{}, false
+	}
+	h := quicLongHeader{packetType: int(data[0]>>4) & 3}
+	r := quicReader{data: data[5:]}
+	r.bytes(uint64(r.readByte()))
+	h.scidLength = int(r.readByte())
+	r.bytes(uint64(h.scidLength))
+	if h.packetType == 3 {
+		// Retry packets hold no packet number and fill the datagram.
+		h.pnOffset, h.end = len(data), len(data)
+		return h, !r.failed
+	}
+	if h.packetType == 0 {
+		r.bytes(r.varint()) // Token
+	}
+	length := r.varint()
+	if r.failed || length > uint64(len(r.data)) {
+		return quicLongHeader{}, false
+	}
+	h.pnOffset = len(data) - len(r.data)
+	h.end = h.pnOffset + int(length)
+	return h, true
+}
+
+// quicKeys protects the packets one side sends at one encryption level.
+type quicKeys struct {
+	secret  []byte
+	newHash func() hash.Hash
+	aead    cipher.AEAD
+	iv      []byte
+	hp      cipher.Block
+}
+
+// newQUICKeys derives packet protection keys from a TLS traffic secret, as
+// RFC 9001 describes. The length of the secret tells the cipher suite:
+// TLS_AES_128_GCM_SHA256 or TLS_AES_256_GCM_SHA384.
+func newQUICKeys(secret []byte) (*quicKeys, error) {
+	k := &quicKeys{secret: secret}
+	var keyLength int
+	switch len(secret) {
+	case sha256.Size:
+		k.newHash, keyLength = sha256.New, 16
+	case sha512.Size384:
+		k.newHash, keyLength = sha512.New384, 32
+	default:
+		return nil, fmt.Errorf("unsupported secret length %d", len(secret))
+	}
+	hp, err := aes.NewCipher(expandLabel(k.newHash, secret, "quic hp", keyLength))
+	if err != nil {
+		return nil, err
+	}
+	k.hp = hp
+	if err := k.derive(keyLength); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// derive sets the key and IV from the secret.
+func (k *quicKeys) derive(keyLength int) error {
+	block, err := aes.NewCipher(expandLabel(k.newHash, k.secret, "quic key", keyLength))
+	if err != nil {
+		return err
+	}
+	if k.aead, err = cipher.NewGCM(block); err != nil {
+		return err
+	}
+	k.iv = expandLabel(k.newHash, k.secret, "quic iv", 12)
+	return nil
+}
+
+// next returns the keys of the next key phase, which keep the header
+// protection key.
+func (k *quicKeys) next() (*quicKeys, error) {
+	n := &quicKeys{newHash: k.newHash, hp: k.hp}
+	n.secret = expandLabel(k.newHash, k.secret, "quic ku", len(k.secret))
+	keyLength := 16
+	if len(k.secret) == sha512.Size384 {
+		keyLength = 32
+	}
+	if err := n.derive(keyLength); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// open removes the header protection of a packet whose packet number starts
+// at pnOffset and decrypts its payload. It returns the full packet number,
+// recovered from the largest one seen before.
+func (k *quicKeys) open(packet []byte, pnOffset int, largest int64) (int64, []byte, error) {
+	if pnOffset+4+aes.BlockSize > len(packet) {
+		return 0, nil, fmt.Errorf("packet too short")
+	}
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	header := make([]byte, pnOffset+4)
+	copy(header, packet)
+	if header[0]&0x80 != 0 {
+		header[0] ^= mask[0] & 0x0f
+	} else {
+		header[0] ^= mask[0] & 0x1f
+	}
+	pnLength := int(header[0]&3) + 1
+	var truncated uint64
+	for i := range pnLength {
+		header[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(header[pnOffset+i])
+	}
+	header = header[:pnOffset+pnLength]
+	pn := decodePacketNumber(largest, truncated, pnLength*8)
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	payload, err := k.aead.Open(nil, nonce, packet[len(header):], header)
+	if err != nil {
+		return 0, nil, err
+	}
+	return pn, payload, nil
+}
+
+// expandLabel is HKDF-Expand-Label from TLS 1.3, with an empty context.
+func expandLabel(newHash func() hash.Hash, secret []byte, label string, length int) []byte {
+	full := "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(full))}
+	info = append(append(info, full...), 0)
+	out, err := hkdf.Expand(newHash, secret, string(info), length)
+	if err != nil {
+		panic(err) // Only for lengths no label here asks for
+	}
+	return out
+}
+
+// decodePacketNumber recovers a full packet number from its truncated
+// encoding of the given number of bits, as in RFC 9000 appendix A.3.
+func decodePacketNumber(largest int64, truncated uint64, bits int) int64 {
+	expected := largest + 1
+	window := int64(1) << bits
+	candidate := expected&^(window-1) | int64(truncated)
+	switch {
+	case candidate <= expected-window/2 && candidate < 1<<62-window:
+		candidate += window
+	case candidate > expected+window/2 && candidate >= window:
+		candidate -= window
+	}
+	return candidate
+}
+
+// quicReader reads the fields of QUIC headers and frames, remembering
+// whether it ran out of data.
+type quicReader struct {
+	data   []byte
+	failed bool
+}
+
+func (r *quicReader) readByte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *quicReader) bytes(n uint64) []byte {
+	if r.failed || n > uint64(len(r.data)) {
+		r.failed = true
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// varint reads a QUIC variable-length integer, whose first two bits give
+// its length.
+func (r *quicReader) varint() uint64 {
+	if r.failed || len(r.data) == 0 {
+		r.failed = true
+		return 0
+	}
+	b := r.bytes(1 << (r.data[0] >> 6))
+	if b == nil {
+		return 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// quicFrames calls stream with the data of each STREAM frame of a
+// decrypted packet payload. It stops at the first frame it cannot read.
+func quicFrames(payload []byte, stream func(id, offset uint64, data []byte)) {
+	r := quicReader{data: payload}
+	for len(r.data) > 0 && !r.failed {
+		switch typ := r.varint(); {
+		case typ == 0x00, typ == 0x01, typ == 0x1e: // PADDING, PING, HANDSHAKE_DONE
+		case typ == 0x02, typ == 0x03: // ACK
+			r.varint()
+			r.varint()
+			ranges := r.varint()
+			r.varint()
+			for i := uint64(0); i < ranges && !r.failed; i++ {
+				r.varint()
+				r.varint()
+			}
+			if typ == 0x03 {
+				r.varint()
+				r.varint()
+				r.varint()
+			}
+		case typ == 0x04: // RESET_STREAM
+			r.varint()
+			r.varint()
+			r.varint()
+		case typ == 0x05, typ == 0x11, typ == 0x15: // STOP_SENDING, MAX_STREAM_DATA, STREAM_DATA_BLOCKED
+			r.varint()
+			r.varint()
+		case typ == 0x06: // CRYPTO
+			r.varint()
+			r.bytes(r.varint())
+		case typ == 0x07: // NEW_TOKEN
+			r.bytes(r.varint())
+		case typ >= 0x08 && typ <= 0x0f: // STREAM
+			id := r.varint()
+			var offset uint64
+			if typ&0x04 != 0 {
+				offset = r.varint()
+			}
+			length := uint64(len(r.data))
+			if typ&0x02 != 0 {
+				length = r.varint()
+			}
+			if data := r.bytes(length); !r.failed {
+				stream(id, offset, data)
+			}
+		case typ == 0x10, typ >= 0x12 && typ <= 0x14, typ == 0x16, typ == 0x17, typ == 0x19:
+			// MAX_DATA, MAX_STREAMS, DATA_BLOCKED, STREAMS_BLOCKED, RETIRE_CONNECTION_ID
+			r.varint()
+		case typ == 0x18: // NEW_CONNECTION_ID
+			r.varint()
+			r.varint()
+			r.bytes(uint64(r.readByte()))
+			r.bytes(16)
+		case typ == 0x1a, typ == 0x1b: // PATH_CHALLENGE, PATH_RESPONSE
+			r.bytes(8)
+		case typ == 0x1c, typ == 0x1d: // CONNECTION_CLOSE
+			r.varint()
+			if typ == 0x1c {
+				r.varint()
+			}
+			r.bytes(r.varint())
+		case typ == 0x30: // DATAGRAM filling the packet
+			r.data = nil
+		case typ == 0x31: // DATAGRAM
+			r.bytes(r.varint())
+		default:
+			return
+		}
+	}
+}
+
+// quicStream collects the data one side sends on a stream.
+type quicStream struct {
+	packet   Packet // Addressing of the body, from the first packet
+	index    int    // Position of the first packet in the capture
+	base     uint64 // Offset of the first byte not read as HTTP/3 frames yet
+	segments []quicSegment
+}
+
+type quicSegment struct {
+	offset uint64
+	data   []byte
+}
+
+// data returns the stream's bytes from base in order, up to the first gap.
+func (s *quicStream) data() []byte {
+	sort.SliceStable(s.segments, func(i, j int) bool { return s.segments[i].offset < s.segments[j].offset })
+	var out []byte
+	for _, seg := range s.segments {
+		next := s.base + uint64(len(out))
+		if seg.offset > next {
+			break
+		}
+		if end := seg.offset + uint64(len(seg.data)); end > next {
+			out = append(out, seg.data[next-seg.offset:]...)
+		}
+	}
+	return out
+}
+
+// take returns the body in the HTTP/3 frames completed on the stream since
+// the last call and drops the data they came in.
+func (s *quicStream) take() []byte {
+	body, n := http3Body(s.data())
+	s.base += uint64(n)
+	s.segments = slices.DeleteFunc(s.segments, func(seg quicSegment) bool {
+		return seg.offset+uint64(len(seg.data)) <= s.base
+	})
+	return body
+}
+
+// http3Body returns the payloads of the DATA frames of an HTTP/3 request or
+// response stream, joined, up to the first incomplete frame, and the length
+// of the frames read. Headers and other frames are skipped.
+func http3Body(stream []byte) ([]byte, int) {
+	var body []byte
+	r := quicReader{data: stream}
+	n := 0
+	for len(r.data) > 0 {
+		typ, length := r.varint(), r.varint()
+		payload := r.bytes(length)
+		if r.failed {
+			break
+		}
+		if typ == 0x00 {
+			body = append(body, payload...)
+		}
+		n = len(stream) - len(r.data)
+	}
+	return body, n
+}
@@ -0,0 +1,73 @@
+package deproto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The client Initial packet of RFC 9001, Appendix A.
+func TestQUICKeysRFC9001(t *testing.T) {
+	hexBytes := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	keys, err := newQUICKeys(hexBytes("3c199828fd139efd216c155ad844cc81fb82fa8d7446fa7d78be803acdda951b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(keys.iv), "0ac1493ca1905853b0bba03e"; got != want {
+		t.Errorf("IV %s, want %s", got, want)
+	}
+	packet := hexBytes("cf000000010008f067a5502a4262b5004075c0d95a482cd0991cd25b0aac406a5816b6394100f37a1c69797554780bb38cc5a99f5ede4cf73c3ec2493a1839b3dbcba3f6ea46c5b7684df3548e7ddeb9c3bf9c73cc3f3bded74b562bfb19fb84022f8ef4cdd93795d77d06edbb7aaf2f58891850abbdca3d20398c276456cbc42158407dd074ee")
+	h, ok := parseLongHeader(packet)
+	if !ok || h.end != len(packet) || h.scidLength != 8 {
+		t.Fatalf("parseLongHeader returned %+v, %v, want a packet of %d bytes with an 8-byte source connection ID", h, ok, len(packet))
+	}
+	pn, payload, err := keys.open(packet, h.pnOffset, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hexBytes("02000000000600405a020000560303eefce7f7b37ba1d1632e96677825ddf73988cfc79825df566dc5430b9a045a1200130100002e00330024001d00209d3c940d89690b84d08a60993c144eca684d1081287c834d5311bcf32bb9da1a002b00020304")
+	if pn != 1 || !bytes.Equal(payload, want) {
+		t.Errorf("opened packet %d with payload %x, want packet 1 with payload %x", pn, payload, want)
+	}
+}
+
+func TestDecryptQUIC(t *testing.T) {
+	packets, request, response := quicExchange(t)
+	// A second request after a key update, on stream 4.
+	clientKeys, err := newQUICKeys(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := clientKeys.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := GRPCFrame([]byte{0x08, 0x02})
+	frames := append(http3Frame(1, []byte{0, 0, 0xd1}), http3Frame(0, second)...)
+	serverCID := []byte{9, 9, 9, 9, 9, 9, 9, 9}
+	packets = append(packets,
+		Packet{Time: packets[2].Time.Add(time.Minute), Protocol: "udp", Src: testClient, Dst: testServer,
+			Payload: sealQUIC(updated, serverCID, 2, append(quicStreamFrame(4, 0, frames), make([]byte, 20)...))},
+		Packet{Time: packets[2].Time.Add(time.Hour), Protocol: "udp", Src: netip.MustParseAddrPort("10.0.0.3:53"), Dst: netip.MustParseAddrPort("10.0.0.4:53"),
+			Payload: []byte{0x08, 0x01}})
+
+	got := DecryptQUIC(packets)
+	want := []Packet{
+		{Time: packets[0].Time, Protocol: "http3", Src: testClient, Dst: testServer, Payload: request},
+		{Time: packets[1].Time, Protocol: "http3", Src: testServer, Dst: testClient, Payload: response},
+		{Time: packets[3].Time, Protocol: "http3", Src: testClient, Dst: testServer, Stream: 4, Payload: second},
+		packets[4],
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecryptQUIC returned %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package deproto
+
+import (
+	"slices"
+	"sort"
+)
+
+// ReassembleTCP joins the payloads of the TCP packets of each connection
+// into turns: the bytes one side sends from when it starts sending until
+// the other side replies, put in sequence order with retransmitted and
+// overlapping bytes dropped. A message split across several segments thus
+// comes out whole, and a request or response is one payload. Each turn is
+// returned as a packet timed and addressed like its first segment. Bytes
+// after a gap left by a lost segment are appended at the end of the turn.
+// UDP packets are returned unchanged, and the result is in capture order.
+func ReassembleTCP(packets []Packet) []Packet {
+	return reassembleTCP(packets, make(map[string]uint32))
+}
+
+// reassembleTCP reassembles packets as ReassembleTCP does, given in next
+// the sequence number after the last turn of each direction, "src > dst",
+// reassembled before, and updates it.
+func reassembleTCP(packets []Packet, next map[string]uint32) []Packet {
+	var done []*tcpTurn
+	open := make(map[string]*tcpTurn) // By direction
+	last := make(map[string]string)   // Direction of the open turn, by connection
+	closeTurn := func(dir string) {
+		t := open[dir]
+		t.flush()
+		next[dir] = t.next
+		done = append(done, t)
+		delete(open, dir)
+	}
+
+	for i, p := range packets {
+		if p.Protocol != "tcp" {
+			done = append(done, &tcpTurn{packet: p, index: i})
+			continue
+		}
+		dir := p.Src.String() + " > " + p.Dst.String()
+		conn := p.Dst.String() + " " + p.Src.String()
+		if p.Src.String() < p.Dst.String() {
+			conn = p.Src.String() + " " + p.Dst.String()
+		}
+		if prev, ok := last[conn]; ok && prev != dir {
+			closeTurn(prev)
+		}
+		last[conn] = dir
+		t := open[dir]
+		if t == nil {
+			seq, ok := next[dir]
+			if !ok {
+				seq = p.Seq
+			}
+			t = &tcpTurn{packet: p, index: i, next: seq}
+			t.packet.Seq, t.packet.Payload = seq, nil
+			open[dir] = t
+		}
+		t.receive(p)
+	}
+	for dir := range open {
+		closeTurn(dir)
+	}
+
+	sort.Slice(done, func(i, j int) bool { return done[i].index < done[j].index })
+	out := make([]Packet, len(done))
+	for i, t := range done {
+		out[i] = t.packet
+	}
+	return out
+}
+
+// tcpTurn collects the segments of one turn of a TCP connection.
+type tcpTurn struct {
+	packet  Packet
+	index   int      // Position of the first segment in the capture
+	next    uint32   // Sequence number of the next byte expected
+	pending []Packet // Segments that arrived ahead of a missing one
+}
+
+// receive adds a segment, or holds it back if bytes before it are missing.
+func (t *tcpTurn) receive(p Packet) {
+	if int32(p.Seq-t.next) > 0 {
+		t.pending = append(t.pending, p)
+		return
+	}
+	t.add(p)
+	// Segments that arrived early may now follow on.
+	for i := 0; i < len(t.pending); {
+		if q := t.pending[i]; int32(q.Seq-t.next) <= 0 {
+			t.add(q)
+			t.pending = slices.Delete(t.pending, i, i+1)
+			i = 0
+			continue
+		}
+		i++
+	}
+}
+
+// flush adds the segments still held back, in sequence order, skipping
+// over the gaps before them.
+func (t *tcpTurn) flush() {
+	sort.SliceStable(t.pending, func(i, j int) bool {
+		return int32(t.pending[i].Seq-t.pending[j].Seq) < 0
+	})
+	for _, p := range t.pending {
+		t.add(p)
+	}
+	t.pending = nil
+}
+
+// add appends the bytes of a segment that the turn does not have yet.
+func (t *tcpTurn) add(p Packet) {
+	skip := int32(t.next - p.Seq) // Bytes of the segment already added
+	if skip < 0 {
+		skip = 0
+	}
+	if int(skip) >= len(p.Payload) {
+		return
+	}
+	t.packet.Payload = append(t.packet.Payload, p.Payload[skip:]...)
+	t.next = p.Seq + uint32(len(p.Payload))
+}
@@ -0,0 +1,224 @@
+package deproto
+
+import "sort"
+
+// RefineSchema merges new observations into a schema previously returned by
+// InferSchema (and possibly edited since), so that a schema can be improved
+// capture by capture instead of being regenerated from scratch. The schema
+// itself is not modified.
+//
+// Names, comments, enums and field types chosen by hand are kept wherever
+// the new messages are consistent with them. Otherwise the merged field is
+// widened to cover both: a required field missing from new messages becomes
+// optional, a field seen repeated becomes repeated, bool widens to int64,
+// double and float to fixed64 and fixed32, and a nested message to bytes or
+// string when its data no longer parses as one. Fields that first appear in
+// the new messages are added as optional.
+func RefineSchema(schema *Schema, corpus [][]Field) *Schema {
+	if len(schema.Messages) == 0 {
+		return InferSchema(corpus, InferOptions{Package: schema.Package, Syntax: schema.Syntax})
+	}
+	old := schema.Messages[0]
+	observed := newInferrer(SchemaNaming(schema), 1).schema(old.Name, schema.Syntax, schema.Package, corpus)
+
+	merged := &Schema{Syntax: schema.Syntax, Package: schema.Package, Enums: schema.Enums}
+	merged.Messages = append(merged.Messages, mergeMessage(old, observed.Messages[0], len(corpus) > 0))
+	for _, m := range schema.Messages[1:] {
+		merged.Messages = append(merged.Messages, cloneMessage(m))
+	}
+	setFullNames(merged)
+	return merged
+}
+
+// mergeMessage combines a known message with one inferred from new
+// observations. observed is false when no instances of the message were
+// seen, in which case the known message is returned unchanged.
+func mergeMessage(old, seen *MessageSchema, observed bool) *MessageSchema {
+	if !observed || seen == nil {
+		return cloneMessage(old)
+	}
+	msg := &MessageSchema{Name: old.Name, Enums: old.Enums}
+	nested := make(map[string]bool)
+	addNested := func(m *MessageSchema) {
+		if m != nil && !nested[m.Name] {
+			nested[m.Name] = true
+			msg.Nested = append(msg.Nested, m)
+		}
+	}
+
+	var numbers []int
+	for _, f := range old.Fields {
+		numbers = append(numbers, f.Number)
+	}
+	for _, f := range seen.Fields {
+		if old.Field(f.Number) == nil {
+			numbers = append(numbers, f.Number)
+		}
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		a, b := old.Field(number), seen.Field(number)
+		var field *FieldSchema
+		switch {
+		case b == nil:
+			field = cloneField(a)
+			if field.Label == LabelRequired {
+				field.Label = LabelOptional
+			}
+			if a.Message != nil && isLocalMessage(old, seen, a.Message.Name) {
+				field.Message = cloneMessage(a.Message)
+			}
+		case a == nil:
+			field = cloneField(b)
+			if field.Label == LabelRequired {
+				field.Label = LabelOptional
+			}
+		default:
+			field = mergeField(a, b)
+		}
+		if field.Message != nil && isLocalMessage(old, seen, field.Message.Name) {
+			addNested(field.Message)
+		}
+		msg.Fields = append(msg.Fields, field)
+	}
+	// Keep messages declared by hand that no field refers to.
+	for _, m := range old.Nested {
+		if !nested[m.Name] {
+			addNested(cloneMessage(m))
+		}
+	}
+	pruneOneofs(msg)
+	return msg
+}
+
+// mergeField combines a known field with its newly observed counterpart.
+func mergeField(old, seen *FieldSchema) *FieldSchema {
+	field := cloneField(old)
+	switch {
+	case old.Label == LabelRepeated || seen.Label == LabelRepeated:
+		field.Label = LabelRepeated
+	case old.Label == LabelRequired && seen.Label == LabelRequired:
+		field.Label = LabelRequired
+	default:
+		field.Label = LabelOptional
+	}
+	if field.Comment == "" {
+		field.Comment = seen.Comment
+	}
+
+	switch {
+	case old.Message != nil && seen.Message != nil:
+		if old.Message.Name != seen.Message.Name {
+			break // Declared elsewhere by hand
+		}
+		field.Message = mergeMessage(old.Message, seen.Message, true)
+	case old.Message != nil && (seen.Type == "string" || seen.Type == "bytes"):
+		// The decoder only falls back to a string or bytes when the data
+		// does not parse, so the message interpretation was wrong.
+		field.Message, field.Type = nil, seen.Type
+	case old.Message != nil || seen.Message != nil:
+		// A string or bytes field that happened to parse as a message.
+	case old.WireType() != seen.WireType():
+		field.Comment = "wire types varied: " + old.Type + " and " + seen.Type
+	default:
+		field.Type = widenType(old.Type, seen.Type)
+	}
+	return field
+}
+
+// widenType returns the inferred type that covers values of both old and
+// seen, which share a wire type. Types other than the ones InferSchema
+// generates were chosen by hand and are kept.
+func widenType(old, seen string) string {
+	switch old {
+	case "bool":
+		if seen == "int64" {
+			return seen
+		}
+	case "double":
+		if seen == "fixed64" {
+			return seen
+		}
+	case "float":
+		if seen == "fixed32" {
+			return seen
+		}
+	case "string":
+		if seen == "bytes" {
+			return seen
+		}
+	}
+	return old
+}
+
+// isLocalMessage reports whether the message with the given name is declared
+// inside old or seen rather than elsewhere in the schema.
+func isLocalMessage(old, seen *MessageSchema, name string) bool {
+	for _, m := range old.Nested {
+		if m.Name == name {
+			return true
+		}
+	}
+	for _, m := range seen.Nested {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneOneofs removes fields from oneofs that are no longer optional and
+// dissolves oneofs left with fewer than two members.
+func pruneOneofs(msg *MessageSchema) {
+	members := make(map[string]int)
+	for _, f := range msg.Fields {
+		if f.Label != LabelOptional {
+			f.Oneof = ""
+		}
+		if f.Oneof != "" {
+			members[f.Oneof]++
+		}
+	}
+	for _, f := range msg.Fields {
+		if members[f.Oneof] < 2 {
+			f.Oneof = ""
+		}
+	}
+}
+
+// cloneMessage deep-copies a message and its nested messages. Enums and
+// messages declared outside it are shared.
+func cloneMessage(m *MessageSchema) *MessageSchema {
+	clones := make(map[*MessageSchema]*MessageSchema)
+	var clone func(m *MessageSchema) *MessageSchema
+	clone = func(m *MessageSchema) *MessageSchema {
+		c := &MessageSchema{Name: m.Name, FullName: m.FullName, Enums: m.Enums}
+		clones[m] = c
+		for _, n := range m.Nested {
+			c.Nested = append(c.Nested, clone(n))
+		}
+		return c
+	}
+	root := clone(m)
+	var fields func(m *MessageSchema)
+	fields = func(m *MessageSchema) {
+		c := clones[m]
+		for _, f := range m.Fields {
+			cf := cloneField(f)
+			if nested, ok := clones[f.Message]; ok {
+				cf.Message = nested
+			}
+			c.Fields = append(c.Fields, cf)
+		}
+		for _, n := range m.Nested {
+			fields(n)
+		}
+	}
+	fields(m)
+	return root
+}
+
+func cloneField(f *FieldSchema) *FieldSchema {
+	c := *f
+	return &c
+}
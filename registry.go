@@ -0,0 +1,176 @@
+package deproto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Registry holds schemas loaded from .proto files, indexed by fully
+// qualified type name, with type references resolved across files.
+type Registry struct {
+	ImportPaths []string // Directories searched for files and their imports
+
+	files    map[string]*Schema
+	loading  map[string]bool
+	messages map[string]*MessageSchema
+	enums    map[string]*EnumSchema
+}
+
+// NewRegistry returns an empty registry that searches importPaths for files.
+func NewRegistry(importPaths ...string) *Registry {
+	return &Registry{
+		ImportPaths: importPaths,
+		files:       make(map[string]*Schema),
+		loading:     make(map[string]bool),
+		messages:    make(map[string]*MessageSchema),
+		enums:       make(map[string]*EnumSchema),
+	}
+}
+
+// LoadFile parses a .proto file and, recursively, its imports. Relative
+// names are looked up in the import paths, then the working directory, and
+// finally among the embedded files: the google/protobuf well-known types,
+// the tensorflow/core/example types of tf.Example, and the OpenTelemetry
+// (opentelemetry/proto) and Prometheus remote write (prometheus/prompb)
+// protocols of the built-in profiles.
+func (r *Registry) LoadFile(name string) (*Schema, error) {
+	if s, ok := r.files[name]; ok {
+		return s, nil
+	}
+	src, err := r.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.AddSource(name, src)
+}
+
+func (r *Registry) readFile(name string) (string, error) {
+	if !filepath.IsAbs(name) {
+		for _, dir := range r.ImportPaths {
+			if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+				return string(data), nil
+			}
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		if src, ok := readWellKnown(name); ok {
+			return src, nil
+		}
+		return "", fmt.Errorf("cannot load %s: %v", name, err)
+	}
+	return string(data), nil
+}
+
+// AddSource parses .proto source registered under name, loading its imports
+// with LoadFile.
+func (r *Registry) AddSource(name, src string) (*Schema, error) {
+	if r.loading[name] {
+		return nil, fmt.Errorf("%s: import cycle", name)
+	}
+	r.loading[name] = true
+	defer delete(r.loading, name)
+
+	schema, imports, err := ParseProto(name, src)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range imports {
+		if _, err := r.LoadFile(imp); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if err := r.AddSchema(schema); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	r.files[name] = schema
+	return schema, nil
+}
+
+// AddSchema registers the types of an already built schema, such as an
+// inferred one, and resolves its type references.
+func (r *Registry) AddSchema(s *Schema) error {
+	setFullNames(s)
+	for _, e := range s.Enums {
+		r.enums[e.FullName] = e
+	}
+	var added []*MessageSchema
+	s.eachMessage(func(m *MessageSchema) {
+		r.messages[m.FullName] = m
+		for _, e := range m.Enums {
+			r.enums[e.FullName] = e
+		}
+		added = append(added, m)
+	})
+	for _, m := range added {
+		for _, f := range m.Fields {
+			if err := r.resolve(m.FullName, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve links a field to its message or enum type, searching enclosing
+// scopes from the innermost outwards as protoc does.
+func (r *Registry) resolve(scope string, f *FieldSchema) error {
+	if _, ok := scalarWireTypes[f.Type]; ok {
+		return nil
+	}
+	if strings.HasPrefix(f.Type, ".") {
+		return r.link(f, strings.TrimPrefix(f.Type, "."), scope)
+	}
+	for {
+		candidate := f.Type
+		if scope != "" {
+			candidate = scope + "." + f.Type
+		}
+		if r.messages[candidate] != nil || r.enums[candidate] != nil {
+			return r.link(f, candidate, scope)
+		}
+		if scope == "" {
+			return fmt.Errorf("unknown type %q for field %s", f.Type, f.Name)
+		}
+		if i := strings.LastIndexByte(scope, '.'); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+func (r *Registry) link(f *FieldSchema, fullName, scope string) error {
+	if m := r.messages[fullName]; m != nil {
+		f.Message = m
+		return nil
+	}
+	if e := r.enums[fullName]; e != nil {
+		f.Enum = e
+		return nil
+	}
+	return fmt.Errorf("unknown type %q for field %s in %s", f.Type, f.Name, scope)
+}
+
+// Message returns the message with the given fully qualified name, or nil.
+func (r *Registry) Message(fullName string) *MessageSchema {
+	return r.messages[strings.TrimPrefix(fullName, ".")]
+}
+
+// Enum returns the enum with the given fully qualified name, or nil.
+func (r *Registry) Enum(fullName string) *EnumSchema {
+	return r.enums[strings.TrimPrefix(fullName, ".")]
+}
+
+// Messages returns every registered message, sorted by full name.
+func (r *Registry) Messages() []*MessageSchema {
+	msgs := make([]*MessageSchema, 0, len(r.messages))
+	for _, m := range r.messages {
+		msgs = append(msgs, m)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].FullName < msgs[j].FullName })
+	return msgs
+}
@@ -0,0 +1,469 @@
+package deproto
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RenderOptions controls how fields are rendered.
+type RenderOptions struct {
+	// ShowSize appends the encoded size of every field, including its tag,
+	// and its share of the enclosing message.
+	ShowSize bool
+
+	// Dialect, if set, is the protobuf-like format the message was decoded
+	// from (see DecodeOptions.Dialect), whose tags ShowSize counts.
+	Dialect *Dialect
+
+	// Schema, if set, is the type of the rendered message. Declared fields
+	// are shown with their names and values formatted as their declared
+	// types; undeclared fields are rendered raw.
+	Schema *MessageSchema
+
+	// DetectStruct renders nested messages that have the shape of a
+	// google.protobuf.Struct as JSON, even without a schema.
+	DetectStruct bool
+
+	// DetectEncodings renders byte fields that look like UTF-16 or
+	// Shift-JIS text as decoded strings labeled with the encoding. See
+	// DetectEncoding.
+	DetectEncodings bool
+
+	// Entropy annotates byte fields with their entropy and a guess at
+	// whether they hold keys, hashes, compressed or structured data. See
+	// AnalyzeBytes.
+	Entropy bool
+
+	// HashHints annotates random-looking byte fields of a digest length
+	// with the algorithms that produce it, and with the result of
+	// HashLookup when it recognizes the value.
+	HashHints  bool
+	HashLookup HashLookup
+
+	// DetectTokens renders string fields holding a JSON Web Token as its
+	// decoded header and claims, and labels long base64 strings with their
+	// decoded size. ExpandTokens also renders base64 strings that decode to
+	// a protobuf message as that message, nested below the string.
+	DetectTokens bool
+	ExpandTokens bool
+
+	// DetectAny links a string field holding a type URL to the
+	// length-delimited field after it, as in google.protobuf.Any, and
+	// labels that field with the type. Its fields are named after the type
+	// when Types declares it. See FindAnyPairs.
+	DetectAny bool
+	Types     *Registry
+
+	// DetectExample renders a message with the shape of a tf.Example as its
+	// list of features. See ParseExample.
+	DetectExample bool
+
+	// ExpandURLs renders string fields holding a URL with its host, path and
+	// decoded query and fragment parameters listed below it. Parameters
+	// whose values are base64 or hex encoded messages are decoded too.
+	ExpandURLs bool
+
+	// BigEndian also shows fixed32 and fixed64 values read big-endian, for
+	// protocols that embed byte-swapped values in protobuf framing.
+	BigEndian bool
+
+	// Hex controls how byte fields that are neither strings nor messages are
+	// dumped with Verbose.
+	Hex HexOptions
+
+	// Verbose renders long strings whole and byte fields as full hex
+	// dumps formatted by Hex. Without it, strings longer than 200 runes are
+	// cut to a preview, and byte fields are shown as one line of hex and
+	// ASCII holding their first 16 bytes, so that a huge value does not
+	// flood the output.
+	Verbose bool
+
+	// Notes, if set, are shown after the lines of the fields they are
+	// attached to.
+	Notes Notes
+
+	// MaxOutput, if positive, limits the size of the rendered text in
+	// bytes. Rendering stops once the limit is passed and the output is cut
+	// after the last line that fits.
+	MaxOutput int
+}
+
+// RenderFields renders a list of fields with the given options. Output cut
+// at opts.MaxOutput ends with a line saying so.
+func RenderFields(fields []Field, opts RenderOptions) string {
+	s, err := RenderFieldsLimited(fields, opts)
+	if err != nil {
+		s += fmt.Sprintf("[%v]\n", err)
+	}
+	return s
+}
+
+// RenderFieldsLimited is like RenderFields, but returns a LimitError along
+// with the output that fits when opts.MaxOutput is exceeded.
+func RenderFieldsLimited(fields []Field, opts RenderOptions) (string, error) {
+	r := &renderer{opts: opts}
+	if opts.DetectAny {
+		r.anyValues = make(map[*LengthDelimitedField]string)
+		for _, p := range FindAnyPairs(fields) {
+			r.anyValues[p.Value] = p.TypeName
+		}
+	}
+	var b strings.Builder
+	if features, ok := r.detectExample(fields); ok {
+		r.example(&b, features)
+	} else {
+		r.fields(&b, fields, 0, opts.Schema)
+	}
+	s := b.String()
+	if opts.MaxOutput <= 0 || len(s) <= opts.MaxOutput {
+		return s, nil
+	}
+	s = s[:strings.LastIndexByte(s[:opts.MaxOutput], '\n')+1]
+	return s, &LimitError{Limit: "output bytes", Max: opts.MaxOutput}
+}
+
+// renderField renders a single field with the default options.
+func renderField(f Field, indentLevel int) string {
+	r := &renderer{}
+	var b strings.Builder
+	r.field(&b, f, indentLevel, 0, nil)
+	return b.String()
+}
+
+// renderer holds the state shared while rendering a tree.
+type renderer struct {
+	opts      RenderOptions
+	path      FieldPath                        // Path of the field being rendered
+	anyValues map[*LengthDelimitedField]string // Type names of the values of Any-like pairs
+}
+
+func (r *renderer) fields(b *strings.Builder, fields []Field, indentLevel int, schema *MessageSchema) {
+	total := 0
+	if r.opts.ShowSize {
+		total = r.size(fields...)
+	}
+	for _, f := range fields {
+		if r.opts.MaxOutput > 0 && b.Len() > r.opts.MaxOutput {
+			return
+		}
+		id := 0
+		if base := fieldBase(f); base != nil {
+			id = base.ID
+		}
+		r.path = append(r.path, id)
+		r.field(b, f, indentLevel, total, schema)
+		r.path = r.path[:len(r.path)-1]
+	}
+}
+
+func (r *renderer) field(b *strings.Builder, f Field, indentLevel int, parentSize int, schema *MessageSchema) {
+	indent := strings.Repeat("    ", indentLevel)
+	note := r.sizeNote(f, parentSize) + r.noteComment()
+	if fs := schemaField(schema, f); fs != nil {
+		r.typedField(b, f, fs, indentLevel, note)
+		return
+	}
+
+	switch v := f.(type) {
+	case *VarintField:
+		fmt.Fprintf(b, "%s[%d %s]: %d (0x%x)%s\n", indent, v.ID, wireTypeString(v.WireType), v.Value, v.Value, note)
+
+	case *Fixed64Field:
+		floatValue := math.Float64frombits(v.Value)
+		fmt.Fprintf(b, "%s[%d %s]: %d (0x%x) (%f)%s%s\n", indent, v.ID, wireTypeString(v.WireType), v.Value, v.Value, floatValue, r.bigEndian64(v.Value), note)
+
+	case *Fixed32Field:
+		floatValue := math.Float32frombits(v.Value)
+		fmt.Fprintf(b, "%s[%d %s]: %d (0x%x) (%f)%s%s\n", indent, v.ID, wireTypeString(v.WireType), v.Value, v.Value, floatValue, r.bigEndian32(v.Value), note)
+
+	case *LengthDelimitedField:
+		if v.EmptyMessage {
+			fmt.Fprintf(b, "%s[%d %s]: (empty message)%s\n", indent, v.ID, wireTypeString(v.WireType), note)
+			return
+		}
+		if len(v.Data) == 0 && !v.IsString && v.Packed == nil {
+			fmt.Fprintf(b, "%s[%d %s]: (empty)%s\n", indent, v.ID, wireTypeString(v.WireType), note)
+			return
+		}
+		fmt.Fprintf(b, "%s[%d %s]: (%d bytes)", indent, v.ID, wireTypeString(v.WireType), len(v.Data))
+		if typeName, ok := r.anyValues[v]; ok {
+			b.WriteString(" any " + typeName)
+			if len(v.SubFields) > 0 {
+				var schema *MessageSchema
+				if r.opts.Types != nil {
+					schema = r.opts.Types.Message(typeName)
+				}
+				fmt.Fprintf(b, "%s%s\n", wrappingNote(v), note)
+				r.fields(b, v.SubFields, indentLevel+1, schema)
+				return
+			}
+		}
+		if v.IsString && v.Padding > 0 {
+			r.stringValue(b, v.StringValue, indentLevel, fmt.Sprintf(" (padded with %d NUL bytes)", v.Padding)+note)
+		} else if v.IsString {
+			r.stringValue(b, v.StringValue, indentLevel, note)
+		} else if value, ok := r.detectStruct(v); ok {
+			fmt.Fprintf(b, " struct %s%s\n", value, note)
+		} else if len(v.SubFields) > 0 {
+			fmt.Fprintf(b, "%s%s\n", wrappingNote(v), note)
+			r.fields(b, v.SubFields, indentLevel+1, nil)
+		} else if v.Packed != nil {
+			fmt.Fprintf(b, " packed %s %s%s\n", v.Packed.Type, formatValues(v.Packed.Values, &FieldSchema{Type: v.Packed.Type}), note)
+		} else if text, encoding, ok := r.detectEncoding(v); ok {
+			quoted, preview := r.quote(text)
+			fmt.Fprintf(b, " %s (%s)%s%s\n", quoted, encoding, preview, note)
+		} else {
+			r.hex(b, v.Data, indentLevel, r.entropyNote(v.Data)+note)
+		}
+
+	default:
+		b.WriteString(f.Render(indentLevel))
+	}
+}
+
+// bigEndian64 returns the value byte-swapped, as " [big-endian N (0x..)
+// (F)]", when BigEndian is set.
+func (r *renderer) bigEndian64(v uint64) string {
+	if !r.opts.BigEndian {
+		return ""
+	}
+	v = bits.ReverseBytes64(v)
+	return fmt.Sprintf(" [big-endian %d (0x%x) (%f)]", v, v, math.Float64frombits(v))
+}
+
+// bigEndian32 is bigEndian64 for fixed32 values.
+func (r *renderer) bigEndian32(v uint32) string {
+	if !r.opts.BigEndian {
+		return ""
+	}
+	v = bits.ReverseBytes32(v)
+	return fmt.Sprintf(" [big-endian %d (0x%x) (%f)]", v, v, math.Float32frombits(v))
+}
+
+// typedField renders a field declared in the schema, as
+// "[3 Length-delimited] name (type): value".
+func (r *renderer) typedField(b *strings.Builder, f Field, fs *FieldSchema, indentLevel int, note string) {
+	indent := strings.Repeat("    ", indentLevel)
+	base := fieldBase(f)
+	fmt.Fprintf(b, "%s[%d %s] %s (%s):", indent, base.ID, wireTypeString(base.WireType), fs.Name, fs.Type)
+
+	switch v := f.(type) {
+	case *VarintField:
+		fmt.Fprintf(b, " %s%s\n", formatScalar(v.Value, fs), note)
+	case *Fixed64Field:
+		fmt.Fprintf(b, " %s%s\n", formatScalar(v.Value, fs), note)
+	case *Fixed32Field:
+		fmt.Fprintf(b, " %s%s\n", formatScalar(uint64(v.Value), fs), note)
+	case *LengthDelimitedField:
+		fmt.Fprintf(b, " (%d bytes)", len(v.Data))
+		switch {
+		case fs.WireType() != WireBytes:
+			if values, err := formatPacked(v.Data, fs); err == nil {
+				fmt.Fprintf(b, " %s%s\n", values, note)
+			} else {
+				r.hex(b, v.Data, indentLevel, note)
+			}
+		case fs.Message != nil && isWellKnown(fs.Message.FullName):
+			if value, ok := wellKnownValue(fs.Message.FullName, v.Data); ok {
+				fmt.Fprintf(b, " %s%s\n", value, note)
+			} else {
+				r.hex(b, v.Data, indentLevel, note)
+			}
+		case fs.Message != nil && len(v.SubFields) > 0:
+			fmt.Fprintf(b, "%s%s\n", wrappingNote(v), note)
+			r.fields(b, v.SubFields, indentLevel+1, fs.Message)
+		case v.IsString || fs.Type == "string":
+			r.stringValue(b, string(v.Data), indentLevel, note)
+		default:
+			r.hex(b, v.Data, indentLevel, r.entropyNote(v.Data)+note)
+		}
+	}
+}
+
+// stringValue writes a string field's value, decoding tokens if enabled.
+func (r *renderer) stringValue(b *strings.Builder, s string, indentLevel int, note string) {
+	if r.opts.ExpandURLs {
+		if u, params, ok := parseURLString(s); ok {
+			r.urlValue(b, s, u, params, indentLevel, note)
+			return
+		}
+	}
+	quoted, preview := r.quote(s)
+	if !r.opts.DetectTokens && !r.opts.ExpandTokens {
+		fmt.Fprintf(b, " %s%s%s\n", quoted, preview, note)
+		return
+	}
+	indent := strings.Repeat("    ", indentLevel+1)
+	if token, ok := DecodeJWT(s); ok {
+		fmt.Fprintf(b, " jwt%s\n", note)
+		fmt.Fprintf(b, "%sheader: %s\n", indent, token.Header)
+		fmt.Fprintf(b, "%sclaims: %s\n", indent, token.Claims)
+		for _, name := range []string{"iat", "nbf", "exp"} {
+			if t, ok := token.Times[name]; ok {
+				fmt.Fprintf(b, "%s%s: %s\n", indent, name, t.Format(time.RFC3339))
+			}
+		}
+		fmt.Fprintf(b, "%ssignature: %d bytes\n", indent, len(token.Signature))
+		return
+	}
+	data, ok := DecodeBase64(s)
+	if !ok {
+		fmt.Fprintf(b, " %s%s%s\n", quoted, preview, note)
+		return
+	}
+	fmt.Fprintf(b, " %s (base64, %d bytes)%s%s\n", quoted, len(data), preview, note)
+	if r.opts.ExpandTokens {
+		if fields, err := DecodeFields(data); err == nil && len(fields) > 0 {
+			r.fields(b, fields, indentLevel+1, nil)
+		}
+	}
+}
+
+// bytesPreviewLen is how many bytes of a byte field are shown without
+// RenderOptions.Verbose.
+const bytesPreviewLen = 16
+
+// stringPreviewRunes is how much of a long string is shown without
+// RenderOptions.Verbose.
+const stringPreviewRunes = 200
+
+// quote quotes a string for display, escaping control characters, and cuts
+// it to a preview unless Verbose is set. The note gives the number of runes
+// when it differs from the number of bytes, and how much of a cut string
+// is shown.
+func (r *renderer) quote(s string) (quoted, note string) {
+	runes := utf8.RuneCountInString(s)
+	if runes > stringPreviewRunes && !r.opts.Verbose {
+		cut := 0
+		for i := 0; i < stringPreviewRunes; i++ {
+			_, size := utf8.DecodeRuneInString(s[cut:])
+			cut += size
+		}
+		return strconv.Quote(s[:cut]) + "...", fmt.Sprintf(" (%d of %d runes shown)", stringPreviewRunes, runes)
+	}
+	if runes != len(s) {
+		note = fmt.Sprintf(" (%d runes)", runes)
+	}
+	return strconv.Quote(s), note
+}
+
+// urlValue writes a URL string followed by its parts.
+func (r *renderer) urlValue(b *strings.Builder, s string, u *url.URL, params []urlParam, indentLevel int, note string) {
+	quoted, preview := r.quote(s)
+	fmt.Fprintf(b, " url %s%s%s\n", quoted, preview, note)
+	indent := strings.Repeat("    ", indentLevel+1)
+	fmt.Fprintf(b, "%shost: %s\n", indent, u.Host)
+	if u.Path != "" {
+		fmt.Fprintf(b, "%spath: %s\n", indent, u.Path)
+	}
+	for _, p := range params {
+		prefix := "?"
+		if p.Fragment {
+			prefix = "#"
+		}
+		fmt.Fprintf(b, "%s%s%s =", indent, prefix, p.Name)
+		if data, wrapping, ok := unwrapText(p.Value); ok {
+			if fields, err := DecodeFields(data); err == nil && plausibleMessage(fields) {
+				fmt.Fprintf(b, " [%s]\n", wrapping)
+				r.fields(b, fields, indentLevel+2, nil)
+				continue
+			}
+		}
+		r.stringValue(b, p.Value, indentLevel+1, "")
+	}
+}
+
+// detectStruct applies the Struct heuristic to a field, if enabled.
+func (r *renderer) detectStruct(l *LengthDelimitedField) (string, bool) {
+	if !r.opts.DetectStruct || len(l.SubFields) == 0 {
+		return "", false
+	}
+	return detectStruct(l.SubFields)
+}
+
+// detectExample applies the tf.Example heuristic to a message, if enabled.
+func (r *renderer) detectExample(fields []Field) ([]ExampleFeature, bool) {
+	if !r.opts.DetectExample || r.opts.Schema != nil {
+		return nil, false
+	}
+	return ParseExample(Encode(fields))
+}
+
+// detectEncoding applies the text encoding heuristic to a field, if enabled.
+func (r *renderer) detectEncoding(l *LengthDelimitedField) (string, string, bool) {
+	if !r.opts.DetectEncodings {
+		return "", "", false
+	}
+	return DetectEncoding(l.Data)
+}
+
+// hex writes a hex dump of data, on the field's line when it fits there and
+// on indented lines below it otherwise.
+func (r *renderer) hex(b *strings.Builder, data []byte, indentLevel int, note string) {
+	if !r.opts.Verbose {
+		preview := data[:min(len(data), bytesPreviewLen)]
+		line := hexLine(preview, len(preview), HexOptions{ASCII: true}, false)
+		if len(preview) < len(data) {
+			line += fmt.Sprintf(" (%d of %d bytes shown)", len(preview), len(data))
+		}
+		fmt.Fprintf(b, " [hex] %s%s\n", line, note)
+		return
+	}
+	lines := FormatHex(data, r.opts.Hex)
+	if len(lines) == 1 {
+		fmt.Fprintf(b, " [hex] %s%s\n", lines[0], note)
+		return
+	}
+	fmt.Fprintf(b, " [hex]%s\n", note)
+	indent := strings.Repeat("    ", indentLevel+1)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+}
+
+// entropyNote returns the entropy and hash annotations for byte data, if
+// enabled.
+func (r *renderer) entropyNote(data []byte) string {
+	var note string
+	if r.opts.Entropy && len(data) > 0 {
+		note = fmt.Sprintf(" (%s)", AnalyzeBytes(data))
+	}
+	if r.opts.HashHints {
+		note += hashNote(data, r.opts.HashLookup)
+	}
+	return note
+}
+
+// wrappingNote names the text encoding a nested message was found in.
+func wrappingNote(l *LengthDelimitedField) string {
+	if l.Wrapping == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", l.Wrapping)
+}
+
+// size returns the encoded size of fields, with the tags of the dialect if
+// one is set. It is worked out from the values, as re-encoding every
+// nested message at each level would take time quadratic in the depth.
+func (r *renderer) size(fields ...Field) int {
+	return estimateSize(fields, r.opts.Dialect)
+}
+
+// sizeNote returns the size annotation for a field, if enabled.
+func (r *renderer) sizeNote(f Field, parentSize int) string {
+	if !r.opts.ShowSize {
+		return ""
+	}
+	size := r.size(f)
+	share := 100.0
+	if parentSize > 0 {
+		share = float64(size) / float64(parentSize) * 100
+	}
+	return fmt.Sprintf(" {%d B, %.1f%%}", size, share)
+}
@@ -0,0 +1,54 @@
+package deproto
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// deepMessage returns a message of depth nested messages around a leaf of
+// random-looking bytes.
+func deepMessage(depth, leaf int) []byte {
+	data := make([]byte, leaf)
+	for i := range data {
+		data[i] = byte(i*131 + i>>8)
+	}
+	data = NewMessage().Bytes(1, data).Encode()
+	for range depth {
+		data = NewMessage().Bytes(1, data).Encode()
+	}
+	return data
+}
+
+func TestRenderDeepNestingSizes(t *testing.T) {
+	data := deepMessage(200, 1<<10)
+	fields, err := DecodeFields(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := RenderFields(fields, RenderOptions{ShowSize: true})
+	if want := fmt.Sprintf("{%d B, 100.0%%}", len(data)); !strings.Contains(strings.SplitN(out, "\n", 2)[0], want) {
+		t.Errorf("first line %q lacks %s", strings.SplitN(out, "\n", 2)[0], want)
+	}
+	if plain := RenderFields(fields, RenderOptions{}); strings.Contains(plain, " B, ") {
+		t.Errorf("sizes rendered without ShowSize")
+	}
+	if !bytes.Equal(Encode(fields), data) {
+		t.Errorf("rendering changed the tree")
+	}
+}
+
+func BenchmarkRenderDeepNesting(b *testing.B) {
+	fields, err := DecodeFields(deepMessage(500, 64<<10))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, opts := range []RenderOptions{{}, {ShowSize: true}} {
+		b.Run(fmt.Sprintf("size=%v", opts.ShowSize), func(b *testing.B) {
+			for range b.N {
+				RenderFields(fields, opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package deproto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Protocol selects how Send frames a message on the wire.
+type Protocol int
+
+const (
+	ProtocolHTTP    Protocol = iota // Plain HTTP POST with the message as the body
+	ProtocolGRPC                    // gRPC over HTTP/2 (h2c for http:// URLs)
+	ProtocolGRPCWeb                 // gRPC-Web over HTTP/1.1 or HTTP/2
+)
+
+// SendOptions controls how Send delivers a message.
+type SendOptions struct {
+	Protocol Protocol
+	Header   http.Header  // Extra request headers
+	Client   *http.Client // Client to use; nil picks one suitable for Protocol
+}
+
+// Reply is the response to a message sent with Send.
+type Reply struct {
+	StatusCode  int         // HTTP status code
+	Header      http.Header // Response headers, and trailers for gRPC
+	Messages    [][]byte    // Response messages, with any gRPC framing removed
+	GRPCStatus  string      // grpc-status, for gRPC protocols
+	GRPCMessage string      // grpc-message, for gRPC protocols
+}
+
+// Send encodes fields, frames them according to opts.Protocol and posts them
+// to url, closing the capture, edit and replay loop.
+func Send(ctx context.Context, url string, fields []Field, opts SendOptions) (*Reply, error) {
+	body := Encode(fields)
+	contentType := "application/x-protobuf"
+	switch opts.Protocol {
+	case ProtocolGRPC:
+		body, contentType = GRPCFrame(body), "application/grpc"
+	case ProtocolGRPCWeb:
+		body, contentType = GRPCFrame(body), "application/grpc-web+proto"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range opts.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	if opts.Protocol == ProtocolGRPC {
+		req.Header.Set("TE", "trailers")
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = defaultClient(opts.Protocol)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &Reply{StatusCode: resp.StatusCode, Header: resp.Header}
+	if opts.Protocol == ProtocolHTTP {
+		reply.Messages = [][]byte{data}
+		return reply, nil
+	}
+
+	frames, trailers, err := parseGRPCFrames(data)
+	if err != nil {
+		return reply, err
+	}
+	reply.Messages = frames
+	for key, values := range resp.Trailer {
+		reply.Header[key] = values
+	}
+	for key, values := range trailers {
+		reply.Header[key] = values
+	}
+	reply.GRPCStatus = reply.Header.Get("Grpc-Status")
+	reply.GRPCMessage = reply.Header.Get("Grpc-Message")
+	return reply, nil
+}
+
+// defaultClient returns a client able to speak the given protocol. gRPC needs
+// HTTP/2, which for http:// URLs means prior-knowledge h2c.
+func defaultClient(p Protocol) *http.Client {
+	if p != ProtocolGRPC {
+		return http.DefaultClient
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP2(true)
+	t.Protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: t}
+}
+
+// GRPCFrame wraps a message in the 5-byte gRPC length prefix (uncompressed).
+func GRPCFrame(msg []byte) []byte {
+	out := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(out[1:], uint32(len(msg)))
+	return append(out, msg...)
+}
+
+// GRPCUnframe splits a stream of gRPC length-prefixed frames into messages.
+// gRPC-Web trailer frames are skipped.
+func GRPCUnframe(data []byte) ([][]byte, error) {
+	frames, _, err := parseGRPCFrames(data)
+	return frames, err
+}
+
+// parseGRPCFrames splits gRPC frames, returning data frames and any headers
+// carried in gRPC-Web trailer frames.
+func parseGRPCFrames(data []byte) ([][]byte, http.Header, error) {
+	var frames [][]byte
+	trailers := make(http.Header)
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return frames, trailers, fmt.Errorf("truncated gRPC frame header")
+		}
+		flags := data[0]
+		length := int(binary.BigEndian.Uint32(data[1:5]))
+		if len(data)-5 < length {
+			return frames, trailers, fmt.Errorf("truncated gRPC frame: want %d bytes, have %d", length, len(data)-5)
+		}
+		payload := data[5 : 5+length]
+		data = data[5+length:]
+
+		switch {
+		case flags&0x80 != 0:
+			for _, line := range strings.Split(string(payload), "\r\n") {
+				if key, value, ok := strings.Cut(line, ":"); ok {
+					trailers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+				}
+			}
+		case flags&0x01 != 0:
+			return frames, trailers, fmt.Errorf("compressed gRPC frames are not supported")
+		default:
+			frames = append(frames, payload)
+		}
+	}
+	return frames, trailers, nil
+}
@@ -0,0 +1,78 @@
+package deproto
+
+import "math/rand/v2"
+
+// SampleOptions controls which messages of a corpus too large to analyze
+// whole are looked at, and how many are held in memory.
+type SampleOptions struct {
+	Rate  float64 // Fraction of the messages to take, chosen at random; 0 for all
+	Limit int     // Number of messages to take before stopping; 0 for no limit
+	Keep  int     // Number of taken messages to hold, chosen by reservoir sampling; 0 for all
+	Seed  uint64  // Seed of the random choices, so that runs can be repeated
+}
+
+// Sampler chooses messages from a stream as SampleOptions describes: Take
+// picks the messages to look at, and Keep holds a uniform random sample of
+// those in bounded memory.
+type Sampler struct {
+	opts  SampleOptions
+	pcg   *rand.PCG // Source of rng, whose state is saved with checkpoints
+	rng   *rand.Rand
+	read  int
+	taken int
+	kept  [][]Field
+}
+
+// NewSampler returns a Sampler choosing messages as opts describes.
+func NewSampler(opts SampleOptions) *Sampler {
+	pcg := rand.NewPCG(opts.Seed, opts.Seed)
+	return &Sampler{opts: opts, pcg: pcg, rng: rand.New(pcg)}
+}
+
+// Take reports whether the next message of the stream should be looked at.
+// It always reports false once Done.
+func (s *Sampler) Take() bool {
+	if s.Done() {
+		return false
+	}
+	s.read++
+	if s.opts.Rate > 0 && s.opts.Rate < 1 && s.rng.Float64() >= s.opts.Rate {
+		return false
+	}
+	s.taken++
+	return true
+}
+
+// Done reports whether the limit of messages to take has been reached, so
+// that the rest of the stream need not be read.
+func (s *Sampler) Done() bool {
+	return s.opts.Limit > 0 && s.taken >= s.opts.Limit
+}
+
+// Keep offers the message just taken to the sample. Past the number of
+// messages to hold, it replaces a random earlier one with a probability
+// that keeps every taken message equally likely to be held.
+func (s *Sampler) Keep(fields []Field) {
+	if s.opts.Keep <= 0 || len(s.kept) < s.opts.Keep {
+		s.kept = append(s.kept, fields)
+		return
+	}
+	if i := s.rng.IntN(max(s.taken, 1)); i < len(s.kept) {
+		s.kept[i] = fields
+	}
+}
+
+// Kept returns the messages held.
+func (s *Sampler) Kept() [][]Field {
+	return s.kept
+}
+
+// Read returns the number of messages offered to Take.
+func (s *Sampler) Read() int {
+	return s.read
+}
+
+// Taken returns the number of messages Take picked.
+func (s *Sampler) Taken() int {
+	return s.taken
+}
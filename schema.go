@@ -0,0 +1,220 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Label is the cardinality of a schema field.
+type Label int
+
+const (
+	LabelOptional Label = iota
+	LabelRequired
+	LabelRepeated
+)
+
+// String returns the .proto keyword for the label.
+func (l Label) String() string {
+	switch l {
+	case LabelOptional:
+		return "optional"
+	case LabelRequired:
+		return "required"
+	case LabelRepeated:
+		return "repeated"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(l))
+	}
+}
+
+// Schema is a set of message and enum definitions, either inferred from
+// captured messages or loaded from .proto source.
+type Schema struct {
+	Syntax   string // "proto2" or "proto3"
+	Package  string
+	Messages []*MessageSchema
+	Enums    []*EnumSchema
+}
+
+// MessageSchema describes one message type.
+type MessageSchema struct {
+	Name     string // Simple name
+	FullName string // Package-qualified name, without a leading dot
+	Fields   []*FieldSchema
+	Nested   []*MessageSchema
+	Enums    []*EnumSchema
+}
+
+// FieldSchema describes one field of a message.
+type FieldSchema struct {
+	Name    string
+	Number  int
+	Label   Label
+	Type    string         // Scalar type name, or the message or enum type name
+	Message *MessageSchema // Resolved message type, if Type names a message
+	Enum    *EnumSchema    // Resolved enum type, if Type names an enum
+	Packed  bool           // Repeated scalars are encoded packed
+	Oneof   string         // Name of the enclosing oneof, if any
+	Comment string         // Free-form note, emitted as a trailing comment
+
+	// Proto3Optional is set for fields declared optional in proto3, which
+	// unlike the other singular fields of proto3 track presence.
+	Proto3Optional bool
+}
+
+// EnumSchema describes an enum type.
+type EnumSchema struct {
+	Name     string
+	FullName string
+	Values   []EnumValue
+}
+
+// EnumValue is a single named enum constant.
+type EnumValue struct {
+	Name   string
+	Number int32
+}
+
+// scalarWireTypes maps scalar type names to their wire types.
+var scalarWireTypes = map[string]int{
+	"int32": WireVarint, "int64": WireVarint, "uint32": WireVarint, "uint64": WireVarint,
+	"sint32": WireVarint, "sint64": WireVarint, "bool": WireVarint,
+	"fixed64": WireFixed64, "sfixed64": WireFixed64, "double": WireFixed64,
+	"fixed32": WireFixed32, "sfixed32": WireFixed32, "float": WireFixed32,
+	"string": WireBytes, "bytes": WireBytes,
+}
+
+// WireType returns the wire type the field is encoded with.
+func (f *FieldSchema) WireType() int {
+	if wt, ok := scalarWireTypes[f.Type]; ok {
+		return wt
+	}
+	if f.Enum != nil {
+		return WireVarint
+	}
+	return WireBytes
+}
+
+// IsMap reports whether a field is a map: a repeated field of the entry
+// message protoc generates for it.
+func (f *FieldSchema) IsMap() bool {
+	m := f.Message
+	return f.Label == LabelRepeated && m != nil && m.Name == mapEntryName(f.Name) &&
+		len(m.Fields) == 2 && m.Field(1) != nil && m.Field(2) != nil
+}
+
+// Field returns the field with the given number, or nil.
+func (m *MessageSchema) Field(number int) *FieldSchema {
+	for _, f := range m.Fields {
+		if f.Number == number {
+			return f
+		}
+	}
+	return nil
+}
+
+// Message returns the message with the given full or simple name, searching
+// nested messages too, or nil.
+func (s *Schema) Message(name string) *MessageSchema {
+	name = strings.TrimPrefix(name, ".")
+	var found *MessageSchema
+	s.eachMessage(func(m *MessageSchema) {
+		if found == nil && (m.FullName == name || m.Name == name) {
+			found = m
+		}
+	})
+	return found
+}
+
+// eachMessage calls fn for every message in the schema, outermost first.
+func (s *Schema) eachMessage(fn func(m *MessageSchema)) {
+	var visit func(msgs []*MessageSchema)
+	visit = func(msgs []*MessageSchema) {
+		for _, m := range msgs {
+			fn(m)
+			visit(m.Nested)
+		}
+	}
+	visit(s.Messages)
+}
+
+// Proto returns the schema as .proto source.
+func (s *Schema) Proto() string {
+	var b strings.Builder
+	syntax := s.Syntax
+	if syntax == "" {
+		syntax = "proto2"
+	}
+	fmt.Fprintf(&b, "syntax = %q;\n", syntax)
+	if s.Package != "" {
+		fmt.Fprintf(&b, "\npackage %s;\n", s.Package)
+	}
+	for _, e := range s.Enums {
+		b.WriteString("\n")
+		writeEnum(&b, e, 0)
+	}
+	for _, m := range s.Messages {
+		b.WriteString("\n")
+		writeMessage(&b, m, syntax, 0)
+	}
+	return b.String()
+}
+
+func writeMessage(b *strings.Builder, m *MessageSchema, syntax string, indentLevel int) {
+	indent := strings.Repeat("  ", indentLevel)
+	fmt.Fprintf(b, "%smessage %s {\n", indent, m.Name)
+	written := make(map[string]bool)
+	for _, f := range m.Fields {
+		if f.Oneof == "" {
+			writeField(b, f, syntax, indentLevel+1)
+			continue
+		}
+		if written[f.Oneof] {
+			continue
+		}
+		written[f.Oneof] = true
+		fmt.Fprintf(b, "%s  oneof %s {\n", indent, f.Oneof)
+		for _, member := range m.Fields {
+			if member.Oneof == f.Oneof {
+				writeField(b, member, syntax, indentLevel+2)
+			}
+		}
+		fmt.Fprintf(b, "%s  }\n", indent)
+	}
+	for _, e := range m.Enums {
+		b.WriteString("\n")
+		writeEnum(b, e, indentLevel+1)
+	}
+	for _, nested := range m.Nested {
+		b.WriteString("\n")
+		writeMessage(b, nested, syntax, indentLevel+1)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func writeField(b *strings.Builder, f *FieldSchema, syntax string, indentLevel int) {
+	indent := strings.Repeat("  ", indentLevel)
+	label := f.Label.String() + " "
+	if syntax == "proto3" && f.Label != LabelRepeated && !f.Proto3Optional || f.Oneof != "" {
+		label = ""
+	}
+	fmt.Fprintf(b, "%s%s%s %s = %d", indent, label, f.Type, f.Name, f.Number)
+	if f.Packed && syntax != "proto3" {
+		b.WriteString(" [packed = true]")
+	}
+	b.WriteString(";")
+	if f.Comment != "" {
+		fmt.Fprintf(b, " // %s", f.Comment)
+	}
+	b.WriteString("\n")
+}
+
+func writeEnum(b *strings.Builder, e *EnumSchema, indentLevel int) {
+	indent := strings.Repeat("  ", indentLevel)
+	fmt.Fprintf(b, "%senum %s {\n", indent, e.Name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "%s  %s = %d;\n", indent, v.Name, v.Number)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
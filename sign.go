@@ -0,0 +1,166 @@
+package deproto
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"slices"
+	"sort"
+)
+
+// SignFunc computes the signature of a message from the encoding of the
+// message without its signature field.
+type SignFunc func(message []byte) ([]byte, error)
+
+// Signer recomputes a field that signs or authenticates the message holding
+// it, such as an HMAC of its other fields, so that an edited message is
+// accepted by a protocol that checks it.
+type Signer struct {
+	Path FieldPath // The signature field
+	Sign SignFunc
+}
+
+// signatureAlgorithms holds the algorithms NewSignFunc knows, by name; each
+// builds a SignFunc from a key.
+var signatureAlgorithms = map[string]func(key []byte) (SignFunc, error){}
+
+func init() {
+	digests := map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+	for name, newHash := range digests {
+		RegisterSignature(name, func(key []byte) (SignFunc, error) {
+			if len(key) > 0 {
+				return nil, fmt.Errorf("%s takes no key", name)
+			}
+			return func(message []byte) ([]byte, error) {
+				h := newHash()
+				h.Write(message)
+				return h.Sum(nil), nil
+			}, nil
+		})
+		RegisterSignature("hmac-"+name, func(key []byte) (SignFunc, error) {
+			if len(key) == 0 {
+				return nil, fmt.Errorf("hmac-%s needs a key", name)
+			}
+			return func(message []byte) ([]byte, error) {
+				h := hmac.New(newHash, key)
+				h.Write(message)
+				return h.Sum(nil), nil
+			}, nil
+		})
+	}
+}
+
+// RegisterSignature makes a signature algorithm available to NewSignFunc
+// under a name, replacing any algorithm of that name. newFunc builds the
+// SignFunc for a key, which is empty when none is given. Register
+// algorithms at start-up, before they are used.
+func RegisterSignature(name string, newFunc func(key []byte) (SignFunc, error)) {
+	signatureAlgorithms[name] = newFunc
+}
+
+// SignatureNames returns the names of the known signature algorithms,
+// sorted.
+func SignatureNames() []string {
+	names := make([]string, 0, len(signatureAlgorithms))
+	for name := range signatureAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSignFunc returns the SignFunc of a registered algorithm, such as
+// "sha256" or "hmac-sha256", for a key.
+func NewSignFunc(algorithm string, key []byte) (SignFunc, error) {
+	newFunc, ok := signatureAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown signature algorithm %q", algorithm)
+	}
+	return newFunc(key)
+}
+
+// Sign recomputes the signature fields of a tree in place, so that Encode
+// with the same options writes a message that verifies. Each signer is
+// given the message holding its field, encoded as o encodes it, without
+// the fields of the signature's number, and the first of those fields takes
+// the result as its value. Signatures nested deeper are computed first, as
+// the messages holding them may themselves be signed.
+func (o EncodeOptions) Sign(fields []Field, signers ...Signer) error {
+	signers = slices.Clone(signers)
+	sort.SliceStable(signers, func(i, j int) bool {
+		return len(signers[i].Path) > len(signers[j].Path)
+	})
+	for _, s := range signers {
+		if len(s.Path) == 0 {
+			return fmt.Errorf("signature path is empty")
+		}
+		parent, number := s.Path[:len(s.Path)-1], s.Path[len(s.Path)-1]
+		holders := [][]Field{fields}
+		if len(parent) > 0 {
+			holders = nil
+			for _, f := range Find(fields, parent) {
+				l, ok := f.(*LengthDelimitedField)
+				if !ok || len(l.SubFields) == 0 {
+					return fmt.Errorf("signature %s: field %s is not a message", s.Path, parent)
+				}
+				holders = append(holders, l.SubFields)
+			}
+		}
+		if len(holders) == 0 {
+			return fmt.Errorf("signature %s: no field at path %s", s.Path, parent)
+		}
+		sub := o
+		sub.Schema = pathSchema(o.Schema, parent)
+		for _, holder := range holders {
+			var rest []Field
+			var target Field
+			for _, f := range holder {
+				if fieldBase(f).ID != number {
+					rest = append(rest, f)
+				} else if target == nil {
+					target = f
+				}
+			}
+			if target == nil {
+				return fmt.Errorf("signature %s: no signature field", s.Path)
+			}
+			data, err := sub.Encode(rest)
+			if err != nil {
+				return fmt.Errorf("signature %s: %v", s.Path, err)
+			}
+			sig, err := s.Sign(data)
+			if err != nil {
+				return fmt.Errorf("signature %s: %v", s.Path, err)
+			}
+			if err := setValueBytes(target, sig); err != nil {
+				return fmt.Errorf("signature %s: %v", s.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pathSchema returns the schema of the message at path within a message of
+// the given schema, or nil if it is not known.
+func pathSchema(schema *MessageSchema, path FieldPath) *MessageSchema {
+	for _, number := range path {
+		if schema == nil {
+			return nil
+		}
+		fs := schema.Field(number)
+		if fs == nil {
+			return nil
+		}
+		schema = fs.Message
+	}
+	return schema
+}
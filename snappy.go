@@ -0,0 +1,87 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxSnappyLength bounds the decoded length a snappy block may claim, so
+// that a corrupt header cannot make DecodeSnappy allocate without limit.
+const maxSnappyLength = 1 << 28
+
+// DecodeSnappy decompresses data in the snappy block format, as sent in
+// Prometheus remote write bodies. The framed stream format, which starts
+// with a "sNaPpY" chunk, is not supported.
+func DecodeSnappy(data []byte) ([]byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid snappy length")
+	}
+	if length > maxSnappyLength {
+		return nil, fmt.Errorf("snappy length %d too large", length)
+	}
+	// The header is not trusted for the allocation: no element expands
+	// more than 64 times, so a larger claim cannot be met and out grows as
+	// it is filled instead.
+	out := make([]byte, 0, min(length, 64*uint64(len(data))))
+	for pos := n; pos < len(data); {
+		tag := data[pos]
+		pos++
+		var size, offset int
+		switch tag & 3 {
+		case 0: // Literal
+			size = int(tag>>2) + 1
+			if size > 60 {
+				extra := size - 60
+				if pos+extra > len(data) {
+					return nil, fmt.Errorf("truncated snappy literal at offset %d", pos-1)
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(data[pos+i])
+				}
+				size++
+				pos += extra
+			}
+			if size > len(data)-pos || len(out)+size > int(length) {
+				return nil, fmt.Errorf("truncated snappy literal at offset %d", pos-1)
+			}
+			out = append(out, data[pos:pos+size]...)
+			pos += size
+			continue
+		case 1: // Copy with a 1-byte offset
+			if pos >= len(data) {
+				return nil, fmt.Errorf("truncated snappy copy at offset %d", pos-1)
+			}
+			size = int(tag>>2&7) + 4
+			offset = int(tag>>5)<<8 | int(data[pos])
+			pos++
+		case 2: // Copy with a 2-byte offset
+			if pos+2 > len(data) {
+				return nil, fmt.Errorf("truncated snappy copy at offset %d", pos-1)
+			}
+			size = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(data[pos:]))
+			pos += 2
+		case 3: // Copy with a 4-byte offset
+			if pos+4 > len(data) {
+				return nil, fmt.Errorf("truncated snappy copy at offset %d", pos-1)
+			}
+			size = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+		if offset == 0 || offset > len(out) || len(out)+size > int(length) {
+			return nil, fmt.Errorf("invalid snappy copy at offset %d", pos)
+		}
+		// Copies may overlap their own output, so go byte by byte.
+		start := len(out) - offset
+		for i := range size {
+			out = append(out, out[start+i])
+		}
+	}
+	if len(out) != int(length) {
+		return nil, fmt.Errorf("snappy data holds %d bytes, want %d", len(out), length)
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package deproto_test
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestDecodeSnappyBoundsAllocation(t *testing.T) {
+	// A header claiming 256 MiB in front of a single literal byte.
+	data := binary.AppendUvarint(nil, 1<<28)
+	data = append(data, 0x00, 'x')
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if out, err := deproto.DecodeSnappy(data); err == nil {
+		t.Fatalf("DecodeSnappy = %q, want a length mismatch", out)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("DecodeSnappy allocated %d bytes for a %d-byte input", n, len(data))
+	}
+
+	// Output still grows past the initial capacity.
+	data = binary.AppendUvarint(nil, 200)
+	data = append(data, 0x00, 'a')
+	for range 3 {
+		data = append(data, 0xfe, 0x01, 0x00) // copy 64 bytes from offset 1
+	}
+	data = append(data, 0x1a, 0x01, 0x00) // copy 7 bytes from offset 1
+	out, err := deproto.DecodeSnappy(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 200 || out[199] != 'a' {
+		t.Errorf("DecodeSnappy = %d bytes, want 200", len(out))
+	}
+}
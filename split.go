@@ -0,0 +1,114 @@
+package deproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SplitConcatenated detects a buffer that holds several messages of the same
+// type written back to back. Protobuf allows concatenation (the result parses
+// as one message, with later fields merged or overriding earlier ones), but
+// encoders emit fields in ascending order, so a drop in field number onto a
+// field already seen in the current piece marks the start of a new message.
+//
+// The pieces are only returned if they look structurally alike; otherwise the
+// result holds fields unchanged as a single message.
+func SplitConcatenated(fields []Field) [][]Field {
+	var pieces [][]Field
+	start, prevID := 0, 0
+	seen := make(map[int]bool)
+	for i, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		if i > start && base.ID < prevID && seen[base.ID] {
+			pieces = append(pieces, fields[start:i])
+			start = i
+			seen = make(map[int]bool)
+		}
+		seen[base.ID] = true
+		prevID = base.ID
+	}
+	pieces = append(pieces, fields[start:])
+
+	if len(pieces) < 2 {
+		return pieces
+	}
+	first := FingerprintOf(pieces[0])
+	for _, piece := range pieces[1:] {
+		if first.Similarity(FingerprintOf(piece)) < 0.5 {
+			return [][]Field{fields}
+		}
+	}
+	return pieces
+}
+
+// RenderMessages renders several messages one after another, each preceded
+// by a header line giving its position.
+func RenderMessages(messages [][]Field) string {
+	var b strings.Builder
+	for i, fields := range messages {
+		fmt.Fprintf(&b, "# message %d of %d\n", i+1, len(messages))
+		for _, f := range fields {
+			b.WriteString(f.Render(0))
+		}
+	}
+	return b.String()
+}
+
+// SplitDelimited splits a stream of messages each preceded by its length as
+// a varint, as written by writeDelimitedTo in the Java library and by
+// protodelim in Go.
+func SplitDelimited(data []byte) ([][]byte, error) {
+	var messages [][]byte
+	for pos := 0; pos < len(data); {
+		length, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return messages, fmt.Errorf("invalid message length at offset %d", pos)
+		}
+		pos += n
+		if length > uint64(len(data)-pos) {
+			return messages, fmt.Errorf("truncated message at offset %d", pos-n)
+		}
+		messages = append(messages, data[pos:pos+int(length)])
+		pos += int(length)
+	}
+	return messages, nil
+}
+
+// DelimitedReader reads messages each preceded by its length as a varint
+// from a stream, one at a time as they arrive, unlike SplitDelimited which
+// needs the whole stream in memory.
+type DelimitedReader struct {
+	r *bufio.Reader
+}
+
+// NewDelimitedReader returns a reader of the length-delimited messages in r.
+func NewDelimitedReader(r io.Reader) *DelimitedReader {
+	return &DelimitedReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next message, or io.EOF when the stream ends cleanly
+// between messages.
+func (d *DelimitedReader) Next() ([]byte, error) {
+	length, err := binary.ReadUvarint(d.r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid message length: %v", err)
+	}
+	// Read rather than allocate the claimed length, which may be garbage.
+	msg, err := io.ReadAll(io.LimitReader(d.r, int64(min(length, 1<<62))))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(msg)) < length {
+		return nil, fmt.Errorf("truncated message of %d bytes", length)
+	}
+	return msg, nil
+}
@@ -0,0 +1,69 @@
+package deproto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RenderStable renders fields in a plain format that is frozen: for the same
+// field tree it produces the same text in every version of this package, so
+// downstream tests can compare it against golden files. Unlike RenderFields,
+// it takes no options and applies no content heuristics; it shows what is in
+// the tree, one field per line:
+//
+//	1: varint 150
+//	2: fixed64 0x3ff0000000000000
+//	3: fixed32 0x3f800000
+//	4: string "hello"
+//	5: bytes 0a0b0c
+//	6: message {
+//	  1: varint 1
+//	}
+//	7: packed uint64 [1 2 3]
+//
+// Strings are quoted with only ASCII characters, so output also does not
+// depend on the Unicode version. A message decoded from text carries its
+// wrapping, as in "6: message base64 {". An empty payload read as a message
+// shows as "message (empty)", and a string's NUL padding follows it, as in
+// `string "abc" (padded with 2 NUL bytes)`.
+func RenderStable(fields []Field) string {
+	var b strings.Builder
+	renderStable(&b, fields, 0)
+	return b.String()
+}
+
+func renderStable(b *strings.Builder, fields []Field, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, f := range fields {
+		switch v := f.(type) {
+		case *VarintField:
+			fmt.Fprintf(b, "%s%d: varint %d\n", indent, v.ID, v.Value)
+		case *Fixed64Field:
+			fmt.Fprintf(b, "%s%d: fixed64 0x%016x\n", indent, v.ID, v.Value)
+		case *Fixed32Field:
+			fmt.Fprintf(b, "%s%d: fixed32 0x%08x\n", indent, v.ID, v.Value)
+		case *LengthDelimitedField:
+			wrapping := ""
+			if v.Wrapping != "" {
+				wrapping = " " + v.Wrapping
+			}
+			switch {
+			case len(v.SubFields) > 0:
+				fmt.Fprintf(b, "%s%d: message%s {\n", indent, v.ID, wrapping)
+				renderStable(b, v.SubFields, depth+1)
+				fmt.Fprintf(b, "%s}\n", indent)
+			case v.EmptyMessage:
+				fmt.Fprintf(b, "%s%d: message%s (empty)\n", indent, v.ID, wrapping)
+			case v.IsString && v.Padding > 0:
+				fmt.Fprintf(b, "%s%d: string %s (padded with %d NUL bytes)\n", indent, v.ID, strconv.QuoteToASCII(v.StringValue), v.Padding)
+			case v.IsString:
+				fmt.Fprintf(b, "%s%d: string %s\n", indent, v.ID, strconv.QuoteToASCII(v.StringValue))
+			case v.Packed != nil:
+				fmt.Fprintf(b, "%s%d: packed %s %v\n", indent, v.ID, v.Packed.Type, v.Packed.Values)
+			default:
+				fmt.Fprintf(b, "%s%d: bytes %x\n", indent, v.ID, v.Data)
+			}
+		}
+	}
+}
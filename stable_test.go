@@ -0,0 +1,33 @@
+package deproto_test
+
+import (
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+	"github.com/bluefalconhd/deproto/testdeproto"
+)
+
+func TestRenderStableGolden(t *testing.T) {
+	data := deproto.NewMessage().
+		Varint(1, 150).
+		Fixed64(2, 0x3ff0000000000000).
+		Fixed32(3, 0x3f800000).
+		String(4, "hello").
+		Bytes(5, []byte{0x00, 0x01}).
+		Message(6, deproto.NewMessage().Varint(1, 1)).
+		Bytes(7, []byte("abc\x00\x00")).
+		Bytes(8, nil).
+		Encode()
+
+	plain, err := deproto.DecodeFields(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdeproto.GoldenFields(t, "stable", plain)
+
+	embedded, err := deproto.DecodeOptions{Embedded: true}.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testdeproto.GoldenFields(t, "stable_embedded", embedded)
+}
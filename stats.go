@@ -0,0 +1,339 @@
+package deproto
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// statsTopValues is how many of the most frequent values FieldStats keeps.
+const statsTopValues = 5
+
+// statsTrackedValues is how many distinct values of a field AnalyzeCorpus
+// counts exactly. Past it, counts are kept with the Misra-Gries algorithm
+// and the number of distinct values is estimated.
+const statsTrackedValues = 1024
+
+// ValueCount is a value and the number of times it occurred.
+type ValueCount struct {
+	Value string `json:"value"` // As described by DescribeValue
+	Count int    `json:"count"`
+}
+
+// FieldStats summarizes one field path across a corpus.
+type FieldStats struct {
+	Path     FieldPath
+	Count    int            // Number of occurrences
+	Messages int            // Number of messages with at least one occurrence
+	Kinds    map[string]int // Occurrences by kind: varint, fixed64, fixed32, message, string, packed or bytes
+	Min, Max uint64         // Range of the values, or of the lengths of length-delimited fields
+	Mean     float64        // Mean of the values, or of the lengths
+	Distinct int            // Distinct values, not counting nested messages
+	Top      []ValueCount   // Most frequent values, most frequent first
+
+	// Estimated is set when the field has too many distinct values to count
+	// them all: Distinct is then a HyperLogLog estimate, and the counts in
+	// Top are lower bounds.
+	Estimated bool
+
+	// Role guesses what the values are from how they vary: "constant" for a
+	// single value, "enum" for a few values that repeat, "counter" for
+	// numbers that mostly grow from one occurrence to the next, such as
+	// sequence numbers and timestamps, "identifier" for values that are
+	// nearly all distinct, or "" when none fits or there are too few
+	// occurrences to tell.
+	Role string
+}
+
+// CorpusStats describes the fields of a corpus of messages of the same type.
+type CorpusStats struct {
+	Samples int          // Messages analyzed
+	Read    int          // Messages read, including those sampling passed over
+	Fields  []FieldStats // Sorted by path
+	Schema  *Schema      // Candidate schema, inferred with InferSchema
+	Kept    int          // Messages the schema and conflicts were inferred from
+
+	Conflicts []WireTypeConflict // Paths seen with more than one wire type
+}
+
+// AnalyzeCorpus gathers field frequencies, kinds and value histograms over
+// a corpus of decoded messages, and infers a candidate schema for it.
+func AnalyzeCorpus(corpus [][]Field) *CorpusStats {
+	a := NewCorpusAnalyzer(SampleOptions{})
+	for _, fields := range corpus {
+		a.Add(fields)
+	}
+	return a.Stats()
+}
+
+// CorpusAnalyzer gathers the statistics of AnalyzeCorpus one message at a
+// time, for corpora too large to hold in memory. The field statistics cover
+// every message its sampler takes; the schema and wire type conflicts are
+// inferred from the messages the sampler keeps. Save and
+// LoadCorpusAnalyzer checkpoint the analysis, so that it can continue over
+// captures arriving for days.
+type CorpusAnalyzer struct {
+	// Sources names the inputs analyzed so far, as recorded by the caller,
+	// so that a run resumed from a checkpoint can skip them.
+	Sources []string
+
+	sampler *Sampler
+	byPath  map[string]*fieldAccumulator
+}
+
+// fieldAccumulator gathers the statistics of one field path.
+type fieldAccumulator struct {
+	stats      FieldStats
+	values     map[string]int
+	distinct   hyperLogLog
+	sum        float64
+	prev       uint64
+	increasing int // Occurrences of a number greater than the previous one
+	last       int // Number of the last message the field was seen in
+}
+
+// NewCorpusAnalyzer returns a CorpusAnalyzer sampling messages as opts
+// describes.
+func NewCorpusAnalyzer(opts SampleOptions) *CorpusAnalyzer {
+	return &CorpusAnalyzer{sampler: NewSampler(opts), byPath: make(map[string]*fieldAccumulator)}
+}
+
+// Add analyzes a message, unless sampling passes it over. It reports false
+// once the limit of messages to analyze is reached, after which further
+// messages are ignored.
+func (a *CorpusAnalyzer) Add(fields []Field) bool {
+	if !a.sampler.Take() {
+		return !a.sampler.Done()
+	}
+	a.sampler.Keep(fields)
+	n := a.sampler.Taken()
+	Walk(fields, func(path FieldPath, f Field) bool {
+		key := path.String()
+		value := measure(f)
+		acc, ok := a.byPath[key]
+		if !ok {
+			acc = &fieldAccumulator{
+				stats:  FieldStats{Path: path, Kinds: make(map[string]int), Min: value, Max: value},
+				values: make(map[string]int),
+			}
+			a.byPath[key] = acc
+		} else if value > acc.prev {
+			acc.increasing++
+		}
+		acc.stats.Count++
+		if acc.last != n {
+			acc.stats.Messages++
+			acc.last = n
+		}
+		kind := valueKind(f)
+		acc.stats.Kinds[kind]++
+		acc.stats.Min = min(acc.stats.Min, value)
+		acc.stats.Max = max(acc.stats.Max, value)
+		acc.sum += float64(value)
+		acc.prev = value
+		if kind != "message" {
+			v := DescribeValue(f)
+			acc.distinct.add(v)
+			if countValue(acc.values, v) {
+				acc.stats.Estimated = true
+			}
+		}
+		return true
+	})
+	return !a.sampler.Done()
+}
+
+// Done reports whether the limit of messages to analyze is reached.
+func (a *CorpusAnalyzer) Done() bool {
+	return a.sampler.Done()
+}
+
+// Stats returns the statistics of the messages analyzed so far.
+func (a *CorpusAnalyzer) Stats() *CorpusStats {
+	kept := a.sampler.Kept()
+	stats := &CorpusStats{
+		Samples: a.sampler.Taken(),
+		Read:    a.sampler.Read(),
+		Schema:  InferSchema(kept, InferOptions{}),
+		Kept:    len(kept),
+	}
+	stats.Conflicts = CorpusWireTypeConflicts(kept)
+	for _, acc := range a.byPath {
+		s := acc.stats
+		s.Mean = acc.sum / float64(s.Count)
+		s.Distinct = len(acc.values)
+		if s.Estimated {
+			s.Distinct = acc.distinct.estimate()
+		}
+		for value, count := range acc.values {
+			s.Top = append(s.Top, ValueCount{value, count})
+		}
+		sort.Slice(s.Top, func(i, j int) bool {
+			if s.Top[i].Count != s.Top[j].Count {
+				return s.Top[i].Count > s.Top[j].Count
+			}
+			return s.Top[i].Value < s.Top[j].Value
+		})
+		if len(s.Top) > statsTopValues {
+			s.Top = s.Top[:statsTopValues]
+		}
+		s.Role = fieldRole(&s, acc.increasing)
+		stats.Fields = append(stats.Fields, s)
+	}
+	sort.Slice(stats.Fields, func(i, j int) bool {
+		return slices.Compare(stats.Fields[i].Path, stats.Fields[j].Path) < 0
+	})
+	return stats
+}
+
+// countValue counts an occurrence of a value. Once more than
+// statsTrackedValues values are counted, every count is decreased by one
+// and the values whose count drops to zero are forgotten, as in the
+// Misra-Gries algorithm: counts then remain lower bounds, and the values
+// occurring in more than a statsTrackedValues-th of the occurrences are
+// sure to be kept. It reports whether counts were decreased.
+func countValue(values map[string]int, v string) bool {
+	values[v]++
+	if len(values) <= statsTrackedValues {
+		return false
+	}
+	for value, count := range values {
+		if count == 1 {
+			delete(values, value)
+		} else {
+			values[value] = count - 1
+		}
+	}
+	return true
+}
+
+// fieldRole guesses the role of a field from its statistics and the number
+// of occurrences greater than the previous one, as described for
+// FieldStats.Role.
+func fieldRole(s *FieldStats, increasing int) string {
+	if s.Count < 8 || s.Kinds["message"] > 0 {
+		return ""
+	}
+	numeric := s.Kinds["varint"]+s.Kinds["fixed64"]+s.Kinds["fixed32"] == s.Count
+	switch {
+	case s.Distinct == 1:
+		return "constant"
+	case s.Distinct <= 16 && s.Distinct*4 <= s.Count:
+		return "enum"
+	case s.Distinct*10 < s.Count*9:
+		return ""
+	case numeric && increasing*10 >= (s.Count-1)*9:
+		return "counter"
+	default:
+		return "identifier"
+	}
+}
+
+// valueKind names the kind of value a field holds, as DescribeValue does.
+func valueKind(f Field) string {
+	switch v := f.(type) {
+	case *VarintField:
+		return "varint"
+	case *Fixed64Field:
+		return "fixed64"
+	case *Fixed32Field:
+		return "fixed32"
+	case *LengthDelimitedField:
+		switch {
+		case len(v.SubFields) > 0 || v.EmptyMessage:
+			return "message"
+		case v.IsString:
+			return "string"
+		case v.Packed != nil:
+			return "packed"
+		default:
+			return "bytes"
+		}
+	default:
+		return ""
+	}
+}
+
+// String renders the statistics as a frequency table, the value histogram
+// of every field and the candidate schema.
+func (s *CorpusStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d samples", s.Samples)
+	if s.Read > s.Samples {
+		fmt.Fprintf(&b, " of %d messages read", s.Read)
+	}
+	if s.Kept < s.Samples {
+		fmt.Fprintf(&b, ", schema inferred from %d", s.Kept)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "%-16s %8s %9s %-24s %-24s %12s %s\n", "PATH", "COUNT", "PRESENCE", "KINDS", "RANGE", "MEAN", "ROLE")
+	for _, f := range s.Fields {
+		presence := 0.0
+		if s.Samples > 0 {
+			presence = float64(f.Messages) / float64(s.Samples) * 100
+		}
+		rng := fmt.Sprintf("%d..%d", f.Min, f.Max)
+		fmt.Fprintf(&b, "%-16s %8d %8.1f%% %-24s %-24s %12.6g %s\n", f.Path, f.Count, presence, describeKinds(f.Kinds), rng, f.Mean, f.Role)
+	}
+	for _, f := range s.Fields {
+		if len(f.Top) == 0 {
+			continue
+		}
+		if f.Estimated {
+			fmt.Fprintf(&b, "\n%s: about %d distinct values\n", f.Path, f.Distinct)
+		} else {
+			fmt.Fprintf(&b, "\n%s: %d distinct values\n", f.Path, f.Distinct)
+		}
+		for _, v := range f.Top {
+			bar := strings.Repeat("#", max(1, v.Count*20/f.Count))
+			fmt.Fprintf(&b, "  %6d  %-20s %s\n", v.Count, bar, truncate(v.Value, 60))
+		}
+	}
+	if len(s.Conflicts) > 0 {
+		b.WriteString("\nwire type conflicts:\n")
+		for _, c := range s.Conflicts {
+			fmt.Fprintf(&b, "  %s\n", c)
+		}
+	}
+	if s.Schema != nil {
+		b.WriteString("\n")
+		b.WriteString(s.Schema.Proto())
+	}
+	return b.String()
+}
+
+// describeKinds lists kinds with their counts, most frequent first.
+func describeKinds(kinds map[string]int) string {
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if kinds[names[i]] != kinds[names[j]] {
+			return kinds[names[i]] > kinds[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) == 1 {
+		return names[0]
+	}
+	parts := make([]string, len(names))
+	for i, kind := range names {
+		parts[i] = fmt.Sprintf("%s x%d", kind, kinds[kind])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// truncate shortens s to at most n bytes, marking the cut with "...".
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n - 3
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
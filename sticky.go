@@ -0,0 +1,81 @@
+package deproto
+
+import "fmt"
+
+// StickyHints returns type hints that read every length-delimited field
+// path in the corpus the way most messages read it, so that messages of one
+// type can be decoded consistently instead of a field flipping between
+// string and message from one sample to the next. Ties go to the less
+// specific reading: bytes, then string, then message.
+func StickyHints(corpus [][]Field) map[string]WireHint {
+	votes := make(map[string]map[WireHint]int)
+	for _, fields := range corpus {
+		Walk(fields, func(path FieldPath, f Field) bool {
+			l, ok := f.(*LengthDelimitedField)
+			if !ok || len(l.Data) == 0 {
+				return true // Empty payloads read the same every way
+			}
+			hint := WireHint{As: l.Interpretation()}
+			if l.Packed != nil {
+				hint.Type = l.Packed.Type
+			}
+			key := path.String()
+			if votes[key] == nil {
+				votes[key] = make(map[WireHint]int)
+			}
+			votes[key][hint]++
+			return true
+		})
+	}
+
+	hints := make(map[string]WireHint, len(votes))
+	for key, counts := range votes {
+		var best WireHint
+		bestCount := 0
+		for hint, count := range counts {
+			if count > bestCount || count == bestCount && lessSpecific(hint, best) {
+				best, bestCount = hint, count
+			}
+		}
+		hints[key] = best
+	}
+	return hints
+}
+
+// lessSpecific orders hints for breaking ties in StickyHints.
+func lessSpecific(a, b WireHint) bool {
+	if a.As != b.As {
+		return a.As < b.As
+	}
+	return a.Type < b.Type
+}
+
+// DecodeCorpus decodes messages of one type so that every field path is
+// read the same way in all of them. It decodes each message, takes
+// StickyHints over the results and decodes again with those hints added to
+// o.TypeHints; hints already in o take precedence. A message whose field
+// cannot be read the majority's way keeps the heuristic reading for it.
+func (o DecodeOptions) DecodeCorpus(messages [][]byte) ([][]Field, error) {
+	corpus := make([][]Field, len(messages))
+	for i, data := range messages {
+		fields, err := o.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %v", i, err)
+		}
+		corpus[i] = fields
+	}
+
+	hints := StickyHints(corpus)
+	for key, hint := range o.TypeHints {
+		hints[key] = hint
+	}
+	o.TypeHints = hints
+	for i, data := range messages {
+		fields, err := o.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %v", i, err)
+		}
+		corpus[i] = fields
+	}
+	return corpus, nil
+}
@@ -0,0 +1,162 @@
+package deproto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GeneratePython returns a Python module declaring a dataclass for every
+// message in the schema and an IntEnum for every enum. Each attribute is
+// annotated with its field number. Nested types are named Parent_Child.
+func GeneratePython(s *Schema) string {
+	var b strings.Builder
+	b.WriteString("# Code generated by deproto. DO NOT EDIT.\n\n")
+	b.WriteString("from __future__ import annotations\n\n")
+	b.WriteString("from dataclasses import dataclass, field\n")
+	b.WriteString("from enum import IntEnum\n")
+	b.WriteString("from typing import List, Optional\n")
+
+	eachEnum(s, func(e *EnumSchema) {
+		fmt.Fprintf(&b, "\n\nclass %s(IntEnum):\n", flatName(s, e.FullName))
+		if len(e.Values) == 0 {
+			b.WriteString("    pass\n")
+		}
+		for _, v := range e.Values {
+			fmt.Fprintf(&b, "    %s = %d\n", pythonName(v.Name), v.Number)
+		}
+	})
+	s.eachMessage(func(m *MessageSchema) {
+		fmt.Fprintf(&b, "\n\n@dataclass\nclass %s:\n", flatName(s, m.FullName))
+		if len(m.Fields) == 0 {
+			b.WriteString("    pass\n")
+		}
+		for _, f := range m.Fields {
+			typ, def := pythonType(s, f)
+			fmt.Fprintf(&b, "    %s: %s = %s  # %d\n", pythonName(f.Name), typ, def, f.Number)
+		}
+	})
+	return b.String()
+}
+
+// pythonType returns the annotation and default value of a field.
+func pythonType(s *Schema, f *FieldSchema) (string, string) {
+	var typ, def string
+	switch {
+	case f.Message != nil:
+		typ, def = flatName(s, f.Message.FullName), "None"
+	case f.Enum != nil:
+		typ = flatName(s, f.Enum.FullName)
+		def = typ + "(0)"
+		if len(f.Enum.Values) > 0 {
+			def = typ + "." + pythonName(f.Enum.Values[0].Name)
+		}
+	default:
+		switch f.Type {
+		case "double", "float":
+			typ, def = "float", "0.0"
+		case "bool":
+			typ, def = "bool", "False"
+		case "string":
+			typ, def = "str", `""`
+		case "bytes":
+			typ, def = "bytes", `b""`
+		default:
+			typ, def = "int", "0"
+		}
+	}
+	switch {
+	case f.Label == LabelRepeated:
+		return "List[" + typ + "]", "field(default_factory=list)"
+	case f.Message != nil:
+		return "Optional[" + typ + "]", def
+	}
+	return typ, def
+}
+
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true,
+	"def": true, "del": true, "elif": true, "else": true, "except": true,
+	"finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true,
+	"not": true, "or": true, "pass": true, "raise": true, "return": true,
+	"try": true, "while": true, "with": true, "yield": true,
+}
+
+// pythonName appends an underscore to names that are Python keywords.
+func pythonName(name string) string {
+	if pythonKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// GenerateTypeScript returns TypeScript declarations for the schema: an
+// interface for every message and a string enum for every enum. The types
+// describe the proto3 JSON form of the messages, as produced by protojson:
+// fields use lowerCamelCase names and are all optional, 64-bit integers and
+// bytes (base64) are strings, enum values are their names, and map fields
+// are objects keyed by the map keys as strings. Each field is annotated with
+// its field number.
+func GenerateTypeScript(s *Schema) string {
+	var b strings.Builder
+	b.WriteString("// Code generated by deproto. DO NOT EDIT.\n")
+	eachEnum(s, func(e *EnumSchema) {
+		fmt.Fprintf(&b, "\nexport enum %s {\n", flatName(s, e.FullName))
+		for _, v := range e.Values {
+			fmt.Fprintf(&b, "  %s = %q,\n", v.Name, v.Name)
+		}
+		b.WriteString("}\n")
+	})
+	s.eachMessage(func(m *MessageSchema) {
+		fmt.Fprintf(&b, "\nexport interface %s {\n", flatName(s, m.FullName))
+		for _, f := range m.Fields {
+			typ := typeScriptType(s, f)
+			if f.IsMap() {
+				typ = fmt.Sprintf("{ [key: string]: %s }", typeScriptType(s, f.Message.Field(2)))
+			} else if f.Label == LabelRepeated {
+				typ += "[]"
+			}
+			fmt.Fprintf(&b, "  %s?: %s; // %d\n", lowerCamel(f.Name), typ, f.Number)
+		}
+		b.WriteString("}\n")
+	})
+	return b.String()
+}
+
+func typeScriptType(s *Schema, f *FieldSchema) string {
+	switch {
+	case f.Message != nil:
+		return flatName(s, f.Message.FullName)
+	case f.Enum != nil:
+		return flatName(s, f.Enum.FullName)
+	}
+	switch f.Type {
+	case "int32", "uint32", "sint32", "fixed32", "sfixed32", "double", "float":
+		return "number"
+	case "bool":
+		return "boolean"
+	default:
+		// string, bytes and the 64-bit integer types.
+		return "string"
+	}
+}
+
+// lowerCamel returns the JSON name protoc derives from a field name, such
+// as userId for user_id.
+func lowerCamel(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
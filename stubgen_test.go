@@ -0,0 +1,36 @@
+package deproto_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestGenerateTypeScriptMaps(t *testing.T) {
+	schema, err := deproto.NewRegistry().AddSource("maps.proto", `
+syntax = "proto3";
+package maps;
+message Item {
+  string name = 1;
+}
+message M {
+  map<string, int64> counts = 1;
+  map<int32, Item> items = 2;
+  repeated Item list = 3;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := deproto.GenerateTypeScript(schema)
+	for _, want := range []string{
+		"counts?: { [key: string]: string }; // 1",
+		"items?: { [key: string]: Item }; // 2",
+		"list?: Item[]; // 3",
+	} {
+		if !strings.Contains(ts, want) {
+			t.Errorf("GenerateTypeScript output lacks %q:\n%s", want, ts)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package testdeproto helps tests pin the output of tools built on deproto
+// with golden files.
+//
+// Golden files live in testdata/ next to the test. Run the tests with
+// DEPROTO_UPDATE_GOLDEN=1 in the environment to create or rewrite them from
+// the current output, then review the changes before committing them.
+package testdeproto
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+// UpdateEnv is the environment variable that makes the helpers rewrite
+// golden files instead of comparing against them.
+const UpdateEnv = "DEPROTO_UPDATE_GOLDEN"
+
+// Golden compares got against testdata/name.golden and fails the test,
+// reporting the first differing line, if they differ.
+func Golden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (set %s=1 to create it)", err, UpdateEnv)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: output differs from golden file (set %s=1 to update)\n%s", path, UpdateEnv, firstDiff(string(want), string(got)))
+	}
+}
+
+// GoldenFields compares the stable rendering of fields (see
+// deproto.RenderStable) against testdata/name.golden.
+func GoldenFields(t testing.TB, name string, fields []deproto.Field) {
+	t.Helper()
+	Golden(t, name, []byte(deproto.RenderStable(fields)))
+}
+
+// GoldenMessage decodes data and compares its stable rendering against
+// testdata/name.golden. It fails the test if data does not decode.
+func GoldenMessage(t testing.TB, name string, data []byte) {
+	t.Helper()
+	fields, err := deproto.DecodeFields(data)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	GoldenFields(t, name, fields)
+}
+
+// firstDiff describes the first line where want and got differ.
+func firstDiff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i >= len(wantLines) || i >= len(gotLines) || w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,366 @@
+package deproto
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseText parses numbered-field protobuf text format, such as the output of
+// protoc --decode_raw, into a field tree that can be passed to Encode:
+//
+//	1: 150
+//	2: "testing"
+//	3 {
+//	  1: 0x3f800000
+//	}
+//
+// Integers become varints, with negative values stored in two's complement.
+// Hexadecimal literals of exactly 8 or 16 digits become fixed32 and fixed64
+// fields respectively, matching how protoc prints them. Decimal numbers with a
+// fraction or exponent become doubles (fixed64), or floats (fixed32) when
+// suffixed with "f". Quoted strings become length-delimited fields and braces
+// or angle brackets introduce nested messages. Comments start with '#'.
+func ParseText(s string) ([]Field, error) {
+	p := &textParser{lex: textLexer{src: s, line: 1, col: 1}}
+	return p.parseFields(tokEOF)
+}
+
+// FormatText renders fields in the text format accepted by ParseText.
+func FormatText(fields []Field) string {
+	var b strings.Builder
+	formatText(&b, fields, 0)
+	return b.String()
+}
+
+func formatText(b *strings.Builder, fields []Field, indentLevel int) {
+	indent := strings.Repeat("  ", indentLevel)
+	for _, f := range fields {
+		switch v := f.(type) {
+		case *VarintField:
+			fmt.Fprintf(b, "%s%d: %d\n", indent, v.ID, v.Value)
+		case *Fixed64Field:
+			fmt.Fprintf(b, "%s%d: 0x%016x\n", indent, v.ID, v.Value)
+		case *Fixed32Field:
+			fmt.Fprintf(b, "%s%d: 0x%08x\n", indent, v.ID, v.Value)
+		case *LengthDelimitedField:
+			if len(v.SubFields) > 0 || v.EmptyMessage {
+				fmt.Fprintf(b, "%s%d {\n", indent, v.ID)
+				formatText(b, v.SubFields, indentLevel+1)
+				fmt.Fprintf(b, "%s}\n", indent)
+			} else {
+				fmt.Fprintf(b, "%s%d: %s\n", indent, v.ID, strconv.Quote(string(v.payload())))
+			}
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokOpenBrace
+	tokCloseBrace
+	tokOpenAngle
+	tokCloseAngle
+	tokColon
+	tokSeparator
+)
+
+type token struct {
+	kind      tokenKind
+	text      string
+	line, col int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+// textLexer splits text format input into tokens.
+type textLexer struct {
+	src       string
+	pos       int
+	line, col int
+	peeked    *token
+}
+
+func (l *textLexer) peek() (token, error) {
+	if l.peeked == nil {
+		t, err := l.scan()
+		if err != nil {
+			return token{}, err
+		}
+		l.peeked = &t
+	}
+	return *l.peeked, nil
+}
+
+func (l *textLexer) next() (token, error) {
+	t, err := l.peek()
+	l.peeked = nil
+	return t, err
+}
+
+func (l *textLexer) advance(n int) {
+	for i := 0; i < n; i++ {
+		if l.src[l.pos] == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+		l.pos++
+	}
+}
+
+func (l *textLexer) scan() (token, error) {
+	// Skip whitespace and comments.
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+		} else if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			l.advance(1)
+		} else {
+			break
+		}
+	}
+	t := token{line: l.line, col: l.col}
+	if l.pos >= len(l.src) {
+		t.kind = tokEOF
+		return t, nil
+	}
+
+	c := l.src[l.pos]
+	punct := map[byte]tokenKind{
+		'{': tokOpenBrace, '}': tokCloseBrace,
+		'<': tokOpenAngle, '>': tokCloseAngle,
+		':': tokColon, ',': tokSeparator, ';': tokSeparator,
+	}
+	if kind, ok := punct[c]; ok {
+		t.kind, t.text = kind, string(c)
+		l.advance(1)
+		return t, nil
+	}
+
+	if c == '"' || c == '\'' {
+		end := l.pos + 1
+		for end < len(l.src) && l.src[end] != c {
+			if l.src[end] == '\\' {
+				end++
+			}
+			if end < len(l.src) && l.src[end] == '\n' {
+				break
+			}
+			end++
+		}
+		if end >= len(l.src) || l.src[end] != c {
+			return t, fmt.Errorf("%d:%d: unterminated string", t.line, t.col)
+		}
+		raw := l.src[l.pos : end+1]
+		if c == '\'' {
+			raw = `"` + strings.ReplaceAll(raw[1:len(raw)-1], `"`, `\"`) + `"`
+		}
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return t, fmt.Errorf("%d:%d: invalid string literal: %v", t.line, t.col, err)
+		}
+		t.kind, t.text = tokString, value
+		l.advance(end + 1 - l.pos)
+		return t, nil
+	}
+
+	end := l.pos
+	for end < len(l.src) && isNumberChar(l.src[end]) {
+		end++
+	}
+	if end == l.pos {
+		return t, fmt.Errorf("%d:%d: unexpected character %q", t.line, t.col, c)
+	}
+	t.kind, t.text = tokNumber, l.src[l.pos:end]
+	l.advance(end - l.pos)
+	return t, nil
+}
+
+func isNumberChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c == '.' || c == '-' || c == '+' || c == '_'
+}
+
+// textParser builds a field tree from text format tokens.
+type textParser struct {
+	lex textLexer
+}
+
+func (p *textParser) parseFields(end tokenKind) ([]Field, error) {
+	var fields []Field
+	for {
+		t, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == end {
+			return fields, nil
+		}
+		if t.kind != tokNumber {
+			return nil, fmt.Errorf("%d:%d: expected field number, got %s", t.line, t.col, t)
+		}
+		id, err := strconv.ParseUint(t.text, 10, 29)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("%d:%d: invalid field number %s", t.line, t.col, t)
+		}
+
+		field, err := p.parseValue(int(id))
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+
+		if t, err := p.lex.peek(); err != nil {
+			return nil, err
+		} else if t.kind == tokSeparator {
+			p.lex.next()
+		}
+	}
+}
+
+func (p *textParser) parseValue(id int) (Field, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == tokColon {
+		if t, err = p.lex.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch t.kind {
+	case tokOpenBrace, tokOpenAngle:
+		end := tokCloseBrace
+		if t.kind == tokOpenAngle {
+			end = tokCloseAngle
+		}
+		subFields, err := p.parseFields(end)
+		if err != nil {
+			return nil, err
+		}
+		return &LengthDelimitedField{
+			FieldBase: FieldBase{ID: id, WireType: WireBytes},
+			Data:      Encode(subFields),
+			SubFields: subFields,
+		}, nil
+
+	case tokString:
+		// Adjacent string literals are concatenated.
+		value := t.text
+		for {
+			next, err := p.lex.peek()
+			if err != nil {
+				return nil, err
+			}
+			if next.kind != tokString {
+				break
+			}
+			p.lex.next()
+			value += next.text
+		}
+		field := &LengthDelimitedField{
+			FieldBase: FieldBase{ID: id, WireType: WireBytes},
+			Data:      []byte(value),
+		}
+		if isPrintableString(field.Data) {
+			field.IsString = true
+			field.StringValue = value
+		}
+		return field, nil
+
+	case tokNumber:
+		field, err := parseTextNumber(id, t.text)
+		if err != nil {
+			return nil, fmt.Errorf("%d:%d: %v", t.line, t.col, err)
+		}
+		return field, nil
+
+	default:
+		return nil, fmt.Errorf("%d:%d: expected value for field %d, got %s", t.line, t.col, id, t)
+	}
+}
+
+// parseTextNumber converts a numeric literal into the field type it denotes.
+func parseTextNumber(id int, text string) (Field, error) {
+	lower := strings.ToLower(strings.ReplaceAll(text, "_", ""))
+	base := FieldBase{ID: id}
+
+	switch lower {
+	case "true":
+		base.WireType = WireVarint
+		return &VarintField{FieldBase: base, Value: 1}, nil
+	case "false":
+		base.WireType = WireVarint
+		return &VarintField{FieldBase: base, Value: 0}, nil
+	}
+
+	digits := strings.TrimLeft(lower, "+-")
+	if strings.HasPrefix(digits, "0x") {
+		value, err := strconv.ParseUint(digits[2:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex literal %q", text)
+		}
+		if strings.HasPrefix(lower, "-") {
+			value = uint64(-int64(value))
+		}
+		switch len(digits) - 2 {
+		case 8:
+			base.WireType = WireFixed32
+			return &Fixed32Field{FieldBase: base, Value: uint32(value)}, nil
+		case 16:
+			base.WireType = WireFixed64
+			return &Fixed64Field{FieldBase: base, Value: value}, nil
+		}
+		base.WireType = WireVarint
+		return &VarintField{FieldBase: base, Value: value}, nil
+	}
+
+	isFloat := strings.ContainsAny(digits, ".e") || digits == "inf" || digits == "nan" ||
+		digits == "inff" || digits == "nanf"
+	if isFloat {
+		if strings.HasSuffix(lower, "f") {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(lower, "f"), 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid float literal %q", text)
+			}
+			base.WireType = WireFixed32
+			return &Fixed32Field{FieldBase: base, Value: math.Float32bits(float32(value))}, nil
+		}
+		value, err := strconv.ParseFloat(lower, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float literal %q", text)
+		}
+		base.WireType = WireFixed64
+		return &Fixed64Field{FieldBase: base, Value: math.Float64bits(value)}, nil
+	}
+
+	base.WireType = WireVarint
+	if strings.HasPrefix(lower, "-") {
+		value, err := strconv.ParseInt(lower, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer literal %q", text)
+		}
+		return &VarintField{FieldBase: base, Value: uint64(value)}, nil
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(lower, "+"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer literal %q", text)
+	}
+	return &VarintField{FieldBase: base, Value: value}, nil
+}
@@ -0,0 +1,24 @@
+package deproto_test
+
+import (
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+)
+
+func TestParseTextRejectsFieldZero(t *testing.T) {
+	for src, want := range map[string]string{
+		"0: 5":       `1:1: invalid field number "0"`,
+		"1 { 0: 5 }": `1:5: invalid field number "0"`,
+	} {
+		fields, err := deproto.ParseText(src)
+		if err == nil {
+			t.Errorf("ParseText(%q) = %v, want an error", src, fields)
+		} else if err.Error() != want {
+			t.Errorf("ParseText(%q): %v, want %s", src, err, want)
+		}
+	}
+	if _, err := deproto.ParseText("1: 5"); err != nil {
+		t.Errorf("ParseText(%q): %v", "1: 5", err)
+	}
+}
@@ -0,0 +1,210 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ExampleFeature is a feature of a tf.Example: a named list of byte
+// strings, floats or integers.
+type ExampleFeature struct {
+	Name   string
+	Kind   string // "bytes_list", "float_list", "int64_list", or "" for an empty feature
+	Bytes  [][]byte
+	Floats []float32
+	Ints   []int64
+}
+
+// Len returns the number of values in the feature.
+func (f ExampleFeature) Len() int {
+	return len(f.Bytes) + len(f.Floats) + len(f.Ints)
+}
+
+// ParseExample reads a message as a tensorflow.Example and returns its
+// features sorted by name. It reports false if the message does not have
+// the shape of an Example with at least one feature. The field numbers of
+// Example are too common for the shape alone to be conclusive, so a false
+// positive is possible on small messages.
+func ParseExample(data []byte) ([]ExampleFeature, bool) {
+	raw := DecodeOptions{NoNestedMessages: true, NoStrings: true}
+	fields, err := raw.Decode(data)
+	if err != nil || len(fields) != 1 {
+		return nil, false
+	}
+	features, ok := fields[0].(*LengthDelimitedField)
+	if !ok || features.ID != 1 {
+		return nil, false
+	}
+	entries, err := raw.Decode(features.Data)
+	if err != nil || len(entries) == 0 {
+		return nil, false
+	}
+	var out []ExampleFeature
+	for _, e := range entries {
+		entry, ok := e.(*LengthDelimitedField)
+		if !ok || entry.ID != 1 {
+			return nil, false
+		}
+		f, ok := parseFeatureEntry(entry.Data)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, f)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, true
+}
+
+// parseFeatureEntry reads an entry of the Features map: a name and a
+// Feature.
+func parseFeatureEntry(data []byte) (ExampleFeature, bool) {
+	raw := DecodeOptions{NoNestedMessages: true, NoStrings: true}
+	fields, err := raw.Decode(data)
+	if err != nil {
+		return ExampleFeature{}, false
+	}
+	var f ExampleFeature
+	var feature []byte
+	for _, field := range fields {
+		l, ok := field.(*LengthDelimitedField)
+		switch {
+		case !ok:
+			return ExampleFeature{}, false
+		case l.ID == 1 && utf8.Valid(l.Data) && isPrintableString(l.Data):
+			f.Name = string(l.Data)
+		case l.ID == 2:
+			feature = l.Data
+		default:
+			return ExampleFeature{}, false
+		}
+	}
+	kinds, err := raw.Decode(feature)
+	if err != nil || len(kinds) > 1 {
+		return ExampleFeature{}, false
+	}
+	if len(kinds) == 0 {
+		return f, true
+	}
+	list, ok := kinds[0].(*LengthDelimitedField)
+	if !ok {
+		return ExampleFeature{}, false
+	}
+	values, err := raw.Decode(list.Data)
+	if err != nil {
+		return ExampleFeature{}, false
+	}
+	switch list.ID {
+	case 1:
+		f.Kind = "bytes_list"
+		f.Bytes = [][]byte{}
+		for _, v := range values {
+			l, ok := v.(*LengthDelimitedField)
+			if !ok || l.ID != 1 {
+				return ExampleFeature{}, false
+			}
+			f.Bytes = append(f.Bytes, l.Data)
+		}
+	case 2:
+		f.Kind = "float_list"
+		f.Floats = []float32{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case *LengthDelimitedField: // Packed
+				if v.ID != 1 || len(v.Data)%4 != 0 {
+					return ExampleFeature{}, false
+				}
+				for i := 0; i < len(v.Data); i += 4 {
+					f.Floats = append(f.Floats, math.Float32frombits(binary.LittleEndian.Uint32(v.Data[i:])))
+				}
+			case *Fixed32Field:
+				if v.ID != 1 {
+					return ExampleFeature{}, false
+				}
+				f.Floats = append(f.Floats, math.Float32frombits(v.Value))
+			default:
+				return ExampleFeature{}, false
+			}
+		}
+	case 3:
+		f.Kind = "int64_list"
+		f.Ints = []int64{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case *LengthDelimitedField: // Packed
+				packed, err := decodePacked(v.Data, &FieldSchema{Type: "int64"})
+				if v.ID != 1 || err != nil {
+					return ExampleFeature{}, false
+				}
+				for _, n := range packed {
+					f.Ints = append(f.Ints, int64(n))
+				}
+			case *VarintField:
+				if v.ID != 1 {
+					return ExampleFeature{}, false
+				}
+				f.Ints = append(f.Ints, int64(v.Value))
+			default:
+				return ExampleFeature{}, false
+			}
+		}
+	default:
+		return ExampleFeature{}, false
+	}
+	return f, true
+}
+
+// exampleListValues is how many values of a feature are shown without
+// RenderOptions.Verbose.
+const exampleListValues = 8
+
+// example renders the features of a tf.Example, one per line.
+func (r *renderer) example(b *strings.Builder, features []ExampleFeature) {
+	fmt.Fprintf(b, "tf.Example (%d features)\n", len(features))
+	for _, f := range features {
+		if r.opts.MaxOutput > 0 && b.Len() > r.opts.MaxOutput {
+			return
+		}
+		var values []string
+		n := f.Len()
+		if !r.opts.Verbose {
+			n = min(n, exampleListValues)
+		}
+		for i := range n {
+			switch {
+			case f.Bytes != nil:
+				values = append(values, r.exampleBytes(f.Bytes[i]))
+			case f.Floats != nil:
+				values = append(values, strconv.FormatFloat(float64(f.Floats[i]), 'g', -1, 32))
+			default:
+				values = append(values, strconv.FormatInt(f.Ints[i], 10))
+			}
+		}
+		more := ""
+		if n < f.Len() {
+			more = fmt.Sprintf(", ... (%d of %d values shown)", n, f.Len())
+		}
+		kind := f.Kind
+		if kind == "" {
+			kind = "empty"
+		}
+		fmt.Fprintf(b, "    %s: %s [%s%s]\n", strconv.Quote(f.Name), kind, strings.Join(values, ", "), more)
+	}
+}
+
+// exampleBytes formats a value of a bytes_list: text quoted, and other
+// data, such as an encoded image, as a short hex preview.
+func (r *renderer) exampleBytes(data []byte) string {
+	if utf8.Valid(data) && isPrintableString(data) {
+		quoted, note := r.quote(string(data))
+		return quoted + note
+	}
+	if len(data) <= bytesPreviewLen || r.opts.Verbose {
+		return fmt.Sprintf("0x%x", data)
+	}
+	return fmt.Sprintf("0x%x... (%d bytes)", data[:bytesPreviewLen], len(data))
+}
@@ -0,0 +1,51 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// castagnoli is the CRC-32C table used by TFRecord checksums.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC returns the masked CRC-32C of data that TFRecord files store,
+// masked so that a CRC of data holding CRCs is not trivial.
+func maskedCRC(data []byte) uint32 {
+	c := crc32.Checksum(data, castagnoli)
+	return (c>>15 | c<<17) + 0xa282ead8
+}
+
+// IsTFRecord reports whether data starts with a TFRecord header: a length
+// followed by its checksum.
+func IsTFRecord(data []byte) bool {
+	return len(data) >= 16 && binary.LittleEndian.Uint32(data[8:12]) == maskedCRC(data[:8])
+}
+
+// ReadTFRecords splits a TFRecord file, as written by TensorFlow's
+// TFRecordWriter, into its records. Each record is framed by its length, a
+// checksum of the length, the data and a checksum of the data; both
+// checksums are verified. Compressed files are not supported.
+func ReadTFRecords(data []byte) ([][]byte, error) {
+	var records [][]byte
+	for offset := 0; offset < len(data); {
+		rest := data[offset:]
+		if len(rest) < 12 {
+			return records, fmt.Errorf("truncated TFRecord header at offset %d", offset)
+		}
+		if binary.LittleEndian.Uint32(rest[8:12]) != maskedCRC(rest[:8]) {
+			return records, fmt.Errorf("bad TFRecord length checksum at offset %d", offset)
+		}
+		length := binary.LittleEndian.Uint64(rest[:8])
+		if len(rest) < 16 || length > uint64(len(rest)-16) {
+			return records, fmt.Errorf("truncated TFRecord at offset %d: want %d bytes", offset, length)
+		}
+		record := rest[12 : 12+length]
+		if binary.LittleEndian.Uint32(rest[12+length:]) != maskedCRC(record) {
+			return records, fmt.Errorf("bad TFRecord data checksum at offset %d", offset)
+		}
+		records = append(records, record)
+		offset += 16 + int(length)
+	}
+	return records, nil
+}
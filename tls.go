@@ -0,0 +1,623 @@
+package deproto
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// tlsSuite describes an AES-GCM cipher suite.
+type tlsSuite struct {
+	keyLength int
+	newHash   func() hash.Hash
+}
+
+// tlsSuites holds the cipher suites DecryptTLS understands: those of TLS 1.3
+// and the AEAD ones of TLS 1.2 that use AES-GCM.
+var tlsSuites = map[uint16]tlsSuite{
+	0x1301: {16, sha256.New},    // TLS_AES_128_GCM_SHA256
+	0x1302: {32, sha512.New384}, // TLS_AES_256_GCM_SHA384
+	0x009c: {16, sha256.New},    // TLS_RSA_WITH_AES_128_GCM_SHA256
+	0x009d: {32, sha512.New384}, // TLS_RSA_WITH_AES_256_GCM_SHA384
+	0x009e: {16, sha256.New},    // TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+	0x009f: {32, sha512.New384}, // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384
+	0xc02b: {16, sha256.New},    // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	0xc02c: {32, sha512.New384}, // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	0xc02f: {16, sha256.New},    // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	0xc030: {32, sha512.New384}, // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+}
+
+// http2Preface starts the client side of an HTTP/2 connection.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// DecryptTLS decrypts the TLS connections of reassembled TCP packets, as
+// ReassembleTCP returns them, with the secrets registered by
+// RegisterKeyLog, and replaces their packets with what they carry: the
+// bodies of HTTP/1 requests and responses as "http1" packets, gzip content
+// encoding undone, and the DATA of HTTP/2 streams as "http2" packets with
+// the stream ID set. The application data of other protocols is returned as
+// "tls" packets, one per turn. Each packet is timed and addressed like the
+// turn its data starts in.
+//
+// TLS 1.2 and 1.3 are supported with AES-GCM cipher suites. Connections that
+// no registered secret decrypts are returned unchanged, as are UDP packets,
+// and the result is in capture order.
+func DecryptTLS(packets []Packet) []Packet {
+	type entry struct {
+		index  int
+		packet Packet
+	}
+	var out []entry
+	conns := make(map[string]*tlsConn)
+	var order []*tlsConn
+	for i, p := range packets {
+		if p.Protocol != "tcp" {
+			out = append(out, entry{i, p})
+			continue
+		}
+		key := p.Src.String() + " " + p.Dst.String()
+		if p.Dst.String() < p.Src.String() {
+			key = p.Dst.String() + " " + p.Src.String()
+		}
+		c := conns[key]
+		if c == nil {
+			c = &tlsConn{clientAddr: p.Src}
+			conns[key] = c
+			order = append(order, c)
+		}
+		c.turns = append(c.turns, i)
+		c.add(i, p)
+	}
+	for _, c := range order {
+		messages := c.decrypt()
+		if !c.decrypted() {
+			for _, i := range c.turns {
+				out = append(out, entry{i, packets[i]})
+			}
+			continue
+		}
+		for _, m := range messages {
+			out = append(out, entry{m.index, m.payload()})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].index < out[j].index })
+	result := make([]Packet, len(out))
+	for i, e := range out {
+		result[i] = e.packet
+	}
+	return result
+}
+
+// Handshake states of a tlsConn.
+const (
+	tlsWaiting    = iota // The hellos are not complete yet
+	tlsFailed            // Not TLS, or no registered secret fits
+	tlsDecrypting        // The keys of both sides are known
+)
+
+// tlsMaxRecord is the size of the largest record TLS allows, header
+// included.
+const tlsMaxRecord = 5 + 1<<14 + 2048
+
+// tlsConn decrypts a TCP connection, turn by turn: the data of each turn
+// is kept only until it has been decrypted and read as messages.
+type tlsConn struct {
+	clientAddr     netip.AddrPort
+	turns          []int // Positions of the connection's packets, for DecryptTLS
+	state          int
+	client, server tlsSide
+	protocol       string // "http1", "http2" or "tls", once the client's application data shows which
+}
+
+// tlsSide is what one side of a connection sent.
+type tlsSide struct {
+	records tlsStream // Bytes not decrypted yet
+	keys    *tlsKeys
+	data    tlsStream // Application data not read as messages yet
+}
+
+// add adds a turn of the connection, the packet at index.
+func (c *tlsConn) add(index int, p Packet) {
+	side := &c.server
+	if p.Src == c.clientAddr {
+		side = &c.client
+	}
+	side.records.add(index, p, p.Payload)
+}
+
+// decrypt decrypts the records completed by the turns added since the
+// last call and returns the messages completed in the application data.
+func (c *tlsConn) decrypt() []tlsMessage {
+	if c.state == tlsWaiting {
+		c.state = c.handshake()
+	}
+	if c.state != tlsDecrypting {
+		return nil
+	}
+	c.client.decrypt()
+	c.server.decrypt()
+	return c.messages()
+}
+
+// decrypted reports whether records of the connection have been
+// decrypted.
+func (c *tlsConn) decrypted() bool {
+	return c.state == tlsDecrypting && (c.client.keys.started || c.server.keys.started)
+}
+
+// tlsStream is data one side of a connection sent, with the packets it
+// came in.
+type tlsStream struct {
+	data   []byte
+	chunks []tlsChunk
+}
+
+// tlsChunk marks where the data of a packet starts in a stream.
+type tlsChunk struct {
+	offset, index int
+	packet        Packet // Timing and addressing of the packet, without its payload
+}
+
+// chunk returns the chunk holding the byte at offset.
+func (s *tlsStream) chunk(offset int) tlsChunk {
+	i := sort.Search(len(s.chunks), func(i int) bool { return s.chunks[i].offset > offset })
+	return s.chunks[max(i-1, 0)]
+}
+
+// add appends data that started in packet p, at index.
+func (s *tlsStream) add(index int, p Packet, data []byte) {
+	if n := len(s.chunks); n == 0 || s.chunks[n-1].index != index {
+		p.Payload = nil
+		s.chunks = append(s.chunks, tlsChunk{len(s.data), index, p})
+	}
+	s.data = append(s.data, data...)
+}
+
+// drop removes the first n bytes of the stream, once they have been read.
+func (s *tlsStream) drop(n int) {
+	if n == 0 {
+		return
+	}
+	var chunks []tlsChunk
+	for i, c := range s.chunks {
+		end := len(s.data)
+		if i+1 < len(s.chunks) {
+			end = s.chunks[i+1].offset
+		}
+		if end > n {
+			c.offset = max(c.offset-n, 0)
+			chunks = append(chunks, c)
+		}
+	}
+	s.chunks = chunks
+	s.data = slices.Clone(s.data[n:])
+}
+
+// tlsRecord is a record of a TLS stream.
+type tlsRecord struct {
+	typ    byte
+	header []byte
+	body   []byte
+	offset int
+}
+
+// tlsRecords splits a stream into records, up to the first incomplete one.
+func tlsRecords(data []byte) []tlsRecord {
+	var records []tlsRecord
+	for offset := 0; offset+5 <= len(data); {
+		length := int(binary.BigEndian.Uint16(data[offset+3:]))
+		if offset+5+length > len(data) {
+			break
+		}
+		records = append(records, tlsRecord{
+			typ:    data[offset],
+			header: data[offset : offset+5],
+			body:   data[offset+5 : offset+5+length],
+			offset: offset,
+		})
+		offset += 5 + length
+	}
+	return records
+}
+
+// handshake reads the hellos of a connection and derives the keys of both
+// sides from the registered secrets.
+func (c *tlsConn) handshake() int {
+	clientRecords, serverRecords := tlsRecords(c.client.records.data), tlsRecords(c.server.records.data)
+	for _, side := range []struct {
+		data    []byte
+		records []tlsRecord
+	}{{c.client.records.data, clientRecords}, {c.server.records.data, serverRecords}} {
+		// Each side starts with a handshake record, which is complete
+		// once more bytes than the largest record have arrived.
+		if len(side.data) > 0 && side.data[0] != 22 || len(side.data) > tlsMaxRecord && len(side.records) == 0 {
+			return tlsFailed
+		}
+		if len(side.records) == 0 {
+			return tlsWaiting
+		}
+	}
+	clientHello := tlsHandshake(clientRecords)
+	serverHello := tlsHandshake(serverRecords)
+	if len(clientHello) < 38 || clientHello[0] != 1 || len(serverHello) < 38 || serverHello[0] != 2 {
+		return tlsFailed
+	}
+	random := hex.EncodeToString(clientHello[6:38])
+	hello, ok := parseServerHello(serverHello[4:])
+	if !ok {
+		return tlsFailed
+	}
+	suite, ok := tlsSuites[hello.suite]
+	if !ok {
+		return tlsFailed
+	}
+	if hello.version == 0x0304 {
+		clientSecret, cok := tlsSecrets.secret("CLIENT_TRAFFIC_SECRET_0", random)
+		serverSecret, sok := tlsSecrets.secret("SERVER_TRAFFIC_SECRET_0", random)
+		if !cok || !sok {
+			return tlsFailed
+		}
+		c.client.keys = newTLS13Keys(suite, clientSecret)
+		c.server.keys = newTLS13Keys(suite, serverSecret)
+		return tlsDecrypting
+	}
+	master, ok := tlsSecrets.secret("CLIENT_RANDOM", random)
+	if !ok {
+		return tlsFailed
+	}
+	seed := append(slices.Clone(hello.random), clientHello[6:38]...)
+	block := tls12PRF(suite.newHash, master, "key expansion", seed, 2*suite.keyLength+8)
+	c.client.keys = newTLS12Keys(block[:suite.keyLength], block[2*suite.keyLength:][:4])
+	c.server.keys = newTLS12Keys(block[suite.keyLength:][:suite.keyLength], block[2*suite.keyLength+4:])
+	return tlsDecrypting
+}
+
+// decrypt decrypts the complete records of a side into its application
+// data and drops them.
+func (s *tlsSide) decrypt() {
+	end := 0
+	for _, r := range tlsRecords(s.records.data) {
+		if data, ok := s.keys.decrypt(r); ok {
+			c := s.records.chunk(r.offset)
+			s.data.add(c.index, c.packet, data)
+		}
+		end = r.offset + len(r.header) + len(r.body)
+	}
+	s.records.drop(end)
+}
+
+// tlsHandshake returns the plaintext handshake data at the start of a side,
+// which begins with its hello message.
+func tlsHandshake(records []tlsRecord) []byte {
+	var data []byte
+	for _, r := range records {
+		if r.typ != 22 {
+			break
+		}
+		data = append(data, r.body...)
+	}
+	return data
+}
+
+type serverHello struct {
+	version uint16
+	random  []byte
+	suite   uint16
+}
+
+// parseServerHello reads the body of a ServerHello message.
+func parseServerHello(body []byte) (serverHello, bool) {
+	if len(body) < 35 {
+		return serverHello{}, false
+	}
+	h := serverHello{version: binary.BigEndian.Uint16(body), random: body[2:34]}
+	rest := body[35:]
+	if int(body[34])+3 > len(rest) {
+		return serverHello{}, false
+	}
+	rest = rest[body[34]:]
+	h.suite = binary.BigEndian.Uint16(rest)
+	rest = rest[3:] // Cipher suite and compression method
+	if len(rest) >= 2 {
+		rest = rest[2:]
+		// The supported_versions extension holds the version of TLS 1.3.
+		for len(rest) >= 4 {
+			typ, length := binary.BigEndian.Uint16(rest), int(binary.BigEndian.Uint16(rest[2:]))
+			if 4+length > len(rest) {
+				break
+			}
+			if typ == 43 && length == 2 {
+				h.version = binary.BigEndian.Uint16(rest[4:])
+			}
+			rest = rest[4+length:]
+		}
+	}
+	return h, true
+}
+
+// tlsKeys decrypts the records one side of a connection sends.
+type tlsKeys struct {
+	suite     tlsSuite
+	secret    []byte // TLS 1.3 traffic secret, nil for TLS 1.2
+	aead      cipher.AEAD
+	iv        []byte // Per-record nonce base in TLS 1.3, implicit salt in TLS 1.2
+	seq       uint64
+	started   bool // Whether a record has been decrypted
+	encrypted bool // Whether ChangeCipherSpec has been seen, in TLS 1.2
+	failed    bool // Whether a record failed to decrypt after encryption started
+}
+
+func newTLS13Keys(suite tlsSuite, secret []byte) *tlsKeys {
+	k := &tlsKeys{suite: suite, secret: secret}
+	k.aead = newGCM(expandLabel(suite.newHash, secret, "key", suite.keyLength))
+	k.iv = expandLabel(suite.newHash, secret, "iv", 12)
+	return k
+}
+
+func newTLS12Keys(key, salt []byte) *tlsKeys {
+	return &tlsKeys{aead: newGCM(key), iv: salt}
+}
+
+func newGCM(key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err) // Key lengths come from tlsSuites
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// decrypt returns the application data of a record, if it holds any. In
+// TLS 1.3 the records protected by handshake keys come first and fail to
+// decrypt, until the first under the traffic secret; in TLS 1.2 encryption
+// starts after ChangeCipherSpec. No record is decrypted after the first
+// that fails past that.
+func (k *tlsKeys) decrypt(r tlsRecord) ([]byte, bool) {
+	if k.failed {
+		return nil, false
+	}
+	if r.typ == 20 {
+		k.encrypted = true
+		return nil, false
+	}
+	if k.secret != nil && r.typ != 23 || k.secret == nil && !k.encrypted {
+		return nil, false
+	}
+	typ, data, err := k.open(r)
+	if err != nil {
+		k.failed = k.started || k.secret == nil
+		return nil, false
+	}
+	k.started = true
+	switch {
+	case typ == 23:
+		return data, true
+	case typ == 22 && k.secret != nil && len(data) > 0 && data[0] == 24:
+		// KeyUpdate: the next records use the next traffic secret.
+		*k = *newTLS13Keys(k.suite, expandLabel(k.suite.newHash, k.secret, "traffic upd", len(k.secret)))
+		k.started = true
+	}
+	return nil, false
+}
+
+// open decrypts a record, returning its content type and data.
+func (k *tlsKeys) open(r tlsRecord) (byte, []byte, error) {
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], k.seq)
+	if k.secret != nil {
+		nonce := slices.Clone(k.iv)
+		for i := range seq {
+			nonce[len(nonce)-8+i] ^= seq[i]
+		}
+		plain, err := k.aead.Open(nil, nonce, r.body, r.header)
+		if err != nil {
+			return 0, nil, err
+		}
+		k.seq++
+		// The content type follows the data, then optional zero padding.
+		end := len(plain)
+		for end > 0 && plain[end-1] == 0 {
+			end--
+		}
+		if end == 0 {
+			return 0, nil, fmt.Errorf("record without content type")
+		}
+		return plain[end-1], plain[:end-1], nil
+	}
+	if len(r.body) < 8+k.aead.Overhead() {
+		return 0, nil, fmt.Errorf("record too short")
+	}
+	nonce := append(slices.Clone(k.iv), r.body[:8]...)
+	aad := append(seq[:], r.typ, r.header[1], r.header[2], 0, 0)
+	binary.BigEndian.PutUint16(aad[11:], uint16(len(r.body)-8-k.aead.Overhead()))
+	plain, err := k.aead.Open(nil, nonce, r.body[8:], aad)
+	if err != nil {
+		return 0, nil, err
+	}
+	k.seq++
+	return r.typ, plain, nil
+}
+
+// tls12PRF is the pseudorandom function of TLS 1.2, P_hash of RFC 5246.
+func tls12PRF(newHash func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+	var out []byte
+	a := seed
+	for len(out) < length {
+		a = hmacSum(newHash, secret, a)
+		out = append(out, hmacSum(newHash, secret, a, seed)...)
+	}
+	return out[:length]
+}
+
+func hmacSum(newHash func() hash.Hash, key []byte, data ...[]byte) []byte {
+	h := hmac.New(newHash, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// tlsMessage is a message found in decrypted application data.
+type tlsMessage struct {
+	index    int    // Position of the packet it starts in
+	packet   Packet // That packet, without its payload
+	protocol string
+	stream   uint64
+	data     []byte
+}
+
+// payload returns the message as a packet timed and addressed like the
+// packet it starts in.
+func (m tlsMessage) payload() Packet {
+	p := m.packet
+	p.Protocol, p.Stream, p.Payload, p.Seq = m.protocol, m.stream, m.data, 0
+	return p
+}
+
+// messages finds the HTTP bodies completed in the application data of a
+// connection, or returns the data of each turn, and drops the data read.
+func (c *tlsConn) messages() []tlsMessage {
+	if client := c.client.data.data; c.protocol == "" && len(client) > 0 {
+		c.protocol = "tls"
+		br := bufio.NewReader(bytes.NewReader(client))
+		if bytes.HasPrefix(client, []byte(http2Preface)) {
+			c.protocol = "http2"
+			c.client.data.drop(len(http2Preface))
+		} else if _, err := http.ReadRequest(br); err == nil {
+			c.protocol = "http1"
+		}
+	}
+	var messages []tlsMessage
+	for _, side := range []*tlsStream{&c.client.data, &c.server.data} {
+		var found []tlsMessage
+		n := len(side.data)
+		switch c.protocol {
+		case "http2":
+			found, n = http2Bodies(side)
+		case "http1":
+			found, n = http1Bodies(side, side == &c.client.data)
+		default:
+			// Until the client has sent anything, what the server sent is
+			// taken as is.
+			for i, ch := range side.chunks {
+				end := len(side.data)
+				if i+1 < len(side.chunks) {
+					end = side.chunks[i+1].offset
+				}
+				found = append(found, tlsMessage{index: ch.index, packet: ch.packet, protocol: "tls", data: side.data[ch.offset:end]})
+			}
+		}
+		messages = append(messages, found...)
+		side.drop(n)
+	}
+	return messages
+}
+
+// http1Bodies returns the non-empty bodies of the HTTP/1 requests or
+// responses of one side, up to the first that does not parse, and the
+// length of the data they take up.
+func http1Bodies(side *tlsStream, requests bool) ([]tlsMessage, int) {
+	var messages []tlsMessage
+	r := bytes.NewReader(side.data)
+	br := bufio.NewReader(r)
+	offset := 0
+	for {
+		offset = len(side.data) - r.Len() - br.Buffered()
+		if offset >= len(side.data) {
+			break
+		}
+		var header http.Header
+		var body io.ReadCloser
+		if requests {
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				break
+			}
+			header, body = req.Header, req.Body
+		} else {
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				break
+			}
+			header, body = resp.Header, resp.Body
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			break
+		}
+		if header.Get("Content-Encoding") == "gzip" {
+			if z, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+				if unzipped, err := io.ReadAll(z); err == nil {
+					data = unzipped
+				}
+			}
+		}
+		if len(data) > 0 {
+			c := side.chunk(offset)
+			messages = append(messages, tlsMessage{index: c.index, packet: c.packet, protocol: "http1", data: data})
+		}
+	}
+	return messages, offset
+}
+
+// http2Bodies returns the DATA of each HTTP/2 stream in the frames one
+// side sent, up to the first incomplete frame, and the length of those
+// frames.
+func http2Bodies(side *tlsStream) ([]tlsMessage, int) {
+	var messages []*tlsMessage
+	streams := make(map[uint64]*tlsMessage)
+	data := side.data
+	offset := 0
+	for offset+9 <= len(data) {
+		length := int(data[offset])<<16 | int(data[offset+1])<<8 | int(data[offset+2])
+		typ, flags := data[offset+3], data[offset+4]
+		id := uint64(binary.BigEndian.Uint32(data[offset+5:]) & 0x7fffffff)
+		if offset+9+length > len(data) {
+			break
+		}
+		payload := data[offset+9 : offset+9+length]
+		if typ == 0 { // DATA
+			if flags&0x08 != 0 && len(payload) > 0 { // PADDED
+				pad := int(payload[0])
+				if 1+pad > len(payload) {
+					break
+				}
+				payload = payload[1 : len(payload)-pad]
+			}
+			m := streams[id]
+			if m == nil {
+				c := side.chunk(offset)
+				m = &tlsMessage{index: c.index, packet: c.packet, protocol: "http2", stream: id}
+				streams[id] = m
+				messages = append(messages, m)
+			}
+			m.data = append(m.data, payload...)
+		}
+		offset += 9 + length
+	}
+	var out []tlsMessage
+	for _, m := range messages {
+		if len(m.data) > 0 {
+			out = append(out, *m)
+		}
+	}
+	return out, offset
+}
@@ -0,0 +1,42 @@
+package deproto
+
+import (
+	"bytes"
+	"crypto/tls"
+	"testing"
+)
+
+func TestDecryptTLS(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		http2    bool
+		version  uint16
+		protocol string
+	}{
+		{"http1 tls1.2", false, tls.VersionTLS12, "http1"},
+		{"http1 tls1.3", false, tls.VersionTLS13, "http1"},
+		{"http2 tls1.2", true, tls.VersionTLS12, "http2"},
+		{"http2 tls1.3", true, tls.VersionTLS13, "http2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			packets, _ := tlsExchange(t, tc.http2, tc.version)
+			got := DecryptTLS(ReassembleTCP(packets))
+			if len(got) != 4 {
+				t.Fatalf("DecryptTLS returned %d packets, want the 4 bodies: %v", len(got), got)
+			}
+			for i, p := range got {
+				request := []byte{0x08, byte(i/2 + 1), 0x12, 0x03, 'a', 'b', 'c'}
+				want, src := request, testClient
+				if i%2 == 1 {
+					want, src = append([]byte{0x0a, 0x04, 'e', 'c', 'h', 'o'}, request...), testServer
+				}
+				if p.Protocol != tc.protocol || p.Src != src || !bytes.Equal(p.Payload, want) {
+					t.Errorf("packet %d is %v carrying %x, want %s from %s carrying %x", i, p, p.Payload, tc.protocol, src, want)
+				}
+				if tc.http2 && (p.Stream == 0 || p.Stream != got[i/2*2].Stream) {
+					t.Errorf("packet %d is on stream %d, want its request's stream %d", i, p.Stream, got[i/2*2].Stream)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package deproto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// JWT is a decoded JSON Web Token. The signature is not verified.
+type JWT struct {
+	Header    string // Header as compact JSON
+	Claims    string // Claims as compact JSON
+	Signature []byte
+	Times     map[string]time.Time // The exp, iat and nbf claims, when numeric
+}
+
+// DecodeJWT reports whether s is a JSON Web Token, three base64url
+// segments separated by dots whose first two decode to JSON objects, and
+// if so decodes it.
+func DecodeJWT(s string) (*JWT, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	var header, claims map[string]any
+	headerJSON, ok := decodeJWTObject(parts[0], &header)
+	if !ok || header["alg"] == nil {
+		return nil, false
+	}
+	claimsJSON, ok := decodeJWTObject(parts[1], &claims)
+	if !ok {
+		return nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, false
+	}
+
+	token := &JWT{Header: headerJSON, Claims: claimsJSON, Signature: signature}
+	for _, name := range []string{"exp", "iat", "nbf"} {
+		if seconds, ok := claims[name].(float64); ok {
+			if token.Times == nil {
+				token.Times = make(map[string]time.Time)
+			}
+			token.Times[name] = time.Unix(int64(seconds), 0).UTC()
+		}
+	}
+	return token, true
+}
+
+// decodeJWTObject decodes a base64url segment holding a JSON object into v
+// and returns the object as compact JSON.
+func decodeJWTObject(segment string, v *map[string]any) (string, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return "", false
+	}
+	if err := json.Unmarshal(data, v); err != nil || *v == nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, data) != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// minBase64Token is the length from which a string may be reported as a
+// base64 token.
+const minBase64Token = 20
+
+// DecodeBase64 reports whether s looks like a base64-encoded token, in the
+// standard or URL-safe alphabet with or without padding, and if so decodes
+// it. Only strings of at least 20 characters that mix upper case, lower
+// case and digits are considered, so ordinary words and identifiers are
+// rarely mistaken for tokens.
+func DecodeBase64(s string) ([]byte, bool) {
+	if len(s) < minBase64Token {
+		return nil, false
+	}
+	var upper, lower, digit, std, url bool
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c == '+' || c == '/':
+			std = true
+		case c == '-' || c == '_':
+			url = true
+		case c == '=' && i >= len(s)-2:
+		default:
+			return nil, false
+		}
+	}
+	if !upper || !lower || !digit || std && url {
+		return nil, false
+	}
+	enc := base64.StdEncoding
+	if url {
+		enc = base64.URLEncoding
+	}
+	if !strings.HasSuffix(s, "=") {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	data, err := enc.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,83 @@
+package deproto
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TraceKind classifies a decoding decision reported to DecodeOptions.Trace.
+type TraceKind int
+
+const (
+	TraceTag     TraceKind = iota // A field key was read
+	TraceMessage                  // A length-delimited field was decoded as a message
+	TraceString                   // A length-delimited field was kept as a string
+	TraceBytes                    // A length-delimited field was kept as raw bytes
+	TraceUnwrap                   // A string was checked for a wrapped message
+	TraceError                    // Decoding stopped with an error
+	TraceHint                     // A type hint was applied, or did not fit
+)
+
+// String returns a short name for the trace kind.
+func (k TraceKind) String() string {
+	switch k {
+	case TraceTag:
+		return "tag"
+	case TraceMessage:
+		return "message"
+	case TraceString:
+		return "string"
+	case TraceBytes:
+		return "bytes"
+	case TraceUnwrap:
+		return "unwrap"
+	case TraceError:
+		return "error"
+	case TraceHint:
+		return "hint"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// MarshalJSON encodes the kind by name.
+func (k TraceKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+// TraceEvent records one decision made while decoding.
+//
+// Length-delimited fields are first decoded as a message, so a field that
+// ends up as a string or bytes is preceded by the events of that failed
+// attempt, ending in an error event that explains it.
+type TraceEvent struct {
+	Kind   TraceKind `json:"kind"`
+	Offset int       `json:"offset"` // Offset of the field's tag in the input, or in the decoded text for unwrapped messages
+	Path   FieldPath `json:"path"`
+	Detail string    `json:"detail"`
+}
+
+// String returns a one-line description of the event.
+func (e TraceEvent) String() string {
+	return fmt.Sprintf("@%d %s [%s] %s", e.Offset, e.Path, e.Kind, e.Detail)
+}
+
+// trace reports an event if tracing is enabled.
+func (o DecodeOptions) trace(kind TraceKind, offset int, path FieldPath, format string, args ...any) {
+	if o.Trace == nil {
+		return
+	}
+	o.Trace(TraceEvent{Kind: kind, Offset: offset, Path: path, Detail: fmt.Sprintf(format, args...)})
+}
+
+// traceReason explains why a length-delimited field is not a message.
+func traceReason(err error, nestedDisabled bool) string {
+	switch {
+	case nestedDisabled:
+		return ", nested decoding disabled"
+	case err != nil:
+		return ", not a message: " + err.Error()
+	default:
+		return ", empty"
+	}
+}
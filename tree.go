@@ -0,0 +1,153 @@
+package deproto
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// treeVersion is the version of the format written by MarshalTree.
+const treeVersion = 1
+
+// treeJSON is the form of a tree written by MarshalTree.
+type treeJSON struct {
+	Version int         `json:"version"`
+	Fields  []fieldJSON `json:"fields"`
+}
+
+// fieldJSON is one field of a tree written by MarshalTree. The payload of a
+// length-delimited field is stored in the form it was decoded to: fields,
+// a string, packed values or raw data. JSON strings hold only valid UTF-8,
+// so strings with invalid bytes are stored as Data with IsString set.
+type fieldJSON struct {
+	ID       int         `json:"id"`
+	WireType int         `json:"wire_type"`
+	Value    *uint64     `json:"value,omitempty"`
+	Fields   []fieldJSON `json:"fields,omitempty"`
+	String   *string     `json:"string,omitempty"`
+	IsString bool        `json:"is_string,omitempty"` // String stored in Data
+	Padding  int         `json:"padding,omitempty"`   // NUL bytes after the string
+	Message  bool        `json:"message,omitempty"`   // Empty message
+	Packed   *Packed     `json:"packed,omitempty"`
+	Data     []byte      `json:"data,omitempty"`
+	Empty    bool        `json:"empty,omitempty"` // Raw data of length zero
+	Wrapping string      `json:"wrapping,omitempty"`
+}
+
+// MarshalTree serializes a decoded tree as JSON, keeping every field's
+// interpretation, so that the result of an expensive decode can be cached
+// and loaded with UnmarshalTree instead of decoding again. Fields not yet
+// expanded after a lazy decode are stored as raw bytes.
+func MarshalTree(fields []Field) ([]byte, error) {
+	return json.Marshal(treeJSON{Version: treeVersion, Fields: marshalFields(fields)})
+}
+
+func marshalFields(fields []Field) []fieldJSON {
+	out := make([]fieldJSON, 0, len(fields))
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		j := fieldJSON{ID: base.ID, WireType: base.WireType}
+		switch v := f.(type) {
+		case *VarintField:
+			j.Value = &v.Value
+		case *Fixed64Field:
+			j.Value = &v.Value
+		case *Fixed32Field:
+			value := uint64(v.Value)
+			j.Value = &value
+		case *LengthDelimitedField:
+			switch {
+			case len(v.SubFields) > 0:
+				j.Fields, j.Wrapping = marshalFields(v.SubFields), v.Wrapping
+			case v.EmptyMessage:
+				j.Message = true
+			case v.IsString && utf8.ValidString(v.StringValue):
+				j.String, j.Padding = &v.StringValue, v.Padding
+			case v.IsString:
+				j.IsString, j.Data, j.Padding = true, []byte(v.StringValue), v.Padding
+			case v.Packed != nil:
+				j.Packed = v.Packed
+			default:
+				j.Data, j.Empty = v.Data, len(v.Data) == 0
+			}
+		}
+		out = append(out, j)
+	}
+	return out
+}
+
+// UnmarshalTree loads a tree serialized by MarshalTree.
+func UnmarshalTree(data []byte) ([]Field, error) {
+	var tree treeJSON
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Version != treeVersion {
+		return nil, fmt.Errorf("unsupported tree version %d", tree.Version)
+	}
+	return unmarshalFields(tree.Fields, nil)
+}
+
+func unmarshalFields(in []fieldJSON, parent FieldPath) ([]Field, error) {
+	fields := make([]Field, 0, len(in))
+	for _, j := range in {
+		path := parent.Append(j.ID)
+		base := FieldBase{ID: j.ID, WireType: j.WireType}
+		if j.WireType != WireBytes && j.Value == nil {
+			return nil, fmt.Errorf("field %s: missing value", path)
+		}
+		switch j.WireType {
+		case WireVarint:
+			fields = append(fields, &VarintField{FieldBase: base, Value: *j.Value})
+		case WireFixed64:
+			fields = append(fields, &Fixed64Field{FieldBase: base, Value: *j.Value})
+		case WireFixed32:
+			if *j.Value > 0xffffffff {
+				return nil, fmt.Errorf("field %s: fixed32 value %d out of range", path, *j.Value)
+			}
+			fields = append(fields, &Fixed32Field{FieldBase: base, Value: uint32(*j.Value)})
+		case WireBytes:
+			l := &LengthDelimitedField{FieldBase: base, Wrapping: j.Wrapping}
+			switch {
+			case len(j.Fields) > 0:
+				sub, err := unmarshalFields(j.Fields, path)
+				if err != nil {
+					return nil, err
+				}
+				l.SubFields = sub
+			case j.Message:
+				l.EmptyMessage = true
+			case j.String != nil || j.IsString:
+				if j.Padding < 0 {
+					return nil, fmt.Errorf("field %s: negative padding", path)
+				}
+				l.IsString, l.StringValue, l.Padding = true, string(j.Data), j.Padding
+				if j.String != nil {
+					l.StringValue = *j.String
+				}
+			case j.Packed != nil:
+				if _, ok := packedWireType(j.Packed.Type); !ok {
+					return nil, fmt.Errorf("field %s: type %q cannot be packed", path, j.Packed.Type)
+				}
+				l.Packed = j.Packed
+			default:
+				l.Data = j.Data
+			}
+			l.Data = l.payload()
+			fields = append(fields, l)
+		default:
+			return nil, fmt.Errorf("field %s: unknown wire type %d", path, j.WireType)
+		}
+	}
+	return fields, nil
+}
+
+// packedWireType returns the wire type of the elements of a packed field
+// of the given scalar type, and whether the type can be packed.
+func packedWireType(typ string) (int, bool) {
+	wireType, ok := scalarWireTypes[typ]
+	return wireType, ok && wireType != WireBytes
+}
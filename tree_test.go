@@ -0,0 +1,60 @@
+package deproto_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/bluefalconhd/deproto"
+	"github.com/bluefalconhd/deproto/protobridge"
+)
+
+func TestTreeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 20000 {
+		data := protobridge.RandomMessage(r, 3)
+		fields, err := deproto.DecodeFields(data)
+		if err != nil {
+			t.Fatalf("%x: %v", data, err)
+		}
+		tree, err := deproto.MarshalTree(fields)
+		if err != nil {
+			t.Fatalf("%x: %v", data, err)
+		}
+		loaded, err := deproto.UnmarshalTree(tree)
+		if err != nil {
+			t.Fatalf("%x: %v", data, err)
+		}
+		// Compare with the encoding of the decoded tree rather than the
+		// input, whose nested varints may be padded.
+		if got, want := deproto.Encode(loaded), deproto.Encode(fields); !bytes.Equal(got, want) {
+			t.Fatalf("%x: reloaded tree encodes to %x, want %x", data, got, want)
+		}
+	}
+}
+
+func TestTreeInvalidUTF8String(t *testing.T) {
+	// A printable string but for an invalid byte, which JSON strings
+	// cannot carry.
+	data := deproto.NewMessage().Field(&deproto.LengthDelimitedField{
+		FieldBase:   deproto.FieldBase{ID: 1, WireType: deproto.WireBytes},
+		IsString:    true,
+		StringValue: "caf\xe9",
+	}).Encode()
+	fields, err := deproto.DecodeFields(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := deproto.MarshalTree(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := deproto.UnmarshalTree(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := loaded[0].(*deproto.LengthDelimitedField)
+	if !l.IsString || l.StringValue != "caf\xe9" {
+		t.Errorf("reloaded as %+v", l)
+	}
+}
@@ -0,0 +1,127 @@
+package deproto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// textWrappings are the base64 variants recognized by UnwrapText, in order
+// of preference. They differ in alphabet and padding so that a message can
+// be wrapped back exactly.
+var textWrappings = []struct {
+	name string
+	enc  *base64.Encoding
+}{
+	{"base64", base64.StdEncoding},
+	{"base64-raw", base64.RawStdEncoding},
+	{"base64url", base64.URLEncoding},
+	{"base64url-raw", base64.RawURLEncoding},
+}
+
+// unwrap replaces a string field with the message it encodes, if any.
+func (o DecodeOptions) unwrap(l *LengthDelimitedField, path FieldPath) {
+	data, wrapping, ok := unwrapText(l.StringValue)
+	if !ok {
+		return
+	}
+	// Offsets within the text are not offsets in the input.
+	o.progress = nil
+	t := o.tentative()
+	fields, err := t.decode(data, 0, path)
+	if err != nil || !plausibleMessage(fields) {
+		o.trace(TraceUnwrap, 0, path, "%s text is not a plausible message", wrapping)
+		return
+	}
+	o.keep(t)
+	o.trace(TraceUnwrap, 0, path, "%s text holds %d fields", wrapping, len(fields))
+	l.SubFields, l.Wrapping = fields, wrapping
+	l.IsString, l.StringValue = false, ""
+}
+
+// unwrapText decodes a hex or base64 string and names its encoding.
+func unwrapText(s string) ([]byte, string, bool) {
+	if data, ok := decodeHexString(s); ok {
+		return data, "hex", true
+	}
+	data, ok := DecodeBase64(s)
+	if !ok {
+		return nil, "", false
+	}
+	for _, w := range textWrappings {
+		if w.enc.EncodeToString(data) == s {
+			return data, w.name, true
+		}
+	}
+	return nil, "", false
+}
+
+// decodeHexString decodes s if it is an even-length run of at least eight
+// hex digits, all in the same case.
+func decodeHexString(s string) ([]byte, bool) {
+	if len(s) < 8 || len(s)%2 != 0 {
+		return nil, false
+	}
+	var upper, lower bool
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+		case c >= 'a' && c <= 'f':
+			lower = true
+		case c >= 'A' && c <= 'F':
+			upper = true
+		default:
+			return nil, false
+		}
+	}
+	if upper && lower {
+		return nil, false
+	}
+	data, err := hex.DecodeString(s)
+	return data, err == nil
+}
+
+// wrapText encodes data with a wrapping recorded by UnwrapText.
+func wrapText(data []byte, wrapping string) []byte {
+	if wrapping == "hex" {
+		return []byte(hex.EncodeToString(data))
+	}
+	for _, w := range textWrappings {
+		if w.name == wrapping {
+			return []byte(w.enc.EncodeToString(data))
+		}
+	}
+	return data
+}
+
+// wrappedLen returns the length of n bytes once wrapped as wrapText does.
+func wrappedLen(n int, wrapping string) int {
+	if wrapping == "hex" {
+		return 2 * n
+	}
+	for _, w := range textWrappings {
+		if w.name == wrapping {
+			return w.enc.EncodedLen(n)
+		}
+	}
+	return n
+}
+
+// maxPlausibleFieldNumber bounds the field numbers of a message believed to
+// be wrapped in text. Real schemas rarely go past a few thousand, while
+// random bytes produce field numbers spread over the whole range.
+const maxPlausibleFieldNumber = 10000
+
+// plausibleMessage reports whether decoded fields look like a real message
+// rather than arbitrary bytes that happen to parse.
+func plausibleMessage(fields []Field) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil || base.ID < 1 || base.ID > maxPlausibleFieldNumber {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package deproto
+
+import (
+	"net/url"
+	"strings"
+)
+
+// urlParam is one decoded query or fragment parameter of a URL.
+type urlParam struct {
+	Name, Value string
+	Fragment    bool // The parameter came from the fragment, as in OAuth redirects
+}
+
+// parseURLString reports whether s is an absolute URL with a host, such as
+// https://example.com/x?id=1 or myapp://open?token=..., and returns it with
+// its query and fragment parameters in the order they appear.
+func parseURLString(s string) (*url.URL, []urlParam, bool) {
+	if strings.ContainsAny(s, " \t\r\n") {
+		return nil, nil, false
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, nil, false
+	}
+	params := splitParams(u.RawQuery, false)
+	if strings.Contains(u.Fragment, "=") {
+		params = append(params, splitParams(u.EscapedFragment(), true)...)
+	}
+	return u, params, true
+}
+
+func splitParams(raw string, fragment bool) []urlParam {
+	var params []urlParam
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		params = append(params, urlParam{Name: name, Value: value, Fragment: fragment})
+	}
+	return params
+}
@@ -0,0 +1,138 @@
+package deproto
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// ValidationKind classifies a problem found by Validate.
+type ValidationKind int
+
+const (
+	ValidationUnknownField     ValidationKind = iota // Field number not in the schema
+	ValidationTypeMismatch                           // Wire data incompatible with the declared type
+	ValidationEnumOutOfRange                         // Enum value not declared in the enum
+	ValidationMissingRequired                        // Required field absent
+	ValidationUnexpectedRepeat                       // Singular field present more than once
+)
+
+// String returns a short name for the validation kind.
+func (k ValidationKind) String() string {
+	switch k {
+	case ValidationUnknownField:
+		return "unknown-field"
+	case ValidationTypeMismatch:
+		return "type-mismatch"
+	case ValidationEnumOutOfRange:
+		return "enum-out-of-range"
+	case ValidationMissingRequired:
+		return "missing-required"
+	case ValidationUnexpectedRepeat:
+		return "unexpected-repeat"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(k))
+	}
+}
+
+// ValidationIssue describes a field that does not conform to a schema.
+type ValidationIssue struct {
+	Kind    ValidationKind
+	Message string    // Full name of the message type being validated
+	Path    FieldPath // Path of the offending field
+	Field   Field     // The offending field, or nil for a missing field
+	Detail  string    // Human-readable explanation
+}
+
+// String returns a one-line description of the issue.
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s [%s] in %s: %s", i.Path, i.Kind, i.Message, i.Detail)
+}
+
+// Validate checks a decoded message against a message schema, inferred or
+// loaded from .proto source, and reports unknown fields, type mismatches,
+// undeclared enum values, missing required fields and repeated singular
+// fields. Nested messages are validated recursively.
+func Validate(fields []Field, schema *MessageSchema) []ValidationIssue {
+	return validateMessage(nil, fields, schema)
+}
+
+func validateMessage(parent FieldPath, fields []Field, schema *MessageSchema) []ValidationIssue {
+	var issues []ValidationIssue
+	report := func(kind ValidationKind, path FieldPath, f Field, format string, args ...any) {
+		issues = append(issues, ValidationIssue{
+			Kind:    kind,
+			Message: schema.FullName,
+			Path:    path,
+			Field:   f,
+			Detail:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	counts := make(map[int]int)
+	for _, f := range fields {
+		base := fieldBase(f)
+		if base == nil {
+			continue
+		}
+		path := parent.Append(base.ID)
+		counts[base.ID]++
+
+		fs := schema.Field(base.ID)
+		if fs == nil {
+			report(ValidationUnknownField, path, f, "field %d is not declared", base.ID)
+			continue
+		}
+		if counts[base.ID] == 2 && fs.Label != LabelRepeated {
+			report(ValidationUnexpectedRepeat, path, f, "singular field %s occurs more than once", fs.Name)
+		}
+
+		expected := fs.WireType()
+		packed := fs.Label == LabelRepeated && expected != WireBytes && base.WireType == WireBytes
+		if base.WireType != expected && !packed {
+			report(ValidationTypeMismatch, path, f, "%s is %s, but field has wire type %s",
+				fs.Name, fs.Type, wireTypeString(base.WireType))
+			continue
+		}
+
+		switch v := f.(type) {
+		case *VarintField:
+			if fs.Enum != nil && !enumHasValue(fs.Enum, int32(v.Value)) {
+				report(ValidationEnumOutOfRange, path, f, "%d is not a value of enum %s", int32(v.Value), fs.Enum.FullName)
+			}
+		case *LengthDelimitedField:
+			if packed {
+				continue
+			}
+			switch {
+			case fs.Message != nil:
+				sub := v.SubFields
+				if len(sub) == 0 && len(v.Data) > 0 {
+					var err error
+					if sub, err = DecodeFields(v.Data); err != nil {
+						report(ValidationTypeMismatch, path, f, "%s is %s, but data is not a message: %v", fs.Name, fs.Type, err)
+						continue
+					}
+				}
+				issues = append(issues, validateMessage(path, sub, fs.Message)...)
+			case fs.Type == "string" && !utf8.Valid(v.Data):
+				report(ValidationTypeMismatch, path, f, "%s is string, but data is not valid UTF-8", fs.Name)
+			}
+		}
+	}
+
+	for _, fs := range schema.Fields {
+		if fs.Label == LabelRequired && counts[fs.Number] == 0 {
+			report(ValidationMissingRequired, parent.Append(fs.Number), nil, "required field %s is missing", fs.Name)
+		}
+	}
+	return issues
+}
+
+func enumHasValue(e *EnumSchema, n int32) bool {
+	for _, v := range e.Values {
+		if v.Number == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package deproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Varint encodings reported by VarintReport.
+const (
+	// VarintNonMinimal is a varint padded with continuation bytes, which no
+	// mainstream encoder writes: it points to a hand-written or unusual
+	// encoder, or to bytes patched in place to keep the message length.
+	VarintNonMinimal = "non-minimal"
+
+	// VarintSignExtended is a negative 32-bit value sign-extended to ten
+	// bytes, as the reference encoders write negative int32 fields, where
+	// a sint32 field would take at most five.
+	VarintSignExtended = "sign-extended"
+
+	// VarintTruncated is a value from 2^31 to 2^32-1 in five bytes: a large
+	// uint32, or a negative int32 written without sign extension by an
+	// encoder that treats int32 as uint32, unlike the reference ones.
+	VarintTruncated = "truncated"
+)
+
+// VarintIssue is a varint of a message encoded in one of the ways
+// VarintReport tracks.
+type VarintIssue struct {
+	Path     FieldPath
+	Offset   int    // Offset of the varint in the message
+	Varint   string // "key", "value" or "length"
+	Value    uint64
+	Bytes    int    // Length of the encoding
+	Encoding string // VarintNonMinimal, VarintSignExtended or VarintTruncated
+}
+
+func (i VarintIssue) String() string {
+	return fmt.Sprintf("%s at %d: %s %d in %d bytes, %s", i.Path, i.Offset, i.Varint, i.Value, i.Bytes, i.Encoding)
+}
+
+// VarintReport tallies how the varints of messages are encoded: whether
+// they are minimal, and how negative numbers are widened. Encoders differ
+// in these choices, so the tallies over a few messages hint at the
+// protobuf implementation that produced them, and a non-minimal varint
+// among minimal ones at tampering. The zero value is an empty report.
+type VarintReport struct {
+	Messages  int            // Messages checked
+	Varints   int            // Keys, values and lengths read
+	Encodings map[string]int // Varints by encoding, as in VarintIssue
+	Issues    []VarintIssue
+}
+
+// Check adds the varints of a message to the report, descending into the
+// nested messages DecodeFields finds.
+func (r *VarintReport) Check(data []byte) error {
+	fields, err := DecodeFields(data)
+	if err != nil {
+		return err
+	}
+	r.Messages++
+	r.scan(data, 0, fields, nil)
+	return nil
+}
+
+// scan checks the varints of the encoding of fields, found at offset in the
+// message.
+func (r *VarintReport) scan(data []byte, offset int, fields []Field, parent FieldPath) {
+	pos := 0
+	for _, f := range fields {
+		key, n := binary.Uvarint(data[pos:])
+		path := parent.Append(int(key >> 3))
+		r.check(path, offset+pos, "key", key, n)
+		pos += n
+		switch v := f.(type) {
+		case *VarintField:
+			_, m := binary.Uvarint(data[pos:])
+			r.check(path, offset+pos, "value", v.Value, m)
+			pos += m
+		case *Fixed64Field:
+			pos += 8
+		case *Fixed32Field:
+			pos += 4
+		case *LengthDelimitedField:
+			length, m := binary.Uvarint(data[pos:])
+			r.check(path, offset+pos, "length", length, m)
+			pos += m
+			if len(v.SubFields) > 0 && v.Wrapping == "" {
+				r.scan(data[pos:pos+int(length)], offset+pos, v.SubFields, path)
+			}
+			pos += int(length)
+		}
+	}
+}
+
+// check records a varint of n bytes holding v.
+func (r *VarintReport) check(path FieldPath, offset int, varint string, v uint64, n int) {
+	r.Varints++
+	var encoding string
+	switch {
+	case n > uvarintLen(v):
+		encoding = VarintNonMinimal
+	case varint != "value":
+		return
+	case v >= 0xffffffff80000000:
+		encoding = VarintSignExtended
+	case v >= 1<<31 && v < 1<<32:
+		encoding = VarintTruncated
+	default:
+		return
+	}
+	if r.Encodings == nil {
+		r.Encodings = make(map[string]int)
+	}
+	r.Encodings[encoding]++
+	r.Issues = append(r.Issues, VarintIssue{path, offset, varint, v, n, encoding})
+}
+
+// String summarizes the report: the tallies, and what they suggest about
+// the encoder.
+func (r *VarintReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d varints in %d messages", r.Varints, r.Messages)
+	if len(r.Encodings) == 0 {
+		b.WriteString(", all minimal\n")
+		return b.String()
+	}
+	b.WriteString("\n")
+	for _, encoding := range []string{VarintNonMinimal, VarintSignExtended, VarintTruncated} {
+		if count := r.Encodings[encoding]; count > 0 {
+			fmt.Fprintf(&b, "  %-14s %d\n", encoding, count)
+		}
+	}
+	switch nonMinimal := r.Encodings[VarintNonMinimal]; {
+	case nonMinimal == 0:
+	case nonMinimal*10 < r.Varints:
+		b.WriteString("a few padded varints among minimal ones: bytes may have been patched in place\n")
+	default:
+		b.WriteString("padded varints throughout: a custom or unusual encoder\n")
+	}
+	if r.Encodings[VarintSignExtended] > 0 && r.Encodings[VarintTruncated] == 0 {
+		b.WriteString("negative numbers sign-extended to 64 bits, as the reference encoders do\n")
+	}
+	return b.String()
+}
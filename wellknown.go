@@ -0,0 +1,286 @@
+package deproto
+
+import (
+	"bytes"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wellKnownFiles holds the well-known type definitions, and those of
+// tf.Example and of the protocols of the built-in profiles, so imports such
+// as "google/protobuf/wrappers.proto" resolve without a protobuf
+// installation.
+//
+//go:embed wellknown
+var wellKnownFiles embed.FS
+
+// readWellKnown returns the source of an embedded well-known .proto file.
+func readWellKnown(name string) (string, bool) {
+	data, err := wellKnownFiles.ReadFile("wellknown/" + name)
+	return string(data), err == nil
+}
+
+// isWellKnown reports whether a message type has a natural rendering.
+func isWellKnown(fullName string) bool {
+	switch fullName {
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue", "google.protobuf.FieldMask",
+		"google.protobuf.Timestamp", "google.protobuf.Duration",
+		"google.protobuf.Struct", "google.protobuf.Value",
+		"google.protobuf.ListValue":
+		return true
+	}
+	return false
+}
+
+// wellKnownValue renders the payload of a well-known message type in its
+// natural form, such as "foo" for a StringValue or a JSON object for a
+// Struct. It reports false if the type is not well known or the payload does
+// not match it.
+func wellKnownValue(fullName string, data []byte) (string, bool) {
+	fields, err := DecodeFields(data)
+	if err != nil {
+		return "", false
+	}
+	first := func(id int) Field {
+		for _, f := range fields {
+			if fieldBase(f).ID == id {
+				return f
+			}
+		}
+		return nil
+	}
+
+	switch fullName {
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue":
+		typ := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(fullName, "google.protobuf."), "Value"))
+		fs := &FieldSchema{Type: typ}
+		switch v := first(1).(type) {
+		case nil:
+			return formatScalar(0, fs), true
+		case *VarintField:
+			return formatScalar(v.Value, fs), fs.WireType() == WireVarint
+		case *Fixed64Field:
+			return formatScalar(v.Value, fs), fs.WireType() == WireFixed64
+		case *Fixed32Field:
+			return formatScalar(uint64(v.Value), fs), fs.WireType() == WireFixed32
+		}
+		return "", false
+
+	case "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		var value []byte
+		if l, ok := first(1).(*LengthDelimitedField); ok {
+			value = l.Data
+		} else if first(1) != nil {
+			return "", false
+		}
+		if fullName == "google.protobuf.BytesValue" {
+			return hex.EncodeToString(value), true
+		}
+		return strconv.Quote(string(value)), true
+
+	case "google.protobuf.FieldMask":
+		var paths []string
+		for _, f := range fields {
+			l, ok := f.(*LengthDelimitedField)
+			if !ok || l.ID != 1 {
+				return "", false
+			}
+			paths = append(paths, string(l.Data))
+		}
+		return strconv.Quote(strings.Join(paths, ",")), true
+
+	case "google.protobuf.Timestamp", "google.protobuf.Duration":
+		seconds, nanos, ok := secondsNanos(fields)
+		if !ok {
+			return "", false
+		}
+		if fullName == "google.protobuf.Duration" {
+			return (time.Duration(seconds)*time.Second + time.Duration(nanos)).String(), true
+		}
+		return time.Unix(seconds, int64(nanos)).UTC().Format(time.RFC3339Nano), true
+
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue":
+		var v any
+		switch fullName {
+		case "google.protobuf.Struct":
+			v, err = structToGo(fields)
+		case "google.protobuf.Value":
+			v, err = valueToGo(fields)
+		default:
+			v, err = listToGo(fields)
+		}
+		if err != nil {
+			return "", false
+		}
+		return marshalJSON(v)
+	}
+	return "", false
+}
+
+func secondsNanos(fields []Field) (int64, int32, bool) {
+	var seconds int64
+	var nanos int32
+	for _, f := range fields {
+		v, ok := f.(*VarintField)
+		if !ok {
+			return 0, 0, false
+		}
+		switch v.ID {
+		case 1:
+			seconds = int64(v.Value)
+		case 2:
+			nanos = int32(v.Value)
+		default:
+			return 0, 0, false
+		}
+	}
+	return seconds, nanos, true
+}
+
+// structToGo converts an encoded google.protobuf.Struct to a Go map.
+func structToGo(fields []Field) (map[string]any, error) {
+	out := make(map[string]any)
+	for _, f := range fields {
+		entry, ok := f.(*LengthDelimitedField)
+		if !ok || entry.ID != 1 {
+			return nil, fmt.Errorf("not a Struct")
+		}
+		entryFields, err := DecodeFields(entry.Data)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		var value any
+		for _, ef := range entryFields {
+			l, ok := ef.(*LengthDelimitedField)
+			if !ok {
+				return nil, fmt.Errorf("not a Struct entry")
+			}
+			switch l.ID {
+			case 1:
+				key = string(l.Data)
+			case 2:
+				valueFields, err := DecodeFields(l.Data)
+				if err != nil {
+					return nil, err
+				}
+				if value, err = valueToGo(valueFields); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("not a Struct entry")
+			}
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+// valueToGo converts an encoded google.protobuf.Value to a Go value.
+func valueToGo(fields []Field) (any, error) {
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("a Value holds exactly one kind")
+	}
+	switch v := fields[0].(type) {
+	case *VarintField:
+		switch v.ID {
+		case 1:
+			return nil, nil
+		case 4:
+			return v.Value != 0, nil
+		}
+	case *Fixed64Field:
+		if v.ID == 2 {
+			return math.Float64frombits(v.Value), nil
+		}
+	case *LengthDelimitedField:
+		switch v.ID {
+		case 3:
+			return string(v.Data), nil
+		case 5, 6:
+			sub, err := DecodeFields(v.Data)
+			if err != nil {
+				return nil, err
+			}
+			if v.ID == 5 {
+				return structToGo(sub)
+			}
+			return listToGo(sub)
+		}
+	}
+	return nil, fmt.Errorf("not a Value")
+}
+
+// listToGo converts an encoded google.protobuf.ListValue to a Go slice.
+func listToGo(fields []Field) ([]any, error) {
+	out := []any{}
+	for _, f := range fields {
+		l, ok := f.(*LengthDelimitedField)
+		if !ok || l.ID != 1 {
+			return nil, fmt.Errorf("not a ListValue")
+		}
+		sub, err := DecodeFields(l.Data)
+		if err != nil {
+			return nil, err
+		}
+		v, err := valueToGo(sub)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func marshalJSON(v any) (string, bool) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// detectStruct reports whether fields look like an encoded
+// google.protobuf.Struct — only map entries in field 1, each holding a
+// printable string key in field 1 and a valid Value in field 2 — and if so
+// returns the Struct rendered as JSON.
+func detectStruct(fields []Field) (string, bool) {
+	if len(fields) == 0 {
+		return "", false
+	}
+	for _, f := range fields {
+		entry, ok := f.(*LengthDelimitedField)
+		if !ok || entry.ID != 1 {
+			return "", false
+		}
+		entryFields, err := DecodeFields(entry.Data)
+		if err != nil || len(entryFields) != 2 {
+			return "", false
+		}
+		key, ok1 := entryFields[0].(*LengthDelimitedField)
+		value, ok2 := entryFields[1].(*LengthDelimitedField)
+		if !ok1 || !ok2 || key.ID != 1 || value.ID != 2 || !isPrintableString(key.Data) {
+			return "", false
+		}
+	}
+	v, err := structToGo(fields)
+	if err != nil {
+		return "", false
+	}
+	return marshalJSON(v)
+}
@@ -0,0 +1,107 @@
+package deproto
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// WireTypeConflict describes a field path that occurs with more than one
+// wire type. Encoders always write a field with the wire type of its
+// declaration, so a conflict usually means that the nested-message
+// heuristic misfired on a parent field or that the data is corrupt.
+type WireTypeConflict struct {
+	Path      FieldPath
+	WireTypes map[int]int // Occurrences by wire type
+
+	// Packable is set when the only types are one scalar type and
+	// length-delimited, and every length-delimited occurrence decodes as
+	// packed values of that type: a repeated scalar field that is written
+	// both packed and unpacked, which is valid.
+	Packable bool
+}
+
+// String returns a one-line description of the conflict.
+func (c WireTypeConflict) String() string {
+	s := fmt.Sprintf("%s: %s", c.Path, describeWireTypes(c.WireTypes))
+	if c.Packable {
+		s += " (possibly packed)"
+	}
+	return s
+}
+
+// FindWireTypeConflicts reports the field paths of a message that occur
+// with differing wire types, such as a repeated field, or a field of
+// repeated nested messages, read as a varint in one place and as
+// length-delimited in another.
+func FindWireTypeConflicts(fields []Field) []WireTypeConflict {
+	return CorpusWireTypeConflicts([][]Field{fields})
+}
+
+// CorpusWireTypeConflicts reports the field paths that occur with differing
+// wire types anywhere in a corpus of messages of the same type.
+func CorpusWireTypeConflicts(corpus [][]Field) []WireTypeConflict {
+	type observation struct {
+		path      FieldPath
+		wireTypes map[int]int
+		payloads  [][]byte // Length-delimited payloads, to check for packing
+	}
+	byPath := make(map[string]*observation)
+	for _, fields := range corpus {
+		Walk(fields, func(path FieldPath, f Field) bool {
+			key := path.String()
+			obs, ok := byPath[key]
+			if !ok {
+				obs = &observation{path: path, wireTypes: make(map[int]int)}
+				byPath[key] = obs
+			}
+			base := fieldBase(f)
+			obs.wireTypes[base.WireType]++
+			if l, ok := f.(*LengthDelimitedField); ok {
+				obs.payloads = append(obs.payloads, l.payload())
+			}
+			return true
+		})
+	}
+
+	var conflicts []WireTypeConflict
+	for _, obs := range byPath {
+		if len(obs.wireTypes) < 2 {
+			continue
+		}
+		conflicts = append(conflicts, WireTypeConflict{
+			Path:      obs.path,
+			WireTypes: obs.wireTypes,
+			Packable:  mixedPacking(obs.wireTypes, obs.payloads),
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return slices.Compare(conflicts[i].Path, conflicts[j].Path) < 0
+	})
+	return conflicts
+}
+
+// mixedPacking reports whether a field seen with the given wire types could be
+// a repeated scalar written both packed and unpacked.
+func mixedPacking(wireTypes map[int]int, payloads [][]byte) bool {
+	if len(wireTypes) != 2 || wireTypes[WireBytes] == 0 {
+		return false
+	}
+	typ := ""
+	switch {
+	case wireTypes[WireVarint] > 0:
+		typ = "uint64"
+	case wireTypes[WireFixed64] > 0:
+		typ = "fixed64"
+	case wireTypes[WireFixed32] > 0:
+		typ = "fixed32"
+	default:
+		return false
+	}
+	for _, data := range payloads {
+		if _, err := decodePacked(data, &FieldSchema{Type: typ}); err != nil {
+			return false
+		}
+	}
+	return true
+}